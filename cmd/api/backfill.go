@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"go-sample-rest/internal/backfill"
+	"go-sample-rest/internal/openmateo"
+	"go-sample-rest/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const backfillUsage = "usage: backfill lat,long from to, e.g. backfill 59.91,10.75 2023-01-01 2023-12-31"
+
+// runBackfill runs the backfill subcommand against the configured database, interrupting it keeps the progress made
+// so far and running it again carries on from there
+func runBackfill(config *Config, args []string) {
+	if len(args) != 3 {
+		log.Fatal(backfillUsage)
+	}
+
+	if config.Storage != "postgres" {
+		log.Fatal("backfills are only supported with postgres storage")
+	}
+
+	lat, long, ok := strings.Cut(args[0], ",")
+	if !ok {
+		log.Fatal(backfillUsage)
+	}
+
+	latFloat, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		log.Fatalf("failed to parse latitude: %v", err)
+	}
+
+	longFloat, err := strconv.ParseFloat(long, 64)
+	if err != nil {
+		log.Fatalf("failed to parse longitude: %v", err)
+	}
+
+	from, to, err := backfill.ParseDates(args[1], args[2])
+	if err != nil {
+		log.Fatalf("invalid dates: %v", err)
+	}
+
+	db, _, err := openDB(config)
+	if err != nil {
+		log.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	httpClient := &http.Client{
+		Timeout: config.HTTPTimeout,
+	}
+
+	service := backfill.NewService(repository.NewRepository(db), openmateo.NewArchiveClient(httpClient, config.OpenMeteoArchiveBaseURL))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := service.Run(ctx, latFloat, longFloat, from, to)
+	if err != nil {
+		log.Fatalf("failed to backfill: %v", err)
+	}
+
+	log.Infof("backfill %s %s: %d imported, %d skipped", result.Id, result.Status, result.Imported, result.Skipped)
+}
@@ -1,29 +1,269 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"go-sample-rest/internal/alerts"
+	"go-sample-rest/internal/metno"
+	"go-sample-rest/internal/openmateo"
+
 	log "github.com/sirupsen/logrus"
 )
 
+type LocationProvider struct {
+	Latitude  float64
+	Longitude float64
+	Provider  string
+}
+
+type FailoverProvider struct {
+	Provider string
+	Timeout  time.Duration
+}
+
+type LocationRetention struct {
+	Latitude            float64
+	Longitude           float64
+	DownsampleAfterDays int
+	DeleteAfterDays     int
+}
+
 type Config struct {
-	PGConnString string
-	HTTPTimeout  time.Duration
-	Port         int
+	// Storage is one of memory, postgres or sqlite
+	Storage string
+	// DBConnString is the postgres connection string or the sqlite database path
+	DBConnString      string
+	AutoMigrate       bool
+	DBConnectTimeout  time.Duration
+	HTTPTimeout       time.Duration
+	GRPCPort          int
+	WeatherProvider   string
+	LocationProviders []LocationProvider
+	FailoverProviders []FailoverProvider
+	OpenMeteoBaseURL  string
+	// OpenMeteoArchiveBaseURL is the base URL of the archive historical weather data is backfilled from
+	OpenMeteoArchiveBaseURL string
+	MetNoBaseURL            string
+	MetNoUserAgent          string
+	// Retention days of zero disable that step
+	RetentionDownsampleAfterDays int
+	RetentionDeleteAfterDays     int
+	RetentionInterval            time.Duration
+	LocationRetentions           []LocationRetention
+	// Monthly partitions of weather data are created this many months ahead
+	PartitionMonthsAhead int
+	PartitionInterval    time.Duration
+	// Update jobs are run by this many workers, a running job that hasn't made progress for JobStaleAfter is run again,
+	// up to JobMaxAttempts times
+	JobWorkers      int
+	JobPollInterval time.Duration
+	JobStaleAfter   time.Duration
+	JobMaxAttempts  int
+	// Responses of requests with an Idempotency-Key header are replayed for IdempotencyTTL
+	IdempotencyTTL             time.Duration
+	IdempotencyCleanupInterval time.Duration
+	// Alert webhooks are attempted up to AlertMaxAttempts times, waiting AlertRetryDelay after the first attempt and
+	// twice as long after every next one
+	AlertDeliveryInterval time.Duration
+	AlertWebhookTimeout   time.Duration
+	AlertMaxAttempts      int
+	AlertRetryDelay       time.Duration
+	// A WebSocket connection can subscribe to up to WebSocketMaxSubscriptions locations
+	WebSocketMaxSubscriptions int
 }
 
-func NewConfig() *Config {
+// getPort returns the port to serve the API on, it's only required to serve so subcommands like migrate run without it
+func getPort() int {
 	port, err := strconv.Atoi(getEnv("PORT"))
 	if err != nil {
 		log.Fatalf("Cannot convert port to int")
 	}
 
+	return port
+}
+
+func NewConfig() *Config {
+	grpcPort, err := strconv.Atoi(getEnvOrDefault("GRPC_PORT", "9090"))
+	if err != nil {
+		log.Fatalf("Cannot convert GRPC_PORT to int")
+	}
+
+	locationProviders, err := parseLocationProviders(getEnvOrDefault("WEATHER_PROVIDER_LOCATIONS", ""))
+	if err != nil {
+		log.Fatalf("Cannot parse WEATHER_PROVIDER_LOCATIONS: %v", err)
+	}
+
+	failoverProviders, err := parseFailoverProviders(getEnvOrDefault("WEATHER_PROVIDER_FAILOVER", "openmeteo:5s,metno:5s"))
+	if err != nil {
+		log.Fatalf("Cannot parse WEATHER_PROVIDER_FAILOVER: %v", err)
+	}
+
+	retentionDownsampleAfterDays, err := strconv.Atoi(getEnvOrDefault("RETENTION_DOWNSAMPLE_AFTER_DAYS", "0"))
+	if err != nil {
+		log.Fatalf("Cannot convert RETENTION_DOWNSAMPLE_AFTER_DAYS to int")
+	}
+
+	retentionDeleteAfterDays, err := strconv.Atoi(getEnvOrDefault("RETENTION_DELETE_AFTER_DAYS", "0"))
+	if err != nil {
+		log.Fatalf("Cannot convert RETENTION_DELETE_AFTER_DAYS to int")
+	}
+
+	retentionInterval, err := time.ParseDuration(getEnvOrDefault("RETENTION_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("Cannot parse RETENTION_INTERVAL: %v", err)
+	}
+
+	locationRetentions, err := parseLocationRetentions(getEnvOrDefault("RETENTION_LOCATIONS", ""))
+	if err != nil {
+		log.Fatalf("Cannot parse RETENTION_LOCATIONS: %v", err)
+	}
+
+	partitionMonthsAhead, err := strconv.Atoi(getEnvOrDefault("PARTITION_MONTHS_AHEAD", "3"))
+	if err != nil {
+		log.Fatalf("Cannot convert PARTITION_MONTHS_AHEAD to int")
+	}
+
+	partitionInterval, err := time.ParseDuration(getEnvOrDefault("PARTITION_INTERVAL", "24h"))
+	if err != nil {
+		log.Fatalf("Cannot parse PARTITION_INTERVAL: %v", err)
+	}
+
+	jobWorkers, err := strconv.Atoi(getEnvOrDefault("JOB_WORKERS", "2"))
+	if err != nil {
+		log.Fatalf("Cannot convert JOB_WORKERS to int")
+	}
+
+	jobPollInterval, err := time.ParseDuration(getEnvOrDefault("JOB_POLL_INTERVAL", "1s"))
+	if err != nil {
+		log.Fatalf("Cannot parse JOB_POLL_INTERVAL: %v", err)
+	}
+
+	jobStaleAfter, err := time.ParseDuration(getEnvOrDefault("JOB_STALE_AFTER", "5m"))
+	if err != nil {
+		log.Fatalf("Cannot parse JOB_STALE_AFTER: %v", err)
+	}
+
+	jobMaxAttempts, err := strconv.Atoi(getEnvOrDefault("JOB_MAX_ATTEMPTS", "3"))
+	if err != nil {
+		log.Fatalf("Cannot convert JOB_MAX_ATTEMPTS to int")
+	}
+
+	idempotencyTTL, err := time.ParseDuration(getEnvOrDefault("IDEMPOTENCY_TTL", "24h"))
+	if err != nil {
+		log.Fatalf("Cannot parse IDEMPOTENCY_TTL: %v", err)
+	}
+
+	idempotencyCleanupInterval, err := time.ParseDuration(getEnvOrDefault("IDEMPOTENCY_CLEANUP_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("Cannot parse IDEMPOTENCY_CLEANUP_INTERVAL: %v", err)
+	}
+
+	alertDeliveryInterval, err := time.ParseDuration(getEnvOrDefault("ALERT_DELIVERY_INTERVAL", "5s"))
+	if err != nil {
+		log.Fatalf("Cannot parse ALERT_DELIVERY_INTERVAL: %v", err)
+	}
+
+	alertWebhookTimeout, err := time.ParseDuration(getEnvOrDefault("ALERT_WEBHOOK_TIMEOUT", "10s"))
+	if err != nil {
+		log.Fatalf("Cannot parse ALERT_WEBHOOK_TIMEOUT: %v", err)
+	}
+
+	if alertWebhookTimeout <= 0 || alertWebhookTimeout >= alerts.DeliveryLease {
+		log.Fatalf("ALERT_WEBHOOK_TIMEOUT must be above 0 and below the alert delivery lease of %s", alerts.DeliveryLease)
+	}
+
+	alertMaxAttempts, err := strconv.Atoi(getEnvOrDefault("ALERT_MAX_ATTEMPTS", "5"))
+	if err != nil {
+		log.Fatalf("Cannot convert ALERT_MAX_ATTEMPTS to int")
+	}
+
+	alertRetryDelay, err := time.ParseDuration(getEnvOrDefault("ALERT_RETRY_DELAY", "30s"))
+	if err != nil {
+		log.Fatalf("Cannot parse ALERT_RETRY_DELAY: %v", err)
+	}
+
+	webSocketMaxSubscriptions, err := strconv.Atoi(getEnvOrDefault("WEBSOCKET_MAX_SUBSCRIPTIONS", "100"))
+	if err != nil {
+		log.Fatalf("Cannot convert WEBSOCKET_MAX_SUBSCRIPTIONS to int")
+	}
+
+	storage, dbConnString, err := parseStorage(getEnvOrDefault("STORAGE", ""))
+	if err != nil {
+		log.Fatalf("Cannot configure storage: %v", err)
+	}
+
 	return &Config{
-		PGConnString: getEnv("PG_DB_CONN_STRING"),
-		HTTPTimeout:  time.Second * 10,
-		Port:         port,
+		Storage:                 storage,
+		DBConnString:            dbConnString,
+		AutoMigrate:             getEnvOrDefault("AUTO_MIGRATE", "false") == "true",
+		DBConnectTimeout:        time.Minute,
+		HTTPTimeout:             time.Second * 10,
+		GRPCPort:                grpcPort,
+		WeatherProvider:         getEnvOrDefault("WEATHER_PROVIDER", openmateo.ProviderName),
+		LocationProviders:       locationProviders,
+		FailoverProviders:       failoverProviders,
+		OpenMeteoBaseURL:        getEnvOrDefault("OPEN_METEO_BASE_URL", openmateo.DefaultBaseURL),
+		OpenMeteoArchiveBaseURL: getEnvOrDefault("OPEN_METEO_ARCHIVE_BASE_URL", openmateo.DefaultArchiveBaseURL),
+		MetNoBaseURL:            getEnvOrDefault("METNO_BASE_URL", metno.DefaultBaseURL),
+		MetNoUserAgent:          getEnvOrDefault("METNO_USER_AGENT", "go-sample-rest github.com/jponc/go-sample-rest"),
+
+		RetentionDownsampleAfterDays: retentionDownsampleAfterDays,
+		RetentionDeleteAfterDays:     retentionDeleteAfterDays,
+		RetentionInterval:            retentionInterval,
+		LocationRetentions:           locationRetentions,
+
+		PartitionMonthsAhead: partitionMonthsAhead,
+		PartitionInterval:    partitionInterval,
+
+		JobWorkers:      jobWorkers,
+		JobPollInterval: jobPollInterval,
+		JobStaleAfter:   jobStaleAfter,
+		JobMaxAttempts:  jobMaxAttempts,
+
+		IdempotencyTTL:             idempotencyTTL,
+		IdempotencyCleanupInterval: idempotencyCleanupInterval,
+
+		AlertDeliveryInterval:     alertDeliveryInterval,
+		AlertWebhookTimeout:       alertWebhookTimeout,
+		AlertMaxAttempts:          alertMaxAttempts,
+		AlertRetryDelay:           alertRetryDelay,
+		WebSocketMaxSubscriptions: webSocketMaxSubscriptions,
+	}
+}
+
+// parseStorage picks the storage from the database connection string scheme, unless in-memory storage is requested
+func parseStorage(storage string) (string, string, error) {
+	switch storage {
+	case "memory":
+		return storage, "", nil
+	case "":
+		// Picked from the connection string
+	default:
+		return "", "", fmt.Errorf("unsupported STORAGE: %s", storage)
+	}
+
+	// PG_DB_CONN_STRING is still accepted for existing deployments
+	connString := getEnvOrDefault("DB_CONN_STRING", os.Getenv("PG_DB_CONN_STRING"))
+	if connString == "" {
+		return "", "", fmt.Errorf("environment variable DB_CONN_STRING not found")
+	}
+
+	scheme, rest, ok := strings.Cut(connString, "://")
+	if !ok {
+		return "", "", fmt.Errorf("missing scheme in DB_CONN_STRING")
+	}
+
+	switch scheme {
+	case "postgres", "postgresql":
+		return "postgres", connString, nil
+	case "sqlite":
+		return "sqlite", rest, nil
+	default:
+		return "", "", fmt.Errorf("unsupported DB_CONN_STRING scheme: %s", scheme)
 	}
 }
 
@@ -36,3 +276,144 @@ func getEnv(key string) string {
 
 	return val
 }
+
+func getEnvOrDefault(key, defaultVal string) string {
+	val := os.Getenv(key)
+
+	if val == "" {
+		return defaultVal
+	}
+
+	return val
+}
+
+type locationEntry struct {
+	latitude  float64
+	longitude float64
+	value     string
+}
+
+// parseLocationEntries parses a list of per-location values in the format "lat,long=value;lat,long=value"
+func parseLocationEntries(val string) ([]locationEntry, error) {
+	var entries []locationEntry
+
+	for _, entry := range strings.Split(val, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		location, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing value in %q", entry)
+		}
+
+		lat, long, ok := strings.Cut(location, ",")
+		if !ok {
+			return nil, fmt.Errorf("missing longitude in %q", entry)
+		}
+
+		latFloat, err := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse latitude in %q: %w", entry, err)
+		}
+
+		longFloat, err := strconv.ParseFloat(strings.TrimSpace(long), 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse longitude in %q: %w", entry, err)
+		}
+
+		entries = append(entries, locationEntry{
+			latitude:  latFloat,
+			longitude: longFloat,
+			value:     strings.TrimSpace(value),
+		})
+	}
+
+	return entries, nil
+}
+
+// parseLocationProviders parses a list of location providers in the format "lat,long=provider;lat,long=provider"
+func parseLocationProviders(val string) ([]LocationProvider, error) {
+	entries, err := parseLocationEntries(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var locationProviders []LocationProvider
+
+	for _, entry := range entries {
+		locationProviders = append(locationProviders, LocationProvider{
+			Latitude:  entry.latitude,
+			Longitude: entry.longitude,
+			Provider:  entry.value,
+		})
+	}
+
+	return locationProviders, nil
+}
+
+// parseLocationRetentions parses a list of location retentions in the format "lat,long=downsampleAfterDays:deleteAfterDays;..."
+func parseLocationRetentions(val string) ([]LocationRetention, error) {
+	entries, err := parseLocationEntries(val)
+	if err != nil {
+		return nil, err
+	}
+
+	var locationRetentions []LocationRetention
+
+	for _, entry := range entries {
+		downsampleAfterDays, deleteAfterDays, ok := strings.Cut(entry.value, ":")
+		if !ok {
+			return nil, fmt.Errorf("missing delete after days in %q", entry.value)
+		}
+
+		downsampleAfterDaysInt, err := strconv.Atoi(downsampleAfterDays)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse downsample after days in %q: %w", entry.value, err)
+		}
+
+		deleteAfterDaysInt, err := strconv.Atoi(deleteAfterDays)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse delete after days in %q: %w", entry.value, err)
+		}
+
+		locationRetentions = append(locationRetentions, LocationRetention{
+			Latitude:            entry.latitude,
+			Longitude:           entry.longitude,
+			DownsampleAfterDays: downsampleAfterDaysInt,
+			DeleteAfterDays:     deleteAfterDaysInt,
+		})
+	}
+
+	return locationRetentions, nil
+}
+
+// parseFailoverProviders parses an ordered list of providers with optional timeouts in the format "provider:timeout,provider"
+func parseFailoverProviders(val string) ([]FailoverProvider, error) {
+	var failoverProviders []FailoverProvider
+
+	for _, entry := range strings.Split(val, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		provider, timeout, hasTimeout := strings.Cut(entry, ":")
+
+		failoverProvider := FailoverProvider{
+			Provider: strings.TrimSpace(provider),
+		}
+
+		if hasTimeout {
+			timeoutDuration, err := time.ParseDuration(strings.TrimSpace(timeout))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse timeout in %q: %w", entry, err)
+			}
+
+			failoverProvider.Timeout = timeoutDuration
+		}
+
+		failoverProviders = append(failoverProviders, failoverProvider)
+	}
+
+	return failoverProviders, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-sample-rest/internal/migrate"
+	"go-sample-rest/internal/repository/sqlite"
+	sqlitemigrations "go-sample-rest/internal/repository/sqlite/migrations"
+	"go-sample-rest/migrations"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// openDB opens the configured database along with its migrator
+func openDB(config *Config) (*sql.DB, *migrate.Migrator, error) {
+	var db *sql.DB
+	var migrator *migrate.Migrator
+	var err error
+
+	switch config.Storage {
+	case "sqlite":
+		db, err = sqlite.Open(config.DBConnString)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialise db: %w", err)
+		}
+
+		migrator, err = migrate.NewMigrator(db, migrate.SQLite, sqlitemigrations.FS)
+	case "postgres":
+		db, err = sql.Open("postgres", config.DBConnString)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialise db: %w", err)
+		}
+
+		err = waitForDB(db, config.DBConnectTimeout)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+
+		migrator, err = migrate.NewMigrator(db, migrate.Postgres, migrations.FS)
+	default:
+		return nil, nil, fmt.Errorf("storage %s has no database", config.Storage)
+	}
+
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	return db, migrator, nil
+}
+
+// waitForDB waits for the database to accept connections, it may still be starting up next to the service
+func waitForDB(db *sql.DB, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err := db.Ping()
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("failed to connect to db: %w", err)
+		}
+
+		log.Warnf("waiting for db: %v", err)
+		time.Sleep(time.Second)
+	}
+}
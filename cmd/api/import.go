@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"go-sample-rest/internal/importer"
+	"go-sample-rest/internal/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const importUsage = "usage: import file, e.g. import readings.csv or import readings.ndjson"
+
+var importFormats = map[string]string{
+	".csv":    importer.FormatCSV,
+	".ndjson": importer.FormatNDJSON,
+	".jsonl":  importer.FormatNDJSON,
+}
+
+// runImport runs the import subcommand against the configured database, the format is picked from the file's extension
+func runImport(config *Config, args []string) {
+	if len(args) != 1 {
+		log.Fatal(importUsage)
+	}
+
+	format, ok := importFormats[filepath.Ext(args[0])]
+	if !ok {
+		log.Fatalf("unsupported file extension, expected .csv, .ndjson or .jsonl: %s", args[0])
+	}
+
+	if config.Storage != "postgres" {
+		log.Fatal("imports are only supported with postgres storage")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		log.Fatalf("failed to open file: %v", err)
+	}
+	defer file.Close()
+
+	db, _, err := openDB(config)
+	if err != nil {
+		log.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	service := importer.NewService(repository.NewRepository(db))
+
+	report, err := service.Import(format, file)
+	if report != nil {
+		for _, rejection := range report.Rejections {
+			log.Warnf("line %d rejected: %s", rejection.Line, rejection.Reason)
+		}
+
+		log.Infof("import of %s: %d accepted, %d skipped, %d rejected", args[0], report.Accepted, report.Skipped, report.Rejected)
+	}
+
+	if err != nil {
+		log.Fatalf("failed to import: %v", err)
+	}
+}
@@ -1,40 +1,265 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"flag"
 	"net/http"
+	_ "time/tzdata"
 
+	"go-sample-rest/internal/alerts"
+	"go-sample-rest/internal/backfill"
+	"go-sample-rest/internal/graphqlapi"
+	"go-sample-rest/internal/grpcapi"
+	"go-sample-rest/internal/importer"
+	"go-sample-rest/internal/jobs"
+	"go-sample-rest/internal/metno"
 	"go-sample-rest/internal/openmateo"
+	"go-sample-rest/internal/partition"
+	"go-sample-rest/internal/provider"
 	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/repository/memory"
+	"go-sample-rest/internal/repository/sqlite"
+	"go-sample-rest/internal/retention"
 	"go-sample-rest/internal/server"
+	"go-sample-rest/internal/socket"
+	"go-sample-rest/internal/stream"
+	"go-sample-rest/internal/types"
 	"go-sample-rest/internal/weatherservice"
+	"go-sample-rest/internal/weatherservice/httpapi"
 
 	_ "github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
 
+// postgresOnlyFeatures are disabled with any other storage
+var postgresOnlyFeatures = []struct {
+	name     string
+	disabled string
+}{
+	{name: "retention policies", disabled: "old weather data is never deleted"},
+	{name: "update jobs", disabled: "/weather/jobs is disabled"},
+	{name: "idempotency keys", disabled: "the Idempotency-Key header is ignored"},
+	{name: "backfills", disabled: "/weather/{lat},{long}/backfill is disabled"},
+	{name: "imports", disabled: "/weather/import is disabled"},
+	{name: "alerts", disabled: "/alerts is disabled"},
+	{name: "graphql queries", disabled: "/graphql is disabled"},
+}
+
 func main() {
 	// Initialise config
 	config := NewConfig()
 
+	autoMigrate := flag.Bool("auto-migrate", config.AutoMigrate, "apply pending migrations on start")
+	flag.Parse()
+
+	// Subcommands
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "migrate":
+			runMigrate(config, flag.Args()[1:])
+		case "backfill":
+			runBackfill(config, flag.Args()[1:])
+		case "import":
+			runImport(config, flag.Args()[1:])
+		default:
+			log.Fatalf("unknown command: %s", flag.Arg(0))
+		}
+
+		return
+	}
+
+	port := getPort()
+
 	// Initialise repository
-	db, err := sql.Open("postgres", config.PGConnString)
-	if err != nil {
-		log.Fatalf("failed to initialise db: %v", err)
+	var repo weatherservice.WeatherDataRepository
+	var options server.Options
+	var jobStore jobs.Store
+	var idempotencyStore httpapi.IdempotencyStore
+	var backfillStore backfill.Store
+	var importStore importer.Store
+	var alertStore alerts.Store
+	var graphQLStore graphqlapi.Store
+
+	// Newly saved weather data is published to /stream and /ws subscribers, with Postgres it's published by every
+	// replica's listener so subscribers of every replica get it. Fired alerts are only published with Postgres.
+	broker := stream.NewWeatherDataBroker()
+	alertBroker := stream.NewAlertBroker()
+	var alertSubscriber socket.AlertSubscriber
+
+	if config.Storage != "postgres" {
+		for _, feature := range postgresOnlyFeatures {
+			log.Warnf("%s are only supported with postgres storage, %s", feature.name, feature.disabled)
+		}
 	}
-	defer db.Close()
 
-	repo := repository.NewRepository(db)
+	switch config.Storage {
+	case "memory":
+		log.Warn("using in-memory storage, weather data will be lost on restart")
+		repo = stream.WrapRepository(memory.NewRepository(), broker)
+	default:
+		db, migrator, err := openDB(config)
+		if err != nil {
+			log.Fatalf("failed to open db: %v", err)
+		}
+		defer db.Close()
+
+		// SQLite is embedded, so there's no separate migration step to run it
+		if *autoMigrate || config.Storage == "sqlite" {
+			err = migrator.Up()
+			if err != nil {
+				log.Fatalf("failed to migrate db: %v", err)
+			}
+		}
+
+		if config.Storage == "sqlite" {
+			repo = stream.WrapRepository(sqlite.NewRepository(db), broker)
+		} else {
+			pgRepo := repository.NewRepository(db)
+			repo = pgRepo
+
+			go func() {
+				err := repository.Listen(context.Background(), config.DBConnString, repository.Listeners{
+					WeatherData: broker.Publish,
+					AlertFired:  alertBroker.Publish,
+				})
+				if err != nil {
+					log.Errorf("failed to listen for notifications, /stream and /ws are not sent any: %v", err)
+				}
+			}()
 
-	// Initialise open mateo client
+			partitionService := partition.NewService(pgRepo, config.PartitionMonthsAhead)
+			go partitionService.Start(context.Background(), config.PartitionInterval)
+
+			options.RetentionService = newRetentionService(config, pgRepo)
+			jobStore = pgRepo
+			idempotencyStore = pgRepo
+			backfillStore = pgRepo
+			importStore = pgRepo
+			alertStore = pgRepo
+			graphQLStore = pgRepo
+			alertSubscriber = alertBroker
+		}
+	}
+
+	// Initialise weather providers
 	httpClient := &http.Client{
 		Timeout: config.HTTPTimeout,
 	}
-	openMateoClient := openmateo.NewClient(httpClient)
+	openMateoClient := openmateo.NewClient(httpClient, config.OpenMeteoBaseURL)
+	metNoClient := metno.NewClient(httpClient, config.MetNoBaseURL, config.MetNoUserAgent)
+
+	providerClients := map[string]provider.Client{
+		openmateo.ProviderName: openMateoClient,
+		metno.ProviderName:     metNoClient,
+	}
+
+	var failoverMembers []provider.FailoverMember
+	for _, failoverProvider := range config.FailoverProviders {
+		client, ok := providerClients[failoverProvider.Provider]
+		if !ok {
+			log.Fatalf("unknown failover provider: %s", failoverProvider.Provider)
+		}
+
+		failoverMembers = append(failoverMembers, provider.FailoverMember{
+			Name:    failoverProvider.Provider,
+			Client:  client,
+			Timeout: failoverProvider.Timeout,
+		})
+	}
+
+	failover := provider.NewFailover(failoverMembers)
+
+	providerRegistry := provider.NewRegistry(config.WeatherProvider)
+	providerRegistry.Register("failover", failover)
+	for name, client := range providerClients {
+		providerRegistry.Register(name, client)
+	}
+
+	for _, locationProvider := range config.LocationProviders {
+		providerRegistry.SetLocationProvider(locationProvider.Latitude, locationProvider.Longitude, locationProvider.Provider)
+	}
 
-	// Initialise weather service
-	weatherService := weatherservice.NewService(openMateoClient, repo)
+	// Alert rules are evaluated after every save
+	if alertStore != nil {
+		webhookClient := &http.Client{
+			Timeout: config.AlertWebhookTimeout,
+		}
 
-	s := server.NewServer(config.Port, weatherService)
+		service := alerts.NewService(alertStore, webhookClient, config.AlertMaxAttempts, config.AlertRetryDelay)
+		go service.Start(context.Background(), config.AlertDeliveryInterval)
+
+		repo = alerts.WrapRepository(repo, service)
+		options.AlertService = service
+	}
+
+	// Initialise weather service, the REST and gRPC APIs are adapters of it
+	weatherService := weatherservice.NewService(providerRegistry, repo)
+	weatherService.SetSubscriber(broker)
+
+	weatherHandler := httpapi.NewHandler(weatherService)
+	if idempotencyStore != nil {
+		weatherHandler.SetIdempotencyStore(idempotencyStore, config.IdempotencyTTL)
+		go weatherHandler.StartIdempotencyCleanup(context.Background(), config.IdempotencyCleanupInterval)
+	}
+
+	if jobStore != nil {
+		service := jobs.NewService(jobStore, weatherService, providerRegistry, weatherservice.MaxUpdateBatchLocations, config.JobMaxAttempts, config.JobStaleAfter)
+		go service.Start(context.Background(), config.JobWorkers, config.JobPollInterval)
+
+		options.JobService = service
+	}
+
+	if backfillStore != nil {
+		options.BackfillService = backfill.NewService(backfillStore, openmateo.NewArchiveClient(httpClient, config.OpenMeteoArchiveBaseURL))
+	}
+
+	if importStore != nil {
+		options.ImportService = importer.NewService(importStore)
+	}
+
+	if graphQLStore != nil {
+		options.GraphQLService = graphqlapi.NewService(graphQLStore)
+	}
+
+	socketService := socket.NewService(broker, alertSubscriber, config.WebSocketMaxSubscriptions)
+
+	grpcServer := grpcapi.NewServer(config.GRPCPort, weatherService)
+	go func() {
+		err := grpcServer.Start()
+		if err != nil {
+			log.Fatalf("failed to start gRPC server: %v", err)
+		}
+	}()
+
+	s := server.NewServer(port, weatherHandler, failover, socketService, options)
 	s.Start()
 }
+
+// newRetentionService creates the retention service and starts applying retention in the background
+func newRetentionService(config *Config, store retention.Store) *retention.Service {
+	var locationPolicies []retention.LocationPolicy
+	for _, locationRetention := range config.LocationRetentions {
+		locationPolicies = append(locationPolicies, retention.LocationPolicy{
+			Location: types.Location{
+				Latitude:  locationRetention.Latitude,
+				Longitude: locationRetention.Longitude,
+			},
+			Policy: retention.Policy{
+				DownsampleAfterDays: locationRetention.DownsampleAfterDays,
+				DeleteAfterDays:     locationRetention.DeleteAfterDays,
+			},
+		})
+	}
+
+	retentionService, err := retention.NewService(store, retention.Policy{
+		DownsampleAfterDays: config.RetentionDownsampleAfterDays,
+		DeleteAfterDays:     config.RetentionDeleteAfterDays,
+	}, locationPolicies)
+	if err != nil {
+		log.Fatalf("failed to initialise retention: %v", err)
+	}
+
+	go retentionService.Start(context.Background(), config.RetentionInterval)
+
+	return retentionService
+}
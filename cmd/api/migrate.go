@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"go-sample-rest/internal/migrate"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const migrateUsage = "usage: migrate up|down|status"
+
+// runMigrate runs the migrate subcommand against the configured database
+func runMigrate(config *Config, args []string) {
+	if len(args) != 1 {
+		log.Fatal(migrateUsage)
+	}
+
+	db, migrator, err := openDB(config)
+	if err != nil {
+		log.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		err = migrator.Down()
+	case "status":
+		err = printMigrationStatus(migrator)
+	default:
+		log.Fatal(migrateUsage)
+	}
+
+	if err != nil {
+		log.Fatalf("failed to migrate db: %v", err)
+	}
+}
+
+func printMigrationStatus(migrator *migrate.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tSTATE\tINSTALLED ON")
+
+	for _, status := range statuses {
+		state := "Pending"
+		installedOn := ""
+
+		if status.Applied {
+			state = "Applied"
+			installedOn = status.InstalledOn.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Description, state, installedOn)
+	}
+
+	return w.Flush()
+}
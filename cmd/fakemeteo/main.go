@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-sample-rest/internal/openmateo/openmateotest"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	port := flag.Int("port", 8090, "port to listen on")
+	latency := flag.Duration("latency", 0, "latency added to every response")
+	statusCode := flag.Int("status", http.StatusOK, "status code of every response")
+	malformed := flag.Bool("malformed", false, "respond with malformed JSON")
+	flag.Parse()
+
+	handler := openmateotest.NewHandler()
+	handler.SetDefault(openmateotest.Response{
+		StatusCode: *statusCode,
+		Latency:    *latency,
+		Malformed:  *malformed,
+	})
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", *port),
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	log.Infof("Starting fake Open-Meteo server on port %d", *port)
+	log.Fatal(server.ListenAndServe())
+}
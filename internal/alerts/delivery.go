@@ -0,0 +1,177 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Headers of a webhook, the signature is the hex HMAC-SHA256 of the timestamp, a dot and the body, keyed with the
+// rule's secret
+const (
+	EventHeader     = "X-Alert-Event"
+	DeliveryHeader  = "X-Alert-Delivery"
+	TimestampHeader = "X-Alert-Timestamp"
+	SignatureHeader = "X-Alert-Signature"
+)
+
+// DeliveryLease is how long a claimed delivery is left to its worker before it's claimed again. Deliveries are claimed
+// one at a time, so the webhook's timeout must be below it for a delivery not to be claimed again while it's posted.
+const DeliveryLease = time.Minute
+
+// maxRetryDelay caps the backoff between attempts
+const maxRetryDelay = time.Hour
+
+// Sign returns the signature of a webhook body sent at timestamp, in Unix seconds
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start delivers due alerts until the context is done, checking for them every interval
+func (s *Service) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// Deliveries are claimed back to back until there's none left
+		for {
+			n, err := s.RunOnce(ctx)
+			if err != nil {
+				log.Errorf("failed to deliver alerts: %v", err)
+			}
+
+			if n == 0 || err != nil || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims a single due delivery and delivers it, it returns how many were claimed
+func (s *Service) RunOnce(ctx context.Context) (int, error) {
+	deliveries, err := s.store.ClaimAlertDeliveries(1, time.Now().Add(DeliveryLease))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim alert deliveries: %w", err)
+	}
+
+	for _, delivery := range deliveries {
+		rule, err := s.store.GetAlertRule(delivery.RuleId)
+		if err != nil {
+			return len(deliveries), fmt.Errorf("failed to get alert rule %s: %w", delivery.RuleId, err)
+		}
+
+		// Deleted since, its deliveries went with it
+		if rule == nil {
+			continue
+		}
+
+		err = s.deliver(ctx, rule, delivery)
+		if err != nil {
+			return len(deliveries), err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// deliver attempts a claimed delivery and saves its outcome on it. Failed attempts are retried with exponential backoff
+// until the delivery runs out of attempts, except for test deliveries.
+func (s *Service) deliver(ctx context.Context, rule *types.AlertRule, delivery *types.AlertDelivery) error {
+	statusCode, err := s.post(ctx, rule, delivery)
+
+	now := time.Now().UTC()
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	delivery.NextAttemptAt = now
+
+	switch {
+	case err == nil:
+		delivery.Status = types.AlertDeliveryDelivered
+		delivery.DeliveredAt = &now
+	case delivery.Event == types.AlertEventTest || delivery.Attempts >= s.maxAttempts:
+		delivery.Status = types.AlertDeliveryFailed
+		delivery.LastError = err.Error()
+	default:
+		delivery.Status = types.AlertDeliveryPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(s.backoff(delivery.Attempts))
+	}
+
+	if err != nil {
+		log.Warnf("alert delivery %s of rule %s failed (attempt %d): %v", delivery.Id, rule.Id, delivery.Attempts, err)
+	}
+
+	ok, err := s.store.SaveAlertDeliveryAttempt(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to save attempt of alert delivery %s: %w", delivery.Id, err)
+	}
+
+	if !ok {
+		log.Warnf("alert delivery %s was claimed by another worker", delivery.Id)
+	}
+
+	return nil
+}
+
+// backoff is how long to wait after a delivery's given attempt failed
+func (s *Service) backoff(attempts int) time.Duration {
+	delay := s.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxRetryDelay)
+}
+
+// post sends the delivery's payload to the rule's webhook, it errs unless the webhook responds with a 2xx status code
+func (s *Service) post(ctx context.Context, rule *types.AlertRule, delivery *types.AlertDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.WebhookURL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.Id)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(rule.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Drained so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status code %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
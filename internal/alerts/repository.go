@@ -0,0 +1,54 @@
+package alerts
+
+import (
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// evaluatingRepository evaluates the alert rules of every weather data it saves
+type evaluatingRepository struct {
+	weatherservice.WeatherDataRepository
+	service *Service
+}
+
+// WrapRepository returns a repository that evaluates the alert rules after every save of repo. Failing to evaluate
+// them is logged rather than failing the save, as the weather data is already saved.
+func WrapRepository(repo weatherservice.WeatherDataRepository, service *Service) weatherservice.WeatherDataRepository {
+	return &evaluatingRepository{
+		WeatherDataRepository: repo,
+		service:               service,
+	}
+}
+
+func (r *evaluatingRepository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+	weatherData, err := r.WeatherDataRepository.SaveWeatherData(lat, long, temperature, windDirection, windSpeed, source)
+	if err != nil {
+		return nil, err
+	}
+
+	r.evaluate(weatherData)
+
+	return weatherData, nil
+}
+
+func (r *evaluatingRepository) SaveWeatherDataBatch(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error) {
+	savedWeatherDataList, err := r.WeatherDataRepository.SaveWeatherDataBatch(weatherDataList)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, weatherData := range savedWeatherDataList {
+		r.evaluate(weatherData)
+	}
+
+	return savedWeatherDataList, nil
+}
+
+func (r *evaluatingRepository) evaluate(weatherData *types.WeatherData) {
+	err := r.service.Evaluate(weatherData)
+	if err != nil {
+		log.Errorf("failed to evaluate alert rules of %f,%f: %v", weatherData.Latitude, weatherData.Longitude, err)
+	}
+}
@@ -0,0 +1,409 @@
+package alerts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/google/uuid"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Store interface {
+	CreateAlertRule(rule *types.AlertRule) (*types.AlertRule, error)
+	GetAlertRule(id string) (*types.AlertRule, error)
+	ListAlertRules() ([]*types.AlertRule, error)
+	GetEnabledAlertRules(lat, long float64) ([]*types.AlertRule, error)
+	UpdateAlertRule(rule *types.AlertRule) (*types.AlertRule, error)
+	DeleteAlertRule(id string) (bool, error)
+	FireAlertRule(rule *types.AlertRule, firedAt time.Time, delivery *types.AlertDelivery) (bool, error)
+	CreateClaimedAlertDelivery(delivery *types.AlertDelivery, leaseUntil time.Time) (*types.AlertDelivery, error)
+	ClaimAlertDeliveries(limit int, leaseUntil time.Time) ([]*types.AlertDelivery, error)
+	SaveAlertDeliveryAttempt(delivery *types.AlertDelivery) (bool, error)
+	ListAlertDeliveries(ruleId string, limit int) ([]*types.AlertDelivery, error)
+}
+
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// MaxListedDeliveries is how many of a rule's latest deliveries are listed
+const MaxListedDeliveries = 100
+
+// Service manages alert rules, evaluates them against saved weather data and delivers the alerts they fire to their
+// webhooks. Deliveries are queued in the store and delivered by workers, failed deliveries are retried with
+// exponential backoff.
+type Service struct {
+	store       Store
+	httpClient  HTTPClient
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+// NewService creates the service, deliveries are attempted up to maxAttempts times, waiting retryDelay after the
+// first attempt and twice as long after every next one
+func NewService(store Store, httpClient HTTPClient, maxAttempts int, retryDelay time.Duration) *Service {
+	return &Service{
+		store:       store,
+		httpClient:  httpClient,
+		maxAttempts: maxAttempts,
+		retryDelay:  retryDelay,
+	}
+}
+
+// Evaluate fires the location's rules that the weather data crosses, queueing their deliveries.
+// Rules still cooling down from their last firing are skipped.
+func (s *Service) Evaluate(weatherData *types.WeatherData) error {
+	rules, err := s.store.GetEnabledAlertRules(weatherData.Latitude, weatherData.Longitude)
+	if err != nil {
+		return fmt.Errorf("failed to get alert rules: %w", err)
+	}
+
+	var errs []error
+	for _, rule := range rules {
+		value := metricValue(rule.Metric, weatherData)
+		if !compare(rule.Comparator, value, rule.Threshold) {
+			continue
+		}
+
+		firedAt := time.Now().UTC()
+
+		delivery, err := newDelivery(rule, types.AlertEventFired, weatherData, value, firedAt)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		fired, err := s.store.FireAlertRule(rule, firedAt, delivery)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to fire alert rule %s: %w", rule.Id, err))
+			continue
+		}
+
+		if fired {
+			log.Infof("alert rule %s fired: %s %s %v with %v", rule.Id, rule.Metric, rule.Comparator, rule.Threshold, value)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func newDelivery(rule *types.AlertRule, event string, weatherData *types.WeatherData, value float64, firedAt time.Time) (*types.AlertDelivery, error) {
+	delivery := &types.AlertDelivery{
+		Id:     uuid.New().String(),
+		RuleId: rule.Id,
+		Event:  event,
+	}
+
+	payloadRule := *rule
+	payloadRule.Secret = ""
+
+	payload, err := json.Marshal(types.AlertPayload{
+		Event:       event,
+		DeliveryId:  delivery.Id,
+		Rule:        payloadRule,
+		WeatherData: weatherData,
+		Value:       value,
+		FiredAt:     firedAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload of alert rule %s: %w", rule.Id, err)
+	}
+
+	delivery.Payload = payload
+
+	return delivery, nil
+}
+
+func metricValue(metric string, weatherData *types.WeatherData) float64 {
+	switch metric {
+	case types.AlertMetricTemperature:
+		return weatherData.Temperature
+	case types.AlertMetricWindSpeed:
+		return weatherData.WindSpeed
+	default:
+		return weatherData.WindDirection
+	}
+}
+
+func compare(comparator string, value, threshold float64) bool {
+	switch comparator {
+	case types.AlertComparatorGreaterThan:
+		return value > threshold
+	case types.AlertComparatorGreaterThanOrEqual:
+		return value >= threshold
+	case types.AlertComparatorLessThan:
+		return value < threshold
+	default:
+		return value <= threshold
+	}
+}
+
+// ruleRequest is the body creating or replacing a rule, enabled defaults to true and a secret is generated when
+// it's not given
+type ruleRequest struct {
+	Latitude        *float64 `json:"latitude"`
+	Longitude       *float64 `json:"longitude"`
+	Metric          string   `json:"metric"`
+	Comparator      string   `json:"comparator"`
+	Threshold       *float64 `json:"threshold"`
+	CooldownSeconds int      `json:"cooldown_seconds"`
+	WebhookURL      string   `json:"webhook_url"`
+	Secret          string   `json:"secret"`
+	Enabled         *bool    `json:"enabled"`
+}
+
+// CreateRule returns the created rule with its secret, it's not returned again
+func (s *Service) CreateRule(w http.ResponseWriter, r *http.Request) {
+	rule, err := s.getRule(r)
+	if err != nil {
+		log.Errorf("failed to get alert rule from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	rule.Id = uuid.New().String()
+
+	if rule.Secret == "" {
+		rule.Secret, err = generateSecret()
+		if err != nil {
+			log.Errorf("failed to generate secret: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	createdRule, err := s.store.CreateAlertRule(rule)
+	if err != nil {
+		log.Errorf("failed to create alert rule: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, createdRule)
+}
+
+func (s *Service) ListRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.store.ListAlertRules()
+	if err != nil {
+		log.Errorf("failed to list alert rules: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	for _, rule := range rules {
+		rule.Secret = ""
+	}
+
+	render.JSON(w, r, rules)
+}
+
+func (s *Service) GetRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := s.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	rule.Secret = ""
+
+	render.JSON(w, r, rule)
+}
+
+// UpdateRule replaces a rule's settings, its secret is kept when a new one isn't given
+func (s *Service) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	existingRule, ok := s.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	rule, err := s.getRule(r)
+	if err != nil {
+		log.Errorf("failed to get alert rule from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	rule.Id = existingRule.Id
+	if rule.Secret == "" {
+		rule.Secret = existingRule.Secret
+	}
+
+	updatedRule, err := s.store.UpdateAlertRule(rule)
+	if err != nil {
+		log.Errorf("failed to update alert rule: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if updatedRule == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	updatedRule.Secret = ""
+
+	render.JSON(w, r, updatedRule)
+}
+
+func (s *Service) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.store.DeleteAlertRule(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Errorf("failed to delete alert rule: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !deleted {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the rule's latest deliveries, newest first
+func (s *Service) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	rule, ok := s.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := s.store.ListAlertDeliveries(rule.Id, MaxListedDeliveries)
+	if err != nil {
+		log.Errorf("failed to list alert deliveries: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, deliveries)
+}
+
+// TestRule delivers a test event to the rule's webhook right away, whether the rule is enabled and cooling down or not,
+// and returns the delivery. Test deliveries aren't retried.
+func (s *Service) TestRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := s.findRule(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := newDelivery(rule, types.AlertEventTest, nil, rule.Threshold, time.Now().UTC())
+	if err != nil {
+		log.Errorf("failed to create test delivery: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	delivery, err = s.store.CreateClaimedAlertDelivery(delivery, time.Now().Add(DeliveryLease))
+	if err != nil {
+		log.Errorf("failed to create test delivery: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.deliver(r.Context(), rule, delivery)
+	if err != nil {
+		log.Errorf("failed to deliver test delivery: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, delivery)
+}
+
+// findRule gets the rule of the id URL parameter, responding with an error when it can't
+func (s *Service) findRule(w http.ResponseWriter, r *http.Request) (*types.AlertRule, bool) {
+	rule, err := s.store.GetAlertRule(chi.URLParam(r, "id"))
+	if err != nil {
+		log.Errorf("failed to get alert rule: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if rule == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return nil, false
+	}
+
+	return rule, true
+}
+
+func (s *Service) getRule(r *http.Request) (*types.AlertRule, error) {
+	var request ruleRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+
+	if request.Latitude == nil || request.Longitude == nil || request.Threshold == nil {
+		return nil, fmt.Errorf("latitude, longitude and threshold must be provided")
+	}
+
+	if *request.Latitude < -90 || *request.Latitude > 90 || *request.Longitude < -180 || *request.Longitude > 180 {
+		return nil, fmt.Errorf("invalid location: %v,%v", *request.Latitude, *request.Longitude)
+	}
+
+	switch request.Metric {
+	case types.AlertMetricTemperature, types.AlertMetricWindSpeed, types.AlertMetricWindDirection:
+	default:
+		return nil, fmt.Errorf("unsupported metric: %q", request.Metric)
+	}
+
+	switch request.Comparator {
+	case types.AlertComparatorGreaterThan, types.AlertComparatorGreaterThanOrEqual, types.AlertComparatorLessThan, types.AlertComparatorLessThanOrEqual:
+	default:
+		return nil, fmt.Errorf("unsupported comparator: %q", request.Comparator)
+	}
+
+	if math.IsNaN(*request.Threshold) || math.IsInf(*request.Threshold, 0) {
+		return nil, fmt.Errorf("threshold must be a finite number")
+	}
+
+	if request.CooldownSeconds < 0 {
+		return nil, fmt.Errorf("cooldown_seconds must not be negative")
+	}
+
+	webhookURL, err := url.Parse(request.WebhookURL)
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+		return nil, fmt.Errorf("webhook_url must be an http or https URL, got %q", request.WebhookURL)
+	}
+
+	enabled := true
+	if request.Enabled != nil {
+		enabled = *request.Enabled
+	}
+
+	return &types.AlertRule{
+		Latitude:        *request.Latitude,
+		Longitude:       *request.Longitude,
+		Metric:          request.Metric,
+		Comparator:      request.Comparator,
+		Threshold:       *request.Threshold,
+		CooldownSeconds: request.CooldownSeconds,
+		WebhookURL:      request.WebhookURL,
+		Secret:          request.Secret,
+		Enabled:         enabled,
+	}, nil
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,554 @@
+package alerts_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/alerts"
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// MockStore keeps rules and deliveries in memory, a rule fires once until fired is reset
+type MockStore struct {
+	rules      map[string]*types.AlertRule
+	deliveries []*types.AlertDelivery
+	cooling    map[string]bool
+	err        error
+}
+
+func newMockStore(rules ...*types.AlertRule) *MockStore {
+	store := &MockStore{rules: map[string]*types.AlertRule{}, cooling: map[string]bool{}}
+	for _, rule := range rules {
+		store.rules[rule.Id] = rule
+	}
+
+	return store
+}
+
+func (m *MockStore) CreateAlertRule(rule *types.AlertRule) (*types.AlertRule, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	created := *rule
+	m.rules[rule.Id] = &created
+
+	result := created
+	return &result, nil
+}
+
+func (m *MockStore) GetAlertRule(id string) (*types.AlertRule, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	rule, ok := m.rules[id]
+	if !ok {
+		return nil, nil
+	}
+
+	result := *rule
+	return &result, nil
+}
+
+func (m *MockStore) ListAlertRules() ([]*types.AlertRule, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	rules := []*types.AlertRule{}
+	for _, rule := range m.rules {
+		result := *rule
+		rules = append(rules, &result)
+	}
+
+	return rules, nil
+}
+
+func (m *MockStore) GetEnabledAlertRules(lat, long float64) ([]*types.AlertRule, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var rules []*types.AlertRule
+	for _, rule := range m.rules {
+		if rule.Enabled && rule.Latitude == lat && rule.Longitude == long {
+			result := *rule
+			rules = append(rules, &result)
+		}
+	}
+
+	return rules, nil
+}
+
+func (m *MockStore) UpdateAlertRule(rule *types.AlertRule) (*types.AlertRule, error) {
+	if _, ok := m.rules[rule.Id]; !ok {
+		return nil, nil
+	}
+
+	return m.CreateAlertRule(rule)
+}
+
+func (m *MockStore) DeleteAlertRule(id string) (bool, error) {
+	if _, ok := m.rules[id]; !ok {
+		return false, nil
+	}
+
+	delete(m.rules, id)
+
+	return true, nil
+}
+
+func (m *MockStore) FireAlertRule(rule *types.AlertRule, firedAt time.Time, delivery *types.AlertDelivery) (bool, error) {
+	if m.cooling[rule.Id] {
+		return false, nil
+	}
+
+	m.cooling[rule.Id] = true
+	m.rules[rule.Id].LastFiredAt = &firedAt
+
+	delivery.Status = types.AlertDeliveryPending
+	m.deliveries = append(m.deliveries, delivery)
+
+	return true, nil
+}
+
+func (m *MockStore) CreateClaimedAlertDelivery(delivery *types.AlertDelivery, leaseUntil time.Time) (*types.AlertDelivery, error) {
+	delivery.Status = types.AlertDeliveryPending
+	delivery.Attempts = 1
+	delivery.NextAttemptAt = leaseUntil
+	m.deliveries = append(m.deliveries, delivery)
+
+	return delivery, nil
+}
+
+func (m *MockStore) ClaimAlertDeliveries(limit int, leaseUntil time.Time) ([]*types.AlertDelivery, error) {
+	var claimed []*types.AlertDelivery
+	for _, delivery := range m.deliveries {
+		if len(claimed) < limit && delivery.Status == types.AlertDeliveryPending && !delivery.NextAttemptAt.After(time.Now()) {
+			delivery.Attempts++
+			delivery.NextAttemptAt = leaseUntil
+			claimed = append(claimed, delivery)
+		}
+	}
+
+	return claimed, nil
+}
+
+func (m *MockStore) SaveAlertDeliveryAttempt(delivery *types.AlertDelivery) (bool, error) {
+	return true, nil
+}
+
+func (m *MockStore) ListAlertDeliveries(ruleId string, limit int) ([]*types.AlertDelivery, error) {
+	deliveries := []*types.AlertDelivery{}
+	for _, delivery := range m.deliveries {
+		if delivery.RuleId == ruleId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return deliveries, nil
+}
+
+// dueNow makes the store's pending deliveries due, as if their backoff had passed
+func (m *MockStore) dueNow() {
+	for _, delivery := range m.deliveries {
+		delivery.NextAttemptAt = time.Now().Add(-time.Second)
+	}
+}
+
+func windRule(webhookURL string) *types.AlertRule {
+	return &types.AlertRule{
+		Id:              "rule1",
+		Latitude:        1.1,
+		Longitude:       2.2,
+		Metric:          types.AlertMetricWindSpeed,
+		Comparator:      types.AlertComparatorGreaterThan,
+		Threshold:       40,
+		CooldownSeconds: 600,
+		WebhookURL:      webhookURL,
+		Secret:          "s3cret",
+		Enabled:         true,
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		comparator    string
+		metric        string
+		windSpeed     float64
+		shouldFire    bool
+		expectedValue float64
+	}{
+		{name: "should fire when wind speed is above the threshold", comparator: types.AlertComparatorGreaterThan, metric: types.AlertMetricWindSpeed, windSpeed: 40.1, shouldFire: true, expectedValue: 40.1},
+		{name: "should not fire when wind speed is at the threshold", comparator: types.AlertComparatorGreaterThan, metric: types.AlertMetricWindSpeed, windSpeed: 40},
+		{name: "should fire when wind speed is at the threshold with gte", comparator: types.AlertComparatorGreaterThanOrEqual, metric: types.AlertMetricWindSpeed, windSpeed: 40, shouldFire: true, expectedValue: 40},
+		{name: "should fire when temperature is below the threshold", comparator: types.AlertComparatorLessThan, metric: types.AlertMetricTemperature, windSpeed: 50, shouldFire: true, expectedValue: 3.3},
+		{name: "should not fire when wind direction is above the threshold with lte", comparator: types.AlertComparatorLessThanOrEqual, metric: types.AlertMetricWindDirection, windSpeed: 50},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := windRule("http://localhost")
+			rule.Comparator = tc.comparator
+			rule.Metric = tc.metric
+
+			store := newMockStore(rule)
+			service := alerts.NewService(store, http.DefaultClient, 3, time.Minute)
+
+			err := service.Evaluate(&types.WeatherData{Id: "w1", Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindDirection: 270, WindSpeed: tc.windSpeed})
+			require.NoError(t, err)
+
+			if !tc.shouldFire {
+				require.Empty(t, store.deliveries)
+				return
+			}
+
+			require.Len(t, store.deliveries, 1)
+			require.Equal(t, types.AlertEventFired, store.deliveries[0].Event)
+			require.Equal(t, "rule1", store.deliveries[0].RuleId)
+
+			var payload types.AlertPayload
+			err = json.Unmarshal(store.deliveries[0].Payload, &payload)
+			require.NoError(t, err)
+			require.Equal(t, store.deliveries[0].Id, payload.DeliveryId)
+			require.Equal(t, tc.expectedValue, payload.Value)
+			require.Equal(t, "w1", payload.WeatherData.Id)
+			require.Empty(t, payload.Rule.Secret)
+		})
+	}
+
+	t.Run("should only fire rules of the location once while cooling down", func(t *testing.T) {
+		otherRule := windRule("http://localhost")
+		otherRule.Id = "rule2"
+		otherRule.Latitude = 3.3
+
+		store := newMockStore(windRule("http://localhost"), otherRule)
+		service := alerts.NewService(store, http.DefaultClient, 3, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			err := service.Evaluate(&types.WeatherData{Latitude: 1.1, Longitude: 2.2, WindSpeed: 50})
+			require.NoError(t, err)
+		}
+
+		require.Len(t, store.deliveries, 1)
+		require.Equal(t, "rule1", store.deliveries[0].RuleId)
+	})
+
+	t.Run("should err when the store returns an error", func(t *testing.T) {
+		store := newMockStore()
+		store.err = fmt.Errorf("error")
+		service := alerts.NewService(store, http.DefaultClient, 3, time.Minute)
+
+		err := service.Evaluate(&types.WeatherData{Latitude: 1.1, Longitude: 2.2, WindSpeed: 50})
+		require.Error(t, err)
+	})
+}
+
+func TestRunOnce(t *testing.T) {
+	t.Run("should deliver signed webhooks", func(t *testing.T) {
+		var received *http.Request
+		var body []byte
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			body, _ = io.ReadAll(r.Body)
+		}))
+		defer server.Close()
+
+		store := newMockStore(windRule(server.URL))
+		service := alerts.NewService(store, server.Client(), 3, time.Minute)
+
+		err := service.Evaluate(&types.WeatherData{Latitude: 1.1, Longitude: 2.2, WindSpeed: 50})
+		require.NoError(t, err)
+
+		n, err := service.RunOnce(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		delivery := store.deliveries[0]
+		require.Equal(t, types.AlertDeliveryDelivered, delivery.Status)
+		require.Equal(t, http.StatusOK, delivery.LastStatusCode)
+		require.NotNil(t, delivery.DeliveredAt)
+
+		require.Equal(t, []byte(delivery.Payload), body)
+		require.Equal(t, "application/json", received.Header.Get("Content-Type"))
+		require.Equal(t, types.AlertEventFired, received.Header.Get(alerts.EventHeader))
+		require.Equal(t, delivery.Id, received.Header.Get(alerts.DeliveryHeader))
+
+		timestamp, err := strconv.ParseInt(received.Header.Get(alerts.TimestampHeader), 10, 64)
+		require.NoError(t, err)
+		require.Equal(t, alerts.Sign("s3cret", timestamp, body), received.Header.Get(alerts.SignatureHeader))
+
+		// Nothing left to deliver
+		n, err = service.RunOnce(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 0, n)
+	})
+
+	t.Run("should claim a single delivery at a time", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		otherRule := windRule(server.URL)
+		otherRule.Id = "rule2"
+
+		store := newMockStore(windRule(server.URL), otherRule)
+		service := alerts.NewService(store, server.Client(), 3, time.Minute)
+
+		err := service.Evaluate(&types.WeatherData{Latitude: 1.1, Longitude: 2.2, WindSpeed: 50})
+		require.NoError(t, err)
+		require.Len(t, store.deliveries, 2)
+
+		for i := 0; i < 2; i++ {
+			n, err := service.RunOnce(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 1, n)
+		}
+
+		n, err := service.RunOnce(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 0, n)
+	})
+
+	t.Run("should retry with backoff until out of attempts", func(t *testing.T) {
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		store := newMockStore(windRule(server.URL))
+		service := alerts.NewService(store, server.Client(), 3, time.Minute)
+
+		err := service.Evaluate(&types.WeatherData{Latitude: 1.1, Longitude: 2.2, WindSpeed: 50})
+		require.NoError(t, err)
+
+		delivery := store.deliveries[0]
+
+		for attempt, expectedDelay := range []time.Duration{time.Minute, 2 * time.Minute} {
+			start := time.Now()
+
+			_, err = service.RunOnce(context.Background())
+			require.NoError(t, err)
+
+			require.Equal(t, attempt+1, delivery.Attempts)
+			require.Equal(t, types.AlertDeliveryPending, delivery.Status)
+			require.Equal(t, http.StatusServiceUnavailable, delivery.LastStatusCode)
+			require.Equal(t, "webhook responded with status code 503", delivery.LastError)
+			require.WithinDuration(t, start.Add(expectedDelay), delivery.NextAttemptAt, 5*time.Second)
+
+			// Not due until the backoff has passed
+			n, err := service.RunOnce(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, 0, n)
+
+			store.dueNow()
+		}
+
+		_, err = service.RunOnce(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 3, calls)
+		require.Equal(t, types.AlertDeliveryFailed, delivery.Status)
+	})
+}
+
+func TestWrapRepository(t *testing.T) {
+	store := newMockStore(windRule("http://localhost"))
+	service := alerts.NewService(store, http.DefaultClient, 3, time.Minute)
+	repo := alerts.WrapRepository(&MockWeatherDataRepository{}, service)
+
+	_, err := repo.SaveWeatherData(1.1, 2.2, 3.3, 270, 30, "openmeteo")
+	require.NoError(t, err)
+	require.Empty(t, store.deliveries)
+
+	_, err = repo.SaveWeatherDataBatch([]*types.WeatherData{{Latitude: 1.1, Longitude: 2.2, WindSpeed: 45}})
+	require.NoError(t, err)
+	require.Len(t, store.deliveries, 1)
+}
+
+// MockWeatherDataRepository returns what it's asked to save
+type MockWeatherDataRepository struct {
+	types.WeatherData
+}
+
+func (m *MockWeatherDataRepository) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	return nil, nil
+}
+
+func (m *MockWeatherDataRepository) GetAllLatestWeatherData() ([]*types.WeatherData, error) {
+	return nil, nil
+}
+
+func (m *MockWeatherDataRepository) GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error) {
+	return nil, nil
+}
+
+func (m *MockWeatherDataRepository) GetWeatherHistory(lat, long float64) ([]*types.WeatherData, error) {
+	return nil, nil
+}
+
+func (m *MockWeatherDataRepository) StreamWeatherHistory(lat, long float64, fn func(weatherData *types.WeatherData) error) error {
+	return nil
+}
+
+func (m *MockWeatherDataRepository) GetWeatherDataSince(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error) {
+	return nil, nil
+}
+
+func (m *MockWeatherDataRepository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+	return &types.WeatherData{Latitude: lat, Longitude: long, Temperature: temperature, WindDirection: windDirection, WindSpeed: windSpeed, Source: source}, nil
+}
+
+func (m *MockWeatherDataRepository) SaveWeatherDataBatch(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error) {
+	return weatherDataList, nil
+}
+
+func newRuleRequest(method, id, body string) *http.Request {
+	r := httptest.NewRequest(method, "/alerts/rules/"+id, strings.NewReader(body))
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestCreateRule(t *testing.T) {
+	testCases := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+	}{
+		{name: "should err when body is not json", body: `{`, expectedStatusCode: http.StatusBadRequest},
+		{name: "should err when threshold is missing", body: `{"latitude":1.1,"longitude":2.2,"metric":"wind_speed","comparator":"gt","webhook_url":"https://example.com/hook"}`, expectedStatusCode: http.StatusBadRequest},
+		{name: "should err when metric is not supported", body: `{"latitude":1.1,"longitude":2.2,"metric":"humidity","comparator":"gt","threshold":40,"webhook_url":"https://example.com/hook"}`, expectedStatusCode: http.StatusBadRequest},
+		{name: "should err when comparator is not supported", body: `{"latitude":1.1,"longitude":2.2,"metric":"wind_speed","comparator":"eq","threshold":40,"webhook_url":"https://example.com/hook"}`, expectedStatusCode: http.StatusBadRequest},
+		{name: "should err when cooldown is negative", body: `{"latitude":1.1,"longitude":2.2,"metric":"wind_speed","comparator":"gt","threshold":40,"cooldown_seconds":-1,"webhook_url":"https://example.com/hook"}`, expectedStatusCode: http.StatusBadRequest},
+		{name: "should err when webhook url is not http", body: `{"latitude":1.1,"longitude":2.2,"metric":"wind_speed","comparator":"gt","threshold":40,"webhook_url":"ftp://example.com/hook"}`, expectedStatusCode: http.StatusBadRequest},
+		{name: "should err when latitude is out of range", body: `{"latitude":91,"longitude":2.2,"metric":"wind_speed","comparator":"gt","threshold":40,"webhook_url":"https://example.com/hook"}`, expectedStatusCode: http.StatusBadRequest},
+		{name: "should create the rule", body: `{"latitude":1.1,"longitude":2.2,"metric":"wind_speed","comparator":"gt","threshold":40,"cooldown_seconds":600,"webhook_url":"https://example.com/hook"}`, expectedStatusCode: http.StatusCreated},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMockStore()
+			service := alerts.NewService(store, http.DefaultClient, 3, time.Minute)
+			w := httptest.NewRecorder()
+
+			service.CreateRule(w, httptest.NewRequest("POST", "/alerts/rules", strings.NewReader(tc.body)))
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			if tc.expectedStatusCode != http.StatusCreated {
+				require.Empty(t, store.rules)
+				return
+			}
+
+			var rule types.AlertRule
+			err := json.Unmarshal(w.Body.Bytes(), &rule)
+			require.NoError(t, err)
+			require.NotEmpty(t, rule.Id)
+			require.Len(t, rule.Secret, 64)
+			require.True(t, rule.Enabled)
+			require.Equal(t, 600, rule.CooldownSeconds)
+			require.Equal(t, store.rules[rule.Id].Secret, rule.Secret)
+		})
+	}
+}
+
+func TestRuleHandlers(t *testing.T) {
+	t.Run("should not return the secret once created", func(t *testing.T) {
+		service := alerts.NewService(newMockStore(windRule("https://example.com/hook")), http.DefaultClient, 3, time.Minute)
+
+		w := httptest.NewRecorder()
+		service.GetRule(w, newRuleRequest("GET", "rule1", ""))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.NotContains(t, w.Body.String(), "s3cret")
+
+		w = httptest.NewRecorder()
+		service.ListRules(w, httptest.NewRequest("GET", "/alerts/rules", nil))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Contains(t, w.Body.String(), "rule1")
+		require.NotContains(t, w.Body.String(), "s3cret")
+	})
+
+	t.Run("should keep the secret when updating without one", func(t *testing.T) {
+		store := newMockStore(windRule("https://example.com/hook"))
+		service := alerts.NewService(store, http.DefaultClient, 3, time.Minute)
+
+		w := httptest.NewRecorder()
+		service.UpdateRule(w, newRuleRequest("PUT", "rule1", `{"latitude":1.1,"longitude":2.2,"metric":"wind_speed","comparator":"gte","threshold":50,"webhook_url":"https://example.com/hook","enabled":false}`))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.NotContains(t, w.Body.String(), "s3cret")
+
+		require.Equal(t, "s3cret", store.rules["rule1"].Secret)
+		require.Equal(t, 50.0, store.rules["rule1"].Threshold)
+		require.False(t, store.rules["rule1"].Enabled)
+	})
+
+	t.Run("should return not found for a missing rule", func(t *testing.T) {
+		service := alerts.NewService(newMockStore(), http.DefaultClient, 3, time.Minute)
+
+		for _, handler := range []http.HandlerFunc{service.GetRule, service.DeleteRule, service.ListDeliveries, service.TestRule} {
+			w := httptest.NewRecorder()
+			handler(w, newRuleRequest("GET", "missing", `{"latitude":1.1,"longitude":2.2,"metric":"wind_speed","comparator":"gt","threshold":40,"webhook_url":"https://example.com/hook"}`))
+			require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+		}
+
+		w := httptest.NewRecorder()
+		service.UpdateRule(w, newRuleRequest("PUT", "missing", `{"latitude":1.1,"longitude":2.2,"metric":"wind_speed","comparator":"gt","threshold":40,"webhook_url":"https://example.com/hook"}`))
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
+	t.Run("should delete the rule", func(t *testing.T) {
+		store := newMockStore(windRule("https://example.com/hook"))
+		service := alerts.NewService(store, http.DefaultClient, 3, time.Minute)
+
+		w := httptest.NewRecorder()
+		service.DeleteRule(w, newRuleRequest("DELETE", "rule1", ""))
+		require.Equal(t, http.StatusNoContent, w.Result().StatusCode)
+		require.Empty(t, store.rules)
+	})
+
+	t.Run("should test fire the rule right away without retrying", func(t *testing.T) {
+		var event string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			event = r.Header.Get(alerts.EventHeader)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		store := newMockStore(windRule(server.URL))
+		service := alerts.NewService(store, server.Client(), 3, time.Minute)
+
+		w := httptest.NewRecorder()
+		service.TestRule(w, newRuleRequest("POST", "rule1", ""))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Equal(t, types.AlertEventTest, event)
+
+		var delivery types.AlertDelivery
+		err := json.Unmarshal(w.Body.Bytes(), &delivery)
+		require.NoError(t, err)
+		require.Equal(t, types.AlertDeliveryFailed, delivery.Status)
+		require.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+		require.Equal(t, 1, delivery.Attempts)
+
+		// It shows up in the delivery log
+		w = httptest.NewRecorder()
+		service.ListDeliveries(w, newRuleRequest("GET", "rule1", ""))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Contains(t, w.Body.String(), delivery.Id)
+	})
+}
@@ -0,0 +1,154 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Store interface {
+	StartBackfill(lat, long float64, from, to time.Time) (*types.Backfill, error)
+	SaveBackfillChunk(backfill *types.Backfill, weatherDataList []*types.WeatherData, next time.Time) (*types.Backfill, error)
+	CreatePartition(month time.Time) (bool, error)
+}
+
+// ArchiveClient gets the hourly historical weather data of a location's UTC days, both included
+type ArchiveClient interface {
+	GetHistoricalWeatherData(lat, long float64, from, to time.Time) ([]*types.WeatherData, error)
+}
+
+// Service imports the historical weather data of a location a month at a time, the progress is saved after every month
+// so an interrupted backfill carries on where it was left when it's run again
+type Service struct {
+	store         Store
+	archiveClient ArchiveClient
+}
+
+func NewService(store Store, archiveClient ArchiveClient) *Service {
+	return &Service{
+		store:         store,
+		archiveClient: archiveClient,
+	}
+}
+
+// Run backfills the UTC days from to to, both included, until it's done or the context is done
+func (s *Service) Run(ctx context.Context, lat, long float64, from, to time.Time) (*types.Backfill, error) {
+	backfill, err := s.store.StartBackfill(lat, long, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start backfill: %w", err)
+	}
+
+	for !backfill.Next.After(backfill.To) {
+		if ctx.Err() != nil {
+			return backfill, ctx.Err()
+		}
+
+		// Chunks are calendar months, so each one goes into a single monthly partition
+		month := time.Date(backfill.Next.Year(), backfill.Next.Month(), 1, 0, 0, 0, 0, time.UTC)
+		end := month.AddDate(0, 1, -1)
+		if end.After(backfill.To) {
+			end = backfill.To
+		}
+
+		_, err := s.store.CreatePartition(month)
+		if err != nil {
+			return backfill, fmt.Errorf("failed to create partition for %s: %w", month.Format("2006-01"), err)
+		}
+
+		weatherDataList, err := s.archiveClient.GetHistoricalWeatherData(lat, long, backfill.Next, end)
+		if err != nil {
+			return backfill, fmt.Errorf("failed to get historical weather data from %s to %s: %w", backfill.Next.Format(time.DateOnly), end.Format(time.DateOnly), err)
+		}
+
+		backfill, err = s.store.SaveBackfillChunk(backfill, weatherDataList, end.AddDate(0, 0, 1))
+		if err != nil {
+			return backfill, fmt.Errorf("failed to save historical weather data: %w", err)
+		}
+
+		log.Infof("backfilled %f,%f up to %s: %d imported, %d skipped", lat, long, end.Format(time.DateOnly), backfill.Imported, backfill.Skipped)
+	}
+
+	return backfill, nil
+}
+
+// Backfill imports the historical weather data of the days in the from and to query parameters, formatted as 2006-01-02.
+// Repeating the request after it's interrupted carries on where it was left.
+func (s *Service) Backfill(w http.ResponseWriter, r *http.Request) {
+	lat, long, err := s.getLatLong(r)
+	if err != nil {
+		log.Errorf("failed to get lat long from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	from, to, err := ParseDates(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		log.Errorf("failed to get dates from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	backfill, err := s.Run(r.Context(), lat, long, from, to)
+	if err != nil {
+		log.Errorf("failed to backfill: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, backfill)
+}
+
+// ParseDates parses the days of a backfill, formatted as 2006-01-02. The archive only has past days, so to must be
+// before today.
+func ParseDates(from, to string) (time.Time, time.Time, error) {
+	fromDate, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to parse from: %w", err)
+	}
+
+	toDate, err := time.Parse(time.DateOnly, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to parse to: %w", err)
+	}
+
+	if toDate.Before(fromDate) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must not be before from")
+	}
+
+	now := time.Now().UTC()
+	if !toDate.Before(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must be before today")
+	}
+
+	return fromDate, toDate, nil
+}
+
+func (s *Service) getLatLong(r *http.Request) (float64, float64, error) {
+	lat := chi.URLParam(r, "lat")
+	long := chi.URLParam(r, "long")
+
+	if lat == "" || long == "" {
+		return 0, 0, fmt.Errorf("latitude and longitude must be provided")
+	}
+
+	latFloat, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse latitude: %w", err)
+	}
+
+	longFloat, err := strconv.ParseFloat(long, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse longitude: %w", err)
+	}
+
+	return latFloat, longFloat, nil
+}
@@ -0,0 +1,288 @@
+package backfill_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/backfill"
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// MockStore keeps a single backfill and the weather data it imported, skipping hours it already has
+type MockStore struct {
+	backfill          *types.Backfill
+	hours             map[time.Time]bool
+	createdPartitions []time.Time
+	err               error
+	// saveChunkCallsLeft is how many chunks can be saved before saving fails, negative never fails
+	saveChunkCallsLeft int
+}
+
+func (m *MockStore) StartBackfill(lat, long float64, from, to time.Time) (*types.Backfill, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if m.backfill == nil {
+		m.backfill = &types.Backfill{Id: "abc123", Latitude: lat, Longitude: long, From: from, To: to, Next: from, Status: types.BackfillRunning}
+	}
+
+	backfill := *m.backfill
+
+	return &backfill, nil
+}
+
+func (m *MockStore) SaveBackfillChunk(backfill *types.Backfill, weatherDataList []*types.WeatherData, next time.Time) (*types.Backfill, error) {
+	if m.saveChunkCallsLeft == 0 {
+		return nil, fmt.Errorf("error")
+	}
+	m.saveChunkCallsLeft--
+
+	if m.hours == nil {
+		m.hours = map[time.Time]bool{}
+	}
+
+	for _, weatherData := range weatherDataList {
+		if m.hours[weatherData.CreatedAt] {
+			m.backfill.Skipped++
+			continue
+		}
+
+		m.hours[weatherData.CreatedAt] = true
+		m.backfill.Imported++
+	}
+
+	m.backfill.Next = next
+	if next.After(m.backfill.To) {
+		m.backfill.Status = types.BackfillCompleted
+	}
+
+	updated := *m.backfill
+
+	return &updated, nil
+}
+
+func (m *MockStore) CreatePartition(month time.Time) (bool, error) {
+	m.createdPartitions = append(m.createdPartitions, month)
+
+	return true, nil
+}
+
+type request struct {
+	from time.Time
+	to   time.Time
+}
+
+// MockArchiveClient returns a single observation a day at noon, recording the days requested
+type MockArchiveClient struct {
+	requests []request
+	err      error
+}
+
+func (m *MockArchiveClient) GetHistoricalWeatherData(lat, long float64, from, to time.Time) ([]*types.WeatherData, error) {
+	m.requests = append(m.requests, request{from: from, to: to})
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var weatherDataList []*types.WeatherData
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		weatherDataList = append(weatherDataList, &types.WeatherData{Latitude: lat, Longitude: long, Temperature: 3.3, Source: "openmeteo-archive", CreatedAt: day.Add(12 * time.Hour)})
+	}
+
+	return weatherDataList, nil
+}
+
+func TestRun(t *testing.T) {
+	t.Run("should import a month at a time", func(t *testing.T) {
+		store := &MockStore{saveChunkCallsLeft: -1}
+		client := &MockArchiveClient{}
+		service := backfill.NewService(store, client)
+
+		result, err := service.Run(context.Background(), 1.1, 2.2, date(2023, 1, 15), date(2023, 3, 10))
+		require.NoError(t, err)
+
+		require.Equal(t, []request{
+			{from: date(2023, 1, 15), to: date(2023, 1, 31)},
+			{from: date(2023, 2, 1), to: date(2023, 2, 28)},
+			{from: date(2023, 3, 1), to: date(2023, 3, 10)},
+		}, client.requests)
+		require.Equal(t, []time.Time{date(2023, 1, 1), date(2023, 2, 1), date(2023, 3, 1)}, store.createdPartitions)
+		require.Equal(t, types.BackfillCompleted, result.Status)
+		require.Equal(t, 17+28+10, result.Imported)
+		require.Equal(t, date(2023, 3, 11), result.Next)
+	})
+
+	t.Run("should carry on where an interrupted backfill was left", func(t *testing.T) {
+		store := &MockStore{saveChunkCallsLeft: 1}
+		client := &MockArchiveClient{}
+		service := backfill.NewService(store, client)
+
+		_, err := service.Run(context.Background(), 1.1, 2.2, date(2023, 1, 15), date(2023, 3, 10))
+		require.Error(t, err)
+		require.Equal(t, date(2023, 2, 1), store.backfill.Next)
+
+		store.saveChunkCallsLeft = -1
+		client.requests = nil
+
+		result, err := service.Run(context.Background(), 1.1, 2.2, date(2023, 1, 15), date(2023, 3, 10))
+		require.NoError(t, err)
+
+		require.Equal(t, []request{
+			{from: date(2023, 2, 1), to: date(2023, 2, 28)},
+			{from: date(2023, 3, 1), to: date(2023, 3, 10)},
+		}, client.requests)
+		require.Equal(t, types.BackfillCompleted, result.Status)
+		require.Equal(t, 17+28+10, result.Imported)
+		require.Equal(t, 0, result.Skipped)
+	})
+
+	t.Run("should not import a completed backfill again", func(t *testing.T) {
+		store := &MockStore{saveChunkCallsLeft: -1}
+		client := &MockArchiveClient{}
+		service := backfill.NewService(store, client)
+
+		_, err := service.Run(context.Background(), 1.1, 2.2, date(2023, 1, 1), date(2023, 1, 31))
+		require.NoError(t, err)
+
+		client.requests = nil
+
+		result, err := service.Run(context.Background(), 1.1, 2.2, date(2023, 1, 1), date(2023, 1, 31))
+		require.NoError(t, err)
+		require.Empty(t, client.requests)
+		require.Equal(t, 31, result.Imported)
+	})
+
+	t.Run("should stop when the context is done", func(t *testing.T) {
+		store := &MockStore{saveChunkCallsLeft: -1}
+		client := &MockArchiveClient{}
+		service := backfill.NewService(store, client)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := service.Run(ctx, 1.1, 2.2, date(2023, 1, 1), date(2023, 1, 31))
+		require.ErrorIs(t, err, context.Canceled)
+		require.Empty(t, client.requests)
+	})
+
+	t.Run("should err when the archive returns an error", func(t *testing.T) {
+		store := &MockStore{saveChunkCallsLeft: -1}
+		service := backfill.NewService(store, &MockArchiveClient{err: fmt.Errorf("error")})
+
+		result, err := service.Run(context.Background(), 1.1, 2.2, date(2023, 1, 1), date(2023, 1, 31))
+		require.Error(t, err)
+		require.Equal(t, date(2023, 1, 1), result.Next)
+	})
+}
+
+func TestParseDates(t *testing.T) {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	testCases := []struct {
+		name        string
+		from        string
+		to          string
+		shouldError bool
+	}{
+		{name: "should accept a single day", from: "2023-01-01", to: "2023-01-01"},
+		{name: "should accept days up to yesterday", from: "2023-01-01", to: yesterday},
+		{name: "should err when from is missing", to: "2023-01-01", shouldError: true},
+		{name: "should err when to is invalid", from: "2023-01-01", to: "2023-01-32", shouldError: true},
+		{name: "should err when to is before from", from: "2023-01-02", to: "2023-01-01", shouldError: true},
+		{name: "should err when to is today", from: "2023-01-01", to: today, shouldError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := backfill.ParseDates(tc.from, tc.to)
+
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	testCases := []struct {
+		name               string
+		lat                string
+		long               string
+		query              string
+		store              *MockStore
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:               "should err when lat is invalid",
+			lat:                "abc",
+			long:               "2.2",
+			query:              "?from=2023-01-01&to=2023-01-02",
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:               "should err when dates are missing",
+			lat:                "1.1",
+			long:               "2.2",
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:               "should return internal error when store returns an error",
+			lat:                "1.1",
+			long:               "2.2",
+			query:              "?from=2023-01-01&to=2023-01-02",
+			store:              &MockStore{err: fmt.Errorf("error")},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name:               "should return the completed backfill",
+			lat:                "1.1",
+			long:               "2.2",
+			query:              "?from=2023-01-01&to=2023-01-02",
+			store:              &MockStore{saveChunkCallsLeft: -1},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"from":"2023-01-01T00:00:00Z","to":"2023-01-02T00:00:00Z","next":"2023-01-03T00:00:00Z","status":"completed","imported":2,"skipped":0,"created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := backfill.NewService(tc.store, &MockArchiveClient{})
+			r := httptest.NewRequest("POST", fmt.Sprintf("/%s,%s/backfill%s", tc.lat, tc.long, tc.query), nil)
+			w := httptest.NewRecorder()
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("lat", tc.lat)
+			rctx.URLParams.Add("long", tc.long)
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			service.Backfill(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
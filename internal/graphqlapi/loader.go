@@ -0,0 +1,100 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"sync"
+)
+
+// loader loads the values of keys in batches with fetch and caches them for the rest of the request. Keys queued with
+// queue are fetched along with the first key that's loaded, so the fields of every location in a list are loaded with a
+// single query however concurrently they're resolved.
+type loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	queued  []K
+	batches map[K]*batch[K, V]
+}
+
+// batch is a single fetch, loading a key waits until its batch is done
+type batch[K comparable, V any] struct {
+	done   chan struct{}
+	values map[K]V
+	err    error
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		batches: map[K]*batch[K, V]{},
+	}
+}
+
+// queue adds the keys to the next batch, keys that are queued or loaded already are skipped
+func (l *loader[K, V]) queue(keys ...K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := l.batches[key]; ok {
+			continue
+		}
+
+		// Queued keys are in the next batch
+		l.batches[key] = nil
+		l.queued = append(l.queued, key)
+	}
+}
+
+// load returns the value of the key, the zero value when fetch didn't return one. The first key that's loaded fetches
+// every queued key along with it.
+func (l *loader[K, V]) load(key K) (V, error) {
+	l.mu.Lock()
+
+	b, ok := l.batches[key]
+	if b != nil {
+		l.mu.Unlock()
+		<-b.done
+
+		return b.result(key)
+	}
+
+	keys := l.queued
+	if !ok {
+		keys = append(keys, key)
+	}
+
+	b = &batch[K, V]{done: make(chan struct{})}
+	for _, k := range keys {
+		l.batches[k] = b
+	}
+	l.queued = nil
+
+	l.mu.Unlock()
+
+	b.run(l.fetch, keys)
+
+	return b.result(key)
+}
+
+// run fetches the keys, the batch is done even when fetch panics so no one waits on it forever
+func (b *batch[K, V]) run(fetch func(keys []K) (map[K]V, error), keys []K) {
+	defer close(b.done)
+
+	defer func() {
+		if r := recover(); r != nil {
+			b.err = fmt.Errorf("failed to fetch batch: %v", r)
+		}
+	}()
+
+	b.values, b.err = fetch(keys)
+}
+
+func (b *batch[K, V]) result(key K) (V, error) {
+	if b.err != nil {
+		var zero V
+		return zero, b.err
+	}
+
+	return b.values[key], nil
+}
@@ -0,0 +1,461 @@
+package graphqlapi
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/units"
+
+	"github.com/graph-gophers/graphql-go"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// resolver resolves the Query type, the store is reached through the request's loaders
+type resolver struct{}
+
+func (r *resolver) Locations(ctx context.Context, args struct {
+	First int32
+	After *string
+}) (*locationConnectionResolver, error) {
+	if args.First < 0 || args.First > MaxLocationsPageSize {
+		return nil, fmt.Errorf("first must be between 0 and %d", MaxLocationsPageSize)
+	}
+
+	var after *types.Location
+	if args.After != nil {
+		location, err := decodeLocationCursor(*args.After)
+		if err != nil {
+			return nil, err
+		}
+
+		after = &location
+	}
+
+	l := loadersFrom(ctx)
+
+	// A location more than the page is fetched to tell whether there's a next page
+	locations, err := l.store.GetLocationsPage(after, int(args.First)+1)
+	if err != nil {
+		log.Errorf("failed to get locations from store: %v", err)
+		return nil, errors.New("failed to get locations")
+	}
+
+	connection := &locationConnectionResolver{}
+
+	if len(locations) > int(args.First) {
+		locations = locations[:args.First]
+		connection.hasNextPage = true
+	}
+
+	err = l.add(locations...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, location := range locations {
+		connection.nodes = append(connection.nodes, &locationResolver{location: location, loaders: l})
+	}
+
+	if len(locations) > 0 {
+		endCursor := encodeLocationCursor(locations[len(locations)-1])
+		connection.endCursor = &endCursor
+	}
+
+	return connection, nil
+}
+
+func (r *resolver) Location(ctx context.Context, args struct {
+	Latitude  float64
+	Longitude float64
+}) (*locationResolver, error) {
+	if args.Latitude < -90 || args.Latitude > 90 {
+		return nil, errors.New("latitude must be between -90 and 90")
+	}
+
+	if args.Longitude < -180 || args.Longitude > 180 {
+		return nil, errors.New("longitude must be between -180 and 180")
+	}
+
+	// Fields of the query resolve concurrently, so locations of separate location fields are only loaded together
+	// when they're added before either is loaded
+	l := loadersFrom(ctx)
+	location := types.Location{Latitude: args.Latitude, Longitude: args.Longitude}
+
+	err := l.add(location)
+	if err != nil {
+		return nil, err
+	}
+
+	return &locationResolver{location: location, loaders: l}, nil
+}
+
+type locationResolver struct {
+	location types.Location
+	loaders  *loaders
+}
+
+func (r *locationResolver) Latitude() float64 {
+	return r.location.Latitude
+}
+
+func (r *locationResolver) Longitude() float64 {
+	return r.location.Longitude
+}
+
+func (r *locationResolver) Latest(args struct{ Units string }) (*weatherDataResolver, error) {
+	u, err := parseUnits(args.Units)
+	if err != nil {
+		return nil, err
+	}
+
+	weatherData, err := r.loaders.latest.load(r.location)
+	if err != nil {
+		log.Errorf("failed to load latest weather data: %v", err)
+		return nil, errors.New("failed to load latest weather data")
+	}
+
+	if weatherData == nil {
+		return nil, nil
+	}
+
+	return &weatherDataResolver{weatherData: units.Convert(weatherData, u)}, nil
+}
+
+func (r *locationResolver) History(args struct {
+	First int32
+	After *string
+	Units string
+}) (*weatherDataConnectionResolver, error) {
+	if args.First < 0 || args.First > MaxHistoryPageSize {
+		return nil, fmt.Errorf("first must be between 0 and %d", MaxHistoryPageSize)
+	}
+
+	u, err := parseUnits(args.Units)
+	if err != nil {
+		return nil, err
+	}
+
+	page := historyPage{limit: int(args.First)}
+	if args.After != nil {
+		after, err := decodeCursor(*args.After)
+		if err != nil {
+			return nil, err
+		}
+
+		page.afterCreatedAt = after.CreatedAt
+		page.afterId = after.Id
+	}
+
+	historyLoader, err := r.loaders.history(page)
+	if err != nil {
+		return nil, err
+	}
+
+	weatherHistory, err := historyLoader.load(r.location)
+	if err != nil {
+		log.Errorf("failed to load weather history: %v", err)
+		return nil, errors.New("failed to load weather history")
+	}
+
+	connection := &weatherDataConnectionResolver{}
+
+	// A weather data more than the page is loaded to tell whether there's a next page
+	if len(weatherHistory) > page.limit {
+		weatherHistory = weatherHistory[:page.limit]
+		connection.hasNextPage = true
+	}
+
+	for _, weatherData := range weatherHistory {
+		connection.nodes = append(connection.nodes, &weatherDataResolver{weatherData: units.Convert(weatherData, u)})
+	}
+
+	if len(weatherHistory) > 0 {
+		endCursor := encodeCursor(weatherHistory[len(weatherHistory)-1])
+		connection.endCursor = &endCursor
+	}
+
+	return connection, nil
+}
+
+func (r *locationResolver) Aggregate(args struct {
+	From  *graphql.Time
+	To    *graphql.Time
+	Units string
+}) (*aggregateResolver, error) {
+	u, err := parseUnits(args.Units)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without to the range ends at the time of the request, which every aggregate of the request shares
+	var aggregateRange aggregateRange
+	end := r.loaders.now
+	if args.To != nil {
+		aggregateRange.to = args.To.UTC()
+		end = aggregateRange.to
+	}
+
+	aggregateRange.from = end.Add(-DefaultAggregateRange)
+	if args.From != nil {
+		aggregateRange.from = args.From.UTC()
+	}
+
+	if end.Sub(aggregateRange.from) > MaxAggregateRange {
+		return nil, fmt.Errorf("aggregate range must be at most %d days", MaxAggregateRange/(24*time.Hour))
+	}
+
+	aggregateLoader, err := r.loaders.aggregate(aggregateRange)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregate, err := aggregateLoader.load(r.location)
+	if err != nil {
+		log.Errorf("failed to load weather aggregate: %v", err)
+		return nil, errors.New("failed to load weather aggregate")
+	}
+
+	if aggregate == nil {
+		aggregate = &types.WeatherAggregate{Location: r.location}
+	}
+
+	return &aggregateResolver{aggregate: aggregate, units: u}, nil
+}
+
+type weatherDataResolver struct {
+	weatherData *types.WeatherData
+}
+
+func (r *weatherDataResolver) Id() graphql.ID {
+	return graphql.ID(r.weatherData.Id)
+}
+
+func (r *weatherDataResolver) Latitude() float64 {
+	return r.weatherData.Latitude
+}
+
+func (r *weatherDataResolver) Longitude() float64 {
+	return r.weatherData.Longitude
+}
+
+func (r *weatherDataResolver) Temperature() float64 {
+	return r.weatherData.Temperature
+}
+
+func (r *weatherDataResolver) WindDirection() float64 {
+	return r.weatherData.WindDirection
+}
+
+func (r *weatherDataResolver) WindSpeed() float64 {
+	return r.weatherData.WindSpeed
+}
+
+func (r *weatherDataResolver) Source() string {
+	return r.weatherData.Source
+}
+
+func (r *weatherDataResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: r.weatherData.CreatedAt.UTC()}
+}
+
+func (r *weatherDataResolver) Units() *unitsResolver {
+	return &unitsResolver{units: r.weatherData.Units}
+}
+
+type unitsResolver struct {
+	units *types.Units
+}
+
+func (r *unitsResolver) Temperature() string {
+	return r.units.Temperature
+}
+
+func (r *unitsResolver) WindSpeed() string {
+	return r.units.WindSpeed
+}
+
+func (r *unitsResolver) WindDirection() string {
+	return r.units.WindDirection
+}
+
+type locationConnectionResolver struct {
+	nodes       []*locationResolver
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (r *locationConnectionResolver) Nodes() []*locationResolver {
+	return r.nodes
+}
+
+func (r *locationConnectionResolver) PageInfo() *pageInfoResolver {
+	return &pageInfoResolver{endCursor: r.endCursor, hasNextPage: r.hasNextPage}
+}
+
+type weatherDataConnectionResolver struct {
+	nodes       []*weatherDataResolver
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (r *weatherDataConnectionResolver) Nodes() []*weatherDataResolver {
+	return r.nodes
+}
+
+func (r *weatherDataConnectionResolver) PageInfo() *pageInfoResolver {
+	return &pageInfoResolver{endCursor: r.endCursor, hasNextPage: r.hasNextPage}
+}
+
+type pageInfoResolver struct {
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (r *pageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
+
+func (r *pageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+// aggregateResolver converts the metric readings of the aggregate into the units, averages convert like readings as
+// every conversion is a scale and an offset
+type aggregateResolver struct {
+	aggregate *types.WeatherAggregate
+	units     units.Units
+}
+
+func (r *aggregateResolver) Count() int32 {
+	return int32(r.aggregate.Count)
+}
+
+func (r *aggregateResolver) First() *graphql.Time {
+	return optionalTime(r.aggregate.First)
+}
+
+func (r *aggregateResolver) Last() *graphql.Time {
+	return optionalTime(r.aggregate.Last)
+}
+
+func (r *aggregateResolver) MinTemperature() *float64 {
+	return r.temperature(r.aggregate.MinTemperature)
+}
+
+func (r *aggregateResolver) MaxTemperature() *float64 {
+	return r.temperature(r.aggregate.MaxTemperature)
+}
+
+func (r *aggregateResolver) AvgTemperature() *float64 {
+	return r.temperature(r.aggregate.AvgTemperature)
+}
+
+func (r *aggregateResolver) AvgWindSpeed() *float64 {
+	return r.windSpeed(r.aggregate.AvgWindSpeed)
+}
+
+func (r *aggregateResolver) MaxWindSpeed() *float64 {
+	return r.windSpeed(r.aggregate.MaxWindSpeed)
+}
+
+func (r *aggregateResolver) Units() *unitsResolver {
+	return &unitsResolver{units: units.Convert(&types.WeatherData{}, r.units).Units}
+}
+
+func (r *aggregateResolver) temperature(celsius *float64) *float64 {
+	if celsius == nil {
+		return nil
+	}
+
+	temperature := units.Convert(&types.WeatherData{Temperature: *celsius}, r.units).Temperature
+
+	return &temperature
+}
+
+func (r *aggregateResolver) windSpeed(kmh *float64) *float64 {
+	if kmh == nil {
+		return nil
+	}
+
+	windSpeed := units.Convert(&types.WeatherData{WindSpeed: *kmh}, r.units).WindSpeed
+
+	return &windSpeed
+}
+
+func optionalTime(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+
+	return &graphql.Time{Time: t.UTC()}
+}
+
+// parseUnits parses a UnitSystem, its values are the unit systems of the units query parameter in upper case
+func parseUnits(unitSystem string) (units.Units, error) {
+	return units.Parse(strings.ToLower(unitSystem), "", "")
+}
+
+// encodeCursor encodes the position of weather data in its history as an opaque cursor
+func encodeCursor(weatherData *types.WeatherData) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(weatherData.CreatedAt.UnixMicro(), 10) + "-" + weatherData.Id))
+}
+
+// decodeCursor decodes a cursor encoded by encodeCursor
+func decodeCursor(cursor string) (*types.WeatherHistoryCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	createdAt, id, ok := strings.Cut(string(decoded), "-")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	micros, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	return &types.WeatherHistoryCursor{
+		CreatedAt: time.UnixMicro(micros).UTC(),
+		Id:        id,
+	}, nil
+}
+
+// encodeLocationCursor encodes the position of a location in the locations as an opaque cursor
+func encodeLocationCursor(location types.Location) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatFloat(location.Latitude, 'g', -1, 64) + "," + strconv.FormatFloat(location.Longitude, 'g', -1, 64)))
+}
+
+// decodeLocationCursor decodes a cursor encoded by encodeLocationCursor
+func decodeLocationCursor(cursor string) (types.Location, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return types.Location{}, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	latitude, longitude, ok := strings.Cut(string(decoded), ",")
+	if !ok {
+		return types.Location{}, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	lat, err := strconv.ParseFloat(latitude, 64)
+	if err != nil {
+		return types.Location{}, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	long, err := strconv.ParseFloat(longitude, 64)
+	if err != nil {
+		return types.Location{}, fmt.Errorf("invalid cursor: %s", cursor)
+	}
+
+	return types.Location{Latitude: lat, Longitude: long}, nil
+}
@@ -0,0 +1,275 @@
+// Package graphqlapi serves a GraphQL schema of locations, their latest weather data, paginated history and aggregates.
+// Nested fields are loaded in batches per request, so a query over many locations costs a query per field rather than
+// one per location.
+package graphqlapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/render"
+	"github.com/graph-gophers/graphql-go"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// Store is what the schema is resolved from, every location of a query is loaded with a single call
+type Store interface {
+	GetLocationsPage(after *types.Location, limit int) ([]types.Location, error)
+	GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error)
+	GetWeatherHistoryPages(locations []types.Location, after *types.WeatherHistoryCursor, limit int) ([]*types.WeatherData, error)
+	GetWeatherAggregates(locations []types.Location, from, to time.Time) ([]*types.WeatherAggregate, error)
+}
+
+const (
+	// DefaultLocationsPageSize is the size of a page of locations without the first argument
+	DefaultLocationsPageSize = 100
+	// MaxLocationsPageSize is the largest page of locations
+	MaxLocationsPageSize = 1000
+	// DefaultHistoryPageSize is the size of a page of history without the first argument
+	DefaultHistoryPageSize = 50
+	// MaxHistoryPageSize is the largest page of history of a location
+	MaxHistoryPageSize = 500
+	// DefaultAggregateRange is how far before to, or the time of the request without to, an aggregate starts without from
+	DefaultAggregateRange = 30 * 24 * time.Hour
+	// MaxAggregateRange is the longest range of weather data an aggregate summarises
+	MaxAggregateRange = 366 * 24 * time.Hour
+	// MaxQueryLocations is the most locations a query resolves, whether they're paged through or aliased
+	MaxQueryLocations = 1000
+	// MaxQueryLoaders is the most history pages and aggregates with different arguments a query loads, each costs a store
+	// call however many locations and aliases share them
+	MaxQueryLoaders = 10
+	// maxQueryDepth stops deeply nested queries, the schema itself is only four levels deep
+	maxQueryDepth = 10
+	// maxQueryLength stops queries that take long to parse and validate, e.g. of thousands of aliases
+	maxQueryLength = 10000
+)
+
+type Service struct {
+	store  Store
+	schema *graphql.Schema
+}
+
+func NewService(store Store) *Service {
+	return &Service{
+		store:  store,
+		schema: graphql.MustParseSchema(schema, &resolver{}, graphql.MaxDepth(maxQueryDepth), graphql.MaxQueryLength(maxQueryLength)),
+	}
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Serve executes a GraphQL query, errors of the query are returned in the response's errors as GraphQL does
+func (s *Service) Serve(w http.ResponseWriter, r *http.Request) {
+	var req request
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		log.Errorf("failed to decode graphql request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), loadersKey{}, newLoaders(s.store))
+
+	response := s.schema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+
+	render.JSON(w, r, response)
+}
+
+type loadersKey struct{}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// historyPage is the arguments of a page of history, an empty afterId starts at the newest weather data
+type historyPage struct {
+	afterCreatedAt time.Time
+	afterId        string
+	limit          int
+}
+
+// aggregateRange is the arguments of an aggregate, a zero to leaves that end open
+type aggregateRange struct {
+	from time.Time
+	to   time.Time
+}
+
+// loaders hold the batch loaders of a request. Every location the request resolves is queued in every loader, the
+// loaders of history and aggregates are per arguments as they're fetched with them. A request resolves up to
+// MaxQueryLocations locations and creates up to MaxQueryLoaders loaders of history and aggregates.
+type loaders struct {
+	store Store
+	// now is the time of the request, open ended aggregates of the request share it so they share a loader
+	now time.Time
+
+	mu         sync.Mutex
+	added      map[types.Location]bool
+	locations  []types.Location
+	latest     *loader[types.Location, *types.WeatherData]
+	histories  map[historyPage]*loader[types.Location, []*types.WeatherData]
+	aggregates map[aggregateRange]*loader[types.Location, *types.WeatherAggregate]
+}
+
+func newLoaders(store Store) *loaders {
+	l := &loaders{
+		store:      store,
+		now:        time.Now().UTC(),
+		added:      map[types.Location]bool{},
+		histories:  map[historyPage]*loader[types.Location, []*types.WeatherData]{},
+		aggregates: map[aggregateRange]*loader[types.Location, *types.WeatherAggregate]{},
+	}
+
+	l.latest = newLoader(l.fetchLatest)
+
+	return l
+}
+
+// add queues the locations in every loader, including the ones created later. It errs when the request would resolve
+// more than MaxQueryLocations locations.
+func (l *loaders) add(locations ...types.Location) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Locations resolved more than once only count once
+	var added []types.Location
+	for _, location := range locations {
+		if !l.added[location] {
+			added = append(added, location)
+		}
+	}
+
+	if len(l.locations)+len(added) > MaxQueryLocations {
+		return fmt.Errorf("query must resolve at most %d locations", MaxQueryLocations)
+	}
+
+	for _, location := range added {
+		l.added[location] = true
+	}
+	l.locations = append(l.locations, added...)
+
+	l.latest.queue(added...)
+	for _, historyLoader := range l.histories {
+		historyLoader.queue(added...)
+	}
+	for _, aggregateLoader := range l.aggregates {
+		aggregateLoader.queue(added...)
+	}
+
+	return nil
+}
+
+// checkLoaders errs when the request has as many loaders of history and aggregates as it may create
+func (l *loaders) checkLoaders() error {
+	if len(l.histories)+len(l.aggregates) >= MaxQueryLoaders {
+		return fmt.Errorf("query must load at most %d history pages and aggregates with different arguments", MaxQueryLoaders)
+	}
+
+	return nil
+}
+
+func (l *loaders) history(page historyPage) (*loader[types.Location, []*types.WeatherData], error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	historyLoader, ok := l.histories[page]
+	if !ok {
+		err := l.checkLoaders()
+		if err != nil {
+			return nil, err
+		}
+
+		historyLoader = newLoader(func(locations []types.Location) (map[types.Location][]*types.WeatherData, error) {
+			return l.fetchHistory(locations, page)
+		})
+		historyLoader.queue(l.locations...)
+		l.histories[page] = historyLoader
+	}
+
+	return historyLoader, nil
+}
+
+func (l *loaders) aggregate(aggregateRange aggregateRange) (*loader[types.Location, *types.WeatherAggregate], error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	aggregateLoader, ok := l.aggregates[aggregateRange]
+	if !ok {
+		err := l.checkLoaders()
+		if err != nil {
+			return nil, err
+		}
+
+		aggregateLoader = newLoader(func(locations []types.Location) (map[types.Location]*types.WeatherAggregate, error) {
+			return l.fetchAggregates(locations, aggregateRange)
+		})
+		aggregateLoader.queue(l.locations...)
+		l.aggregates[aggregateRange] = aggregateLoader
+	}
+
+	return aggregateLoader, nil
+}
+
+func (l *loaders) fetchLatest(locations []types.Location) (map[types.Location]*types.WeatherData, error) {
+	weatherDataList, err := l.store.GetLatestWeatherDataBatch(locations)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[types.Location]*types.WeatherData, len(weatherDataList))
+	for _, weatherData := range weatherDataList {
+		latest[types.Location{Latitude: weatherData.Latitude, Longitude: weatherData.Longitude}] = weatherData
+	}
+
+	return latest, nil
+}
+
+// fetchHistory fetches a weather data more than the page, so it's known whether there's a next page
+func (l *loaders) fetchHistory(locations []types.Location, page historyPage) (map[types.Location][]*types.WeatherData, error) {
+	var after *types.WeatherHistoryCursor
+	if page.afterId != "" {
+		after = &types.WeatherHistoryCursor{CreatedAt: page.afterCreatedAt, Id: page.afterId}
+	}
+
+	weatherDataList, err := l.store.GetWeatherHistoryPages(locations, after, page.limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	histories := make(map[types.Location][]*types.WeatherData, len(locations))
+	for _, weatherData := range weatherDataList {
+		location := types.Location{Latitude: weatherData.Latitude, Longitude: weatherData.Longitude}
+		histories[location] = append(histories[location], weatherData)
+	}
+
+	return histories, nil
+}
+
+func (l *loaders) fetchAggregates(locations []types.Location, aggregateRange aggregateRange) (map[types.Location]*types.WeatherAggregate, error) {
+	aggregateList, err := l.store.GetWeatherAggregates(locations, aggregateRange.from, aggregateRange.to)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates := make(map[types.Location]*types.WeatherAggregate, len(aggregateList))
+	for _, aggregate := range aggregateList {
+		aggregates[aggregate.Location] = aggregate
+	}
+
+	return aggregates, nil
+}
@@ -0,0 +1,467 @@
+package graphqlapi_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/graphqlapi"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+var createdAt = time.Date(2023, 10, 4, 6, 53, 38, 0, time.UTC)
+
+// MockStore keeps the history of every location newest first and counts the calls of every method
+type MockStore struct {
+	locations []types.Location
+	history   map[types.Location][]*types.WeatherData
+	err       error
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func NewMockStore() *MockStore {
+	a := types.Location{Latitude: 1.1, Longitude: 2.2}
+	b := types.Location{Latitude: 3.3, Longitude: 4.4}
+	c := types.Location{Latitude: 5.5, Longitude: 6.6}
+
+	return &MockStore{
+		locations: []types.Location{a, b, c},
+		history: map[types.Location][]*types.WeatherData{
+			a: {
+				{Id: "a3", Latitude: 1.1, Longitude: 2.2, Temperature: 30, WindDirection: 90, WindSpeed: 36, Source: "open-meteo", CreatedAt: createdAt.Add(2 * time.Hour)},
+				{Id: "a2", Latitude: 1.1, Longitude: 2.2, Temperature: 20, WindDirection: 90, WindSpeed: 18, Source: "open-meteo", CreatedAt: createdAt.Add(time.Hour)},
+				{Id: "a1", Latitude: 1.1, Longitude: 2.2, Temperature: 10, WindDirection: 90, WindSpeed: 0, Source: "open-meteo", CreatedAt: createdAt},
+			},
+			b: {
+				{Id: "b1", Latitude: 3.3, Longitude: 4.4, Temperature: 0, WindDirection: 180, WindSpeed: 10, Source: "met.no", CreatedAt: createdAt},
+			},
+		},
+		calls: map[string]int{},
+	}
+}
+
+func (m *MockStore) called(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls[method]++
+}
+
+// GetLocationsPage pages through the locations in the order they're kept
+func (m *MockStore) GetLocationsPage(after *types.Location, limit int) ([]types.Location, error) {
+	m.called("GetLocationsPage")
+
+	locations := m.locations
+	if after != nil {
+		for i, location := range locations {
+			if location == *after {
+				locations = locations[i+1:]
+				break
+			}
+		}
+	}
+
+	if len(locations) > limit {
+		locations = locations[:limit]
+	}
+
+	return locations, m.err
+}
+
+func (m *MockStore) GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error) {
+	m.called("GetLatestWeatherDataBatch")
+
+	var weatherDataList []*types.WeatherData
+	for _, location := range locations {
+		if history := m.history[location]; len(history) > 0 {
+			weatherDataList = append(weatherDataList, history[0])
+		}
+	}
+
+	return weatherDataList, m.err
+}
+
+func (m *MockStore) GetWeatherHistoryPages(locations []types.Location, after *types.WeatherHistoryCursor, limit int) ([]*types.WeatherData, error) {
+	m.called("GetWeatherHistoryPages")
+
+	var weatherDataList []*types.WeatherData
+	for _, location := range locations {
+		page := 0
+		for _, weatherData := range m.history[location] {
+			if after != nil && !weatherData.CreatedAt.Before(after.CreatedAt) {
+				continue
+			}
+
+			if page == limit {
+				break
+			}
+
+			weatherDataList = append(weatherDataList, weatherData)
+			page++
+		}
+	}
+
+	return weatherDataList, m.err
+}
+
+func (m *MockStore) GetWeatherAggregates(locations []types.Location, from, to time.Time) ([]*types.WeatherAggregate, error) {
+	m.called("GetWeatherAggregates")
+
+	var aggregates []*types.WeatherAggregate
+	for _, location := range locations {
+		aggregate := &types.WeatherAggregate{Location: location}
+
+		for _, weatherData := range m.history[location] {
+			if (!from.IsZero() && weatherData.CreatedAt.Before(from)) || (!to.IsZero() && !weatherData.CreatedAt.Before(to)) {
+				continue
+			}
+
+			// The history is newest first, the oldest weather data stands in for the readings as only conversions are checked
+			aggregate.Count++
+			aggregate.First = &weatherData.CreatedAt
+			if aggregate.Last == nil {
+				aggregate.Last = &weatherData.CreatedAt
+			}
+			aggregate.MinTemperature = &weatherData.Temperature
+			aggregate.MaxWindSpeed = &weatherData.WindSpeed
+		}
+
+		aggregates = append(aggregates, aggregate)
+	}
+
+	return aggregates, m.err
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func query(t *testing.T, service *graphqlapi.Service, q string, variables map[string]interface{}) response {
+	body, err := json.Marshal(map[string]interface{}{"query": q, "variables": variables})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+	rr := httptest.NewRecorder()
+
+	service.Serve(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var res response
+	err = json.Unmarshal(rr.Body.Bytes(), &res)
+	require.NoError(t, err)
+
+	return res
+}
+
+func TestServe(t *testing.T) {
+	t.Run("loads nested fields of every location with a single store call each", func(t *testing.T) {
+		store := NewMockStore()
+		service := graphqlapi.NewService(store)
+
+		res := query(t, service, `{
+			locations {
+				nodes {
+					latitude
+					longitude
+					latest { id temperature }
+					history(first: 2) { nodes { id } pageInfo { hasNextPage } }
+					aggregate(from: "2023-10-01T00:00:00Z", to: "2023-10-05T00:00:00Z") { count }
+				}
+			}
+		}`, nil)
+		require.Empty(t, res.Errors)
+		require.JSONEq(t, `{
+			"locations": {"nodes": [
+				{
+					"latitude": 1.1,
+					"longitude": 2.2,
+					"latest": {"id": "a3", "temperature": 30},
+					"history": {"nodes": [{"id": "a3"}, {"id": "a2"}], "pageInfo": {"hasNextPage": true}},
+					"aggregate": {"count": 3}
+				},
+				{
+					"latitude": 3.3,
+					"longitude": 4.4,
+					"latest": {"id": "b1", "temperature": 0},
+					"history": {"nodes": [{"id": "b1"}], "pageInfo": {"hasNextPage": false}},
+					"aggregate": {"count": 1}
+				},
+				{
+					"latitude": 5.5,
+					"longitude": 6.6,
+					"latest": null,
+					"history": {"nodes": [], "pageInfo": {"hasNextPage": false}},
+					"aggregate": {"count": 0}
+				}
+			]}
+		}`, string(res.Data))
+
+		require.Equal(t, map[string]int{
+			"GetLocationsPage":          1,
+			"GetLatestWeatherDataBatch": 1,
+			"GetWeatherHistoryPages":    1,
+			"GetWeatherAggregates":      1,
+		}, store.calls)
+	})
+
+	t.Run("loads fields with different arguments separately", func(t *testing.T) {
+		store := NewMockStore()
+		service := graphqlapi.NewService(store)
+
+		res := query(t, service, `{
+			locations {
+				nodes {
+					recent: aggregate(from: "2023-10-04T07:00:00Z", to: "2023-10-05T00:00:00Z") { count }
+					all: aggregate(from: "2023-10-01T00:00:00Z", to: "2023-10-05T00:00:00Z") { count }
+				}
+			}
+		}`, nil)
+		require.Empty(t, res.Errors)
+		require.JSONEq(t, `{
+			"locations": {"nodes": [
+				{"recent": {"count": 2}, "all": {"count": 3}},
+				{"recent": {"count": 0}, "all": {"count": 1}},
+				{"recent": {"count": 0}, "all": {"count": 0}}
+			]}
+		}`, string(res.Data))
+
+		require.Equal(t, 2, store.calls["GetWeatherAggregates"])
+	})
+
+	t.Run("aggregates the last 30 days without from", func(t *testing.T) {
+		store := NewMockStore()
+		a := store.locations[0]
+		store.history[a] = append([]*types.WeatherData{
+			{Id: "a4", Latitude: 1.1, Longitude: 2.2, Temperature: 40, CreatedAt: time.Now().Add(-time.Hour)},
+		}, store.history[a]...)
+		service := graphqlapi.NewService(store)
+
+		res := query(t, service, `{ location(latitude: 1.1, longitude: 2.2) { aggregate { count } } }`, nil)
+		require.Empty(t, res.Errors)
+		require.JSONEq(t, `{"location": {"aggregate": {"count": 1}}}`, string(res.Data))
+	})
+
+	t.Run("pages through locations with the end cursor", func(t *testing.T) {
+		service := graphqlapi.NewService(NewMockStore())
+
+		q := `query ($after: String) {
+			locations(first: 2, after: $after) { nodes { latitude } pageInfo { endCursor hasNextPage } }
+		}`
+
+		var page struct {
+			Locations struct {
+				Nodes []struct {
+					Latitude float64 `json:"latitude"`
+				} `json:"nodes"`
+				PageInfo struct {
+					EndCursor   *string `json:"endCursor"`
+					HasNextPage bool    `json:"hasNextPage"`
+				} `json:"pageInfo"`
+			} `json:"locations"`
+		}
+
+		res := query(t, service, q, nil)
+		require.Empty(t, res.Errors)
+		require.NoError(t, json.Unmarshal(res.Data, &page))
+		require.Len(t, page.Locations.Nodes, 2)
+		require.True(t, page.Locations.PageInfo.HasNextPage)
+		require.NotNil(t, page.Locations.PageInfo.EndCursor)
+
+		res = query(t, service, q, map[string]interface{}{"after": *page.Locations.PageInfo.EndCursor})
+		require.Empty(t, res.Errors)
+		require.NoError(t, json.Unmarshal(res.Data, &page))
+		require.Len(t, page.Locations.Nodes, 1)
+		require.Equal(t, 5.5, page.Locations.Nodes[0].Latitude)
+		require.False(t, page.Locations.PageInfo.HasNextPage)
+	})
+
+	t.Run("errs when a query resolves too many locations", func(t *testing.T) {
+		store := NewMockStore()
+		store.locations = nil
+		for i := 0; i < graphqlapi.MaxQueryLocations; i++ {
+			store.locations = append(store.locations, types.Location{Latitude: float64(i) / 100, Longitude: 0})
+		}
+		service := graphqlapi.NewService(store)
+
+		res := query(t, service, fmt.Sprintf(`{
+			locations(first: %d) { nodes { latitude } }
+			location(latitude: 89, longitude: 0) { latitude }
+		}`, graphqlapi.MaxQueryLocations), nil)
+		require.Len(t, res.Errors, 1)
+		require.Equal(t, fmt.Sprintf("query must resolve at most %d locations", graphqlapi.MaxQueryLocations), res.Errors[0].Message)
+	})
+
+	t.Run("errs when a query loads too many aggregates", func(t *testing.T) {
+		store := NewMockStore()
+		service := graphqlapi.NewService(store)
+
+		var aggregates strings.Builder
+		for i := 0; i <= graphqlapi.MaxQueryLoaders; i++ {
+			fmt.Fprintf(&aggregates, `a%d: aggregate(from: "2023-10-%02dT00:00:00Z", to: "2023-10-31T00:00:00Z") { count } `, i, i+1)
+		}
+
+		res := query(t, service, `{ location(latitude: 1.1, longitude: 2.2) { `+aggregates.String()+`} }`, nil)
+		require.Len(t, res.Errors, 1)
+		require.Equal(t, fmt.Sprintf("query must load at most %d history pages and aggregates with different arguments", graphqlapi.MaxQueryLoaders), res.Errors[0].Message)
+		require.Equal(t, graphqlapi.MaxQueryLoaders, store.calls["GetWeatherAggregates"])
+	})
+
+	t.Run("pages through history with the end cursor", func(t *testing.T) {
+		service := graphqlapi.NewService(NewMockStore())
+
+		q := `query ($after: String) {
+			location(latitude: 1.1, longitude: 2.2) {
+				history(first: 2, after: $after) { nodes { id } pageInfo { endCursor hasNextPage } }
+			}
+		}`
+
+		var page struct {
+			Location struct {
+				History struct {
+					Nodes []struct {
+						Id string `json:"id"`
+					} `json:"nodes"`
+					PageInfo struct {
+						EndCursor   *string `json:"endCursor"`
+						HasNextPage bool    `json:"hasNextPage"`
+					} `json:"pageInfo"`
+				} `json:"history"`
+			} `json:"location"`
+		}
+
+		res := query(t, service, q, nil)
+		require.Empty(t, res.Errors)
+		require.NoError(t, json.Unmarshal(res.Data, &page))
+		require.Len(t, page.Location.History.Nodes, 2)
+		require.True(t, page.Location.History.PageInfo.HasNextPage)
+		require.NotNil(t, page.Location.History.PageInfo.EndCursor)
+
+		res = query(t, service, q, map[string]interface{}{"after": *page.Location.History.PageInfo.EndCursor})
+		require.Empty(t, res.Errors)
+		require.NoError(t, json.Unmarshal(res.Data, &page))
+		require.Len(t, page.Location.History.Nodes, 1)
+		require.Equal(t, "a1", page.Location.History.Nodes[0].Id)
+		require.False(t, page.Location.History.PageInfo.HasNextPage)
+	})
+
+	t.Run("converts weather data and aggregates into units", func(t *testing.T) {
+		service := graphqlapi.NewService(NewMockStore())
+
+		res := query(t, service, `{
+			location(latitude: 1.1, longitude: 2.2) {
+				latest(units: IMPERIAL) { temperature windSpeed units { temperature windSpeed windDirection } }
+				aggregate(from: "2023-10-01T00:00:00Z", to: "2023-10-05T00:00:00Z", units: IMPERIAL) { minTemperature maxTemperature maxWindSpeed units { temperature } }
+			}
+		}`, nil)
+		require.Empty(t, res.Errors)
+		require.JSONEq(t, `{
+			"location": {
+				"latest": {
+					"temperature": 86,
+					"windSpeed": 22.37,
+					"units": {"temperature": "fahrenheit", "windSpeed": "mph", "windDirection": "degrees"}
+				},
+				"aggregate": {
+					"minTemperature": 50,
+					"maxTemperature": null,
+					"maxWindSpeed": 0,
+					"units": {"temperature": "fahrenheit"}
+				}
+			}
+		}`, string(res.Data))
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		err   string
+	}{
+		{
+			name:  "latitude out of range",
+			query: `{ location(latitude: 91, longitude: 2.2) { latitude } }`,
+			err:   "latitude must be between -90 and 90",
+		},
+		{
+			name:  "longitude out of range",
+			query: `{ location(latitude: 1.1, longitude: 181) { latitude } }`,
+			err:   "longitude must be between -180 and 180",
+		},
+		{
+			name:  "page too large",
+			query: fmt.Sprintf(`{ location(latitude: 1.1, longitude: 2.2) { history(first: %d) { nodes { id } } } }`, graphqlapi.MaxHistoryPageSize+1),
+			err:   fmt.Sprintf("first must be between 0 and %d", graphqlapi.MaxHistoryPageSize),
+		},
+		{
+			name:  "locations page too large",
+			query: fmt.Sprintf(`{ locations(first: %d) { nodes { latitude } } }`, graphqlapi.MaxLocationsPageSize+1),
+			err:   fmt.Sprintf("first must be between 0 and %d", graphqlapi.MaxLocationsPageSize),
+		},
+		{
+			name:  "invalid locations cursor",
+			query: `{ locations(after: "abc") { nodes { latitude } } }`,
+			err:   "invalid cursor: abc",
+		},
+		{
+			name:  "aggregate range too long",
+			query: `{ location(latitude: 1.1, longitude: 2.2) { aggregate(from: "2022-01-01T00:00:00Z", to: "2023-10-01T00:00:00Z") { count } } }`,
+			err:   "aggregate range must be at most 366 days",
+		},
+		{
+			name:  "query too long",
+			query: `{ location(latitude: 1.1, longitude: 2.2) { latitude } }` + strings.Repeat(" ", 10000),
+			err:   "query length 10056 exceeds the maximum allowed query length of 10000 bytes",
+		},
+		{
+			name:  "invalid cursor",
+			query: `{ location(latitude: 1.1, longitude: 2.2) { history(after: "abc") { nodes { id } } } }`,
+			err:   "invalid cursor: abc",
+		},
+		{
+			name:  "unknown field",
+			query: `{ location(latitude: 1.1, longitude: 2.2) { humidity } }`,
+			err:   `Cannot query field "humidity" on type "Location".`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := graphqlapi.NewService(NewMockStore())
+
+			res := query(t, service, tt.query, nil)
+			require.Len(t, res.Errors, 1)
+			require.Equal(t, tt.err, res.Errors[0].Message)
+		})
+	}
+
+	t.Run("store error", func(t *testing.T) {
+		store := NewMockStore()
+		store.err = fmt.Errorf("error")
+		service := graphqlapi.NewService(store)
+
+		res := query(t, service, `{ location(latitude: 1.1, longitude: 2.2) { latest { id } } }`, nil)
+		require.Len(t, res.Errors, 1)
+		require.Equal(t, "failed to load latest weather data", res.Errors[0].Message)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		service := graphqlapi.NewService(NewMockStore())
+
+		req := httptest.NewRequest("POST", "/graphql", strings.NewReader("{"))
+		rr := httptest.NewRecorder()
+
+		service.Serve(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
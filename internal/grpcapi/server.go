@@ -0,0 +1,199 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/units"
+	"go-sample-rest/internal/weatherservice"
+	weatherv1 "go-sample-rest/proto/weather/v1"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WeatherService is the business logic the gRPC WeatherService is served by, the same the /weather routes use
+type WeatherService interface {
+	LatestWeather(location types.Location) (*types.WeatherData, error)
+	StreamHistory(query weatherservice.HistoryQuery, fn func(weatherData *types.WeatherData) error) error
+	UpdateLocation(providerName string, location types.Location) (*types.WeatherData, error)
+}
+
+type Server struct {
+	weatherv1.UnimplementedWeatherServiceServer
+
+	port           int
+	weatherService WeatherService
+}
+
+func NewServer(port int, weatherService WeatherService) *Server {
+	return &Server{
+		port:           port,
+		weatherService: weatherService,
+	}
+}
+
+// Register registers the WeatherService, health checking and reflection with grpcServer
+func (s *Server) Register(grpcServer *grpc.Server) {
+	weatherv1.RegisterWeatherServiceServer(grpcServer, s)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(weatherv1.WeatherService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	reflection.Register(grpcServer)
+}
+
+// Start serves gRPC on the port until serving fails, it returns the error of the port not being listened on too
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d: %w", s.port, err)
+	}
+
+	grpcServer := grpc.NewServer()
+	s.Register(grpcServer)
+
+	log.Infof("Starting gRPC server on port %d", s.port)
+	err = grpcServer.Serve(listener)
+	if err != nil {
+		return fmt.Errorf("failed to serve gRPC: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) GetLatest(ctx context.Context, request *weatherv1.GetLatestRequest) (*weatherv1.GetLatestResponse, error) {
+	err := validateLocation(request.GetLatitude(), request.GetLongitude())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	u, err := units.Parse(request.GetUnits(), "", "")
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	weatherData, err := s.weatherService.LatestWeather(types.Location{Latitude: request.GetLatitude(), Longitude: request.GetLongitude()})
+	if errors.Is(err, weatherservice.ErrWeatherDataNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err != nil {
+		log.Errorf("failed to get latest weather data: %v", err)
+		return nil, status.Error(codes.Internal, "failed to get latest weather data")
+	}
+
+	return &weatherv1.GetLatestResponse{
+		WeatherData: toWeatherData(units.Convert(weatherData, u)),
+	}, nil
+}
+
+func (s *Server) GetHistory(request *weatherv1.GetHistoryRequest, stream weatherv1.WeatherService_GetHistoryServer) error {
+	err := validateLocation(request.GetLatitude(), request.GetLongitude())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	u, err := units.Parse(request.GetUnits(), "", "")
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	kind, err := weatherservice.ParseKind(request.GetKind())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	query := weatherservice.HistoryQuery{
+		Location: types.Location{Latitude: request.GetLatitude(), Longitude: request.GetLongitude()},
+		Kind:     kind,
+	}
+
+	err = s.weatherService.StreamHistory(query, func(weatherData *types.WeatherData) error {
+		return stream.Send(&weatherv1.GetHistoryResponse{
+			WeatherData: toWeatherData(units.Convert(weatherData, u)),
+		})
+	})
+	if err != nil {
+		// The client going away ends the stream, there's no one left to tell
+		if stream.Context().Err() != nil {
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+
+		log.Errorf("failed to stream weather history: %v", err)
+		return status.Error(codes.Internal, "failed to stream weather history")
+	}
+
+	return nil
+}
+
+func (s *Server) Update(ctx context.Context, request *weatherv1.UpdateRequest) (*weatherv1.UpdateResponse, error) {
+	err := validateLocation(request.GetLatitude(), request.GetLongitude())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	weatherData, err := s.weatherService.UpdateLocation(request.GetProvider(), types.Location{Latitude: request.GetLatitude(), Longitude: request.GetLongitude()})
+	if errors.Is(err, weatherservice.ErrUnknownProvider) {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown provider: %s", request.GetProvider())
+	}
+
+	if errors.Is(err, weatherservice.ErrWeatherDataNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	if err != nil {
+		log.Errorf("failed to update weather data: %v", err)
+		return nil, status.Error(codes.Internal, "failed to update weather data")
+	}
+
+	return &weatherv1.UpdateResponse{
+		WeatherData: toWeatherData(weatherData),
+	}, nil
+}
+
+func validateLocation(lat, long float64) error {
+	if lat < -90 || lat > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90")
+	}
+
+	if long < -180 || long > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180")
+	}
+
+	return nil
+}
+
+func toWeatherData(weatherData *types.WeatherData) *weatherv1.WeatherData {
+	message := &weatherv1.WeatherData{
+		Id:            weatherData.Id,
+		Latitude:      weatherData.Latitude,
+		Longitude:     weatherData.Longitude,
+		Temperature:   weatherData.Temperature,
+		WindDirection: weatherData.WindDirection,
+		WindSpeed:     weatherData.WindSpeed,
+		Source:        weatherData.Source,
+		CreatedAt:     timestamppb.New(weatherData.CreatedAt),
+	}
+
+	if weatherData.Units != nil {
+		message.Units = &weatherv1.Units{
+			Temperature:   weatherData.Units.Temperature,
+			WindSpeed:     weatherData.Units.WindSpeed,
+			WindDirection: weatherData.Units.WindDirection,
+		}
+	}
+
+	return message
+}
@@ -0,0 +1,284 @@
+package grpcapi_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/grpcapi"
+	"go-sample-rest/internal/provider"
+	"go-sample-rest/internal/repository/memory"
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+	weatherv1 "go-sample-rest/proto/weather/v1"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type MockWeatherDataClient struct {
+	weatherData *types.WeatherData
+}
+
+func (m *MockWeatherDataClient) GetLatestWeatherData(providerName string, lat, long float64) (*types.WeatherData, error) {
+	if providerName == "unknown" {
+		return nil, fmt.Errorf("%w: %s", provider.ErrUnknownProvider, providerName)
+	}
+
+	return m.weatherData, nil
+}
+
+func (m *MockWeatherDataClient) GetLatestWeatherDataBatch(providerName string, locations []types.Location) ([]provider.BatchResult, error) {
+	return nil, nil
+}
+
+// newClient serves the weather service over an in-memory connection, it's closed once the test is
+func newClient(t *testing.T, weatherService grpcapi.WeatherService) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+
+	grpcServer := grpc.NewServer()
+	grpcapi.NewServer(0, weatherService).Register(grpcServer)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func newWeatherService(t *testing.T, client *MockWeatherDataClient) *weatherservice.Service {
+	repo := memory.NewRepository()
+
+	for _, temperature := range []float64{10, 20} {
+		_, err := repo.SaveWeatherData(1.1, 2.2, temperature, 90, 36, "openmeteo")
+		require.NoError(t, err)
+	}
+
+	_, err := repo.SaveWeatherData(1.1, 2.2, 30, 90, 36, weatherservice.ManualSource)
+	require.NoError(t, err)
+
+	return weatherservice.NewService(client, repo)
+}
+
+func TestGetLatest(t *testing.T) {
+	t.Run("should return the latest weather data of a provider in the requested units", func(t *testing.T) {
+		client := weatherv1.NewWeatherServiceClient(newClient(t, newWeatherService(t, &MockWeatherDataClient{})))
+
+		response, err := client.GetLatest(context.Background(), &weatherv1.GetLatestRequest{
+			Latitude:  1.1,
+			Longitude: 2.2,
+			Units:     "imperial",
+		})
+		require.NoError(t, err)
+
+		weatherData := response.GetWeatherData()
+		require.Equal(t, 1.1, weatherData.GetLatitude())
+		require.Equal(t, 2.2, weatherData.GetLongitude())
+		// The observation saved after it doesn't replace it
+		require.Equal(t, 68.0, weatherData.GetTemperature())
+		require.Equal(t, 22.37, weatherData.GetWindSpeed())
+		require.Equal(t, "openmeteo", weatherData.GetSource())
+		require.Equal(t, &weatherv1.Units{Temperature: "fahrenheit", WindSpeed: "mph", WindDirection: "degrees"}, weatherData.GetUnits())
+		require.WithinDuration(t, time.Now(), weatherData.GetCreatedAt().AsTime(), time.Minute)
+	})
+
+	tests := []struct {
+		name    string
+		request *weatherv1.GetLatestRequest
+		code    codes.Code
+	}{
+		{
+			name:    "should return not found without weather data",
+			request: &weatherv1.GetLatestRequest{Latitude: 3.3, Longitude: 4.4},
+			code:    codes.NotFound,
+		},
+		{
+			name:    "should reject an out of range latitude",
+			request: &weatherv1.GetLatestRequest{Latitude: 91, Longitude: 2.2},
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "should reject an unsupported unit system",
+			request: &weatherv1.GetLatestRequest{Latitude: 1.1, Longitude: 2.2, Units: "kelvin"},
+			code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := weatherv1.NewWeatherServiceClient(newClient(t, newWeatherService(t, &MockWeatherDataClient{})))
+
+			_, err := client.GetLatest(context.Background(), tt.request)
+			require.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	tests := []struct {
+		name         string
+		request      *weatherv1.GetHistoryRequest
+		temperatures []float64
+		code         codes.Code
+	}{
+		{
+			name:         "should stream the weather history newest first",
+			request:      &weatherv1.GetHistoryRequest{Latitude: 1.1, Longitude: 2.2},
+			temperatures: []float64{30, 20, 10},
+		},
+		{
+			name:         "should only stream weather data of the requested kind",
+			request:      &weatherv1.GetHistoryRequest{Latitude: 1.1, Longitude: 2.2, Kind: string(weatherservice.KindProvider)},
+			temperatures: []float64{20, 10},
+		},
+		{
+			name:         "should convert to the requested units",
+			request:      &weatherv1.GetHistoryRequest{Latitude: 1.1, Longitude: 2.2, Units: "imperial", Kind: string(weatherservice.KindObservation)},
+			temperatures: []float64{86},
+		},
+		{
+			name:    "should stream nothing without weather data",
+			request: &weatherv1.GetHistoryRequest{Latitude: 3.3, Longitude: 4.4},
+		},
+		{
+			name:    "should reject an unsupported kind",
+			request: &weatherv1.GetHistoryRequest{Latitude: 1.1, Longitude: 2.2, Kind: "forecast"},
+			code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := weatherv1.NewWeatherServiceClient(newClient(t, newWeatherService(t, &MockWeatherDataClient{})))
+
+			stream, err := client.GetHistory(context.Background(), tt.request)
+			require.NoError(t, err)
+
+			var temperatures []float64
+			for {
+				response, err := stream.Recv()
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+					require.Equal(t, tt.code, status.Code(err))
+					return
+				}
+
+				temperatures = append(temperatures, response.GetWeatherData().GetTemperature())
+			}
+
+			require.Equal(t, codes.OK, tt.code)
+			require.Equal(t, tt.temperatures, temperatures)
+		})
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Run("should save and return the provider's latest weather data", func(t *testing.T) {
+		weatherService := newWeatherService(t, &MockWeatherDataClient{
+			weatherData: &types.WeatherData{
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   40,
+				WindDirection: 180,
+				WindSpeed:     10,
+				Source:        "metno",
+			},
+		})
+		client := weatherv1.NewWeatherServiceClient(newClient(t, weatherService))
+
+		response, err := client.Update(context.Background(), &weatherv1.UpdateRequest{Latitude: 1.1, Longitude: 2.2, Provider: "metno"})
+		require.NoError(t, err)
+		require.NotEmpty(t, response.GetWeatherData().GetId())
+		require.Equal(t, 40.0, response.GetWeatherData().GetTemperature())
+		require.Equal(t, "metno", response.GetWeatherData().GetSource())
+
+		latest, err := client.GetLatest(context.Background(), &weatherv1.GetLatestRequest{Latitude: 1.1, Longitude: 2.2})
+		require.NoError(t, err)
+		require.Equal(t, response.GetWeatherData().GetId(), latest.GetWeatherData().GetId())
+	})
+
+	tests := []struct {
+		name    string
+		request *weatherv1.UpdateRequest
+		client  *MockWeatherDataClient
+		code    codes.Code
+	}{
+		{
+			name:    "should reject an unknown provider",
+			request: &weatherv1.UpdateRequest{Latitude: 1.1, Longitude: 2.2, Provider: "unknown"},
+			client:  &MockWeatherDataClient{},
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "should return not found when the provider has no weather data",
+			request: &weatherv1.UpdateRequest{Latitude: 1.1, Longitude: 2.2},
+			client:  &MockWeatherDataClient{},
+			code:    codes.NotFound,
+		},
+		{
+			name:    "should reject an out of range longitude",
+			request: &weatherv1.UpdateRequest{Latitude: 1.1, Longitude: 181},
+			client:  &MockWeatherDataClient{},
+			code:    codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := weatherv1.NewWeatherServiceClient(newClient(t, newWeatherService(t, tt.client)))
+
+			_, err := client.Update(context.Background(), tt.request)
+			require.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestHealthAndReflection(t *testing.T) {
+	conn := newClient(t, newWeatherService(t, &MockWeatherDataClient{}))
+
+	t.Run("should report the weather service as serving", func(t *testing.T) {
+		for _, service := range []string{"", "weather.v1.WeatherService"} {
+			response, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			require.NoError(t, err)
+			require.Equal(t, healthpb.HealthCheckResponse_SERVING, response.GetStatus())
+		}
+	})
+
+	t.Run("should list the weather service", func(t *testing.T) {
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+		require.NoError(t, err)
+
+		err = stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+		require.NoError(t, err)
+
+		response, err := stream.Recv()
+		require.NoError(t, err)
+
+		var services []string
+		for _, service := range response.GetListServicesResponse().GetService() {
+			services = append(services, service.GetName())
+		}
+		require.Contains(t, services, "weather.v1.WeatherService")
+		require.Contains(t, services, "grpc.health.v1.Health")
+	})
+}
@@ -0,0 +1,338 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/units"
+	"go-sample-rest/internal/weatherservice"
+
+	"github.com/google/uuid"
+)
+
+// maxLineSize is the longest NDJSON line that can be imported
+const maxLineSize = 1024 * 1024
+
+// idNamespace namespaces the ids derived for rows without one
+var idNamespace = uuid.MustParse("5f1c7d2e-8a43-4b6e-9c0d-2e7a1b3f4c58")
+
+// record is a row of an import before it's validated, missing values are nil
+type record struct {
+	Id            string       `json:"id"`
+	Latitude      *float64     `json:"latitude"`
+	Longitude     *float64     `json:"longitude"`
+	Temperature   *float64     `json:"temperature"`
+	WindDirection *float64     `json:"wind_direction"`
+	WindSpeed     *float64     `json:"wind_speed"`
+	Source        string       `json:"source"`
+	CreatedAt     *time.Time   `json:"created_at"`
+	Units         *types.Units `json:"units"`
+}
+
+// row is a valid row, or why the row on its line is rejected
+type row struct {
+	line        int
+	weatherData *types.WeatherData
+	reason      string
+}
+
+// rowReader reads an import a row at a time, returning io.EOF after the last row.
+// An error means the rest of the import can't be read.
+type rowReader interface {
+	Next() (row, error)
+}
+
+type csvRowReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+var csvColumns = map[string]bool{
+	"id": false, "latitude": true, "longitude": true, "temperature": true, "wind_direction": true, "wind_speed": true,
+	"source": false, "created_at": true, "temperature_unit": false, "wind_speed_unit": false, "wind_direction_unit": false,
+}
+
+// newCSVRowReader reads the header row, which names the columns in any order. It has the columns of the CSV export,
+// only id, source and the units are optional.
+func newCSVRowReader(r io.Reader) (*csvRowReader, error) {
+	csvReader := csv.NewReader(r)
+	csvReader.ReuseRecord = true
+
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %v", ErrInvalidFile, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+
+		if _, ok := csvColumns[column]; !ok {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidFile, column)
+		}
+
+		if _, ok := columns[column]; ok {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidFile, column)
+		}
+
+		columns[column] = i
+	}
+
+	for column, required := range csvColumns {
+		if _, ok := columns[column]; required && !ok {
+			return nil, fmt.Errorf("%w: missing column %q", ErrInvalidFile, column)
+		}
+	}
+
+	return &csvRowReader{r: csvReader, columns: columns}, nil
+}
+
+func (c *csvRowReader) Next() (row, error) {
+	values, err := c.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return row{line: parseErr.StartLine, reason: parseErr.Err.Error()}, nil
+		}
+
+		return row{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+
+	rec, err := c.record(values)
+	if err != nil {
+		return row{line: line, reason: err.Error()}, nil
+	}
+
+	return validate(line, rec), nil
+}
+
+func (c *csvRowReader) record(values []string) (*record, error) {
+	value := func(column string) string {
+		i, ok := c.columns[column]
+		if !ok {
+			return ""
+		}
+
+		return strings.TrimSpace(values[i])
+	}
+
+	var rec record
+	var err error
+
+	rec.Id = value("id")
+	rec.Source = value("source")
+
+	floats := []struct {
+		column string
+		dest   **float64
+	}{
+		{"latitude", &rec.Latitude},
+		{"longitude", &rec.Longitude},
+		{"temperature", &rec.Temperature},
+		{"wind_direction", &rec.WindDirection},
+		{"wind_speed", &rec.WindSpeed},
+	}
+
+	for _, f := range floats {
+		*f.dest, err = parseFloat(f.column, value(f.column))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if createdAt := value("created_at"); createdAt != "" {
+		t, err := time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid created_at: %q is not an RFC 3339 timestamp", createdAt)
+		}
+
+		rec.CreatedAt = &t
+	}
+
+	temperatureUnit, windSpeedUnit, windDirectionUnit := value("temperature_unit"), value("wind_speed_unit"), value("wind_direction_unit")
+	if temperatureUnit != "" || windSpeedUnit != "" || windDirectionUnit != "" {
+		rec.Units = &types.Units{Temperature: temperatureUnit, WindSpeed: windSpeedUnit, WindDirection: windDirectionUnit}
+	}
+
+	return &rec, nil
+}
+
+func parseFloat(column, value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %q is not a number", column, value)
+	}
+
+	return &f, nil
+}
+
+type ndjsonRowReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONRowReader(r io.Reader) *ndjsonRowReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	return &ndjsonRowReader{scanner: scanner}
+}
+
+func (n *ndjsonRowReader) Next() (row, error) {
+	for n.scanner.Scan() {
+		n.line++
+
+		line := bytes.TrimSpace(n.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+
+		var rec record
+		err := decoder.Decode(&rec)
+		if err != nil {
+			return row{line: n.line, reason: fmt.Sprintf("invalid JSON: %v", err)}, nil
+		}
+
+		if decoder.More() {
+			return row{line: n.line, reason: "invalid JSON: more than one value on the line"}, nil
+		}
+
+		return validate(n.line, &rec), nil
+	}
+
+	err := n.scanner.Err()
+	if errors.Is(err, bufio.ErrTooLong) {
+		return row{}, fmt.Errorf("%w: line %d is longer than %d bytes", ErrInvalidFile, n.line+1, maxLineSize)
+	}
+
+	if err != nil {
+		return row{}, err
+	}
+
+	return row{}, io.EOF
+}
+
+// validate checks a record against the weather data schema. Weather data is stored in metric units,
+// so units other than metric are rejected rather than guessed.
+func validate(line int, rec *record) row {
+	reject := func(format string, a ...any) row {
+		return row{line: line, reason: fmt.Sprintf(format, a...)}
+	}
+
+	required := []struct {
+		field string
+		value *float64
+	}{
+		{"latitude", rec.Latitude},
+		{"longitude", rec.Longitude},
+		{"temperature", rec.Temperature},
+		{"wind_direction", rec.WindDirection},
+		{"wind_speed", rec.WindSpeed},
+	}
+
+	for _, r := range required {
+		if r.value == nil {
+			return reject("%s is required", r.field)
+		}
+
+		if math.IsNaN(*r.value) || math.IsInf(*r.value, 0) {
+			return reject("%s must be a finite number", r.field)
+		}
+	}
+
+	if rec.CreatedAt == nil {
+		return reject("created_at is required")
+	}
+
+	if *rec.Latitude < -90 || *rec.Latitude > 90 {
+		return reject("latitude must be between -90 and 90, got %v", *rec.Latitude)
+	}
+
+	if *rec.Longitude < -180 || *rec.Longitude > 180 {
+		return reject("longitude must be between -180 and 180, got %v", *rec.Longitude)
+	}
+
+	if *rec.WindDirection < 0 || *rec.WindDirection > 360 {
+		return reject("wind_direction must be between 0 and 360, got %v", *rec.WindDirection)
+	}
+
+	if *rec.WindSpeed < 0 {
+		return reject("wind_speed must not be negative, got %v", *rec.WindSpeed)
+	}
+
+	// Observations are submitted to /observations, imported rows would be mistaken for them
+	if weatherservice.IsObservationSource(rec.Source) {
+		return reject("source %q is reserved for observations", rec.Source)
+	}
+
+	if rec.CreatedAt.After(time.Now()) {
+		return reject("created_at must not be in the future, got %s", rec.CreatedAt.Format(time.RFC3339))
+	}
+
+	if rec.Units != nil {
+		if rec.Units.Temperature != "" && rec.Units.Temperature != string(units.Metric.Temperature) {
+			return reject("temperature must be in %s, got %s", units.Metric.Temperature, rec.Units.Temperature)
+		}
+
+		if rec.Units.WindSpeed != "" && rec.Units.WindSpeed != string(units.Metric.WindSpeed) {
+			return reject("wind_speed must be in %s, got %s", units.Metric.WindSpeed, rec.Units.WindSpeed)
+		}
+
+		if rec.Units.WindDirection != "" && rec.Units.WindDirection != units.WindDirectionDegrees {
+			return reject("wind_direction must be in %s, got %s", units.WindDirectionDegrees, rec.Units.WindDirection)
+		}
+	}
+
+	weatherData := &types.WeatherData{
+		Id:            rec.Id,
+		Latitude:      *rec.Latitude,
+		Longitude:     *rec.Longitude,
+		Temperature:   *rec.Temperature,
+		WindDirection: *rec.WindDirection,
+		WindSpeed:     *rec.WindSpeed,
+		Source:        rec.Source,
+		CreatedAt:     rec.CreatedAt.UTC(),
+	}
+
+	if weatherData.Source == "" {
+		weatherData.Source = SourceName
+	}
+
+	if weatherData.Id == "" {
+		weatherData.Id = deriveId(weatherData)
+	}
+
+	return row{line: line, weatherData: weatherData}
+}
+
+// deriveId derives the id of a row without one from its location, time and source, so importing the row again gives
+// it the same id and it's skipped
+func deriveId(weatherData *types.WeatherData) string {
+	name := fmt.Sprintf("%s,%s,%s,%s",
+		strconv.FormatFloat(weatherData.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(weatherData.Longitude, 'f', -1, 64),
+		weatherData.CreatedAt.Format(time.RFC3339Nano),
+		weatherData.Source,
+	)
+
+	return uuid.NewSHA1(idNamespace, []byte(name)).String()
+}
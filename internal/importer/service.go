@@ -0,0 +1,199 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SourceName is the source of imported weather data that doesn't have one
+const SourceName = "import"
+
+// Formats an import can be in
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// BatchSize is how many valid rows are saved at a time
+const BatchSize = 1000
+
+// MaxReportedRejections is how many rejected rows are listed in a report, the rest are only counted
+const MaxReportedRejections = 1000
+
+// ErrInvalidFile is returned when an import can't be read at all, e.g. the CSV header is missing a column
+var ErrInvalidFile = errors.New("invalid import file")
+
+type Store interface {
+	ImportWeatherData(weatherDataList []*types.WeatherData) (int, error)
+	CreatePartition(month time.Time) (bool, error)
+}
+
+// Service imports weather data from CSV or NDJSON a batch at a time, reporting the rows it rejected and why
+type Service struct {
+	store Store
+}
+
+func NewService(store Store) *Service {
+	return &Service{
+		store: store,
+	}
+}
+
+// Import validates and saves every row of r, which is in the given format. Batches saved before an error are kept,
+// the report counts them.
+func (s *Service) Import(format string, r io.Reader) (*types.ImportReport, error) {
+	var rows rowReader
+	switch format {
+	case FormatCSV:
+		csvRows, err := newCSVRowReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		rows = csvRows
+	case FormatNDJSON:
+		rows = newNDJSONRowReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	report := &types.ImportReport{Rejections: []types.ImportRejection{}}
+	batch := make([]*types.WeatherData, 0, BatchSize)
+	partitions := map[time.Time]bool{}
+
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return report, fmt.Errorf("failed to read import: %w", err)
+		}
+
+		if row.weatherData == nil {
+			report.Rejected++
+			if len(report.Rejections) < MaxReportedRejections {
+				report.Rejections = append(report.Rejections, types.ImportRejection{Line: row.line, Reason: row.reason})
+			}
+
+			continue
+		}
+
+		batch = append(batch, row.weatherData)
+		if len(batch) < BatchSize {
+			continue
+		}
+
+		err = s.saveBatch(report, batch, partitions)
+		if err != nil {
+			return report, err
+		}
+
+		batch = batch[:0]
+	}
+
+	if len(batch) > 0 {
+		err := s.saveBatch(report, batch, partitions)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// saveBatch creates the monthly partitions of the batch's weather data that weren't created during this import yet,
+// so old weather data doesn't pile up in the default partition
+func (s *Service) saveBatch(report *types.ImportReport, batch []*types.WeatherData, partitions map[time.Time]bool) error {
+	for _, weatherData := range batch {
+		month := time.Date(weatherData.CreatedAt.Year(), weatherData.CreatedAt.Month(), 1, 0, 0, 0, 0, time.UTC)
+		if partitions[month] {
+			continue
+		}
+
+		_, err := s.store.CreatePartition(month)
+		if err != nil {
+			return fmt.Errorf("failed to create partition for %s: %w", month.Format("2006-01"), err)
+		}
+
+		partitions[month] = true
+	}
+
+	imported, err := s.store.ImportWeatherData(batch)
+	if err != nil {
+		return fmt.Errorf("failed to import weather data: %w", err)
+	}
+
+	report.Accepted += imported
+	report.Skipped += len(batch) - imported
+
+	return nil
+}
+
+// ImportWeather imports the request body, the format is picked from the format query parameter (csv or ndjson),
+// then the Content-Type header (text/csv or application/x-ndjson)
+func (s *Service) ImportWeather(w http.ResponseWriter, r *http.Request) {
+	format, err := s.getFormat(r)
+	if err != nil {
+		log.Errorf("failed to get format from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	report, err := s.Import(format, r.Body)
+	if errors.Is(err, ErrInvalidFile) {
+		log.Errorf("failed to import weather data: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		// Batches saved so far are kept, importing the file again skips them
+		if report != nil {
+			log.Errorf("failed to import weather data after %d accepted rows: %v", report.Accepted, err)
+		} else {
+			log.Errorf("failed to import weather data: %v", err)
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, report)
+}
+
+func (s *Service) getFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format != "" {
+		if format != FormatCSV && format != FormatNDJSON {
+			return "", fmt.Errorf("unsupported format: %s", format)
+		}
+
+		return format, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse content type: %w", err)
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV, nil
+	case "application/x-ndjson":
+		return FormatNDJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported content type: %s", mediaType)
+	}
+}
@@ -0,0 +1,305 @@
+package importer_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/importer"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+// MockStore saves weather data by id, skipping ids it already has
+type MockStore struct {
+	saved             map[string]*types.WeatherData
+	batches           int
+	createdPartitions []time.Time
+	err               error
+}
+
+func (m *MockStore) ImportWeatherData(weatherDataList []*types.WeatherData) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+
+	if m.saved == nil {
+		m.saved = map[string]*types.WeatherData{}
+	}
+
+	m.batches++
+
+	imported := 0
+	for _, weatherData := range weatherDataList {
+		if _, ok := m.saved[weatherData.Id]; ok {
+			continue
+		}
+
+		m.saved[weatherData.Id] = weatherData
+		imported++
+	}
+
+	return imported, nil
+}
+
+func (m *MockStore) CreatePartition(month time.Time) (bool, error) {
+	m.createdPartitions = append(m.createdPartitions, month)
+
+	return true, nil
+}
+
+func TestImportCSV(t *testing.T) {
+	store := &MockStore{}
+	service := importer.NewService(store)
+
+	csv := strings.Join([]string{
+		"latitude,longitude,temperature,wind_direction,wind_speed,created_at,id,source",
+		"1.1,2.2,3.3,4.4,5.5,2023-10-04T06:53:38Z,a1,station",
+		"1.1,2.2,3.3,4.4,5.5,2023-10-04T08:53:38+02:00,,",
+		"1.1,2.2,abc,4.4,5.5,2023-10-04T06:53:38Z,a3,station",
+		"1.1,2.2,3.3,4.4,5.5,2023-10-04,a4,station",
+		"1.1,2.2,3.3,4.4,5.5",
+		"91,2.2,3.3,4.4,5.5,2023-10-04T06:53:38Z,a6,station",
+		"1.1,2.2,3.3,4.4,-1,2023-10-04T06:53:38Z,a7,station",
+		"1.1,2.2,3.3,4.4,5.5,,a8,station",
+		`1.1,2.2,3.3,4.4,5.5,2023-09-30T23:00:00Z,a9,"station ""north"""`,
+		"1.1,2.2,3.3,4.4,5.5,2023-10-04T06:53:38Z,a1,station",
+		"1.1,2.2,3.3,4.4,5.5,2999-01-01T00:00:00Z,a11,station",
+		"1.1,2.2,3.3,4.4,5.5,2023-10-04T06:53:38Z,a12,manual",
+		"1.1,2.2,3.3,4.4,5.5,2023-10-04T06:53:38Z,a13,sensor:roof-1",
+	}, "\n")
+
+	report, err := service.Import(importer.FormatCSV, strings.NewReader(csv))
+	require.NoError(t, err)
+
+	require.Equal(t, &types.ImportReport{
+		Accepted: 3,
+		Skipped:  1,
+		Rejected: 9,
+		Rejections: []types.ImportRejection{
+			{Line: 4, Reason: `invalid temperature: "abc" is not a number`},
+			{Line: 5, Reason: `invalid created_at: "2023-10-04" is not an RFC 3339 timestamp`},
+			{Line: 6, Reason: "wrong number of fields"},
+			{Line: 7, Reason: "latitude must be between -90 and 90, got 91"},
+			{Line: 8, Reason: "wind_speed must not be negative, got -1"},
+			{Line: 9, Reason: "created_at is required"},
+			{Line: 12, Reason: "created_at must not be in the future, got 2999-01-01T00:00:00Z"},
+			{Line: 13, Reason: `source "manual" is reserved for observations`},
+			{Line: 14, Reason: `source "sensor:roof-1" is reserved for observations`},
+		},
+	}, report)
+
+	require.Equal(t, &types.WeatherData{
+		Id: "a1", Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindDirection: 4.4, WindSpeed: 5.5, Source: "station",
+		CreatedAt: time.Date(2023, 10, 4, 6, 53, 38, 0, time.UTC),
+	}, store.saved["a1"])
+	require.Equal(t, `station "north"`, store.saved["a9"].Source)
+
+	// Generated id and the default source, in UTC
+	for id, weatherData := range store.saved {
+		if id == "a1" || id == "a9" {
+			continue
+		}
+
+		require.NotEmpty(t, id)
+		require.Equal(t, importer.SourceName, weatherData.Source)
+		require.Equal(t, time.Date(2023, 10, 4, 6, 53, 38, 0, time.UTC), weatherData.CreatedAt)
+	}
+
+	require.ElementsMatch(t, []time.Time{
+		time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC),
+	}, store.createdPartitions)
+}
+
+func TestImportCSVExport(t *testing.T) {
+	store := &MockStore{}
+	service := importer.NewService(store)
+
+	// The CSV export can be imported as it is, as long as it's in metric units
+	csv := strings.Join([]string{
+		"id,latitude,longitude,temperature,wind_direction,wind_speed,source,created_at,temperature_unit,wind_speed_unit,wind_direction_unit",
+		"a1,1.1,2.2,3.3,5.5,4.4,openmeteo,2023-10-04T06:53:38.581587Z,celsius,kmh,degrees",
+		"a2,1.1,2.2,37.94,5.5,1.22,openmeteo,2023-10-04T17:53:38.581587+11:00,fahrenheit,ms,degrees",
+	}, "\n")
+
+	report, err := service.Import(importer.FormatCSV, strings.NewReader(csv))
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Accepted)
+	require.Equal(t, []types.ImportRejection{{Line: 3, Reason: "temperature must be in celsius, got fahrenheit"}}, report.Rejections)
+}
+
+func TestImportAgainWithoutIds(t *testing.T) {
+	store := &MockStore{}
+	service := importer.NewService(store)
+
+	ndjson := strings.Join([]string{
+		`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":4.4,"wind_speed":5.5,"created_at":"2023-10-04T06:53:38Z"}`,
+		`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":4.4,"wind_speed":5.5,"created_at":"2023-10-04T07:53:38Z"}`,
+		`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":4.4,"wind_speed":5.5,"source":"station","created_at":"2023-10-04T07:53:38Z"}`,
+	}, "\n")
+
+	report, err := service.Import(importer.FormatNDJSON, strings.NewReader(ndjson))
+	require.NoError(t, err)
+	require.Equal(t, 3, report.Accepted)
+
+	// Rows without an id are given the same id again, so they're skipped
+	report, err = service.Import(importer.FormatNDJSON, strings.NewReader(ndjson))
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Accepted)
+	require.Equal(t, 3, report.Skipped)
+	require.Len(t, store.saved, 3)
+}
+
+func TestImportCSVHeader(t *testing.T) {
+	testCases := []struct {
+		name   string
+		header string
+	}{
+		{name: "should err when the file is empty", header: ""},
+		{name: "should err when a required column is missing", header: "latitude,longitude,temperature,wind_direction,wind_speed"},
+		{name: "should err when a column is unknown", header: "latitude,longitude,temperature,wind_direction,wind_speed,created_at,humidity"},
+		{name: "should err when a column is repeated", header: "latitude,longitude,temperature,wind_direction,wind_speed,created_at,latitude"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := importer.NewService(&MockStore{})
+
+			_, err := service.Import(importer.FormatCSV, strings.NewReader(tc.header))
+			require.ErrorIs(t, err, importer.ErrInvalidFile)
+		})
+	}
+}
+
+func TestImportNDJSON(t *testing.T) {
+	store := &MockStore{}
+	service := importer.NewService(store)
+
+	ndjson := strings.Join([]string{
+		`{"id":"a1","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}`,
+		``,
+		`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"created_at":"2023-10-04T06:53:38Z"}`,
+		`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"created_at":"2023-10-04T06:53:38Z"}`,
+		`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"created_at":"2023-10-04T06:53:38Z","humidity":80}`,
+		`{"latitude":1.1,`,
+		`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":361,"wind_speed":4.4,"created_at":"2023-10-04T06:53:38Z"}`,
+		`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"created_at":"2023-10-04T06:53:38Z"} {}`,
+	}, "\n")
+
+	report, err := service.Import(importer.FormatNDJSON, strings.NewReader(ndjson))
+	require.NoError(t, err)
+
+	require.Equal(t, 2, report.Accepted)
+	require.Equal(t, 5, report.Rejected)
+	require.Equal(t, []int{4, 5, 6, 7, 8}, rejectedLines(report))
+	require.Equal(t, "wind_speed is required", report.Rejections[0].Reason)
+	require.Equal(t, `invalid JSON: json: unknown field "humidity"`, report.Rejections[1].Reason)
+	require.Equal(t, "wind_direction must be between 0 and 360, got 361", report.Rejections[3].Reason)
+	require.Equal(t, "invalid JSON: more than one value on the line", report.Rejections[4].Reason)
+	require.Equal(t, "openmeteo", store.saved["a1"].Source)
+}
+
+func TestImportBatches(t *testing.T) {
+	store := &MockStore{}
+	service := importer.NewService(store)
+
+	var lines []string
+	for i := 0; i < importer.BatchSize*2+1; i++ {
+		createdAt := time.Date(2023, 10, 4, 6, 53, i, 0, time.UTC).Format(time.RFC3339)
+		lines = append(lines, fmt.Sprintf(`{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"created_at":"%s"}`, createdAt))
+	}
+
+	// Rejections beyond the limit are only counted
+	for i := 0; i < importer.MaxReportedRejections+1; i++ {
+		lines = append(lines, `{}`)
+	}
+
+	report, err := service.Import(importer.FormatNDJSON, strings.NewReader(strings.Join(lines, "\n")))
+	require.NoError(t, err)
+	require.Equal(t, 3, store.batches)
+	require.Equal(t, importer.BatchSize*2+1, report.Accepted)
+	require.Equal(t, importer.MaxReportedRejections+1, report.Rejected)
+	require.Len(t, report.Rejections, importer.MaxReportedRejections)
+}
+
+func rejectedLines(report *types.ImportReport) []int {
+	var lines []int
+	for _, rejection := range report.Rejections {
+		lines = append(lines, rejection.Line)
+	}
+
+	return lines
+}
+
+func TestImportWeather(t *testing.T) {
+	testCases := []struct {
+		name               string
+		query              string
+		contentType        string
+		body               string
+		store              *MockStore
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:               "should err when the content type is not supported",
+			contentType:        "application/json",
+			body:               `[]`,
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusUnsupportedMediaType,
+			expectedBody:       http.StatusText(http.StatusUnsupportedMediaType),
+		},
+		{
+			name:               "should err when the csv header is invalid",
+			contentType:        "text/csv",
+			body:               "latitude,longitude",
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:               "should return internal error when store returns an error",
+			contentType:        "text/csv; charset=utf-8",
+			body:               "latitude,longitude,temperature,wind_direction,wind_speed,created_at\n1.1,2.2,3.3,4.4,5.5,2023-10-04T06:53:38Z",
+			store:              &MockStore{err: fmt.Errorf("error")},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name:               "should return the report of a csv import",
+			contentType:        "text/csv",
+			body:               "latitude,longitude,temperature,wind_direction,wind_speed,created_at\n1.1,2.2,3.3,4.4,5.5,2023-10-04T06:53:38Z\n1.1,2.2,3.3,4.4,5.5,",
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"accepted":1,"skipped":0,"rejected":1,"rejections":[{"line":3,"reason":"created_at is required"}]}`,
+		},
+		{
+			name:               "should prefer the format query parameter over the content type",
+			query:              "?format=ndjson",
+			contentType:        "text/plain",
+			body:               `{"latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":4.4,"wind_speed":5.5,"created_at":"2023-10-04T06:53:38Z"}`,
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"accepted":1,"skipped":0,"rejected":0,"rejections":[]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := importer.NewService(tc.store)
+			r := httptest.NewRequest("POST", "/import"+tc.query, strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+
+			service.ImportWeather(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
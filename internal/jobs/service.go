@@ -0,0 +1,248 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Store interface {
+	CreateUpdateJob(provider string, locations []types.Location) (*types.UpdateJob, error)
+	GetUpdateJob(id string) (*types.UpdateJob, error)
+	ClaimUpdateJob(staleBefore time.Time, maxAttempts int) (*types.UpdateJob, error)
+	SaveUpdateJobProgress(job *types.UpdateJob, results map[string]types.UpdateWeatherBatchResult) (bool, error)
+	FinishUpdateJob(job *types.UpdateJob, status, errorMessage string) (bool, error)
+}
+
+// Updater updates the weather data of a batch of locations, like weatherservice.Service
+type Updater interface {
+	UpdateLocations(provider string, locations []types.Location) (map[string]types.UpdateWeatherBatchResult, error)
+}
+
+// Providers tells whether a weather provider is registered, like provider.Registry
+type Providers interface {
+	Has(name string) bool
+}
+
+// MaxJobLocations is the most locations a single job can update
+const MaxJobLocations = 10000
+
+// Service runs update jobs in the background, jobs are processed a batch of locations at a time and their progress is
+// saved after every batch, so a job claimed again after its worker is gone carries on where it was left
+type Service struct {
+	store       Store
+	updater     Updater
+	providers   Providers
+	batchSize   int
+	maxAttempts int
+	staleAfter  time.Duration
+}
+
+// NewService creates the service, jobs are updated batchSize locations at a time and are claimed again when they
+// haven't made progress for staleAfter. A job whose batch can't be updated is left to be claimed again, until it has
+// been attempted maxAttempts times.
+func NewService(store Store, updater Updater, providers Providers, batchSize, maxAttempts int, staleAfter time.Duration) *Service {
+	return &Service{
+		store:       store,
+		updater:     updater,
+		providers:   providers,
+		batchSize:   batchSize,
+		maxAttempts: maxAttempts,
+		staleAfter:  staleAfter,
+	}
+}
+
+// Start runs the given number of workers until the context is done, idle workers check for new jobs every pollInterval
+func (s *Service) Start(ctx context.Context, workers int, pollInterval time.Duration) {
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx, pollInterval)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (s *Service) work(ctx context.Context, pollInterval time.Duration) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Jobs are processed back to back until there's none left
+		for {
+			ok, err := s.RunOnce()
+			if err != nil {
+				log.Errorf("failed to run update job: %v", err)
+			}
+
+			if !ok || err != nil || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims and processes a single job, it returns false when there was no job to claim
+func (s *Service) RunOnce() (bool, error) {
+	job, err := s.store.ClaimUpdateJob(time.Now().Add(-s.staleAfter), s.maxAttempts)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim update job: %w", err)
+	}
+
+	if job == nil {
+		return false, nil
+	}
+
+	log.Infof("running update job %s (attempt %d): %d/%d locations done", job.Id, job.Attempts, job.Completed+job.Failed, job.Total)
+
+	err = s.process(job)
+	if err != nil {
+		return true, fmt.Errorf("failed to run update job %s: %w", job.Id, err)
+	}
+
+	return true, nil
+}
+
+func (s *Service) process(job *types.UpdateJob) error {
+	// Locations are processed in order, so the ones with results are done
+	for start := job.Completed + job.Failed; start < len(job.Locations); start += s.batchSize {
+		end := min(start+s.batchSize, len(job.Locations))
+
+		results, err := s.updater.UpdateLocations(job.Provider, job.Locations[start:end])
+		if err != nil {
+			// The error may be transient, e.g. the database being unavailable, so the job stays running and is claimed
+			// again once stale, unless it's out of attempts
+			if job.Attempts < s.maxAttempts {
+				return fmt.Errorf("failed to update locations on attempt %d of %d: %w", job.Attempts, s.maxAttempts, err)
+			}
+
+			log.Errorf("update job %s failed after %d attempts: %v", job.Id, job.Attempts, err)
+
+			_, err = s.store.FinishUpdateJob(job, types.UpdateJobFailed, err.Error())
+			if err != nil {
+				return fmt.Errorf("failed to finish: %w", err)
+			}
+
+			return nil
+		}
+
+		ok, err := s.store.SaveUpdateJobProgress(job, results)
+		if err != nil {
+			return fmt.Errorf("failed to save progress: %w", err)
+		}
+
+		if !ok {
+			log.Warnf("update job %s was claimed by another worker, stopping", job.Id)
+			return nil
+		}
+	}
+
+	ok, err := s.store.FinishUpdateJob(job, types.UpdateJobCompleted, "")
+	if err != nil {
+		return fmt.Errorf("failed to finish: %w", err)
+	}
+
+	if !ok {
+		log.Warnf("update job %s was claimed by another worker, stopping", job.Id)
+	}
+
+	return nil
+}
+
+func (s *Service) CreateJob(w http.ResponseWriter, r *http.Request) {
+	locations, err := s.getLocations(r)
+	if err != nil {
+		log.Errorf("failed to get locations from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	provider := r.URL.Query().Get("provider")
+	if provider != "" && !s.providers.Has(provider) {
+		log.Errorf("unknown weather provider: %s", provider)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	job, err := s.store.CreateUpdateJob(provider, locations)
+	if err != nil {
+		log.Errorf("failed to create update job: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/%s", strings.TrimSuffix(r.URL.Path, "/"), job.Id))
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, job)
+}
+
+func (s *Service) GetJob(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	job, err := s.store.GetUpdateJob(id)
+	if err != nil {
+		log.Errorf("failed to get update job %s: %v", id, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if job == nil {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	render.JSON(w, r, job)
+}
+
+func (s *Service) getLocations(r *http.Request) ([]types.Location, error) {
+	var request types.WeatherBatchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+
+	if len(request.Locations) == 0 {
+		return nil, fmt.Errorf("at least one location must be provided")
+	}
+
+	if len(request.Locations) > MaxJobLocations {
+		return nil, fmt.Errorf("at most %d locations can be provided, got %d", MaxJobLocations, len(request.Locations))
+	}
+
+	// Results are keyed by location, so each location is only updated once
+	seen := make(map[types.Location]bool, len(request.Locations))
+	locations := make([]types.Location, 0, len(request.Locations))
+
+	for _, location := range request.Locations {
+		if seen[location] {
+			continue
+		}
+
+		seen[location] = true
+		locations = append(locations, location)
+	}
+
+	return locations, nil
+}
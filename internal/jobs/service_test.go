@@ -0,0 +1,459 @@
+package jobs_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/jobs"
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+var createdAt = time.Date(2023, 10, 4, 6, 53, 38, 581587000, time.UTC)
+
+// MockStore keeps a single job, claiming it like the Postgres store does
+type MockStore struct {
+	job         *types.UpdateJob
+	err         error
+	staleBefore time.Time
+}
+
+func (m *MockStore) CreateUpdateJob(provider string, locations []types.Location) (*types.UpdateJob, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	m.job = &types.UpdateJob{
+		Id:        "abc123",
+		Status:    types.UpdateJobQueued,
+		Provider:  provider,
+		Locations: locations,
+		Total:     len(locations),
+		Results:   map[string]types.UpdateWeatherBatchResult{},
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+	}
+
+	return m.job, nil
+}
+
+func (m *MockStore) GetUpdateJob(id string) (*types.UpdateJob, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if m.job == nil || m.job.Id != id {
+		return nil, nil
+	}
+
+	return m.job, nil
+}
+
+// ClaimUpdateJob takes every running job to be stale
+func (m *MockStore) ClaimUpdateJob(staleBefore time.Time, maxAttempts int) (*types.UpdateJob, error) {
+	m.staleBefore = staleBefore
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if m.job == nil || (m.job.Status != types.UpdateJobQueued && m.job.Status != types.UpdateJobRunning) {
+		return nil, nil
+	}
+
+	if m.job.Status == types.UpdateJobRunning && m.job.Attempts >= maxAttempts {
+		m.job.Status = types.UpdateJobFailed
+		return nil, nil
+	}
+
+	m.job.Status = types.UpdateJobRunning
+	m.job.Attempts++
+
+	job := *m.job
+
+	return &job, nil
+}
+
+func (m *MockStore) SaveUpdateJobProgress(job *types.UpdateJob, results map[string]types.UpdateWeatherBatchResult) (bool, error) {
+	if m.job.Attempts != job.Attempts || m.job.Status != types.UpdateJobRunning {
+		return false, nil
+	}
+
+	for key, result := range results {
+		m.job.Results[key] = result
+
+		if result.Error != "" {
+			m.job.Failed++
+		} else {
+			m.job.Completed++
+		}
+	}
+
+	return true, nil
+}
+
+func (m *MockStore) FinishUpdateJob(job *types.UpdateJob, status, errorMessage string) (bool, error) {
+	if m.job.Attempts != job.Attempts || m.job.Status != types.UpdateJobRunning {
+		return false, nil
+	}
+
+	m.job.Status = status
+	m.job.Error = errorMessage
+
+	return true, nil
+}
+
+// MockUpdater records the batches it's asked to update, failing the locations in failLocations
+type MockUpdater struct {
+	batches       [][]types.Location
+	failLocations map[types.Location]bool
+	err           error
+	// onUpdate is called before every batch is updated
+	onUpdate func()
+}
+
+func (m *MockUpdater) UpdateLocations(provider string, locations []types.Location) (map[string]types.UpdateWeatherBatchResult, error) {
+	m.batches = append(m.batches, locations)
+
+	if m.onUpdate != nil {
+		m.onUpdate()
+	}
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	results := map[string]types.UpdateWeatherBatchResult{}
+	for _, location := range locations {
+		key := fmt.Sprintf("%v,%v", location.Latitude, location.Longitude)
+
+		if m.failLocations[location] {
+			results[key] = types.UpdateWeatherBatchResult{Error: "failed to get weather data"}
+		} else {
+			results[key] = types.UpdateWeatherBatchResult{WeatherData: &types.WeatherData{Latitude: location.Latitude, Longitude: location.Longitude, Source: provider}}
+		}
+	}
+
+	return results, nil
+}
+
+// MockProviders has the providers that are registered
+type MockProviders map[string]bool
+
+func (m MockProviders) Has(name string) bool {
+	return m[name]
+}
+
+var providers = MockProviders{"metno": true, "openmeteo": true}
+
+func locations(n int) []types.Location {
+	var locations []types.Location
+	for i := 0; i < n; i++ {
+		locations = append(locations, types.Location{Latitude: float64(i), Longitude: float64(i)})
+	}
+
+	return locations
+}
+
+func TestRunOnce(t *testing.T) {
+	t.Run("should not run anything when there's no job", func(t *testing.T) {
+		updater := &MockUpdater{}
+		service := jobs.NewService(&MockStore{}, updater, providers, 2, 3, time.Minute)
+
+		ok, err := service.RunOnce()
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Empty(t, updater.batches)
+	})
+
+	t.Run("should update the job's locations in batches and complete it", func(t *testing.T) {
+		store := &MockStore{}
+		_, err := store.CreateUpdateJob("metno", locations(5))
+		require.NoError(t, err)
+
+		updater := &MockUpdater{failLocations: map[types.Location]bool{{Latitude: 3, Longitude: 3}: true}}
+		service := jobs.NewService(store, updater, providers, 2, 3, time.Minute)
+
+		before := time.Now()
+		ok, err := service.RunOnce()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		require.Equal(t, [][]types.Location{locations(5)[0:2], locations(5)[2:4], locations(5)[4:5]}, updater.batches)
+		require.Equal(t, types.UpdateJobCompleted, store.job.Status)
+		require.Equal(t, 4, store.job.Completed)
+		require.Equal(t, 1, store.job.Failed)
+		require.Len(t, store.job.Results, 5)
+		require.Equal(t, "metno", store.job.Results["0,0"].WeatherData.Source)
+		require.Equal(t, "failed to get weather data", store.job.Results["3,3"].Error)
+		require.WithinDuration(t, before.Add(-time.Minute), store.staleBefore, time.Second)
+	})
+
+	t.Run("should carry on where a stale job was left", func(t *testing.T) {
+		store := &MockStore{}
+		_, err := store.CreateUpdateJob("", locations(5))
+		require.NoError(t, err)
+
+		store.job.Status = types.UpdateJobRunning
+		store.job.Attempts = 1
+		store.job.Completed = 2
+		store.job.Results["0,0"] = types.UpdateWeatherBatchResult{}
+		store.job.Results["1,1"] = types.UpdateWeatherBatchResult{}
+
+		updater := &MockUpdater{}
+		service := jobs.NewService(store, updater, providers, 2, 3, time.Minute)
+
+		ok, err := service.RunOnce()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		require.Equal(t, [][]types.Location{locations(5)[2:4], locations(5)[4:5]}, updater.batches)
+		require.Equal(t, types.UpdateJobCompleted, store.job.Status)
+		require.Equal(t, 5, store.job.Completed)
+		require.Equal(t, 2, store.job.Attempts)
+	})
+
+	t.Run("should leave the job running to be claimed again when a batch can't be updated", func(t *testing.T) {
+		store := &MockStore{}
+		_, err := store.CreateUpdateJob("", locations(5))
+		require.NoError(t, err)
+
+		updater := &MockUpdater{err: fmt.Errorf("failed to save weather data")}
+		service := jobs.NewService(store, updater, providers, 2, 3, time.Minute)
+
+		ok, err := service.RunOnce()
+		require.Error(t, err)
+		require.True(t, ok)
+
+		require.Len(t, updater.batches, 1)
+		require.Equal(t, types.UpdateJobRunning, store.job.Status)
+		require.Equal(t, 1, store.job.Attempts)
+		require.Empty(t, store.job.Error)
+	})
+
+	t.Run("should fail the job when a batch can't be updated on its last attempt", func(t *testing.T) {
+		store := &MockStore{}
+		_, err := store.CreateUpdateJob("", locations(5))
+		require.NoError(t, err)
+
+		// The job was claimed twice before
+		store.job.Status = types.UpdateJobRunning
+		store.job.Attempts = 2
+
+		updater := &MockUpdater{err: fmt.Errorf("failed to save weather data")}
+		service := jobs.NewService(store, updater, providers, 2, 3, time.Minute)
+
+		ok, err := service.RunOnce()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		require.Len(t, updater.batches, 1)
+		require.Equal(t, types.UpdateJobFailed, store.job.Status)
+		require.Equal(t, 3, store.job.Attempts)
+		require.Equal(t, "failed to save weather data", store.job.Error)
+	})
+
+	t.Run("should not claim a stale job out of attempts", func(t *testing.T) {
+		store := &MockStore{}
+		_, err := store.CreateUpdateJob("", locations(5))
+		require.NoError(t, err)
+
+		store.job.Status = types.UpdateJobRunning
+		store.job.Attempts = 3
+
+		updater := &MockUpdater{}
+		service := jobs.NewService(store, updater, providers, 2, 3, time.Minute)
+
+		ok, err := service.RunOnce()
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Empty(t, updater.batches)
+		require.Equal(t, types.UpdateJobFailed, store.job.Status)
+	})
+
+	t.Run("should stop when the job is claimed by another worker", func(t *testing.T) {
+		store := &MockStore{}
+		_, err := store.CreateUpdateJob("", locations(5))
+		require.NoError(t, err)
+
+		updater := &MockUpdater{}
+		updater.onUpdate = func() {
+			// Another worker claims the job as this one is slow to make progress
+			if len(updater.batches) == 2 {
+				store.job.Attempts++
+			}
+		}
+
+		service := jobs.NewService(store, updater, providers, 2, 3, time.Minute)
+
+		ok, err := service.RunOnce()
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		require.Len(t, updater.batches, 2)
+		require.Equal(t, types.UpdateJobRunning, store.job.Status)
+		require.Equal(t, 2, store.job.Completed)
+	})
+
+	t.Run("should err when the job can't be claimed", func(t *testing.T) {
+		service := jobs.NewService(&MockStore{err: fmt.Errorf("error")}, &MockUpdater{}, providers, 2, 3, time.Minute)
+
+		ok, err := service.RunOnce()
+		require.Error(t, err)
+		require.False(t, ok)
+	})
+}
+
+func TestCreateJob(t *testing.T) {
+	testCases := []struct {
+		name               string
+		query              string
+		body               string
+		store              *MockStore
+		expectedStatusCode int
+		expectedBody       string
+		expectedLocation   string
+		expectedLocations  []types.Location
+	}{
+		{
+			name:               "should err when body is invalid",
+			body:               `{"locations":`,
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:               "should err when no locations are provided",
+			body:               `{"locations":[]}`,
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:               "should err when too many locations are provided",
+			body:               fmt.Sprintf(`{"locations":[%s{"latitude":1.1,"longitude":2.2}]}`, strings.Repeat(`{"latitude":1.1,"longitude":2.2},`, jobs.MaxJobLocations)),
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:               "should err when the provider is unknown",
+			query:              "?provider=unknown",
+			body:               `{"locations":[{"latitude":1.1,"longitude":2.2}]}`,
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:               "should return internal error when store returns an error",
+			body:               `{"locations":[{"latitude":1.1,"longitude":2.2}]}`,
+			store:              &MockStore{err: fmt.Errorf("error")},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name:               "should queue a job for the unique locations",
+			query:              "?provider=metno",
+			body:               `{"locations":[{"latitude":1.1,"longitude":2.2},{"latitude":3.3,"longitude":4.4},{"latitude":1.1,"longitude":2.2}]}`,
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusAccepted,
+			expectedBody:       `{"id":"abc123","status":"queued","provider":"metno","total":2,"completed":0,"failed":0,"results":{},"attempts":0,"created_at":"2023-10-04T06:53:38.581587Z","updated_at":"2023-10-04T06:53:38.581587Z"}`,
+			expectedLocation:   "/weather/jobs/abc123",
+			expectedLocations:  []types.Location{{Latitude: 1.1, Longitude: 2.2}, {Latitude: 3.3, Longitude: 4.4}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := jobs.NewService(tc.store, &MockUpdater{}, providers, 2, 3, time.Minute)
+			r := httptest.NewRequest("POST", fmt.Sprintf("/weather/jobs%s", tc.query), strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+
+			service.CreateJob(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+			require.Equal(t, tc.expectedLocation, w.Header().Get("Location"))
+
+			if tc.expectedLocations != nil {
+				require.Equal(t, tc.expectedLocations, tc.store.job.Locations)
+			}
+		})
+	}
+}
+
+func TestGetJob(t *testing.T) {
+	finishedAt := createdAt.Add(time.Minute)
+
+	testCases := []struct {
+		name               string
+		id                 string
+		store              *MockStore
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			name:               "should return internal error when store returns an error",
+			id:                 "abc123",
+			store:              &MockStore{err: fmt.Errorf("error")},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name:               "should return not found when the job doesn't exist",
+			id:                 "abc123",
+			store:              &MockStore{},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       http.StatusText(http.StatusNotFound),
+		},
+		{
+			name: "should return the job's progress and results",
+			id:   "abc123",
+			store: &MockStore{
+				job: &types.UpdateJob{
+					Id:        "abc123",
+					Status:    types.UpdateJobCompleted,
+					Locations: []types.Location{{Latitude: 1.1, Longitude: 2.2}, {Latitude: 3.3, Longitude: 4.4}},
+					Total:     2,
+					Completed: 1,
+					Failed:    1,
+					Results: map[string]types.UpdateWeatherBatchResult{
+						"1.1,2.2": {WeatherData: &types.WeatherData{Id: "a1", Latitude: 1.1, Longitude: 2.2, Source: "openmeteo", CreatedAt: finishedAt}},
+						"3.3,4.4": {Error: "weather data not found"},
+					},
+					Attempts:   1,
+					CreatedAt:  createdAt,
+					UpdatedAt:  finishedAt,
+					StartedAt:  &createdAt,
+					FinishedAt: &finishedAt,
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"id":"abc123","status":"completed","total":2,"completed":1,"failed":1,"results":{"1.1,2.2":{"weather_data":{"id":"a1","latitude":1.1,"longitude":2.2,"temperature":0,"wind_direction":0,"wind_speed":0,"source":"openmeteo","created_at":"2023-10-04T06:54:38.581587Z"}},"3.3,4.4":{"error":"weather data not found"}},"attempts":1,"created_at":"2023-10-04T06:53:38.581587Z","updated_at":"2023-10-04T06:54:38.581587Z","started_at":"2023-10-04T06:53:38.581587Z","finished_at":"2023-10-04T06:54:38.581587Z"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := jobs.NewService(tc.store, &MockUpdater{}, providers, 2, 3, time.Minute)
+			r := httptest.NewRequest("GET", fmt.Sprintf("/weather/jobs/%s", tc.id), nil)
+			w := httptest.NewRecorder()
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", tc.id)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			service.GetJob(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package metno
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"go-sample-rest/internal/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const ProviderName = "metno"
+
+// DefaultBaseURL is MET Norway's public API
+const DefaultBaseURL = "https://api.met.no"
+
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type Client struct {
+	httpClient HTTPClient
+	baseURL    string
+	userAgent  string
+}
+
+// NewClient creates a MET Norway locationforecast client against the given base URL, e.g. DefaultBaseURL or a proxy.
+// MET Norway requires every request to identify the application through its User-Agent.
+func NewClient(httpClient HTTPClient, baseURL string, userAgent string) *Client {
+	return &Client{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		userAgent:  userAgent,
+	}
+}
+
+func (c *Client) GetLatestWeatherData(latitude float64, longitude float64) (*types.WeatherData, error) {
+	return c.GetLatestWeatherDataContext(context.Background(), latitude, longitude)
+}
+
+// GetLatestWeatherDataContext is GetLatestWeatherData with a context, the request is cancelled with the context
+func (c *Client) GetLatestWeatherDataContext(ctx context.Context, latitude float64, longitude float64) (*types.WeatherData, error) {
+	// MET Norway rejects coordinates with more than 4 decimals
+	url := fmt.Sprintf("%s/weatherapi/locationforecast/2.0/compact?lat=%.4f&lon=%.4f", c.baseURL, latitude, longitude)
+
+	log.Infof(fmt.Sprintf("Requesting: %s", url))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request weather data: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get latest weather, response status code: %d", resp.StatusCode)
+	}
+
+	var body MetNoLocationForecastResponseBody
+
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %w", err)
+	}
+
+	if len(body.Properties.Timeseries) == 0 || len(body.Geometry.Coordinates) < 2 {
+		return nil, nil
+	}
+
+	details := body.Properties.Timeseries[0].Data.Instant.Details
+
+	return &types.WeatherData{
+		Latitude:      body.Geometry.Coordinates[1],
+		Longitude:     body.Geometry.Coordinates[0],
+		Temperature:   details.AirTemperature,
+		WindDirection: details.WindFromDirection,
+		WindSpeed:     toKilometresPerHour(details.WindSpeed),
+	}, nil
+}
+
+// toKilometresPerHour converts MET Norway's m/s wind speed into the km/h weather data is stored in
+func toKilometresPerHour(metresPerSecond float64) float64 {
+	return math.Round(metresPerSecond*36) / 10
+}
@@ -0,0 +1,177 @@
+package metno_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"go-sample-rest/internal/metno"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+var mockResponseBody = metno.MetNoLocationForecastResponseBody{
+	Geometry: metno.MetNoGeometry{
+		Coordinates: []float64{2.2, 1.1, 10},
+	},
+	Properties: metno.MetNoProperties{
+		Timeseries: []metno.MetNoTimeseries{
+			{
+				Time: "2023-10-04T06:00:00Z",
+				Data: metno.MetNoTimeseriesData{
+					Instant: metno.MetNoInstant{
+						Details: metno.MetNoInstantDetails{
+							AirTemperature:    3.3,
+							WindSpeed:         10,
+							WindFromDirection: 5.5,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+type MockHTTPClient struct {
+	do func(req *http.Request) (*http.Response, error)
+}
+
+func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	if m != nil && m.do != nil {
+		return m.do(req)
+	}
+
+	jsonBody, _ := json.Marshal(mockResponseBody)
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(bytes.NewBuffer(jsonBody)),
+	}, nil
+}
+
+func TestGetLatestWeatherData(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mockHTTPClient   *MockHTTPClient
+		shouldError      bool
+		expectedResponse *types.WeatherData
+	}{
+		{
+			name: "should return error when http client returns error",
+			mockHTTPClient: &MockHTTPClient{
+				do: func(req *http.Request) (*http.Response, error) {
+					return nil, fmt.Errorf("some error")
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "should return error when http client returns non-200 status code",
+			mockHTTPClient: &MockHTTPClient{
+				do: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusForbidden,
+						Body:       io.NopCloser(bytes.NewBuffer([]byte("some error"))),
+					}, nil
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "should return error when http client returns invalid json",
+			mockHTTPClient: &MockHTTPClient{
+				do: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(bytes.NewBuffer([]byte("invalid json"))),
+					}, nil
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "should return nil when there is no forecast for the location",
+			mockHTTPClient: &MockHTTPClient{
+				do: func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(bytes.NewBuffer([]byte(`{"geometry":{"coordinates":[2.2,1.1]},"properties":{"timeseries":[]}}`))),
+					}, nil
+				},
+			},
+			shouldError:      false,
+			expectedResponse: nil,
+		},
+		{
+			name: "should send the user agent and truncated coordinates",
+			mockHTTPClient: &MockHTTPClient{
+				do: func(req *http.Request) (*http.Response, error) {
+					if req.Header.Get("User-Agent") != "test-agent" {
+						return nil, fmt.Errorf("unexpected user agent: %s", req.Header.Get("User-Agent"))
+					}
+
+					if req.URL.Query().Get("lat") != "1.1000" || req.URL.Query().Get("lon") != "2.2000" {
+						return nil, fmt.Errorf("unexpected coordinates: %s", req.URL.RawQuery)
+					}
+
+					jsonBody, _ := json.Marshal(mockResponseBody)
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(bytes.NewBuffer(jsonBody)),
+					}, nil
+				},
+			},
+			shouldError: false,
+			expectedResponse: &types.WeatherData{
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   3.3,
+				WindSpeed:     36,
+				WindDirection: 5.5,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metNo := metno.NewClient(tc.mockHTTPClient, metno.DefaultBaseURL, "test-agent")
+
+			weatherData, err := metNo.GetLatestWeatherData(1.1, 2.2)
+
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedResponse, weatherData)
+			}
+		})
+	}
+}
+
+func TestGetLatestWeatherDataBaseURL(t *testing.T) {
+	var requestedURL string
+
+	mockHTTPClient := &MockHTTPClient{
+		do: func(req *http.Request) (*http.Response, error) {
+			requestedURL = req.URL.String()
+
+			jsonBody, _ := json.Marshal(mockResponseBody)
+
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       io.NopCloser(bytes.NewBuffer(jsonBody)),
+			}, nil
+		},
+	}
+
+	metNo := metno.NewClient(mockHTTPClient, "http://localhost:8090/", "test-agent")
+
+	_, err := metNo.GetLatestWeatherData(1.1, 2.2)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:8090/weatherapi/locationforecast/2.0/compact?lat=1.1000&lon=2.2000", requestedURL)
+}
@@ -0,0 +1,34 @@
+package metno
+
+type MetNoInstantDetails struct {
+	AirTemperature    float64 `json:"air_temperature"`
+	WindFromDirection float64 `json:"wind_from_direction"`
+	WindSpeed         float64 `json:"wind_speed"`
+}
+
+type MetNoInstant struct {
+	Details MetNoInstantDetails `json:"details"`
+}
+
+type MetNoTimeseriesData struct {
+	Instant MetNoInstant `json:"instant"`
+}
+
+type MetNoTimeseries struct {
+	Time string              `json:"time"`
+	Data MetNoTimeseriesData `json:"data"`
+}
+
+type MetNoProperties struct {
+	Timeseries []MetNoTimeseries `json:"timeseries"`
+}
+
+type MetNoGeometry struct {
+	// Coordinates are in GeoJSON order: longitude, latitude, altitude
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type MetNoLocationForecastResponseBody struct {
+	Geometry   MetNoGeometry   `json:"geometry"`
+	Properties MetNoProperties `json:"properties"`
+}
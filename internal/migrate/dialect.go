@@ -0,0 +1,84 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect holds the database specific statements of the migrator
+type Dialect struct {
+	historyTable     string
+	setupStatements  []string
+	lockStatements   []string
+	unlockStatements []string
+	placeholder      func(n int) string
+}
+
+// Postgres keeps the schema history in Flyway's flyway_schema_history table, so databases migrated
+// by Flyway are picked up where Flyway left off
+var Postgres = Dialect{
+	historyTable: `"weather"."flyway_schema_history"`,
+	setupStatements: []string{
+		`CREATE SCHEMA IF NOT EXISTS "weather"`,
+		`CREATE TABLE IF NOT EXISTS "weather"."flyway_schema_history" (
+      "installed_rank" INT NOT NULL,
+      "version" VARCHAR(50),
+      "description" VARCHAR(200) NOT NULL,
+      "type" VARCHAR(20) NOT NULL,
+      "script" VARCHAR(1000) NOT NULL,
+      "checksum" INTEGER,
+      "installed_by" VARCHAR(100) NOT NULL,
+      "installed_on" TIMESTAMP NOT NULL DEFAULT now(),
+      "execution_time" INTEGER NOT NULL,
+      "success" BOOLEAN NOT NULL,
+      CONSTRAINT "flyway_schema_history_pk" PRIMARY KEY ("installed_rank")
+    )`,
+	},
+	// Keeps replicas migrating on start from racing each other
+	lockStatements:   []string{`SELECT pg_advisory_lock(hashtext('weather.flyway_schema_history'))`},
+	unlockStatements: []string{`SELECT pg_advisory_unlock(hashtext('weather.flyway_schema_history'))`},
+	placeholder: func(n int) string {
+		return fmt.Sprintf("$%d", n)
+	},
+}
+
+// SQLite only allows a single writer, so no lock is required
+var SQLite = Dialect{
+	historyTable: `"flyway_schema_history"`,
+	setupStatements: []string{
+		`CREATE TABLE IF NOT EXISTS "flyway_schema_history" (
+      "installed_rank" INTEGER NOT NULL,
+      "version" TEXT,
+      "description" TEXT NOT NULL,
+      "type" TEXT NOT NULL,
+      "script" TEXT NOT NULL,
+      "checksum" INTEGER,
+      "installed_by" TEXT NOT NULL,
+      "installed_on" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+      "execution_time" INTEGER NOT NULL,
+      "success" BOOLEAN NOT NULL,
+      CONSTRAINT "flyway_schema_history_pk" PRIMARY KEY ("installed_rank")
+    )`,
+	},
+	placeholder: func(n int) string {
+		return "?"
+	},
+}
+
+// rebind replaces the ? placeholders of a query with the dialect's placeholders
+func (d Dialect) rebind(query string) string {
+	var b strings.Builder
+
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(d.placeholder(n))
+			continue
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,349 @@
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Migration files follow Flyway's naming: V<version>__<description>.sql applies a migration,
+// U<version>__<description>.sql undoes it
+var migrationFileRegexp = regexp.MustCompile(`^([VU])(\d+)__(.+)\.sql$`)
+
+type Migration struct {
+	Version     int
+	Description string
+	// Script is the migration's file name
+	Script string
+	Up     string
+	Down   string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied     bool
+	InstalledOn time.Time
+}
+
+type Migrator struct {
+	dbClient   *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+func NewMigrator(dbClient *sql.DB, dialect Dialect, migrationsFS fs.FS) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationsFS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		dbClient:   dbClient,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// Up applies all pending migrations in version order
+func (m *Migrator) Up() error {
+	return m.withLock(func(conn *sql.Conn) error {
+		applied, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err := m.apply(conn, migration)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Down undoes the most recently applied migration
+func (m *Migrator) Down() error {
+	return m.withLock(func(conn *sql.Conn) error {
+		applied, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			return m.undo(conn, migration)
+		}
+
+		log.Info("no migrations to undo")
+
+		return nil
+	})
+}
+
+// Status returns every known migration and whether it has been applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := m.appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			installedOn, ok := applied[migration.Version]
+
+			statuses = append(statuses, MigrationStatus{
+				Migration:   migration,
+				Applied:     ok,
+				InstalledOn: installedOn,
+			})
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+
+	// A single connection, so session level locks are held for the whole operation
+	conn, err := m.dbClient.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get db connection: %w", err)
+	}
+	defer conn.Close()
+
+	for _, statement := range m.dialect.lockStatements {
+		_, err := conn.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to lock schema history: %w", err)
+		}
+	}
+
+	defer func() {
+		for _, statement := range m.dialect.unlockStatements {
+			_, err := conn.ExecContext(ctx, statement)
+			if err != nil {
+				log.Errorf("failed to unlock schema history: %v", err)
+			}
+		}
+	}()
+
+	for _, statement := range m.dialect.setupStatements {
+		_, err := conn.ExecContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("failed to create schema history table: %w", err)
+		}
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) appliedVersions(conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), fmt.Sprintf(`
+    SELECT version, installed_on
+    FROM %s
+    WHERE type = 'SQL' AND success AND version IS NOT NULL
+  `, m.dialect.historyTable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+
+	for rows.Next() {
+		var version string
+		var installedOn time.Time
+
+		err := rows.Scan(&version, &installedOn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+
+		versionInt, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid applied migration version %s: %w", version, err)
+		}
+
+		applied[versionInt] = installedOn.UTC()
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *Migrator) apply(conn *sql.Conn, migration Migration) error {
+	ctx := context.Background()
+	start := time.Now()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %s: %w", migration.Script, err)
+	}
+
+	_, err = tx.ExecContext(ctx, migration.Up)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to apply migration %s: %w", migration.Script, err)
+	}
+
+	_, err = tx.ExecContext(ctx, m.dialect.rebind(fmt.Sprintf(`
+    INSERT INTO %s (installed_rank, version, description, type, script, checksum, installed_by, execution_time, success)
+    SELECT COALESCE(MAX(installed_rank), 0) + 1, ?, ?, 'SQL', ?, ?, ?, ?, true
+    FROM %s
+  `, m.dialect.historyTable, m.dialect.historyTable)),
+		strconv.Itoa(migration.Version),
+		migration.Description,
+		migration.Script,
+		checksum(migration.Up),
+		"go-sample-rest",
+		time.Since(start).Milliseconds(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to record migration %s: %w", migration.Script, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", migration.Script, err)
+	}
+
+	log.Infof("applied migration %s", migration.Script)
+
+	return nil
+}
+
+func (m *Migrator) undo(conn *sql.Conn, migration Migration) error {
+	if migration.Down == "" {
+		return fmt.Errorf("migration %s has no undo script", migration.Script)
+	}
+
+	ctx := context.Background()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin undoing migration %s: %w", migration.Script, err)
+	}
+
+	_, err = tx.ExecContext(ctx, migration.Down)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to undo migration %s: %w", migration.Script, err)
+	}
+
+	_, err = tx.ExecContext(ctx, m.dialect.rebind(fmt.Sprintf(`
+    DELETE FROM %s WHERE type = 'SQL' AND version = ?
+  `, m.dialect.historyTable)), strconv.Itoa(migration.Version))
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to remove migration %s from schema history: %w", migration.Script, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("failed to commit undoing migration %s: %w", migration.Script, err)
+	}
+
+	log.Infof("undid migration %s", migration.Script)
+
+	return nil
+}
+
+func loadMigrations(migrationsFS fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	migrations := map[int]*Migration{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		match := migrationFileRegexp.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.Atoi(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", entry.Name(), err)
+		}
+
+		script, err := fs.ReadFile(migrationsFS, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := migrations[version]
+		if !ok {
+			migration = &Migration{Version: version}
+			migrations[version] = migration
+		}
+
+		switch match[1] {
+		case "V":
+			migration.Description = strings.ReplaceAll(match[3], "_", " ")
+			migration.Script = entry.Name()
+			migration.Up = string(script)
+		case "U":
+			migration.Down = string(script)
+		}
+	}
+
+	var sorted []Migration
+
+	for _, migration := range migrations {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("undo migration for version %d has no migration", migration.Version)
+		}
+
+		sorted = append(sorted, *migration)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return sorted, nil
+}
+
+// checksum is computed the way Flyway computes it, a CRC32 over the script's lines without line endings
+func checksum(script string) int32 {
+	hash := crc32.NewIEEE()
+
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for scanner.Scan() {
+		hash.Write([]byte(strings.TrimPrefix(scanner.Text(), "\uFEFF")))
+	}
+
+	return int32(hash.Sum32())
+}
@@ -0,0 +1,93 @@
+package migrate_test
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"go-sample-rest/internal/migrate"
+	"go-sample-rest/internal/repository/sqlite"
+
+	"github.com/stretchr/testify/require"
+)
+
+var migrationsFS = fstest.MapFS{
+	"V1__Locations.sql":        {Data: []byte(`CREATE TABLE locations (id TEXT NOT NULL PRIMARY KEY);`)},
+	"U1__Locations.sql":        {Data: []byte(`DROP TABLE locations;`)},
+	"V2__Location_Name.sql":    {Data: []byte(`ALTER TABLE locations ADD COLUMN name TEXT;`)},
+	"U2__Location_Name.sql":    {Data: []byte(`ALTER TABLE locations DROP COLUMN name;`)},
+	"V10__LocationNameIdx.sql": {Data: []byte(`CREATE INDEX locations_name_idx ON locations(name);`)},
+	"README.md":                {Data: []byte(`not a migration`)},
+	"V11__Broken.sql.orig":     {Data: []byte(`not a migration either`)},
+	"nested/V12__Ignored.sql":  {Data: []byte(`SELECT 1;`)},
+	"V3__InsertLocation.sql":   {Data: []byte(`INSERT INTO locations (id, name) VALUES ('a', 'b');`)},
+	"U3__InsertLocation.sql":   {Data: []byte(`DELETE FROM locations WHERE id = 'a';`)},
+}
+
+func TestMigrator(t *testing.T) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "migrate.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator, err := migrate.NewMigrator(db, migrate.SQLite, migrationsFS)
+	require.NoError(t, err)
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 4)
+
+	for i, version := range []int{1, 2, 3, 10} {
+		require.Equal(t, version, statuses[i].Version)
+		require.False(t, statuses[i].Applied)
+	}
+
+	require.Equal(t, "Location Name", statuses[1].Description)
+	require.Equal(t, "V2__Location_Name.sql", statuses[1].Script)
+
+	// Applies every pending migration in version order
+	require.NoError(t, migrator.Up())
+
+	var name string
+	require.NoError(t, db.QueryRow(`SELECT name FROM locations WHERE id = 'a'`).Scan(&name))
+	require.Equal(t, "b", name)
+
+	statuses, err = migrator.Status()
+	require.NoError(t, err)
+
+	for _, status := range statuses {
+		require.True(t, status.Applied)
+		require.False(t, status.InstalledOn.IsZero())
+	}
+
+	// Applying again is a no-op
+	require.NoError(t, migrator.Up())
+
+	// The last migration has no undo script
+	require.Error(t, migrator.Down())
+
+	_, err = db.Exec(`DELETE FROM flyway_schema_history WHERE version = '10'`)
+	require.NoError(t, err)
+	_, err = db.Exec(`DROP INDEX locations_name_idx`)
+	require.NoError(t, err)
+
+	// Undoes the most recently applied migration only
+	require.NoError(t, migrator.Down())
+
+	var count int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM locations`).Scan(&count))
+	require.Equal(t, 0, count)
+
+	statuses, err = migrator.Status()
+	require.NoError(t, err)
+	require.True(t, statuses[1].Applied)
+	require.False(t, statuses[2].Applied)
+	require.False(t, statuses[3].Applied)
+}
+
+func TestNewMigratorErrorsOnUndoWithoutMigration(t *testing.T) {
+	_, err := migrate.NewMigrator(nil, migrate.SQLite, fstest.MapFS{
+		"U1__Orphan.sql": {Data: []byte(`SELECT 1;`)},
+	})
+
+	require.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package openmateo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ArchiveSourceName is the source of weather data imported from the archive
+const ArchiveSourceName = "openmeteo-archive"
+
+const DefaultArchiveBaseURL = "https://archive-api.open-meteo.com"
+
+// Archive times are requested in GMT and returned without a time zone
+const archiveTimeFormat = "2006-01-02T15:04"
+
+// ArchiveClient gets historical hourly observations from Open-Meteo's archive
+type ArchiveClient struct {
+	httpClient HTTPClient
+	baseURL    string
+}
+
+// NewArchiveClient creates an Open-Meteo archive client against the given base URL, e.g. DefaultArchiveBaseURL
+func NewArchiveClient(httpClient HTTPClient, baseURL string) *ArchiveClient {
+	return &ArchiveClient{
+		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+	}
+}
+
+// GetHistoricalWeatherData returns the hourly observations of the UTC days from and to, both included, in order.
+// Hours the archive has no data for are left out.
+func (c *ArchiveClient) GetHistoricalWeatherData(latitude, longitude float64, from, to time.Time) ([]*types.WeatherData, error) {
+	url := fmt.Sprintf(
+		"%s/v1/archive?latitude=%f&longitude=%f&start_date=%s&end_date=%s&hourly=temperature_2m,wind_speed_10m,wind_direction_10m&timezone=GMT",
+		c.baseURL, latitude, longitude, from.UTC().Format(time.DateOnly), to.UTC().Format(time.DateOnly),
+	)
+
+	log.Infof(fmt.Sprintf("Requesting: %s", url))
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request historical weather data: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get historical weather, response status code: %d", resp.StatusCode)
+	}
+
+	var body OpenMateoArchiveResponseBody
+
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %w", err)
+	}
+
+	hourly := body.Hourly
+	if len(hourly.Temperature) != len(hourly.Time) || len(hourly.WindSpeed) != len(hourly.Time) || len(hourly.WindDirection) != len(hourly.Time) {
+		return nil, fmt.Errorf("expected %d hourly values of every variable", len(hourly.Time))
+	}
+
+	weatherDataList := make([]*types.WeatherData, 0, len(hourly.Time))
+
+	for i, hour := range hourly.Time {
+		if hourly.Temperature[i] == nil || hourly.WindSpeed[i] == nil || hourly.WindDirection[i] == nil {
+			continue
+		}
+
+		createdAt, err := time.Parse(archiveTimeFormat, hour)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse time %q: %w", hour, err)
+		}
+
+		weatherDataList = append(weatherDataList, &types.WeatherData{
+			Latitude:      body.Latitude,
+			Longitude:     body.Longitude,
+			Temperature:   *hourly.Temperature[i],
+			WindDirection: *hourly.WindDirection[i],
+			WindSpeed:     *hourly.WindSpeed[i],
+			Source:        ArchiveSourceName,
+			CreatedAt:     createdAt,
+		})
+	}
+
+	return weatherDataList, nil
+}
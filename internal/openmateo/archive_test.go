@@ -0,0 +1,125 @@
+package openmateo_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/openmateo"
+	"go-sample-rest/internal/openmateo/openmateotest"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHistoricalWeatherData(t *testing.T) {
+	from := time.Date(2023, 10, 4, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 10, 5, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name             string
+		mockHTTPClient   *MockHTTPClient
+		shouldError      bool
+		expectedResponse []*types.WeatherData
+	}{
+		{
+			name: "should return error when http client returns error",
+			mockHTTPClient: &MockHTTPClient{
+				get: func(url string) (resp *http.Response, err error) {
+					return nil, fmt.Errorf("some error")
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "should return error when http client returns non-200 status code",
+			mockHTTPClient: &MockHTTPClient{
+				get: func(url string) (resp *http.Response, err error) {
+					return &http.Response{
+						StatusCode: http.StatusBadRequest,
+						Body:       io.NopCloser(bytes.NewBuffer([]byte("some error"))),
+					}, nil
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "should return error when a variable is missing hourly values",
+			mockHTTPClient: &MockHTTPClient{
+				get: func(url string) (resp *http.Response, err error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body: io.NopCloser(bytes.NewBuffer([]byte(`{
+              "latitude": 1.1, "longitude": 2.2,
+              "hourly": {"time": ["2023-10-04T00:00"], "temperature_2m": [], "wind_speed_10m": [4.4], "wind_direction_10m": [5.5]}
+            }`))),
+					}, nil
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name: "should return the hourly weather data leaving out hours without data",
+			mockHTTPClient: &MockHTTPClient{
+				get: func(url string) (resp *http.Response, err error) {
+					if url != "/v1/archive?latitude=1.100000&longitude=2.200000&start_date=2023-10-04&end_date=2023-10-05&hourly=temperature_2m,wind_speed_10m,wind_direction_10m&timezone=GMT" {
+						return nil, fmt.Errorf("unexpected url: %s", url)
+					}
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body: io.NopCloser(bytes.NewBuffer([]byte(`{
+              "latitude": 1.125, "longitude": 2.25,
+              "hourly": {
+                "time": ["2023-10-04T00:00", "2023-10-04T01:00", "2023-10-04T02:00"],
+                "temperature_2m": [3.3, null, 6.6],
+                "wind_speed_10m": [4.4, 7.7, 7.7],
+                "wind_direction_10m": [5.5, 8.8, 8.8]
+              }
+            }`))),
+					}, nil
+				},
+			},
+			expectedResponse: []*types.WeatherData{
+				{Latitude: 1.125, Longitude: 2.25, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5, Source: "openmeteo-archive", CreatedAt: from},
+				{Latitude: 1.125, Longitude: 2.25, Temperature: 6.6, WindSpeed: 7.7, WindDirection: 8.8, Source: "openmeteo-archive", CreatedAt: from.Add(2 * time.Hour)},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := openmateo.NewArchiveClient(tc.mockHTTPClient, "")
+			weatherDataList, err := client.GetHistoricalWeatherData(1.1, 2.2, from, to)
+
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedResponse, weatherDataList)
+			}
+		})
+	}
+}
+
+func TestGetHistoricalWeatherDataFromFakeServer(t *testing.T) {
+	server := openmateotest.NewServer()
+	defer server.Close()
+
+	client := openmateo.NewArchiveClient(http.DefaultClient, server.URL)
+
+	from := time.Date(2023, 10, 4, 0, 0, 0, 0, time.UTC)
+	weatherDataList, err := client.GetHistoricalWeatherData(1.1, 2.2, from, from.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Len(t, weatherDataList, 48)
+	require.Equal(t, from, weatherDataList[0].CreatedAt)
+	require.Equal(t, from.Add(47*time.Hour), weatherDataList[47].CreatedAt)
+
+	server.Enqueue(openmateotest.Response{StatusCode: http.StatusServiceUnavailable})
+
+	_, err = client.GetHistoricalWeatherData(1.1, 2.2, from, from)
+	require.Error(t, err)
+}
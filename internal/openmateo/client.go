@@ -1,35 +1,48 @@
 package openmateo
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"go-sample-rest/internal/types"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const ProviderName = "openmeteo"
+
+const DefaultBaseURL = "https://api.open-meteo.com"
+
 type HTTPClient interface {
-	Get(url string) (resp *http.Response, err error)
+	Do(req *http.Request) (*http.Response, error)
 }
 
 type Client struct {
 	httpClient HTTPClient
+	baseURL    string
 }
 
-func NewClient(httpClient HTTPClient) *Client {
+// NewClient creates an Open-Meteo client against the given base URL, e.g. DefaultBaseURL or a self-hosted instance
+func NewClient(httpClient HTTPClient, baseURL string) *Client {
 	return &Client{
 		httpClient: httpClient,
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
 	}
 }
 
 func (c *Client) GetLatestWeatherData(latitude float64, longitude float64) (*types.WeatherData, error) {
-	url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%f&longitude=%f&current_weather=true", latitude, longitude)
+	return c.GetLatestWeatherDataContext(context.Background(), latitude, longitude)
+}
 
-	log.Infof(fmt.Sprintf("Requesting: %s", url))
+// GetLatestWeatherDataContext is GetLatestWeatherData with a context, the request is cancelled with the context
+func (c *Client) GetLatestWeatherDataContext(ctx context.Context, latitude float64, longitude float64) (*types.WeatherData, error) {
+	url := fmt.Sprintf("%s/v1/forecast?latitude=%f&longitude=%f&current_weather=true", c.baseURL, latitude, longitude)
 
-	resp, err := c.httpClient.Get(url)
+	resp, err := c.get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to request weather data: %w", err)
 	}
@@ -55,3 +68,86 @@ func (c *Client) GetLatestWeatherData(latitude float64, longitude float64) (*typ
 		WindSpeed:     body.CurrentWeather.WindSpeed,
 	}, nil
 }
+
+// GetLatestWeatherDataBatch fetches the weather data of every location with a single request,
+// the weather data is returned in the same order as the locations
+func (c *Client) GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error) {
+	return c.GetLatestWeatherDataBatchContext(context.Background(), locations)
+}
+
+// GetLatestWeatherDataBatchContext is GetLatestWeatherDataBatch with a context, the request is cancelled with the context
+func (c *Client) GetLatestWeatherDataBatchContext(ctx context.Context, locations []types.Location) ([]*types.WeatherData, error) {
+	if len(locations) == 0 {
+		return nil, nil
+	}
+
+	latitudes := make([]string, 0, len(locations))
+	longitudes := make([]string, 0, len(locations))
+
+	for _, location := range locations {
+		latitudes = append(latitudes, fmt.Sprintf("%f", location.Latitude))
+		longitudes = append(longitudes, fmt.Sprintf("%f", location.Longitude))
+	}
+
+	url := fmt.Sprintf("%s/v1/forecast?latitude=%s&longitude=%s&current_weather=true", c.baseURL, strings.Join(latitudes, ","), strings.Join(longitudes, ","))
+
+	resp, err := c.get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request weather data: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get latest weather, response status code: %d", resp.StatusCode)
+	}
+
+	var rawBody json.RawMessage
+
+	err = json.NewDecoder(resp.Body).Decode(&rawBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %w", err)
+	}
+
+	// Open-Meteo responds with a list for multiple locations, but with a single forecast for one
+	var bodies []OpenMateoForecastResponseBody
+
+	if rawBody = bytes.TrimSpace(rawBody); len(rawBody) > 0 && rawBody[0] == '[' {
+		err = json.Unmarshal(rawBody, &bodies)
+	} else {
+		bodies = make([]OpenMateoForecastResponseBody, 1)
+		err = json.Unmarshal(rawBody, &bodies[0])
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %w", err)
+	}
+
+	if len(bodies) != len(locations) {
+		return nil, fmt.Errorf("expected weather data of %d locations, got %d", len(locations), len(bodies))
+	}
+
+	weatherDataList := make([]*types.WeatherData, 0, len(bodies))
+	for _, body := range bodies {
+		weatherDataList = append(weatherDataList, &types.WeatherData{
+			Latitude:      body.Latitude,
+			Longitude:     body.Longitude,
+			Temperature:   body.CurrentWeather.Temperature,
+			WindDirection: body.CurrentWeather.WindDirection,
+			WindSpeed:     body.CurrentWeather.WindSpeed,
+		})
+	}
+
+	return weatherDataList, nil
+}
+
+func (c *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	log.Infof(fmt.Sprintf("Requesting: %s", url))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.httpClient.Do(req)
+}
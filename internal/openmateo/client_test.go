@@ -7,8 +7,10 @@ import (
 	"io"
 	"net/http"
 	"testing"
+	"time"
 
 	"go-sample-rest/internal/openmateo"
+	"go-sample-rest/internal/openmateo/openmateotest"
 	"go-sample-rest/internal/types"
 
 	"github.com/stretchr/testify/require"
@@ -28,9 +30,9 @@ type MockHTTPClient struct {
 	get func(url string) (resp *http.Response, err error)
 }
 
-func (m *MockHTTPClient) Get(url string) (*http.Response, error) {
+func (m *MockHTTPClient) Do(req *http.Request) (*http.Response, error) {
 	if m != nil && m.get != nil {
-		return m.get(url)
+		return m.get(req.URL.String())
 	}
 
 	jsonBody, _ := json.Marshal(mockResponseBody)
@@ -109,7 +111,7 @@ func TestGetLatestWeatherData(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			openMateo := openmateo.NewClient(tc.mockHTTPClient)
+			openMateo := openmateo.NewClient(tc.mockHTTPClient, openmateo.DefaultBaseURL)
 
 			weatherData, err := openMateo.GetLatestWeatherData(1.1, 2.2)
 
@@ -122,3 +124,163 @@ func TestGetLatestWeatherData(t *testing.T) {
 		})
 	}
 }
+
+func TestGetLatestWeatherDataFromFakeServer(t *testing.T) {
+	testCases := []struct {
+		name             string
+		responses        []openmateotest.Response
+		shouldError      bool
+		expectedResponse *types.WeatherData
+	}{
+		{
+			name:        "should return error when server responds with an error",
+			responses:   []openmateotest.Response{{StatusCode: http.StatusServiceUnavailable}},
+			shouldError: true,
+		},
+		{
+			name:        "should return error when server responds with malformed json",
+			responses:   []openmateotest.Response{{Malformed: true}},
+			shouldError: true,
+		},
+		{
+			name:        "should return error when server responds slower than the http client timeout",
+			responses:   []openmateotest.Response{{Latency: time.Second}},
+			shouldError: true,
+		},
+		{
+			name:        "should return the deterministic forecast of the location",
+			shouldError: false,
+			expectedResponse: &types.WeatherData{
+				Latitude:      10,
+				Longitude:     20,
+				Temperature:   25,
+				WindSpeed:     2,
+				WindDirection: 200,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := openmateotest.NewServer()
+			defer server.Close()
+
+			server.Enqueue(tc.responses...)
+
+			openMateo := openmateo.NewClient(&http.Client{Timeout: 100 * time.Millisecond}, server.URL)
+
+			weatherData, err := openMateo.GetLatestWeatherData(10, 20)
+
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedResponse, weatherData)
+			}
+
+			require.Equal(t, 1, server.Requests())
+		})
+	}
+}
+
+func TestGetLatestWeatherDataBatch(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mockHTTPClient   *MockHTTPClient
+		locations        []types.Location
+		shouldError      bool
+		expectedResponse []*types.WeatherData
+	}{
+		{
+			name: "should return error when http client returns non-200 status code",
+			mockHTTPClient: &MockHTTPClient{
+				get: func(url string) (resp *http.Response, err error) {
+					return &http.Response{
+						StatusCode: http.StatusInternalServerError,
+						Body:       io.NopCloser(bytes.NewBuffer([]byte("some error"))),
+					}, nil
+				},
+			},
+			locations:   []types.Location{{Latitude: 1.1, Longitude: 2.2}, {Latitude: 3.3, Longitude: 4.4}},
+			shouldError: true,
+		},
+		{
+			name: "should return error when the number of forecasts doesn't match the locations",
+			mockHTTPClient: &MockHTTPClient{
+				get: func(url string) (resp *http.Response, err error) {
+					jsonBody, _ := json.Marshal([]openmateo.OpenMateoForecastResponseBody{mockResponseBody})
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(bytes.NewBuffer(jsonBody)),
+					}, nil
+				},
+			},
+			locations:   []types.Location{{Latitude: 1.1, Longitude: 2.2}, {Latitude: 3.3, Longitude: 4.4}},
+			shouldError: true,
+		},
+		{
+			name: "should request every location at once and return the forecasts in order",
+			mockHTTPClient: &MockHTTPClient{
+				get: func(url string) (resp *http.Response, err error) {
+					if url != "https://api.open-meteo.com/v1/forecast?latitude=1.100000,3.300000&longitude=2.200000,4.400000&current_weather=true" {
+						return nil, fmt.Errorf("unexpected url: %s", url)
+					}
+
+					second := mockResponseBody
+					second.Latitude = 3.3
+					second.Longitude = 4.4
+
+					jsonBody, _ := json.Marshal([]openmateo.OpenMateoForecastResponseBody{mockResponseBody, second})
+
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       io.NopCloser(bytes.NewBuffer(jsonBody)),
+					}, nil
+				},
+			},
+			locations: []types.Location{{Latitude: 1.1, Longitude: 2.2}, {Latitude: 3.3, Longitude: 4.4}},
+			expectedResponse: []*types.WeatherData{
+				{Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5},
+				{Latitude: 3.3, Longitude: 4.4, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5},
+			},
+		},
+		{
+			name:      "should accept the single forecast Open-Meteo responds with for one location",
+			locations: []types.Location{{Latitude: 1.1, Longitude: 2.2}},
+			expectedResponse: []*types.WeatherData{
+				{Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			openMateo := openmateo.NewClient(tc.mockHTTPClient, openmateo.DefaultBaseURL)
+
+			weatherDataList, err := openMateo.GetLatestWeatherDataBatch(tc.locations)
+
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedResponse, weatherDataList)
+			}
+		})
+	}
+}
+
+func TestGetLatestWeatherDataBatchFromFakeServer(t *testing.T) {
+	server := openmateotest.NewServer()
+	defer server.Close()
+
+	openMateo := openmateo.NewClient(&http.Client{Timeout: 100 * time.Millisecond}, server.URL)
+
+	weatherDataList, err := openMateo.GetLatestWeatherDataBatch([]types.Location{{Latitude: 10, Longitude: 20}, {Latitude: -40, Longitude: 150}})
+	require.NoError(t, err)
+	require.Equal(t, []*types.WeatherData{
+		{Latitude: 10, Longitude: 20, Temperature: 25, WindSpeed: 2, WindDirection: 200},
+		{Latitude: -40, Longitude: 150, Temperature: 10, WindSpeed: 15, WindDirection: 240},
+	}, weatherDataList)
+	require.Equal(t, 1, server.Requests())
+}
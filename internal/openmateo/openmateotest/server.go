@@ -0,0 +1,345 @@
+// Package openmateotest provides a fake Open-Meteo server with deterministic, scriptable responses
+package openmateotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-sample-rest/internal/openmateo"
+)
+
+// Response describes how the fake server answers a single request
+type Response struct {
+	// StatusCode defaults to 200
+	StatusCode int
+	Latency    time.Duration
+	// Malformed responds with a body that is not valid JSON
+	Malformed bool
+	// Body overrides the generated forecast
+	Body *openmateo.OpenMateoForecastResponseBody
+}
+
+// Handler serves Open-Meteo's forecast and archive endpoints. Scripted responses are served in order,
+// once they run out every request gets the default response.
+type Handler struct {
+	mu              sync.Mutex
+	script          []Response
+	defaultResponse Response
+	requests        int
+	mux             *http.ServeMux
+}
+
+func NewHandler() *Handler {
+	h := &Handler{}
+
+	h.mux = http.NewServeMux()
+	h.mux.HandleFunc("/v1/forecast", h.handleForecast)
+	h.mux.HandleFunc("/v1/archive", h.handleArchive)
+	h.mux.HandleFunc("/__fake/responses", h.handleScript)
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// Enqueue scripts the responses of the next requests
+func (h *Handler) Enqueue(responses ...Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.script = append(h.script, responses...)
+}
+
+// SetDefault sets the response served once the script runs out
+func (h *Handler) SetDefault(response Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.defaultResponse = response
+}
+
+// Reset clears the script and the default response
+func (h *Handler) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.script = nil
+	h.defaultResponse = Response{}
+	h.requests = 0
+}
+
+// Requests returns the number of forecast and archive requests served
+func (h *Handler) Requests() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.requests
+}
+
+func (h *Handler) nextResponse() Response {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.requests++
+
+	if len(h.script) == 0 {
+		return h.defaultResponse
+	}
+
+	response := h.script[0]
+	h.script = h.script[1:]
+
+	return response
+}
+
+// serveScripted applies the latency, status code and malformed body of a scripted response,
+// it returns false when the response has been written
+func serveScripted(w http.ResponseWriter, r *http.Request, response Response) bool {
+	if response.Latency > 0 {
+		select {
+		case <-time.After(response.Latency):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+
+	statusCode := response.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	if statusCode != http.StatusOK {
+		http.Error(w, http.StatusText(statusCode), statusCode)
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if response.Malformed {
+		w.WriteHeader(statusCode)
+		w.Write([]byte(`{"latitude": 1.1, "current_weather": {`))
+		return false
+	}
+
+	return true
+}
+
+func (h *Handler) handleForecast(w http.ResponseWriter, r *http.Request) {
+	response := h.nextResponse()
+
+	if !serveScripted(w, r, response) {
+		return
+	}
+
+	statusCode := http.StatusOK
+
+	if response.Body != nil {
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(response.Body)
+		return
+	}
+
+	latitudes, err := parseCoordinates(r.URL.Query().Get("latitude"))
+	if err != nil {
+		http.Error(w, "invalid latitude", http.StatusBadRequest)
+		return
+	}
+
+	longitudes, err := parseCoordinates(r.URL.Query().Get("longitude"))
+	if err != nil || len(longitudes) != len(latitudes) {
+		http.Error(w, "invalid longitude", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(statusCode)
+
+	// Like Open-Meteo, multiple locations get a list of forecasts
+	if len(latitudes) == 1 {
+		json.NewEncoder(w).Encode(Forecast(latitudes[0], longitudes[0]))
+		return
+	}
+
+	forecasts := make([]openmateo.OpenMateoForecastResponseBody, 0, len(latitudes))
+	for i := range latitudes {
+		forecasts = append(forecasts, Forecast(latitudes[i], longitudes[i]))
+	}
+
+	json.NewEncoder(w).Encode(forecasts)
+}
+
+func (h *Handler) handleArchive(w http.ResponseWriter, r *http.Request) {
+	response := h.nextResponse()
+
+	if !serveScripted(w, r, response) {
+		return
+	}
+
+	query := r.URL.Query()
+
+	lat, err := strconv.ParseFloat(query.Get("latitude"), 64)
+	if err != nil {
+		http.Error(w, "invalid latitude", http.StatusBadRequest)
+		return
+	}
+
+	long, err := strconv.ParseFloat(query.Get("longitude"), 64)
+	if err != nil {
+		http.Error(w, "invalid longitude", http.StatusBadRequest)
+		return
+	}
+
+	startDate, err := time.Parse(time.DateOnly, query.Get("start_date"))
+	if err != nil {
+		http.Error(w, "invalid start_date", http.StatusBadRequest)
+		return
+	}
+
+	endDate, err := time.Parse(time.DateOnly, query.Get("end_date"))
+	if err != nil || endDate.Before(startDate) {
+		http.Error(w, "invalid end_date", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(Archive(lat, long, startDate, endDate))
+}
+
+// parseCoordinates parses a comma separated list of coordinates
+func parseCoordinates(val string) ([]float64, error) {
+	var coordinates []float64
+
+	for _, coordinate := range strings.Split(val, ",") {
+		coordinateFloat, err := strconv.ParseFloat(coordinate, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		coordinates = append(coordinates, coordinateFloat)
+	}
+
+	return coordinates, nil
+}
+
+// scriptedResponse is the wire format of Response accepted by the script endpoint
+type scriptedResponse struct {
+	StatusCode int                                      `json:"status_code"`
+	Latency    string                                   `json:"latency"`
+	Malformed  bool                                     `json:"malformed"`
+	Body       *openmateo.OpenMateoForecastResponseBody `json:"body"`
+}
+
+// handleScript lets other processes script responses: POST enqueues a JSON list of responses, DELETE resets
+func (h *Handler) handleScript(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var scriptedResponses []scriptedResponse
+
+		err := json.NewDecoder(r.Body).Decode(&scriptedResponses)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid script: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		responses := make([]Response, 0, len(scriptedResponses))
+		for _, scripted := range scriptedResponses {
+			response := Response{
+				StatusCode: scripted.StatusCode,
+				Malformed:  scripted.Malformed,
+				Body:       scripted.Body,
+			}
+
+			if scripted.Latency != "" {
+				latency, err := time.ParseDuration(scripted.Latency)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("invalid latency: %v", err), http.StatusBadRequest)
+					return
+				}
+
+				response.Latency = latency
+			}
+
+			responses = append(responses, response)
+		}
+
+		h.Enqueue(responses...)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		h.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// Forecast generates the deterministic forecast served for a location
+func Forecast(lat, long float64) openmateo.OpenMateoForecastResponseBody {
+	return openmateo.OpenMateoForecastResponseBody{
+		Latitude:  lat,
+		Longitude: long,
+		CurrentWeather: openmateo.OpenMateoCurrentWeather{
+			Temperature:   round(30 - math.Abs(lat)/2),
+			WindDirection: round(math.Mod(math.Abs(lat*long), 360)),
+			WindSpeed:     round(math.Abs(long) / 10),
+		},
+	}
+}
+
+// Archive generates the deterministic hourly observations served for a location from the start of startDate
+// to the end of endDate, the temperature follows the forecast's with a daily cycle
+func Archive(lat, long float64, startDate, endDate time.Time) openmateo.OpenMateoArchiveResponseBody {
+	forecast := Forecast(lat, long)
+
+	body := openmateo.OpenMateoArchiveResponseBody{
+		Latitude:  lat,
+		Longitude: long,
+	}
+
+	for hour := startDate; hour.Before(endDate.AddDate(0, 0, 1)); hour = hour.Add(time.Hour) {
+		temperature := round(forecast.CurrentWeather.Temperature + 5*math.Sin(float64(hour.Hour())*math.Pi/12))
+		windSpeed := forecast.CurrentWeather.WindSpeed
+		windDirection := forecast.CurrentWeather.WindDirection
+
+		body.Hourly.Time = append(body.Hourly.Time, hour.Format("2006-01-02T15:04"))
+		body.Hourly.Temperature = append(body.Hourly.Temperature, &temperature)
+		body.Hourly.WindSpeed = append(body.Hourly.WindSpeed, &windSpeed)
+		body.Hourly.WindDirection = append(body.Hourly.WindDirection, &windDirection)
+	}
+
+	return body
+}
+
+func round(val float64) float64 {
+	return math.Round(val*10) / 10
+}
+
+// Server is a fake Open-Meteo server listening on a local port, its URL can be used as the client's base URL
+type Server struct {
+	*Handler
+
+	URL        string
+	httpServer *httptest.Server
+}
+
+func NewServer() *Server {
+	handler := NewHandler()
+	httpServer := httptest.NewServer(handler)
+
+	return &Server{
+		Handler:    handler,
+		URL:        httpServer.URL,
+		httpServer: httpServer,
+	}
+}
+
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
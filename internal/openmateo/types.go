@@ -11,3 +11,17 @@ type OpenMateoForecastResponseBody struct {
 	Longitude      float64                 `json:"longitude"`
 	CurrentWeather OpenMateoCurrentWeather `json:"current_weather"`
 }
+
+// OpenMateoArchiveHourly holds the hourly values of the archive in columns, values are null where the archive has no data
+type OpenMateoArchiveHourly struct {
+	Time          []string   `json:"time"`
+	Temperature   []*float64 `json:"temperature_2m"`
+	WindSpeed     []*float64 `json:"wind_speed_10m"`
+	WindDirection []*float64 `json:"wind_direction_10m"`
+}
+
+type OpenMateoArchiveResponseBody struct {
+	Latitude  float64                `json:"latitude"`
+	Longitude float64                `json:"longitude"`
+	Hourly    OpenMateoArchiveHourly `json:"hourly"`
+}
@@ -0,0 +1,70 @@
+package partition
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Store interface {
+	CreatePartition(month time.Time) (bool, error)
+}
+
+// Service creates the monthly partitions of weather data ahead of time, so new weather data never ends up in the default partition
+type Service struct {
+	store       Store
+	monthsAhead int
+}
+
+func NewService(store Store, monthsAhead int) *Service {
+	return &Service{
+		store:       store,
+		monthsAhead: monthsAhead,
+	}
+}
+
+// Start creates partitions every interval until the context is done
+func (s *Service) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		created, err := s.Run()
+		if err != nil {
+			log.Errorf("failed to create partitions: %v", err)
+		} else if created > 0 {
+			log.Infof("created %d partitions", created)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run creates the partitions of the current month and the months ahead that don't exist yet, returning how many were created
+func (s *Service) Run() (int, error) {
+	now := time.Now().UTC()
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var created int
+
+	for i := 0; i <= s.monthsAhead; i++ {
+		month := currentMonth.AddDate(0, i, 0)
+
+		ok, err := s.store.CreatePartition(month)
+		if err != nil {
+			return created, fmt.Errorf("failed to create partition for %s: %w", month.Format("2006-01"), err)
+		}
+
+		if ok {
+			created++
+		}
+	}
+
+	return created, nil
+}
@@ -0,0 +1,79 @@
+package partition_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/partition"
+
+	"github.com/stretchr/testify/require"
+)
+
+type MockStore struct {
+	existing map[time.Time]bool
+	err      error
+	months   []time.Time
+}
+
+func (m *MockStore) CreatePartition(month time.Time) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+
+	m.months = append(m.months, month)
+
+	return !m.existing[month], nil
+}
+
+func TestRun(t *testing.T) {
+	now := time.Now().UTC()
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name            string
+		store           *MockStore
+		monthsAhead     int
+		expectedMonths  []time.Time
+		expectedCreated int
+		shouldError     bool
+	}{
+		{
+			name:            "should create the current month and the months ahead",
+			store:           &MockStore{},
+			monthsAhead:     2,
+			expectedMonths:  []time.Time{currentMonth, currentMonth.AddDate(0, 1, 0), currentMonth.AddDate(0, 2, 0)},
+			expectedCreated: 3,
+		},
+		{
+			name:            "should not count partitions that already exist",
+			store:           &MockStore{existing: map[time.Time]bool{currentMonth: true}},
+			monthsAhead:     1,
+			expectedMonths:  []time.Time{currentMonth, currentMonth.AddDate(0, 1, 0)},
+			expectedCreated: 1,
+		},
+		{
+			name:        "should return an error when store returns an error",
+			store:       &MockStore{err: fmt.Errorf("error")},
+			monthsAhead: 1,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service := partition.NewService(tc.store, tc.monthsAhead)
+
+			created, err := service.Run()
+
+			if tc.shouldError {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedCreated, created)
+			require.Equal(t, tc.expectedMonths, tc.store.months)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"go-sample-rest/internal/types"
+)
+
+// BatchClient is implemented by providers that can fetch the weather data of many locations with a single request,
+// the weather data is returned in the same order as the locations
+type BatchClient interface {
+	GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error)
+}
+
+// ContextBatchClient is implemented by batch clients whose requests can be cancelled, like ContextClient
+type ContextBatchClient interface {
+	GetLatestWeatherDataBatchContext(ctx context.Context, locations []types.Location) ([]*types.WeatherData, error)
+}
+
+// BatchResult is the weather data of a single location of a batch, or the error fetching it
+type BatchResult struct {
+	WeatherData *types.WeatherData
+	Err         error
+}
+
+// partialBatchClient is implemented by clients whose batches can partially succeed, like Failover
+type partialBatchClient interface {
+	getLatestWeatherDataBatch(locations []types.Location) []BatchResult
+}
+
+// GetLatestWeatherDataBatch fetches the weather data of every location from the named provider, results are in the
+// same order as the locations. When no provider is named, each location's provider is used, falling back to the
+// default provider. Locations sharing a provider that supports batches are fetched with a single request.
+func (r *Registry) GetLatestWeatherDataBatch(name string, locations []types.Location) ([]BatchResult, error) {
+	if name != "" {
+		if _, ok := r.clients[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+	}
+
+	// Indices of the locations of each provider
+	var providerNames []string
+	providerLocations := map[string][]int{}
+
+	for i, location := range locations {
+		providerName := name
+		if providerName == "" {
+			providerName = r.providerForLocation(location.Latitude, location.Longitude)
+		}
+
+		if _, ok := providerLocations[providerName]; !ok {
+			providerNames = append(providerNames, providerName)
+		}
+
+		providerLocations[providerName] = append(providerLocations[providerName], i)
+	}
+
+	results := make([]BatchResult, len(locations))
+
+	for _, providerName := range providerNames {
+		indices := providerLocations[providerName]
+
+		client, ok := r.clients[providerName]
+		if !ok {
+			for _, i := range indices {
+				results[i].Err = fmt.Errorf("%w: %s", ErrUnknownProvider, providerName)
+			}
+
+			continue
+		}
+
+		batch := make([]types.Location, 0, len(indices))
+		for _, i := range indices {
+			batch = append(batch, locations[i])
+		}
+
+		for j, result := range getBatch(client, batch) {
+			if result.Err != nil {
+				result.Err = fmt.Errorf("failed to get weather data from %s: %w", providerName, result.Err)
+			}
+
+			if result.WeatherData != nil && result.WeatherData.Source == "" {
+				result.WeatherData.Source = providerName
+			}
+
+			results[indices[j]] = result
+		}
+	}
+
+	return results, nil
+}
+
+// getBatch fetches the weather data of every location from the client, with a single request when the client supports batches
+// and a request per location when it doesn't
+func getBatch(client Client, locations []types.Location) []BatchResult {
+	switch c := client.(type) {
+	case partialBatchClient:
+		return c.getLatestWeatherDataBatch(locations)
+	case BatchClient:
+		weatherDataList, err := c.GetLatestWeatherDataBatch(locations)
+		return batchResults(locations, weatherDataList, err)
+	default:
+		results := make([]BatchResult, len(locations))
+		for i, location := range locations {
+			weatherData, err := client.GetLatestWeatherData(location.Latitude, location.Longitude)
+			results[i] = BatchResult{WeatherData: weatherData, Err: err}
+		}
+
+		return results
+	}
+}
+
+// getBatchContext fetches the weather data of every location with a single request of the batch client, with the
+// context when the client supports it
+func getBatchContext(ctx context.Context, client BatchClient, locations []types.Location) ([]*types.WeatherData, error) {
+	if c, ok := client.(ContextBatchClient); ok {
+		return c.GetLatestWeatherDataBatchContext(ctx, locations)
+	}
+
+	return client.GetLatestWeatherDataBatch(locations)
+}
+
+// batchResults splits the weather data of a single batch request into the result of each location, every location
+// fails with the request
+func batchResults(locations []types.Location, weatherDataList []*types.WeatherData, err error) []BatchResult {
+	if err == nil && len(weatherDataList) != len(locations) {
+		err = fmt.Errorf("expected weather data of %d locations, got %d", len(locations), len(weatherDataList))
+	}
+
+	results := make([]BatchResult, len(locations))
+	for i := range results {
+		if err != nil {
+			results[i].Err = err
+		} else {
+			results[i].WeatherData = weatherDataList[i]
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,253 @@
+package provider_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/provider"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+type MockBatchClient struct {
+	MockClient
+	batches [][]types.Location
+}
+
+func (m *MockBatchClient) GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error) {
+	m.batches = append(m.batches, locations)
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var weatherDataList []*types.WeatherData
+	for _, location := range locations {
+		weatherDataList = append(weatherDataList, &types.WeatherData{
+			Latitude:    location.Latitude,
+			Longitude:   location.Longitude,
+			Temperature: m.temperature,
+		})
+	}
+
+	return weatherDataList, nil
+}
+
+// LocationFailingClient fails for a single latitude only
+type LocationFailingClient struct {
+	MockClient
+	failLatitude float64
+}
+
+func (m *LocationFailingClient) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	if lat == m.failLatitude {
+		return nil, fmt.Errorf("some error")
+	}
+
+	return m.MockClient.GetLatestWeatherData(lat, long)
+}
+
+// LocationBlockingClient blocks for a single latitude only, until its request is cancelled
+type LocationBlockingClient struct {
+	MockClient
+	blockLatitude float64
+	cancelled     chan struct{}
+}
+
+func (m *LocationBlockingClient) GetLatestWeatherDataContext(ctx context.Context, lat, long float64) (*types.WeatherData, error) {
+	if lat == m.blockLatitude {
+		<-ctx.Done()
+		close(m.cancelled)
+
+		return nil, ctx.Err()
+	}
+
+	return m.MockClient.GetLatestWeatherData(lat, long)
+}
+
+var batchLocations = []types.Location{
+	{Latitude: 1.1, Longitude: 2.2},
+	{Latitude: 3.3, Longitude: 4.4},
+	{Latitude: 5.5, Longitude: 6.6},
+}
+
+func TestRegistryGetLatestWeatherDataBatch(t *testing.T) {
+	t.Run("should error when the named provider is not registered", func(t *testing.T) {
+		registry := provider.NewRegistry("openmeteo")
+
+		_, err := registry.GetLatestWeatherDataBatch("unknown", batchLocations)
+		require.ErrorIs(t, err, provider.ErrUnknownProvider)
+	})
+
+	t.Run("should fetch each provider's locations with a single request when it supports batches", func(t *testing.T) {
+		batchClient := &MockBatchClient{MockClient: MockClient{temperature: 1}}
+
+		registry := provider.NewRegistry("openmeteo")
+		registry.Register("openmeteo", batchClient)
+		registry.Register("metno", &MockClient{temperature: 2})
+		registry.SetLocationProvider(3.3, 4.4, "metno")
+		registry.SetLocationProvider(5.5, 6.6, "unknown")
+
+		results, err := registry.GetLatestWeatherDataBatch("", append(batchLocations, types.Location{Latitude: 7.7, Longitude: 8.8}))
+		require.NoError(t, err)
+		require.Len(t, results, 4)
+
+		require.Equal(t, [][]types.Location{{{Latitude: 1.1, Longitude: 2.2}, {Latitude: 7.7, Longitude: 8.8}}}, batchClient.batches)
+
+		require.NoError(t, results[0].Err)
+		require.Equal(t, &types.WeatherData{Latitude: 1.1, Longitude: 2.2, Temperature: 1, Source: "openmeteo"}, results[0].WeatherData)
+
+		require.NoError(t, results[1].Err)
+		require.Equal(t, &types.WeatherData{Latitude: 3.3, Longitude: 4.4, Temperature: 2, Source: "metno"}, results[1].WeatherData)
+
+		require.ErrorIs(t, results[2].Err, provider.ErrUnknownProvider)
+
+		require.NoError(t, results[3].Err)
+		require.Equal(t, &types.WeatherData{Latitude: 7.7, Longitude: 8.8, Temperature: 1, Source: "openmeteo"}, results[3].WeatherData)
+	})
+
+	t.Run("should fail every location of a failed batch", func(t *testing.T) {
+		registry := provider.NewRegistry("openmeteo")
+		registry.Register("openmeteo", &MockBatchClient{MockClient: MockClient{err: fmt.Errorf("some error")}})
+
+		results, err := registry.GetLatestWeatherDataBatch("", batchLocations)
+		require.NoError(t, err)
+
+		for _, result := range results {
+			require.Error(t, result.Err)
+			require.Nil(t, result.WeatherData)
+		}
+	})
+}
+
+func TestFailoverGetLatestWeatherDataBatch(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		members              []provider.FailoverMember
+		expectedTemperatures []float64
+		expectedSources      []string
+		expectedFailures     []bool
+		expectedStats        []provider.Stats
+	}{
+		{
+			name: "should fetch every location from the first provider when it succeeds",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &MockBatchClient{MockClient: MockClient{temperature: 1}}},
+				{Name: "secondary", Client: &MockClient{temperature: 2}},
+			},
+			expectedTemperatures: []float64{1, 1, 1},
+			expectedSources:      []string{"primary", "primary", "primary"},
+			expectedFailures:     []bool{false, false, false},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Successes: 3},
+				{Provider: "secondary"},
+			},
+		},
+		{
+			name: "should fall back to the next provider for the whole batch when a batch fails",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &MockBatchClient{MockClient: MockClient{err: fmt.Errorf("some error")}}},
+				{Name: "secondary", Client: &MockClient{temperature: 2}},
+			},
+			expectedTemperatures: []float64{2, 2, 2},
+			expectedSources:      []string{"secondary", "secondary", "secondary"},
+			expectedFailures:     []bool{false, false, false},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Failures: 3},
+				{Provider: "secondary", Successes: 3},
+			},
+		},
+		{
+			name: "should only fall back to the next provider for the locations that failed",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &LocationFailingClient{MockClient: MockClient{temperature: 1}, failLatitude: 3.3}},
+				{Name: "secondary", Client: &MockClient{temperature: 2}},
+			},
+			expectedTemperatures: []float64{1, 2, 1},
+			expectedSources:      []string{"primary", "secondary", "primary"},
+			expectedFailures:     []bool{false, false, false},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Successes: 2, Failures: 1},
+				{Provider: "secondary", Successes: 1},
+			},
+		},
+		{
+			name: "should fail the locations every provider failed",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &LocationFailingClient{MockClient: MockClient{temperature: 1}, failLatitude: 3.3}},
+				{Name: "secondary", Client: &LocationFailingClient{MockClient: MockClient{temperature: 2}, failLatitude: 3.3}},
+			},
+			expectedTemperatures: []float64{1, 0, 1},
+			expectedSources:      []string{"primary", "", "primary"},
+			expectedFailures:     []bool{false, true, false},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Successes: 2, Failures: 1},
+				{Provider: "secondary", Failures: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			failover := provider.NewFailover(tc.members)
+
+			registry := provider.NewRegistry("failover")
+			registry.Register("failover", failover)
+
+			results, err := registry.GetLatestWeatherDataBatch("", batchLocations)
+			require.NoError(t, err)
+			require.Len(t, results, len(batchLocations))
+
+			for i, result := range results {
+				if tc.expectedFailures[i] {
+					require.Error(t, result.Err)
+					require.Nil(t, result.WeatherData)
+					continue
+				}
+
+				require.NoError(t, result.Err)
+				require.Equal(t, batchLocations[i].Latitude, result.WeatherData.Latitude)
+				require.Equal(t, tc.expectedTemperatures[i], result.WeatherData.Temperature)
+				require.Equal(t, tc.expectedSources[i], result.WeatherData.Source)
+			}
+
+			require.Equal(t, tc.expectedStats, failover.Stats())
+		})
+	}
+}
+
+func TestFailoverBatchTimesOutEachRequest(t *testing.T) {
+	blockingClient := &LocationBlockingClient{MockClient: MockClient{temperature: 1}, blockLatitude: 3.3, cancelled: make(chan struct{})}
+
+	failover := provider.NewFailover([]provider.FailoverMember{
+		{Name: "primary", Client: blockingClient, Timeout: 50 * time.Millisecond},
+		{Name: "secondary", Client: &MockClient{temperature: 2}},
+	})
+
+	registry := provider.NewRegistry("failover")
+	registry.Register("failover", failover)
+
+	results, err := registry.GetLatestWeatherDataBatch("", batchLocations)
+	require.NoError(t, err)
+	require.Len(t, results, len(batchLocations))
+
+	// Only the location that timed out falls back, the others keep the weather data fetched before the timeout
+	for i, expectedSource := range []string{"primary", "secondary", "primary"} {
+		require.NoError(t, results[i].Err)
+		require.Equal(t, expectedSource, results[i].WeatherData.Source)
+	}
+
+	require.Equal(t, []provider.Stats{
+		{Provider: "primary", Successes: 2, Failures: 1},
+		{Provider: "secondary", Successes: 1},
+	}, failover.Stats())
+
+	select {
+	case <-blockingClient.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("timed out request was not cancelled")
+	}
+}
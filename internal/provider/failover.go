@@ -0,0 +1,261 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrProviderTimeout = errors.New("weather provider timed out")
+
+// errNoWeatherData is the failure of a member that succeeded without weather data, the next member is tried
+var errNoWeatherData = errors.New("no weather data")
+
+type FailoverMember struct {
+	Name   string
+	Client Client
+	// Timeout of zero means the member is waited on for as long as its client takes
+	Timeout time.Duration
+}
+
+type Stats struct {
+	Provider  string `json:"provider"`
+	Successes int64  `json:"successes"`
+	Failures  int64  `json:"failures"`
+}
+
+// Failover tries its members in order until one of them returns weather data
+type Failover struct {
+	members []FailoverMember
+
+	mu    sync.Mutex
+	stats map[string]*Stats
+}
+
+func NewFailover(members []FailoverMember) *Failover {
+	stats := map[string]*Stats{}
+	for _, member := range members {
+		stats[member.Name] = &Stats{Provider: member.Name}
+	}
+
+	return &Failover{
+		members: members,
+		stats:   stats,
+	}
+}
+
+// GetLatestWeatherData returns the first successful member's weather data, with its source set to that member. Members
+// without weather data for the location are skipped, when none of them has any no weather data is returned.
+func (f *Failover) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	var errs []error
+
+	for _, member := range f.members {
+		weatherData, err := f.getFromMember(member, lat, long)
+		if err == nil && weatherData == nil {
+			err = errNoWeatherData
+		}
+
+		if err != nil {
+			f.recordFailure(member.Name)
+			log.Warnf("weather provider %s failed, trying next provider: %v", member.Name, err)
+			errs = append(errs, fmt.Errorf("%s: %w", member.Name, err))
+			continue
+		}
+
+		f.recordSuccess(member.Name)
+
+		weatherData.Source = member.Name
+
+		return weatherData, nil
+	}
+
+	if onlyNoWeatherData(errs) {
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("all weather providers failed: %w", errors.Join(errs...))
+}
+
+func (f *Failover) getFromMember(member FailoverMember, lat, long float64) (*types.WeatherData, error) {
+	return withTimeout(member.Timeout, func(ctx context.Context) (*types.WeatherData, error) {
+		return getLatest(ctx, member.Client, lat, long)
+	})
+}
+
+// getLatest fetches the weather data with the context when the client supports it
+func getLatest(ctx context.Context, client Client, lat, long float64) (*types.WeatherData, error) {
+	if c, ok := client.(ContextClient); ok {
+		return c.GetLatestWeatherDataContext(ctx, lat, long)
+	}
+
+	return client.GetLatestWeatherData(lat, long)
+}
+
+// onlyNoWeatherData tells whether every member succeeded without weather data
+func onlyNoWeatherData(errs []error) bool {
+	for _, err := range errs {
+		if !errors.Is(err, errNoWeatherData) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// getLatestWeatherDataBatch tries its members in order for the locations every previous member failed to fetch,
+// using a single request per member when the member supports batches
+func (f *Failover) getLatestWeatherDataBatch(locations []types.Location) []BatchResult {
+	results := make([]BatchResult, len(locations))
+	errs := make([][]error, len(locations))
+
+	remaining := make([]int, 0, len(locations))
+	for i := range locations {
+		remaining = append(remaining, i)
+	}
+
+	for _, member := range f.members {
+		if len(remaining) == 0 {
+			break
+		}
+
+		memberLocations := make([]types.Location, 0, len(remaining))
+		for _, i := range remaining {
+			memberLocations = append(memberLocations, locations[i])
+		}
+
+		memberResults := f.getBatchFromMember(member, memberLocations)
+
+		var failed []int
+
+		for j, i := range remaining {
+			result := memberResults[j]
+			if result.Err == nil && result.WeatherData == nil {
+				result.Err = errNoWeatherData
+			}
+
+			if result.Err != nil {
+				f.recordFailure(member.Name)
+				errs[i] = append(errs[i], fmt.Errorf("%s: %w", member.Name, result.Err))
+				failed = append(failed, i)
+				continue
+			}
+
+			f.recordSuccess(member.Name)
+
+			result.WeatherData.Source = member.Name
+			results[i] = result
+		}
+
+		if len(failed) > 0 {
+			log.Warnf("weather provider %s failed for %d of %d locations, trying next provider", member.Name, len(failed), len(remaining))
+		}
+
+		remaining = failed
+	}
+
+	for _, i := range remaining {
+		if onlyNoWeatherData(errs[i]) {
+			continue
+		}
+
+		results[i].Err = fmt.Errorf("all weather providers failed: %w", errors.Join(errs[i]...))
+	}
+
+	return results
+}
+
+// getBatchFromMember fetches the weather data of every location from the member, the member's timeout applies to each
+// request: the single request of a batch client, or the request of each location otherwise, so locations fetched
+// before a timeout keep their weather data
+func (f *Failover) getBatchFromMember(member FailoverMember, locations []types.Location) []BatchResult {
+	switch c := member.Client.(type) {
+	case partialBatchClient:
+		return c.getLatestWeatherDataBatch(locations)
+	case BatchClient:
+		weatherDataList, err := withTimeout(member.Timeout, func(ctx context.Context) ([]*types.WeatherData, error) {
+			return getBatchContext(ctx, c, locations)
+		})
+
+		return batchResults(locations, weatherDataList, err)
+	default:
+		results := make([]BatchResult, len(locations))
+		for i, location := range locations {
+			weatherData, err := f.getFromMember(member, location.Latitude, location.Longitude)
+			results[i] = BatchResult{WeatherData: weatherData, Err: err}
+		}
+
+		return results
+	}
+}
+
+// withTimeout waits on fn for up to the timeout and then cancels its context, a timeout of zero waits for as long as
+// fn takes. fn returns once its context is cancelled when its client supports contexts.
+func withTimeout[T any](timeout time.Duration, fn func(ctx context.Context) (T, error)) (T, error) {
+	if timeout <= 0 {
+		return fn(context.Background())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type result struct {
+		val T
+		err error
+	}
+
+	// Buffered so fn can return after timing out without anyone receiving its result
+	resultCh := make(chan result, 1)
+
+	go func() {
+		val, err := fn(ctx)
+		resultCh <- result{val: val, err: err}
+	}()
+
+	select {
+	case res := <-resultCh:
+		return res.val, res.err
+	case <-ctx.Done():
+		var zero T
+		return zero, fmt.Errorf("%w after %s", ErrProviderTimeout, timeout)
+	}
+}
+
+func (f *Failover) recordSuccess(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stats[name].Successes++
+}
+
+func (f *Failover) recordFailure(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.stats[name].Failures++
+}
+
+// Stats returns the success and failure counts of each member, in failover order
+func (f *Failover) Stats() []Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := make([]Stats, 0, len(f.members))
+	for _, member := range f.members {
+		stats = append(stats, *f.stats[member.Name])
+	}
+
+	return stats
+}
+
+func (f *Failover) GetStats(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, f.Stats())
+}
@@ -0,0 +1,197 @@
+package provider_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/provider"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+type SlowClient struct {
+	delay time.Duration
+}
+
+func (s *SlowClient) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	time.Sleep(s.delay)
+
+	return &types.WeatherData{Latitude: lat, Longitude: long}, nil
+}
+
+// NoWeatherDataClient succeeds without weather data
+type NoWeatherDataClient struct{}
+
+func (n *NoWeatherDataClient) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	return nil, nil
+}
+
+// BlockingClient blocks until its request is cancelled
+type BlockingClient struct {
+	cancelled chan struct{}
+}
+
+func (b *BlockingClient) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	return b.GetLatestWeatherDataContext(context.Background(), lat, long)
+}
+
+func (b *BlockingClient) GetLatestWeatherDataContext(ctx context.Context, lat, long float64) (*types.WeatherData, error) {
+	<-ctx.Done()
+	close(b.cancelled)
+
+	return nil, ctx.Err()
+}
+
+func TestFailoverGetLatestWeatherData(t *testing.T) {
+	testCases := []struct {
+		name                string
+		members             []provider.FailoverMember
+		shouldError         bool
+		expectedWeatherData *types.WeatherData
+		expectedStats       []provider.Stats
+	}{
+		{
+			name: "should return the first provider's weather data when it succeeds",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &MockClient{temperature: 1}},
+				{Name: "secondary", Client: &MockClient{temperature: 2}},
+			},
+			expectedWeatherData: &types.WeatherData{
+				Latitude:    1.1,
+				Longitude:   2.2,
+				Temperature: 1,
+				Source:      "primary",
+			},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Successes: 1},
+				{Provider: "secondary"},
+			},
+		},
+		{
+			name: "should fall back to the next provider when a provider fails",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &MockClient{err: fmt.Errorf("some error")}},
+				{Name: "secondary", Client: &MockClient{temperature: 2}},
+			},
+			expectedWeatherData: &types.WeatherData{
+				Latitude:    1.1,
+				Longitude:   2.2,
+				Temperature: 2,
+				Source:      "secondary",
+			},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Failures: 1},
+				{Provider: "secondary", Successes: 1},
+			},
+		},
+		{
+			name: "should fall back to the next provider when a provider times out",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &SlowClient{delay: time.Second}, Timeout: time.Millisecond},
+				{Name: "secondary", Client: &MockClient{temperature: 2}, Timeout: time.Second},
+			},
+			expectedWeatherData: &types.WeatherData{
+				Latitude:    1.1,
+				Longitude:   2.2,
+				Temperature: 2,
+				Source:      "secondary",
+			},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Failures: 1},
+				{Provider: "secondary", Successes: 1},
+			},
+		},
+		{
+			name: "should fall back to the next provider when a provider has no weather data",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &NoWeatherDataClient{}},
+				{Name: "secondary", Client: &MockClient{temperature: 2}},
+			},
+			expectedWeatherData: &types.WeatherData{
+				Latitude:    1.1,
+				Longitude:   2.2,
+				Temperature: 2,
+				Source:      "secondary",
+			},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Failures: 1},
+				{Provider: "secondary", Successes: 1},
+			},
+		},
+		{
+			name: "should return no weather data when no provider has any",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &NoWeatherDataClient{}},
+				{Name: "secondary", Client: &NoWeatherDataClient{}},
+			},
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Failures: 1},
+				{Provider: "secondary", Failures: 1},
+			},
+		},
+		{
+			name: "should return error when all providers fail",
+			members: []provider.FailoverMember{
+				{Name: "primary", Client: &MockClient{err: fmt.Errorf("some error")}},
+				{Name: "secondary", Client: &MockClient{err: fmt.Errorf("some error")}},
+			},
+			shouldError: true,
+			expectedStats: []provider.Stats{
+				{Provider: "primary", Failures: 1},
+				{Provider: "secondary", Failures: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			failover := provider.NewFailover(tc.members)
+
+			weatherData, err := failover.GetLatestWeatherData(1.1, 2.2)
+
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedWeatherData, weatherData)
+			}
+
+			require.Equal(t, tc.expectedStats, failover.Stats())
+		})
+	}
+}
+
+func TestFailoverCancelsTimedOutRequests(t *testing.T) {
+	blockingClient := &BlockingClient{cancelled: make(chan struct{})}
+
+	failover := provider.NewFailover([]provider.FailoverMember{
+		{Name: "primary", Client: blockingClient, Timeout: time.Millisecond},
+		{Name: "secondary", Client: &MockClient{temperature: 2}},
+	})
+
+	weatherData, err := failover.GetLatestWeatherData(1.1, 2.2)
+	require.NoError(t, err)
+	require.Equal(t, "secondary", weatherData.Source)
+
+	select {
+	case <-blockingClient.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("timed out request was not cancelled")
+	}
+}
+
+func TestRegistryKeepsFailoverSource(t *testing.T) {
+	registry := provider.NewRegistry("failover")
+	registry.Register("failover", provider.NewFailover([]provider.FailoverMember{
+		{Name: "primary", Client: &MockClient{err: fmt.Errorf("some error")}},
+		{Name: "secondary", Client: &MockClient{temperature: 2}},
+	}))
+
+	weatherData, err := registry.GetLatestWeatherData("", 1.1, 2.2)
+
+	require.NoError(t, err)
+	require.Equal(t, "secondary", weatherData.Source)
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go-sample-rest/internal/types"
+)
+
+var ErrUnknownProvider = errors.New("unknown weather provider")
+
+type Client interface {
+	GetLatestWeatherData(lat, long float64) (*types.WeatherData, error)
+}
+
+// ContextClient is implemented by clients whose requests can be cancelled, requests of failover members that time out
+// are cancelled rather than left running
+type ContextClient interface {
+	GetLatestWeatherDataContext(ctx context.Context, lat, long float64) (*types.WeatherData, error)
+}
+
+type location struct {
+	latitude  float64
+	longitude float64
+}
+
+// Registry holds the configured weather providers and picks one for each request
+type Registry struct {
+	clients         map[string]Client
+	defaultProvider string
+	locations       map[location]string
+}
+
+func NewRegistry(defaultProvider string) *Registry {
+	return &Registry{
+		clients:         map[string]Client{},
+		defaultProvider: defaultProvider,
+		locations:       map[location]string{},
+	}
+}
+
+func (r *Registry) Register(name string, client Client) {
+	r.clients[name] = client
+}
+
+// Has tells whether a provider is registered with the name
+func (r *Registry) Has(name string) bool {
+	_, ok := r.clients[name]
+	return ok
+}
+
+// SetLocationProvider makes the given provider the default for a location
+func (r *Registry) SetLocationProvider(lat, long float64, name string) {
+	r.locations[location{latitude: lat, longitude: long}] = name
+}
+
+// GetLatestWeatherData fetches weather data from the named provider. When no provider is named,
+// the location's provider is used, falling back to the default provider.
+func (r *Registry) GetLatestWeatherData(name string, lat, long float64) (*types.WeatherData, error) {
+	if name == "" {
+		name = r.providerForLocation(lat, long)
+	}
+
+	client, ok := r.clients[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+
+	weatherData, err := client.GetLatestWeatherData(lat, long)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get weather data from %s: %w", name, err)
+	}
+
+	if weatherData != nil && weatherData.Source == "" {
+		weatherData.Source = name
+	}
+
+	return weatherData, nil
+}
+
+func (r *Registry) providerForLocation(lat, long float64) string {
+	if name, ok := r.locations[location{latitude: lat, longitude: long}]; ok {
+		return name
+	}
+
+	return r.defaultProvider
+}
@@ -0,0 +1,114 @@
+package provider_test
+
+import (
+	"fmt"
+	"testing"
+
+	"go-sample-rest/internal/provider"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+type MockClient struct {
+	temperature float64
+	err         error
+}
+
+func (m *MockClient) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &types.WeatherData{
+		Latitude:    lat,
+		Longitude:   long,
+		Temperature: m.temperature,
+	}, nil
+}
+
+func TestGetLatestWeatherData(t *testing.T) {
+	registry := provider.NewRegistry("primary")
+	registry.Register("primary", &MockClient{temperature: 1})
+	registry.Register("secondary", &MockClient{temperature: 2})
+	registry.Register("broken", &MockClient{err: fmt.Errorf("some error")})
+	registry.SetLocationProvider(3.3, 4.4, "secondary")
+
+	testCases := []struct {
+		name                string
+		provider            string
+		lat                 float64
+		long                float64
+		shouldError         bool
+		expectedErr         error
+		expectedWeatherData *types.WeatherData
+	}{
+		{
+			name:     "should use the default provider when no provider is requested",
+			provider: "",
+			lat:      1.1,
+			long:     2.2,
+			expectedWeatherData: &types.WeatherData{
+				Latitude:    1.1,
+				Longitude:   2.2,
+				Temperature: 1,
+				Source:      "primary",
+			},
+		},
+		{
+			name:     "should use the location's provider when no provider is requested",
+			provider: "",
+			lat:      3.3,
+			long:     4.4,
+			expectedWeatherData: &types.WeatherData{
+				Latitude:    3.3,
+				Longitude:   4.4,
+				Temperature: 2,
+				Source:      "secondary",
+			},
+		},
+		{
+			name:     "should use the requested provider over the location's provider",
+			provider: "primary",
+			lat:      3.3,
+			long:     4.4,
+			expectedWeatherData: &types.WeatherData{
+				Latitude:    3.3,
+				Longitude:   4.4,
+				Temperature: 1,
+				Source:      "primary",
+			},
+		},
+		{
+			name:        "should return unknown provider error when provider is not registered",
+			provider:    "unknown",
+			lat:         1.1,
+			long:        2.2,
+			shouldError: true,
+			expectedErr: provider.ErrUnknownProvider,
+		},
+		{
+			name:        "should return error when provider returns an error",
+			provider:    "broken",
+			lat:         1.1,
+			long:        2.2,
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			weatherData, err := registry.GetLatestWeatherData(tc.provider, tc.lat, tc.long)
+
+			if tc.shouldError {
+				require.Error(t, err)
+				if tc.expectedErr != nil {
+					require.ErrorIs(t, err, tc.expectedErr)
+				}
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedWeatherData, weatherData)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"go-sample-rest/internal/types"
+)
+
+const alertRuleColumns = `id, latitude, longitude, metric, comparator, threshold, cooldown_seconds, webhook_url, secret, enabled, last_fired_at, created_at, updated_at`
+
+const alertDeliveryColumns = `id, rule_id, event, payload, status, attempts, last_status_code, last_error, next_attempt_at, created_at, updated_at, delivered_at`
+
+func (r *Repository) CreateAlertRule(rule *types.AlertRule) (*types.AlertRule, error) {
+	row := r.dbClient.QueryRow(`
+    INSERT INTO alert_rules (id, latitude, longitude, metric, comparator, threshold, cooldown_seconds, webhook_url, secret, enabled)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    RETURNING `+alertRuleColumns,
+		rule.Id, rule.Latitude, rule.Longitude, rule.Metric, rule.Comparator, rule.Threshold, rule.CooldownSeconds, rule.WebhookURL, rule.Secret, rule.Enabled,
+	)
+
+	return scanAlertRule(row)
+}
+
+// GetAlertRule returns nil when the rule doesn't exist
+func (r *Repository) GetAlertRule(id string) (*types.AlertRule, error) {
+	row := r.dbClient.QueryRow(`
+    SELECT `+alertRuleColumns+`
+    FROM alert_rules
+    WHERE id = $1
+  `, id)
+
+	rule, err := scanAlertRule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return rule, err
+}
+
+func (r *Repository) ListAlertRules() ([]*types.AlertRule, error) {
+	rows, err := r.dbClient.Query(`
+    SELECT ` + alertRuleColumns + `
+    FROM alert_rules
+    ORDER BY created_at
+  `)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAlertRules(rows)
+}
+
+// GetEnabledAlertRules returns the enabled rules of a location
+func (r *Repository) GetEnabledAlertRules(lat, long float64) ([]*types.AlertRule, error) {
+	rows, err := r.dbClient.Query(`
+    SELECT `+alertRuleColumns+`
+    FROM alert_rules
+    WHERE latitude = $1 AND longitude = $2 AND enabled
+  `, lat, long)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAlertRules(rows)
+}
+
+// UpdateAlertRule replaces a rule's settings, it returns nil when the rule doesn't exist
+func (r *Repository) UpdateAlertRule(rule *types.AlertRule) (*types.AlertRule, error) {
+	row := r.dbClient.QueryRow(`
+    UPDATE alert_rules
+    SET latitude = $2, longitude = $3, metric = $4, comparator = $5, threshold = $6, cooldown_seconds = $7,
+      webhook_url = $8, secret = $9, enabled = $10, updated_at = NOW()
+    WHERE id = $1
+    RETURNING `+alertRuleColumns,
+		rule.Id, rule.Latitude, rule.Longitude, rule.Metric, rule.Comparator, rule.Threshold, rule.CooldownSeconds, rule.WebhookURL, rule.Secret, rule.Enabled,
+	)
+
+	updatedRule, err := scanAlertRule(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return updatedRule, err
+}
+
+// DeleteAlertRule deletes a rule along with its deliveries, it returns false when the rule doesn't exist
+func (r *Repository) DeleteAlertRule(id string) (bool, error) {
+	res, err := r.dbClient.Exec(`DELETE FROM alert_rules WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected(res)
+}
+
+// FireAlertRule records the rule as fired at firedAt, queues its delivery and notifies its payload on AlertFiredChannel
+// in a single transaction, unless it fired within its cooldown. It returns false when it's cooling down, so concurrent
+// saves fire a rule once.
+func (r *Repository) FireAlertRule(rule *types.AlertRule, firedAt time.Time, delivery *types.AlertDelivery) (bool, error) {
+	tx, err := r.dbClient.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+    UPDATE alert_rules
+    SET last_fired_at = $2
+    WHERE id = $1 AND enabled
+      AND (last_fired_at IS NULL OR last_fired_at <= $2::timestamptz - cooldown_seconds * INTERVAL '1 second')
+  `, rule.Id, firedAt)
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := rowsAffected(res)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+    INSERT INTO alert_deliveries (id, rule_id, event, payload)
+    VALUES ($1, $2, $3, $4::jsonb)
+  `, delivery.Id, delivery.RuleId, delivery.Event, string(delivery.Payload))
+	if err != nil {
+		return false, err
+	}
+
+	// Sent to the listeners of every replica once committed
+	_, err = tx.Exec(`SELECT pg_notify($1, $2)`, AlertFiredChannel, string(delivery.Payload))
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// CreateClaimedAlertDelivery queues a delivery that's already claimed until leaseUntil, for the caller to deliver it
+// right away
+func (r *Repository) CreateClaimedAlertDelivery(delivery *types.AlertDelivery, leaseUntil time.Time) (*types.AlertDelivery, error) {
+	row := r.dbClient.QueryRow(`
+    INSERT INTO alert_deliveries (id, rule_id, event, payload, attempts, next_attempt_at)
+    VALUES ($1, $2, $3, $4::jsonb, 1, $5)
+    RETURNING `+alertDeliveryColumns,
+		delivery.Id, delivery.RuleId, delivery.Event, string(delivery.Payload), leaseUntil,
+	)
+
+	return scanAlertDelivery(row)
+}
+
+// ClaimAlertDeliveries claims up to limit pending deliveries that are due until leaseUntil, incrementing their attempts
+func (r *Repository) ClaimAlertDeliveries(limit int, leaseUntil time.Time) ([]*types.AlertDelivery, error) {
+	rows, err := r.dbClient.Query(`
+    UPDATE alert_deliveries
+    SET attempts = attempts + 1, next_attempt_at = $2, updated_at = NOW()
+    WHERE id IN (
+      SELECT id
+      FROM alert_deliveries
+      WHERE status = 'pending' AND next_attempt_at <= NOW()
+      ORDER BY next_attempt_at
+      LIMIT $1
+      FOR UPDATE SKIP LOCKED
+    )
+    RETURNING `+alertDeliveryColumns,
+		limit, leaseUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAlertDeliveries(rows)
+}
+
+// SaveAlertDeliveryAttempt saves the outcome of a delivery's attempt, it returns false when the delivery was claimed
+// again since
+func (r *Repository) SaveAlertDeliveryAttempt(delivery *types.AlertDelivery) (bool, error) {
+	res, err := r.dbClient.Exec(`
+    UPDATE alert_deliveries
+    SET status = $3, last_status_code = $4, last_error = $5, next_attempt_at = $6, delivered_at = $7, updated_at = NOW()
+    WHERE id = $1 AND attempts = $2 AND status = 'pending'
+  `, delivery.Id, delivery.Attempts, delivery.Status, delivery.LastStatusCode, delivery.LastError, delivery.NextAttemptAt, delivery.DeliveredAt)
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected(res)
+}
+
+// ListAlertDeliveries returns the latest deliveries of a rule, newest first
+func (r *Repository) ListAlertDeliveries(ruleId string, limit int) ([]*types.AlertDelivery, error) {
+	rows, err := r.dbClient.Query(`
+    SELECT `+alertDeliveryColumns+`
+    FROM alert_deliveries
+    WHERE rule_id = $1
+    ORDER BY created_at DESC
+    LIMIT $2
+  `, ruleId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAlertDeliveries(rows)
+}
+
+func scanAlertRules(rows *sql.Rows) ([]*types.AlertRule, error) {
+	defer rows.Close()
+
+	rules := []*types.AlertRule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func scanAlertRule(row scanner) (*types.AlertRule, error) {
+	var rule types.AlertRule
+	var lastFiredAt sql.NullTime
+
+	err := row.Scan(
+		&rule.Id,
+		&rule.Latitude,
+		&rule.Longitude,
+		&rule.Metric,
+		&rule.Comparator,
+		&rule.Threshold,
+		&rule.CooldownSeconds,
+		&rule.WebhookURL,
+		&rule.Secret,
+		&rule.Enabled,
+		&lastFiredAt,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The driver returns timestamps in the session time zone, normalise them
+	rule.CreatedAt = rule.CreatedAt.UTC()
+	rule.UpdatedAt = rule.UpdatedAt.UTC()
+
+	if lastFiredAt.Valid {
+		t := lastFiredAt.Time.UTC()
+		rule.LastFiredAt = &t
+	}
+
+	return &rule, nil
+}
+
+func scanAlertDeliveries(rows *sql.Rows) ([]*types.AlertDelivery, error) {
+	defer rows.Close()
+
+	deliveries := []*types.AlertDelivery{}
+	for rows.Next() {
+		delivery, err := scanAlertDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func scanAlertDelivery(row scanner) (*types.AlertDelivery, error) {
+	var delivery types.AlertDelivery
+	var payload []byte
+	var deliveredAt sql.NullTime
+
+	err := row.Scan(
+		&delivery.Id,
+		&delivery.RuleId,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.NextAttemptAt,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+		&deliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery.Payload = payload
+
+	// The driver returns timestamps in the session time zone, normalise them
+	delivery.NextAttemptAt = delivery.NextAttemptAt.UTC()
+	delivery.CreatedAt = delivery.CreatedAt.UTC()
+	delivery.UpdatedAt = delivery.UpdatedAt.UTC()
+
+	if deliveredAt.Valid {
+		t := deliveredAt.Time.UTC()
+		delivery.DeliveredAt = &t
+	}
+
+	return &delivery, nil
+}
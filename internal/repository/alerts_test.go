@@ -0,0 +1,145 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIntegrationAlerts(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."alert_rules"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	rule, err := repo.CreateAlertRule(&types.AlertRule{
+		Id:              "rule1",
+		Latitude:        1.1,
+		Longitude:       2.2,
+		Metric:          types.AlertMetricWindSpeed,
+		Comparator:      types.AlertComparatorGreaterThan,
+		Threshold:       40,
+		CooldownSeconds: 600,
+		WebhookURL:      "https://example.com/hook",
+		Secret:          "s3cret",
+		Enabled:         true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "rule1", rule.Id)
+	require.Nil(t, rule.LastFiredAt)
+
+	rules, err := repo.GetEnabledAlertRules(1.1, 2.2)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+
+	rules, err = repo.GetEnabledAlertRules(3.3, 2.2)
+	require.NoError(t, err)
+	require.Empty(t, rules)
+
+	rule.Threshold = 50
+	rule, err = repo.UpdateAlertRule(rule)
+	require.NoError(t, err)
+	require.Equal(t, 50.0, rule.Threshold)
+
+	missing, err := repo.UpdateAlertRule(&types.AlertRule{Id: "missing"})
+	require.NoError(t, err)
+	require.Nil(t, missing)
+
+	missing, err = repo.GetAlertRule("missing")
+	require.NoError(t, err)
+	require.Nil(t, missing)
+
+	// Fires once within the cooldown
+	firedAt := time.Now().UTC().Truncate(time.Microsecond)
+	ok, err := repo.FireAlertRule(rule, firedAt, &types.AlertDelivery{Id: "delivery1", RuleId: rule.Id, Event: types.AlertEventFired, Payload: []byte(`{"value":50.1}`)})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = repo.FireAlertRule(rule, firedAt.Add(time.Minute), &types.AlertDelivery{Id: "delivery2", RuleId: rule.Id, Event: types.AlertEventFired, Payload: []byte(`{}`)})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	rule, err = repo.GetAlertRule(rule.Id)
+	require.NoError(t, err)
+	require.Equal(t, firedAt, *rule.LastFiredAt)
+
+	// Claimed once, then not due until the lease is over
+	leaseUntil := time.Now().Add(time.Minute)
+	deliveries, err := repo.ClaimAlertDeliveries(10, leaseUntil)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, "delivery1", deliveries[0].Id)
+	require.Equal(t, 1, deliveries[0].Attempts)
+	require.Equal(t, types.AlertDeliveryPending, deliveries[0].Status)
+	require.JSONEq(t, `{"value":50.1}`, string(deliveries[0].Payload))
+
+	claimed, err := repo.ClaimAlertDeliveries(10, leaseUntil)
+	require.NoError(t, err)
+	require.Empty(t, claimed)
+
+	// A stale attempt isn't saved over a newer claim
+	delivery := deliveries[0]
+	delivery.Status = types.AlertDeliveryDelivered
+	delivery.LastStatusCode = 200
+	deliveredAt := time.Now().UTC()
+	delivery.DeliveredAt = &deliveredAt
+
+	stale := *delivery
+	stale.Attempts = 0
+	ok, err = repo.SaveAlertDeliveryAttempt(&stale)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = repo.SaveAlertDeliveryAttempt(delivery)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// A test delivery is claimed as it's created
+	testDelivery, err := repo.CreateClaimedAlertDelivery(&types.AlertDelivery{Id: "delivery3", RuleId: rule.Id, Event: types.AlertEventTest, Payload: []byte(`{}`)}, leaseUntil)
+	require.NoError(t, err)
+	require.Equal(t, 1, testDelivery.Attempts)
+	require.Equal(t, types.AlertDeliveryPending, testDelivery.Status)
+
+	deliveries, err = repo.ListAlertDeliveries(rule.Id, 1)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, "delivery3", deliveries[0].Id)
+
+	deliveries, err = repo.ListAlertDeliveries(rule.Id, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, types.AlertDeliveryDelivered, deliveries[1].Status)
+	require.Equal(t, 200, deliveries[1].LastStatusCode)
+	require.NotNil(t, deliveries[1].DeliveredAt)
+
+	// Deleting the rule deletes its deliveries
+	ok, err = repo.DeleteAlertRule(rule.Id)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = repo.DeleteAlertRule(rule.Id)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	deliveries, err = repo.ListAlertDeliveries(rule.Id, 10)
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+}
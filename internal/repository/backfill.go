@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const backfillColumns = `id, latitude, longitude, from_date, to_date, next_date, status, imported, skipped, created_at, updated_at`
+
+// StartBackfill creates the backfill of a location's days, or returns the existing one so it carries on where it was left
+func (r *Repository) StartBackfill(lat, long float64, from, to time.Time) (*types.Backfill, error) {
+	row := r.dbClient.QueryRow(`
+    INSERT INTO backfills (id, latitude, longitude, from_date, to_date, next_date)
+    VALUES ($1, $2, $3, $4, $5, $4)
+    ON CONFLICT (latitude, longitude, from_date, to_date) DO UPDATE
+    SET updated_at = NOW()
+    RETURNING `+backfillColumns,
+		uuid.New().String(), lat, long, from.UTC().Format(time.DateOnly), to.UTC().Format(time.DateOnly),
+	)
+
+	return scanBackfill(row)
+}
+
+// SaveBackfillChunk imports the historical weather data of a chunk of days and moves the backfill on to next in a single
+// transaction. Hours the location already has weather data for are skipped, so nothing is imported twice.
+func (r *Repository) SaveBackfillChunk(backfill *types.Backfill, weatherDataList []*types.WeatherData, next time.Time) (*types.Backfill, error) {
+	ids := make([]string, 0, len(weatherDataList))
+	temperatures := make([]float64, 0, len(weatherDataList))
+	windDirections := make([]float64, 0, len(weatherDataList))
+	windSpeeds := make([]float64, 0, len(weatherDataList))
+	sources := make([]string, 0, len(weatherDataList))
+	createdAts := make([]string, 0, len(weatherDataList))
+
+	for _, weatherData := range weatherDataList {
+		ids = append(ids, uuid.New().String())
+		temperatures = append(temperatures, weatherData.Temperature)
+		windDirections = append(windDirections, weatherData.WindDirection)
+		windSpeeds = append(windSpeeds, weatherData.WindSpeed)
+		sources = append(sources, weatherData.Source)
+		createdAts = append(createdAts, weatherData.CreatedAt.UTC().Format(time.RFC3339Nano))
+	}
+
+	tx, err := r.dbClient.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	// Weather data is saved under the backfill's location, the archive may snap it to its grid
+	res, err := tx.Exec(`
+    INSERT INTO weather_data (id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at)
+    SELECT h.id, $1, $2, h.temperature, h.wind_direction, h.wind_speed, h.source, h.created_at
+    FROM unnest($3::text[], $4::float8[], $5::float8[], $6::float8[], $7::text[], $8::timestamptz[])
+      AS h(id, temperature, wind_direction, wind_speed, source, created_at)
+    WHERE NOT EXISTS (
+      SELECT 1
+      FROM weather_data w
+      WHERE w.latitude = $1 AND w.longitude = $2
+        AND w.created_at >= h.created_at AND w.created_at < h.created_at + INTERVAL '1 hour'
+    )
+  `,
+		backfill.Latitude, backfill.Longitude,
+		pq.Array(ids), pq.Array(temperatures), pq.Array(windDirections), pq.Array(windSpeeds), pq.Array(sources), pq.Array(createdAts),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import weather data: %w", err)
+	}
+
+	imported, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only moves on from where this chunk started, a backfill of the same days running concurrently rolls back
+	row := tx.QueryRow(`
+    UPDATE backfills
+    SET next_date = $3, imported = imported + $4, skipped = skipped + $5, updated_at = NOW(),
+      status = CASE WHEN $3::date > to_date THEN 'completed' ELSE 'running' END
+    WHERE id = $1 AND next_date = $2
+    RETURNING `+backfillColumns,
+		backfill.Id, backfill.Next.Format(time.DateOnly), next.UTC().Format(time.DateOnly), imported, int64(len(weatherDataList))-imported,
+	)
+
+	updatedBackfill, err := scanBackfill(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save progress of backfill %s: %w", backfill.Id, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return updatedBackfill, nil
+}
+
+func scanBackfill(row scanner) (*types.Backfill, error) {
+	var backfill types.Backfill
+
+	err := row.Scan(
+		&backfill.Id,
+		&backfill.Latitude,
+		&backfill.Longitude,
+		&backfill.From,
+		&backfill.To,
+		&backfill.Next,
+		&backfill.Status,
+		&backfill.Imported,
+		&backfill.Skipped,
+		&backfill.CreatedAt,
+		&backfill.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dates are days in UTC, the driver returns them and timestamps in the session time zone
+	backfill.From = utcDate(backfill.From)
+	backfill.To = utcDate(backfill.To)
+	backfill.Next = utcDate(backfill.Next)
+	backfill.CreatedAt = backfill.CreatedAt.UTC()
+	backfill.UpdatedAt = backfill.UpdatedAt.UTC()
+
+	return &backfill, nil
+}
+
+func utcDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,89 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIntegrationBackfill(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"; DELETE FROM "weather"."backfills"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+	from := time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	// Weather data saved live during the first hour
+	_, err = dbClient.Exec(`
+    INSERT INTO "weather"."weather_data" (id, latitude, longitude, temperature, wind_speed, wind_direction, created_at)
+    VALUES ('live', 1.1, 2.2, 1, 1, 1, '2020-03-01T00:30:00Z')
+  `)
+	require.NoError(t, err)
+
+	backfill, err := repo.StartBackfill(1.1, 2.2, from, to)
+	require.NoError(t, err)
+	require.Equal(t, from, backfill.From)
+	require.Equal(t, to, backfill.To)
+	require.Equal(t, from, backfill.Next)
+	require.Equal(t, types.BackfillRunning, backfill.Status)
+
+	// Snapped to the archive's grid
+	hours := []*types.WeatherData{
+		{Latitude: 1.125, Longitude: 2.25, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5, Source: "openmeteo-archive", CreatedAt: from},
+		{Latitude: 1.125, Longitude: 2.25, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5, Source: "openmeteo-archive", CreatedAt: from.Add(time.Hour)},
+	}
+
+	backfill, err = repo.SaveBackfillChunk(backfill, hours, from.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, 1, backfill.Imported)
+	require.Equal(t, 1, backfill.Skipped)
+	require.Equal(t, from.AddDate(0, 0, 1), backfill.Next)
+	require.Equal(t, types.BackfillRunning, backfill.Status)
+
+	// A stale copy of the backfill can't move it on again
+	stale := *backfill
+	stale.Next = from
+
+	_, err = repo.SaveBackfillChunk(&stale, hours, from.AddDate(0, 0, 1))
+	require.Error(t, err)
+
+	// Started again, it carries on where it was left
+	resumed, err := repo.StartBackfill(1.1, 2.2, from, to)
+	require.NoError(t, err)
+	require.Equal(t, backfill.Id, resumed.Id)
+	require.Equal(t, from.AddDate(0, 0, 1), resumed.Next)
+
+	backfill, err = repo.SaveBackfillChunk(resumed, []*types.WeatherData{
+		{Latitude: 1.125, Longitude: 2.25, Temperature: 6.6, WindSpeed: 4.4, WindDirection: 5.5, Source: "openmeteo-archive", CreatedAt: to},
+	}, to.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, 2, backfill.Imported)
+	require.Equal(t, types.BackfillCompleted, backfill.Status)
+
+	weatherHistory, err := repo.GetWeatherHistory(1.1, 2.2)
+	require.NoError(t, err)
+	require.Len(t, weatherHistory, 3)
+	require.Equal(t, to, weatherHistory[0].CreatedAt)
+	require.Equal(t, "openmeteo-archive", weatherHistory[0].Source)
+	require.Equal(t, "live", weatherHistory[1].Id)
+	require.Equal(t, from, weatherHistory[2].CreatedAt)
+}
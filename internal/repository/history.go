@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/lib/pq"
+)
+
+// GetLocationsPage returns up to limit locations with weather data ordered by latitude then longitude, after the
+// location when it's not nil. They're read from the latest weather data, which has a row per location and kind.
+func (r *Repository) GetLocationsPage(after *types.Location, limit int) ([]types.Location, error) {
+	var afterLatitude, afterLongitude *float64
+	if after != nil {
+		afterLatitude = &after.Latitude
+		afterLongitude = &after.Longitude
+	}
+
+	rows, err := r.dbClient.Query(`
+    SELECT DISTINCT latitude, longitude
+    FROM latest_weather
+    WHERE $1::float IS NULL OR (latitude, longitude) > ($1::float, $2::float)
+    ORDER BY latitude, longitude
+    LIMIT $3
+  `, afterLatitude, afterLongitude, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanLocations(rows)
+}
+
+// GetWeatherHistoryPages returns a page of up to limit weather data of every location with a single query, each newest
+// first and after the cursor when it's not nil. Weather data is ordered by created at then id, so a page never repeats
+// or skips weather data saved at the same time.
+func (r *Repository) GetWeatherHistoryPages(locations []types.Location, after *types.WeatherHistoryCursor, limit int) ([]*types.WeatherData, error) {
+	latitudes, longitudes := locationArrays(locations)
+
+	var afterCreatedAt *time.Time
+	var afterId *string
+	if after != nil {
+		afterCreatedAt = &after.CreatedAt
+		afterId = &after.Id
+	}
+
+	rows, err := r.dbClient.Query(`
+    SELECT w.id, w.latitude, w.longitude, w.temperature, w.wind_direction, w.wind_speed, w.source, w.created_at
+    FROM unnest($1::float[], $2::float[]) AS l(latitude, longitude)
+    CROSS JOIN LATERAL (
+      SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+      FROM weather_data
+      WHERE latitude = l.latitude AND longitude = l.longitude
+        AND ($3::timestamptz IS NULL OR (created_at, id) < ($3::timestamptz, $4::varchar))
+      ORDER BY created_at DESC, id DESC
+      LIMIT $5
+    ) w
+  `, pq.Array(latitudes), pq.Array(longitudes), afterCreatedAt, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var weatherDataList []*types.WeatherData
+
+	for rows.Next() {
+		weatherData, err := scanWeatherData(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		weatherDataList = append(weatherDataList, weatherData)
+	}
+
+	return weatherDataList, rows.Err()
+}
+
+// GetWeatherAggregates summarises the weather data of every location created from from up to to with a single query,
+// a zero from or to leaves that end open. Every location has an aggregate, in the order of locations.
+func (r *Repository) GetWeatherAggregates(locations []types.Location, from, to time.Time) ([]*types.WeatherAggregate, error) {
+	latitudes, longitudes := locationArrays(locations)
+
+	rows, err := r.dbClient.Query(`
+    SELECT
+      l.latitude, l.longitude, COUNT(w.id), MIN(w.created_at), MAX(w.created_at),
+      MIN(w.temperature), MAX(w.temperature), AVG(w.temperature), AVG(w.wind_speed), MAX(w.wind_speed)
+    FROM unnest($1::float[], $2::float[]) WITH ORDINALITY AS l(latitude, longitude, position)
+    LEFT JOIN weather_data w ON w.latitude = l.latitude AND w.longitude = l.longitude
+      AND ($3::timestamptz IS NULL OR w.created_at >= $3::timestamptz)
+      AND ($4::timestamptz IS NULL OR w.created_at < $4::timestamptz)
+    GROUP BY l.position, l.latitude, l.longitude
+    ORDER BY l.position
+  `, pq.Array(latitudes), pq.Array(longitudes), timeParam(from), timeParam(to))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var aggregates []*types.WeatherAggregate
+
+	for rows.Next() {
+		var aggregate types.WeatherAggregate
+		var first, last sql.NullTime
+		var minTemperature, maxTemperature, avgTemperature, avgWindSpeed, maxWindSpeed sql.NullFloat64
+
+		err := rows.Scan(
+			&aggregate.Location.Latitude,
+			&aggregate.Location.Longitude,
+			&aggregate.Count,
+			&first,
+			&last,
+			&minTemperature,
+			&maxTemperature,
+			&avgTemperature,
+			&avgWindSpeed,
+			&maxWindSpeed,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		aggregate.First = nullTime(first)
+		aggregate.Last = nullTime(last)
+		aggregate.MinTemperature = nullFloat(minTemperature)
+		aggregate.MaxTemperature = nullFloat(maxTemperature)
+		aggregate.AvgTemperature = nullFloat(avgTemperature)
+		aggregate.AvgWindSpeed = nullFloat(avgWindSpeed)
+		aggregate.MaxWindSpeed = nullFloat(maxWindSpeed)
+
+		aggregates = append(aggregates, &aggregate)
+	}
+
+	return aggregates, rows.Err()
+}
+
+// locationArrays splits locations into their latitudes and longitudes, to be unnested together
+func locationArrays(locations []types.Location) ([]float64, []float64) {
+	latitudes := make([]float64, 0, len(locations))
+	longitudes := make([]float64, 0, len(locations))
+
+	for _, location := range locations {
+		latitudes = append(latitudes, location.Latitude)
+		longitudes = append(longitudes, location.Longitude)
+	}
+
+	return latitudes, longitudes
+}
+
+// timeParam passes a zero time as NULL
+func timeParam(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	// The driver returns timestamps in the session time zone, normalise them
+	utc := t.Time.UTC()
+
+	return &utc
+}
+
+func nullFloat(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+
+	return &f.Float64
+}
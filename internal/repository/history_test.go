@@ -0,0 +1,151 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIntegrationLocationsPage(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	for _, location := range []types.Location{{Latitude: 3.3, Longitude: 4.4}, {Latitude: 1.1, Longitude: 2.2}, {Latitude: 1.1, Longitude: 1.1}} {
+		_, err = repo.SaveWeatherData(location.Latitude, location.Longitude, 3.3, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+	}
+
+	// Weather data of a location that has some already doesn't add it again
+	_, err = repo.SaveWeatherData(1.1, 2.2, 3.3, 4.4, 5.5, "openmeteo")
+	require.NoError(t, err)
+
+	locations, err := repo.GetLocationsPage(nil, 2)
+	require.NoError(t, err)
+	require.Equal(t, []types.Location{{Latitude: 1.1, Longitude: 1.1}, {Latitude: 1.1, Longitude: 2.2}}, locations)
+
+	locations, err = repo.GetLocationsPage(&locations[1], 2)
+	require.NoError(t, err)
+	require.Equal(t, []types.Location{{Latitude: 3.3, Longitude: 4.4}}, locations)
+}
+
+func TestIntegrationWeatherHistoryPages(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+	createdAt := time.Date(2023, 10, 4, 6, 53, 38, 0, time.UTC)
+
+	// a2 and a3 are saved at the same time, they're ordered by id
+	_, err = repo.ImportWeatherData([]*types.WeatherData{
+		{Id: "a1", Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindDirection: 4.4, WindSpeed: 5.5, Source: "station", CreatedAt: createdAt},
+		{Id: "a2", Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindDirection: 4.4, WindSpeed: 5.5, Source: "station", CreatedAt: createdAt.Add(time.Hour)},
+		{Id: "a3", Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindDirection: 4.4, WindSpeed: 5.5, Source: "station", CreatedAt: createdAt.Add(time.Hour)},
+		{Id: "b1", Latitude: 3.3, Longitude: 4.4, Temperature: 3.3, WindDirection: 4.4, WindSpeed: 5.5, Source: "station", CreatedAt: createdAt},
+	})
+	require.NoError(t, err)
+
+	locations := []types.Location{
+		{Latitude: 1.1, Longitude: 2.2},
+		{Latitude: 3.3, Longitude: 4.4},
+		{Latitude: 5.5, Longitude: 6.6},
+	}
+
+	weatherDataList, err := repo.GetWeatherHistoryPages(locations, nil, 2)
+	require.NoError(t, err)
+	require.Len(t, weatherDataList, 3)
+	require.Equal(t, "a3", weatherDataList[0].Id)
+	require.Equal(t, "a2", weatherDataList[1].Id)
+	require.Equal(t, "b1", weatherDataList[2].Id)
+
+	// The next page starts after the cursor, even when the cursor's weather data was saved at the same time
+	weatherDataList, err = repo.GetWeatherHistoryPages(locations[:1], &types.WeatherHistoryCursor{CreatedAt: createdAt.Add(time.Hour), Id: "a3"}, 2)
+	require.NoError(t, err)
+	require.Len(t, weatherDataList, 2)
+	require.Equal(t, "a2", weatherDataList[0].Id)
+	require.Equal(t, "a1", weatherDataList[1].Id)
+}
+
+func TestIntegrationWeatherAggregates(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+	createdAt := time.Date(2023, 10, 4, 6, 53, 38, 0, time.UTC)
+
+	_, err = repo.ImportWeatherData([]*types.WeatherData{
+		{Id: "a1", Latitude: 1.1, Longitude: 2.2, Temperature: 10, WindDirection: 4.4, WindSpeed: 5, Source: "station", CreatedAt: createdAt},
+		{Id: "a2", Latitude: 1.1, Longitude: 2.2, Temperature: 20, WindDirection: 4.4, WindSpeed: 15, Source: "station", CreatedAt: createdAt.Add(time.Hour)},
+		{Id: "a3", Latitude: 1.1, Longitude: 2.2, Temperature: 30, WindDirection: 4.4, WindSpeed: 25, Source: "station", CreatedAt: createdAt.Add(2 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	locations := []types.Location{
+		{Latitude: 5.5, Longitude: 6.6},
+		{Latitude: 1.1, Longitude: 2.2},
+	}
+
+	aggregates, err := repo.GetWeatherAggregates(locations, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, aggregates, 2)
+
+	// Every location has an aggregate in the order of locations, even without weather data
+	require.Equal(t, locations[0], aggregates[0].Location)
+	require.Equal(t, 0, aggregates[0].Count)
+	require.Nil(t, aggregates[0].First)
+	require.Nil(t, aggregates[0].AvgTemperature)
+
+	require.Equal(t, locations[1], aggregates[1].Location)
+	require.Equal(t, 3, aggregates[1].Count)
+	require.Equal(t, createdAt, *aggregates[1].First)
+	require.Equal(t, createdAt.Add(2*time.Hour), *aggregates[1].Last)
+	require.Equal(t, 10.0, *aggregates[1].MinTemperature)
+	require.Equal(t, 30.0, *aggregates[1].MaxTemperature)
+	require.InDelta(t, 20.0, *aggregates[1].AvgTemperature, 0.0001)
+	require.InDelta(t, 15.0, *aggregates[1].AvgWindSpeed, 0.0001)
+	require.Equal(t, 25.0, *aggregates[1].MaxWindSpeed)
+
+	// from is inclusive and to is exclusive
+	aggregates, err = repo.GetWeatherAggregates(locations[1:], createdAt.Add(time.Hour), createdAt.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, aggregates, 1)
+	require.Equal(t, 1, aggregates[0].Count)
+	require.Equal(t, 20.0, *aggregates[0].MinTemperature)
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-sample-rest/internal/types"
+)
+
+// ReserveIdempotencyKey stores a key for a request in flight until lockedUntil, taking over the key when it has expired
+// or its request was abandoned in flight. It returns nil when the key was reserved, or the record of the request that
+// holds it.
+func (r *Repository) ReserveIdempotencyKey(key, fingerprint string, lockedUntil time.Time) (*types.IdempotencyRecord, error) {
+	// The key can be released between reserving and reading it, in which case it's reserved again
+	for i := 0; i < 3; i++ {
+		res, err := r.dbClient.Exec(`
+      INSERT INTO idempotency_keys (key, fingerprint, expires_at)
+      VALUES ($1, $2, $3)
+      ON CONFLICT (key) DO UPDATE
+      SET fingerprint = EXCLUDED.fingerprint, status_code = NULL, content_type = NULL, body = NULL, created_at = NOW(), expires_at = EXCLUDED.expires_at
+      WHERE idempotency_keys.expires_at <= NOW()
+    `, key, fingerprint, lockedUntil)
+		if err != nil {
+			return nil, err
+		}
+
+		reserved, err := rowsAffected(res)
+		if err != nil {
+			return nil, err
+		}
+
+		if reserved {
+			return nil, nil
+		}
+
+		record, err := r.getIdempotencyRecord(key)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			return nil, err
+		}
+
+		return record, nil
+	}
+
+	return nil, fmt.Errorf("failed to reserve idempotency key %s", key)
+}
+
+// CompleteIdempotencyKey stores the response of the request holding a key, it's replayed until expiresAt
+func (r *Repository) CompleteIdempotencyKey(key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	_, err := r.dbClient.Exec(`
+    UPDATE idempotency_keys
+    SET status_code = $2, content_type = $3, body = $4, expires_at = $5
+    WHERE key = $1
+  `, key, statusCode, contentType, body, expiresAt)
+
+	return err
+}
+
+// ReleaseIdempotencyKey removes a key whose request didn't complete, so it can be retried
+func (r *Repository) ReleaseIdempotencyKey(key string) error {
+	_, err := r.dbClient.Exec(`
+    DELETE FROM idempotency_keys
+    WHERE key = $1 AND status_code IS NULL
+  `, key)
+
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys returns how many keys were deleted
+func (r *Repository) DeleteExpiredIdempotencyKeys() (int64, error) {
+	res, err := r.dbClient.Exec(`
+    DELETE FROM idempotency_keys
+    WHERE expires_at <= NOW()
+  `)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (r *Repository) getIdempotencyRecord(key string) (*types.IdempotencyRecord, error) {
+	var record types.IdempotencyRecord
+	var statusCode sql.NullInt64
+	var contentType sql.NullString
+
+	err := r.dbClient.QueryRow(`
+    SELECT key, fingerprint, status_code, content_type, body, created_at, expires_at
+    FROM idempotency_keys
+    WHERE key = $1
+  `, key).Scan(
+		&record.Key,
+		&record.Fingerprint,
+		&statusCode,
+		&contentType,
+		&record.Body,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	record.StatusCode = int(statusCode.Int64)
+	record.ContentType = contentType.String
+	record.CreatedAt = record.CreatedAt.UTC()
+	record.ExpiresAt = record.ExpiresAt.UTC()
+
+	return &record, nil
+}
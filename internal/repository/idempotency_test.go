@@ -0,0 +1,105 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/repository"
+
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIntegrationIdempotencyKeys(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."idempotency_keys"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+	lockedUntil := time.Now().Add(time.Minute)
+	expiresAt := time.Now().Add(time.Hour)
+
+	// Reserved by the first request
+	record, err := repo.ReserveIdempotencyKey("abc", "fingerprint", lockedUntil)
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	// Held while in flight
+	record, err = repo.ReserveIdempotencyKey("abc", "fingerprint", lockedUntil)
+	require.NoError(t, err)
+	require.Equal(t, "fingerprint", record.Fingerprint)
+	require.Equal(t, 0, record.StatusCode)
+
+	err = repo.CompleteIdempotencyKey("abc", 200, "application/json", []byte(`{"id":"a1"}`), expiresAt)
+	require.NoError(t, err)
+
+	// Completed keys aren't released
+	err = repo.ReleaseIdempotencyKey("abc")
+	require.NoError(t, err)
+
+	record, err = repo.ReserveIdempotencyKey("abc", "other", lockedUntil)
+	require.NoError(t, err)
+	require.Equal(t, "fingerprint", record.Fingerprint)
+	require.Equal(t, 200, record.StatusCode)
+	require.Equal(t, "application/json", record.ContentType)
+	require.Equal(t, []byte(`{"id":"a1"}`), record.Body)
+	require.WithinDuration(t, expiresAt, record.ExpiresAt, time.Second)
+
+	// Released keys can be reserved again
+	record, err = repo.ReserveIdempotencyKey("def", "fingerprint", lockedUntil)
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	err = repo.ReleaseIdempotencyKey("def")
+	require.NoError(t, err)
+
+	record, err = repo.ReserveIdempotencyKey("def", "other", lockedUntil)
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	// Keys of requests abandoned in flight, e.g. by a crash, are taken over once their lease is over
+	record, err = repo.ReserveIdempotencyKey("ghi", "fingerprint", lockedUntil)
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	record, err = repo.ReserveIdempotencyKey("ghi", "fingerprint", lockedUntil)
+	require.NoError(t, err)
+	require.Equal(t, 0, record.StatusCode)
+
+	_, err = dbClient.Exec(`UPDATE "weather"."idempotency_keys" SET expires_at = NOW() - INTERVAL '1 second' WHERE key = 'ghi'`)
+	require.NoError(t, err)
+
+	record, err = repo.ReserveIdempotencyKey("ghi", "fingerprint", lockedUntil)
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	err = repo.ReleaseIdempotencyKey("ghi")
+	require.NoError(t, err)
+
+	// Expired keys are taken over and deleted
+	_, err = dbClient.Exec(`UPDATE "weather"."idempotency_keys" SET expires_at = NOW() - INTERVAL '1 minute' WHERE key = 'abc'`)
+	require.NoError(t, err)
+
+	record, err = repo.ReserveIdempotencyKey("abc", "other", lockedUntil)
+	require.NoError(t, err)
+	require.Nil(t, record)
+
+	_, err = dbClient.Exec(`UPDATE "weather"."idempotency_keys" SET expires_at = NOW() - INTERVAL '1 minute'`)
+	require.NoError(t, err)
+
+	deleted, err := repo.DeleteExpiredIdempotencyKeys()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), deleted)
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"fmt"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/lib/pq"
+)
+
+// ImportWeatherData copies weather data into a staging table with COPY, then moves it into weather_data in a single
+// transaction. Weather data already saved with the same id and created at is skipped, so an import can be repeated.
+// It returns how many were saved.
+func (r *Repository) ImportWeatherData(weatherDataList []*types.WeatherData) (int, error) {
+	tx, err := r.dbClient.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+    CREATE TEMPORARY TABLE weather_data_import (LIKE weather_data INCLUDING DEFAULTS) ON COMMIT DROP
+  `)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create staging table: %w", err)
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("weather_data_import", "id", "latitude", "longitude", "temperature", "wind_direction", "wind_speed", "source", "created_at"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to start copy: %w", err)
+	}
+
+	for _, weatherData := range weatherDataList {
+		_, err = stmt.Exec(
+			weatherData.Id,
+			weatherData.Latitude,
+			weatherData.Longitude,
+			weatherData.Temperature,
+			weatherData.WindDirection,
+			weatherData.WindSpeed,
+			weatherData.Source,
+			weatherData.CreatedAt,
+		)
+		if err != nil {
+			stmt.Close()
+			return 0, fmt.Errorf("failed to copy weather data: %w", err)
+		}
+	}
+
+	// Flushes the copy
+	_, err = stmt.Exec()
+	if err != nil {
+		stmt.Close()
+		return 0, fmt.Errorf("failed to copy weather data: %w", err)
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`
+    INSERT INTO weather_data (id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at)
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM weather_data_import
+    ON CONFLICT (id, created_at) DO NOTHING
+  `)
+	if err != nil {
+		return 0, fmt.Errorf("failed to import weather data: %w", err)
+	}
+
+	imported, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(imported), nil
+}
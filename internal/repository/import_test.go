@@ -0,0 +1,94 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/importer"
+	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIntegrationImportWeatherData(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+	createdAt := time.Date(2023, 10, 4, 6, 53, 38, 0, time.UTC)
+
+	weatherDataList := []*types.WeatherData{
+		{Id: "a1", Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindDirection: 4.4, WindSpeed: 5.5, Source: "station", CreatedAt: createdAt},
+		{Id: "a2", Latitude: 1.1, Longitude: 2.2, Temperature: 6.6, WindDirection: 4.4, WindSpeed: 5.5, Source: "station", CreatedAt: createdAt.Add(time.Hour)},
+	}
+
+	imported, err := repo.ImportWeatherData(weatherDataList)
+	require.NoError(t, err)
+	require.Equal(t, 2, imported)
+
+	// Importing again skips what's already saved
+	imported, err = repo.ImportWeatherData(append(weatherDataList, &types.WeatherData{
+		Id: "a3", Latitude: 1.1, Longitude: 2.2, Temperature: 9.9, WindDirection: 4.4, WindSpeed: 5.5, Source: "station", CreatedAt: createdAt.Add(2 * time.Hour),
+	}))
+	require.NoError(t, err)
+	require.Equal(t, 1, imported)
+
+	weatherHistory, err := repo.GetWeatherHistory(1.1, 2.2)
+	require.NoError(t, err)
+	require.Len(t, weatherHistory, 3)
+	require.Equal(t, "a3", weatherHistory[0].Id)
+	require.Equal(t, createdAt, weatherHistory[2].CreatedAt)
+	require.Equal(t, "station", weatherHistory[2].Source)
+
+	latest, err := repo.GetLatestWeatherData(1.1, 2.2)
+	require.NoError(t, err)
+	require.Equal(t, "a3", latest.Id)
+}
+
+func TestIntegrationImportFileWithoutIdsAgain(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+	}()
+
+	service := importer.NewService(repository.NewRepository(dbClient))
+
+	csv := strings.Join([]string{
+		"latitude,longitude,temperature,wind_direction,wind_speed,created_at",
+		"1.1,2.2,3.3,4.4,5.5,2023-10-04T06:53:38Z",
+		"1.1,2.2,6.6,4.4,5.5,2023-10-04T07:53:38Z",
+	}, "\n")
+
+	for i := 0; i < 2; i++ {
+		_, err = service.Import(importer.FormatCSV, strings.NewReader(csv))
+		require.NoError(t, err)
+	}
+
+	var count int
+	err = dbClient.QueryRow(`SELECT COUNT(*) FROM "weather"."weather_data"`).Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/google/uuid"
+)
+
+const updateJobColumns = `id, status, provider, locations, results, total, completed, failed, error, attempts, created_at, updated_at, started_at, finished_at`
+
+// CreateUpdateJob queues a job updating the weather data of the given locations
+func (r *Repository) CreateUpdateJob(provider string, locations []types.Location) (*types.UpdateJob, error) {
+	encodedLocations, err := json.Marshal(locations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode locations: %w", err)
+	}
+
+	row := r.dbClient.QueryRow(`
+    INSERT INTO update_jobs (id, provider, locations, total)
+    VALUES ($1, $2, $3::jsonb, $4)
+    RETURNING `+updateJobColumns,
+		uuid.New().String(), provider, string(encodedLocations), len(locations),
+	)
+
+	return scanUpdateJob(row)
+}
+
+// GetUpdateJob returns nil when the job doesn't exist
+func (r *Repository) GetUpdateJob(id string) (*types.UpdateJob, error) {
+	row := r.dbClient.QueryRow(`
+    SELECT `+updateJobColumns+`
+    FROM update_jobs
+    WHERE id = $1
+  `, id)
+
+	job, err := scanUpdateJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ClaimUpdateJob marks the oldest queued job as running and returns it, along with running jobs that haven't made
+// progress since staleBefore as their worker is assumed gone. Stale jobs that were attempted maxAttempts times already
+// are failed instead. It returns nil when there's no job to claim.
+func (r *Repository) ClaimUpdateJob(staleBefore time.Time, maxAttempts int) (*types.UpdateJob, error) {
+	row := r.dbClient.QueryRow(`
+    WITH out_of_attempts AS (
+      UPDATE update_jobs
+      SET status = 'failed', error = 'stopped making progress on each of its ' || attempts || ' attempts', finished_at = NOW(), updated_at = NOW()
+      WHERE status = 'running' AND updated_at < $1 AND attempts >= $2
+    )
+    UPDATE update_jobs
+    SET status = 'running', attempts = attempts + 1, started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+    WHERE id = (
+      SELECT id
+      FROM update_jobs
+      WHERE status = 'queued' OR (status = 'running' AND updated_at < $1 AND attempts < $2)
+      ORDER BY created_at
+      LIMIT 1
+      FOR UPDATE SKIP LOCKED
+    )
+    RETURNING `+updateJobColumns,
+		staleBefore,
+		maxAttempts,
+	)
+
+	job, err := scanUpdateJob(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// SaveUpdateJobProgress adds the results of a batch of locations to a job, it returns false when the job was claimed
+// by another worker since
+func (r *Repository) SaveUpdateJobProgress(job *types.UpdateJob, results map[string]types.UpdateWeatherBatchResult) (bool, error) {
+	encodedResults, err := json.Marshal(results)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode results: %w", err)
+	}
+
+	var failed int
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+
+	res, err := r.dbClient.Exec(`
+    UPDATE update_jobs
+    SET results = results || $3::jsonb, completed = completed + $4, failed = failed + $5, updated_at = NOW()
+    WHERE id = $1 AND attempts = $2 AND status = 'running'
+  `, job.Id, job.Attempts, string(encodedResults), len(results)-failed, failed)
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected(res)
+}
+
+// FinishUpdateJob marks a job as completed or failed, it returns false when the job was claimed by another worker since
+func (r *Repository) FinishUpdateJob(job *types.UpdateJob, status, errorMessage string) (bool, error) {
+	res, err := r.dbClient.Exec(`
+    UPDATE update_jobs
+    SET status = $3, error = $4, finished_at = NOW(), updated_at = NOW()
+    WHERE id = $1 AND attempts = $2 AND status = 'running'
+  `, job.Id, job.Attempts, status, errorMessage)
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected(res)
+}
+
+func rowsAffected(res sql.Result) (bool, error) {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+func scanUpdateJob(row scanner) (*types.UpdateJob, error) {
+	var job types.UpdateJob
+	var locations, results []byte
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(
+		&job.Id,
+		&job.Status,
+		&job.Provider,
+		&locations,
+		&results,
+		&job.Total,
+		&job.Completed,
+		&job.Failed,
+		&job.Error,
+		&job.Attempts,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&startedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(locations, &job.Locations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode locations of job %s: %w", job.Id, err)
+	}
+
+	err = json.Unmarshal(results, &job.Results)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode results of job %s: %w", job.Id, err)
+	}
+
+	// The driver returns timestamps in the session time zone, normalise them
+	job.CreatedAt = job.CreatedAt.UTC()
+	job.UpdatedAt = job.UpdatedAt.UTC()
+
+	if startedAt.Valid {
+		t := startedAt.Time.UTC()
+		job.StartedAt = &t
+	}
+
+	if finishedAt.Valid {
+		t := finishedAt.Time.UTC()
+		job.FinishedAt = &t
+	}
+
+	return &job, nil
+}
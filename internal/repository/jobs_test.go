@@ -0,0 +1,191 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIntegrationUpdateJobs(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."update_jobs"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+	locations := []types.Location{{Latitude: 1.1, Longitude: 2.2}, {Latitude: 3.3, Longitude: 4.4}}
+
+	job, err := repo.CreateUpdateJob("metno", locations)
+	require.NoError(t, err)
+	require.Equal(t, types.UpdateJobQueued, job.Status)
+	require.Equal(t, locations, job.Locations)
+	require.Equal(t, 2, job.Total)
+	require.Empty(t, job.Results)
+	require.Nil(t, job.StartedAt)
+
+	// Claimed by a single worker
+	claimedJob, err := repo.ClaimUpdateJob(time.Now().Add(-time.Minute), 3)
+	require.NoError(t, err)
+	require.Equal(t, job.Id, claimedJob.Id)
+	require.Equal(t, types.UpdateJobRunning, claimedJob.Status)
+	require.Equal(t, 1, claimedJob.Attempts)
+	require.NotNil(t, claimedJob.StartedAt)
+
+	otherJob, err := repo.ClaimUpdateJob(time.Now().Add(-time.Minute), 3)
+	require.NoError(t, err)
+	require.Nil(t, otherJob)
+
+	ok, err := repo.SaveUpdateJobProgress(claimedJob, map[string]types.UpdateWeatherBatchResult{
+		"1.1,2.2": {WeatherData: &types.WeatherData{Id: "a1", Latitude: 1.1, Longitude: 2.2, Source: "metno"}},
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Claimed again once stale, the worker that lost it can't write to it anymore
+	reclaimedJob, err := repo.ClaimUpdateJob(time.Now().Add(time.Minute), 3)
+	require.NoError(t, err)
+	require.Equal(t, job.Id, reclaimedJob.Id)
+	require.Equal(t, 2, reclaimedJob.Attempts)
+	require.Equal(t, 1, reclaimedJob.Completed)
+	require.Equal(t, claimedJob.StartedAt, reclaimedJob.StartedAt)
+
+	ok, err = repo.SaveUpdateJobProgress(claimedJob, map[string]types.UpdateWeatherBatchResult{
+		"3.3,4.4": {Error: "failed to get weather data"},
+	})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = repo.SaveUpdateJobProgress(reclaimedJob, map[string]types.UpdateWeatherBatchResult{
+		"3.3,4.4": {Error: "weather data not found"},
+	})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = repo.FinishUpdateJob(reclaimedJob, types.UpdateJobCompleted, "")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	finishedJob, err := repo.GetUpdateJob(job.Id)
+	require.NoError(t, err)
+	require.Equal(t, types.UpdateJobCompleted, finishedJob.Status)
+	require.Equal(t, 1, finishedJob.Completed)
+	require.Equal(t, 1, finishedJob.Failed)
+	require.NotNil(t, finishedJob.FinishedAt)
+	require.Equal(t, map[string]types.UpdateWeatherBatchResult{
+		"1.1,2.2": {WeatherData: &types.WeatherData{Id: "a1", Latitude: 1.1, Longitude: 2.2, Source: "metno"}},
+		"3.3,4.4": {Error: "weather data not found"},
+	}, finishedJob.Results)
+
+	// Finished jobs aren't claimed again
+	otherJob, err = repo.ClaimUpdateJob(time.Now().Add(time.Minute), 3)
+	require.NoError(t, err)
+	require.Nil(t, otherJob)
+
+	missingJob, err := repo.GetUpdateJob("missing")
+	require.NoError(t, err)
+	require.Nil(t, missingJob)
+}
+
+func TestIntegrationClaimUpdateJobOutOfAttempts(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."update_jobs"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	job, err := repo.CreateUpdateJob("", []types.Location{{Latitude: 1.1, Longitude: 2.2}})
+	require.NoError(t, err)
+
+	// The worker of every attempt stops making progress
+	for attempt := 1; attempt <= 2; attempt++ {
+		claimedJob, err := repo.ClaimUpdateJob(time.Now().Add(time.Minute), 2)
+		require.NoError(t, err)
+		require.Equal(t, attempt, claimedJob.Attempts)
+	}
+
+	otherJob, err := repo.ClaimUpdateJob(time.Now().Add(time.Minute), 2)
+	require.NoError(t, err)
+	require.Nil(t, otherJob)
+
+	failedJob, err := repo.GetUpdateJob(job.Id)
+	require.NoError(t, err)
+	require.Equal(t, types.UpdateJobFailed, failedJob.Status)
+	require.Equal(t, "stopped making progress on each of its 2 attempts", failedJob.Error)
+	require.NotNil(t, failedJob.FinishedAt)
+}
+
+func TestIntegrationClaimUpdateJobConcurrently(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."update_jobs"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	for i := 0; i < 10; i++ {
+		_, err := repo.CreateUpdateJob("", []types.Location{{Latitude: float64(i), Longitude: float64(i)}})
+		require.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	claimed := map[string]int{}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				job, err := repo.ClaimUpdateJob(time.Now().Add(-time.Minute), 3)
+				if err != nil || job == nil {
+					return
+				}
+
+				mu.Lock()
+				claimed[job.Id]++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Every job is claimed exactly once
+	require.Len(t, claimed, 10)
+	for _, n := range claimed {
+		require.Equal(t, 1, n)
+	}
+}
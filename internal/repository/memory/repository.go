@@ -0,0 +1,237 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+
+	"github.com/google/uuid"
+)
+
+type location struct {
+	latitude  float64
+	longitude float64
+}
+
+// Repository keeps weather data in memory, it's meant for local development and tests
+type Repository struct {
+	mu          sync.RWMutex
+	weatherData map[location][]*types.WeatherData
+}
+
+func NewRepository() *Repository {
+	return &Repository{
+		weatherData: map[location][]*types.WeatherData{},
+	}
+}
+
+// GetLatestWeatherData returns the latest weather data of a provider at the location, observations don't replace it
+func (r *Repository) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// No data found when it's nil
+	return latestOfProvider(r.weatherData[location{latitude: lat, longitude: long}]), nil
+}
+
+// GetAllLatestWeatherData returns the latest weather data of a provider of every location, ordered by location
+func (r *Repository) GetAllLatestWeatherData() ([]*types.WeatherData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var weatherDataList []*types.WeatherData
+
+	for _, stored := range r.weatherData {
+		if latest := latestOfProvider(stored); latest != nil {
+			weatherDataList = append(weatherDataList, latest)
+		}
+	}
+
+	sort.Slice(weatherDataList, func(i, j int) bool {
+		if weatherDataList[i].Latitude != weatherDataList[j].Latitude {
+			return weatherDataList[i].Latitude < weatherDataList[j].Latitude
+		}
+
+		return weatherDataList[i].Longitude < weatherDataList[j].Longitude
+	})
+
+	return weatherDataList, nil
+}
+
+// GetLatestWeatherDataBatch returns the latest weather data of a provider of the given locations, locations without it
+// are left out
+func (r *Repository) GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var weatherDataList []*types.WeatherData
+
+	for _, l := range locations {
+		if latest := latestOfProvider(r.weatherData[location{latitude: l.Latitude, longitude: l.Longitude}]); latest != nil {
+			weatherDataList = append(weatherDataList, latest)
+		}
+	}
+
+	return weatherDataList, nil
+}
+
+// latestOfProvider returns a copy of the newest of the stored weather data that isn't an observation, nil when there's
+// none
+func latestOfProvider(stored []*types.WeatherData) *types.WeatherData {
+	// Stored oldest first
+	for i := len(stored) - 1; i >= 0; i-- {
+		if !weatherservice.IsObservationSource(stored[i].Source) {
+			latest := *stored[i]
+			return &latest
+		}
+	}
+
+	return nil
+}
+
+func (r *Repository) GetWeatherHistory(lat, long float64) ([]*types.WeatherData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored := r.weatherData[location{latitude: lat, longitude: long}]
+
+	var weatherDataList []*types.WeatherData
+
+	// Stored oldest first, history is newest first
+	for i := len(stored) - 1; i >= 0; i-- {
+		weatherData := *stored[i]
+		weatherDataList = append(weatherDataList, &weatherData)
+	}
+
+	return weatherDataList, nil
+}
+
+// StreamWeatherHistory calls fn with the location's weather history newest first, the lock isn't held while fn runs
+func (r *Repository) StreamWeatherHistory(lat, long float64, fn func(weatherData *types.WeatherData) error) error {
+	weatherHistory, err := r.GetWeatherHistory(lat, long)
+	if err != nil {
+		return err
+	}
+
+	for _, weatherData := range weatherHistory {
+		err := fn(weatherData)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetWeatherDataSince returns up to limit weather data created at or after since, oldest first, of the location or of
+// every location when it's nil. Weather data created at since is only returned when its id sorts after afterId.
+func (r *Repository) GetWeatherDataSince(l *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	weatherDataList := []*types.WeatherData{}
+	for key, stored := range r.weatherData {
+		if l != nil && (key.latitude != l.Latitude || key.longitude != l.Longitude) {
+			continue
+		}
+
+		// Stored oldest first
+		i := sort.Search(len(stored), func(i int) bool {
+			return !stored[i].CreatedAt.Before(since)
+		})
+
+		for _, weatherData := range stored[i:] {
+			if weatherData.CreatedAt.Equal(since) && weatherData.Id <= afterId {
+				continue
+			}
+
+			saved := *weatherData
+			weatherDataList = append(weatherDataList, &saved)
+		}
+	}
+
+	sort.Slice(weatherDataList, func(i, j int) bool {
+		if !weatherDataList[i].CreatedAt.Equal(weatherDataList[j].CreatedAt) {
+			return weatherDataList[i].CreatedAt.Before(weatherDataList[j].CreatedAt)
+		}
+
+		return weatherDataList[i].Id < weatherDataList[j].Id
+	})
+
+	if len(weatherDataList) > limit {
+		weatherDataList = weatherDataList[:limit]
+	}
+
+	return weatherDataList, nil
+}
+
+func (r *Repository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	weatherData := &types.WeatherData{
+		Id:            uuid.New().String(),
+		Latitude:      lat,
+		Longitude:     long,
+		Temperature:   temperature,
+		WindDirection: windDirection,
+		WindSpeed:     windSpeed,
+		Source:        source,
+		// Same precision as Postgres timestamps
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	r.insert(weatherData)
+
+	saved := *weatherData
+
+	return &saved, nil
+}
+
+// SaveWeatherDataBatch saves the weather data of many locations at once
+func (r *Repository) SaveWeatherDataBatch(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	createdAt := time.Now().UTC().Truncate(time.Microsecond)
+	savedWeatherDataList := make([]*types.WeatherData, 0, len(weatherDataList))
+
+	for _, weatherData := range weatherDataList {
+		stored := &types.WeatherData{
+			Id:            uuid.New().String(),
+			Latitude:      weatherData.Latitude,
+			Longitude:     weatherData.Longitude,
+			Temperature:   weatherData.Temperature,
+			WindDirection: weatherData.WindDirection,
+			WindSpeed:     weatherData.WindSpeed,
+			Source:        weatherData.Source,
+			CreatedAt:     createdAt,
+		}
+
+		r.insert(stored)
+
+		saved := *stored
+		savedWeatherDataList = append(savedWeatherDataList, &saved)
+	}
+
+	return savedWeatherDataList, nil
+}
+
+// insert keeps each location's weather data sorted by created at, oldest first
+func (r *Repository) insert(weatherData *types.WeatherData) {
+	key := location{latitude: weatherData.Latitude, longitude: weatherData.Longitude}
+	stored := r.weatherData[key]
+
+	i := sort.Search(len(stored), func(i int) bool {
+		return stored[i].CreatedAt.After(weatherData.CreatedAt)
+	})
+
+	stored = append(stored, nil)
+	copy(stored[i+1:], stored[i:])
+	stored[i] = weatherData
+
+	r.weatherData[key] = stored
+}
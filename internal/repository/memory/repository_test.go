@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"go-sample-rest/internal/repository/memory"
+	"go-sample-rest/internal/repository/repositorytest"
+	"go-sample-rest/internal/weatherservice"
+)
+
+func TestConformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) weatherservice.WeatherDataRepository {
+		return memory.NewRepository()
+	})
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/lib/pq"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// WeatherDataChannel is the channel the weather_data_notify trigger notifies newly saved weather data on
+	WeatherDataChannel = "weather_data_inserted"
+	// AlertFiredChannel is the channel FireAlertRule notifies the payload of fired alerts on
+	AlertFiredChannel = "alert_fired"
+)
+
+// listenerPingInterval is how often an idle listener checks its connection is still alive
+const listenerPingInterval = 90 * time.Second
+
+// Listeners are called with the notifications of every replica, nil listeners aren't listened for
+type Listeners struct {
+	WeatherData func(weatherData *types.WeatherData)
+	AlertFired  func(payload *types.AlertPayload)
+}
+
+// Listen calls the listeners with the notifications of every replica until the context is done. The listener
+// reconnects on its own, notifications sent while it's disconnected are missed.
+func Listen(ctx context.Context, connString string, listeners Listeners) error {
+	listener := pq.NewListener(connString, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Errorf("notification listener: %v", err)
+		}
+	})
+	defer listener.Close()
+
+	handlers := map[string]func(extra string) error{}
+
+	if listeners.WeatherData != nil {
+		handlers[WeatherDataChannel] = func(extra string) error {
+			var weatherData types.WeatherData
+			err := json.Unmarshal([]byte(extra), &weatherData)
+			if err != nil {
+				return err
+			}
+
+			// Rendered in the session's time zone
+			weatherData.CreatedAt = weatherData.CreatedAt.UTC()
+
+			listeners.WeatherData(&weatherData)
+
+			return nil
+		}
+	}
+
+	if listeners.AlertFired != nil {
+		handlers[AlertFiredChannel] = func(extra string) error {
+			var payload types.AlertPayload
+			err := json.Unmarshal([]byte(extra), &payload)
+			if err != nil {
+				return err
+			}
+
+			listeners.AlertFired(&payload)
+
+			return nil
+		}
+	}
+
+	for channel := range handlers {
+		err := listener.Listen(channel)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", channel, err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			// Sent after the connection is re-established
+			if notification == nil {
+				log.Warn("notification listener reconnected, notifications sent while it was disconnected were missed")
+				continue
+			}
+
+			handler, ok := handlers[notification.Channel]
+			if !ok {
+				continue
+			}
+
+			err := handler(notification.Extra)
+			if err != nil {
+				log.Errorf("failed to decode %s notification: %v", notification.Channel, err)
+			}
+		case <-time.After(listenerPingInterval):
+			go func() {
+				err := listener.Ping()
+				if err != nil {
+					log.Errorf("notification listener ping failed: %v", err)
+				}
+			}()
+		}
+	}
+}
@@ -0,0 +1,102 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIntegrationListen(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"; DELETE FROM "weather"."alert_rules"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notified := make(chan *types.WeatherData, 10)
+	alertsFired := make(chan *types.AlertPayload, 10)
+	listening := make(chan error, 1)
+	go func() {
+		listening <- repository.Listen(ctx, pgConnString, repository.Listeners{
+			WeatherData: func(weatherData *types.WeatherData) {
+				notified <- weatherData
+			},
+			AlertFired: func(payload *types.AlertPayload) {
+				alertsFired <- payload
+			},
+		})
+	}()
+
+	// Historical weather data isn't new
+	_, err = dbClient.Exec(`
+    INSERT INTO "weather"."weather_data" (id, latitude, longitude, temperature, wind_speed, wind_direction, created_at)
+    VALUES ('old', 1.1, 2.2, 1, 1, 1, NOW() - INTERVAL '1 day')
+  `)
+	require.NoError(t, err)
+
+	// The listener may still be connecting, save until it's notified
+	var saved *types.WeatherData
+	var weatherData *types.WeatherData
+	require.Eventually(t, func() bool {
+		saved, err = repo.SaveWeatherData(1.1, 2.2, 3.3, 4.4, 5.5, "openmeteo")
+		if err != nil {
+			return false
+		}
+
+		select {
+		case weatherData = <-notified:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 10*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, err)
+	require.NotEqual(t, "old", weatherData.Id)
+
+	// Drained of the saves it missed while connecting
+	for len(notified) > 0 || weatherData.Id != saved.Id {
+		weatherData = <-notified
+	}
+	require.Equal(t, saved, weatherData)
+
+	// Fired alerts are notified once the rule fires
+	rule, err := repo.CreateAlertRule(&types.AlertRule{Id: "rule1", Latitude: 1.1, Longitude: 2.2, Metric: types.AlertMetricWindSpeed, Comparator: types.AlertComparatorGreaterThan, WebhookURL: "https://example.com/hook", Enabled: true})
+	require.NoError(t, err)
+
+	ok, err := repo.FireAlertRule(rule, time.Now().UTC(), &types.AlertDelivery{Id: "delivery1", RuleId: rule.Id, Event: types.AlertEventFired, Payload: []byte(`{"event":"alert.fired","delivery_id":"delivery1","rule":{"id":"rule1","latitude":1.1,"longitude":2.2}}`)})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	select {
+	case payload := <-alertsFired:
+		require.Equal(t, "delivery1", payload.DeliveryId)
+		require.Equal(t, 1.1, payload.Rule.Latitude)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "alert fired wasn't notified")
+	}
+
+	cancel()
+	require.NoError(t, <-listening)
+}
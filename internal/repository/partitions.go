@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/lib/pq"
+)
+
+// Monthly partitions are named after the UTC month they hold, e.g. weather_data_2023_10
+const partitionNameFormat = "weather_data_2006_01"
+
+// CreatePartition creates the monthly partition of weather data for the UTC month the given time falls in, it returns false
+// when the partition already exists. Weather data of that month which ended up in the default partition is moved to it.
+func (r *Repository) CreatePartition(month time.Time) (bool, error) {
+	from := monthStart(month)
+	to := from.AddDate(0, 1, 0)
+	name := from.Format(partitionNameFormat)
+
+	tx, err := r.dbClient.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	defer tx.Rollback()
+
+	// Serialises partition maintenance across service instances
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('weather_data_partitions'))`)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock partitions: %w", err)
+	}
+
+	var exists bool
+	err = tx.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check partition %s: %w", name, err)
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	// The default partition can't hold weather data of a partition being attached, so it's moved over first
+	_, err = tx.Exec(fmt.Sprintf(`CREATE TABLE %s (LIKE weather_data INCLUDING DEFAULTS)`, pq.QuoteIdentifier(name)))
+	if err != nil {
+		return false, fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+
+	rows, err := tx.Query(fmt.Sprintf(`
+    WITH moved AS (
+      DELETE FROM weather_data_default
+      WHERE created_at >= $1 AND created_at < $2
+      RETURNING *
+    )
+    INSERT INTO %s
+    SELECT * FROM moved
+    RETURNING latitude, longitude
+  `, pq.QuoteIdentifier(name)), from, to)
+	if err != nil {
+		return false, fmt.Errorf("failed to move weather data to partition %s: %w", name, err)
+	}
+
+	movedLocations, err := scanLocations(rows)
+	if err != nil {
+		return false, fmt.Errorf("failed to move weather data to partition %s: %w", name, err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(
+		`ALTER TABLE weather_data ATTACH PARTITION %s FOR VALUES FROM (%s) TO (%s)`,
+		pq.QuoteIdentifier(name),
+		pq.QuoteLiteral(from.Format(time.RFC3339)),
+		pq.QuoteLiteral(to.Format(time.RFC3339)),
+	))
+	if err != nil {
+		return false, fmt.Errorf("failed to attach partition %s: %w", name, err)
+	}
+
+	// Moving weather data out of the default partition removed it from the latest weather data
+	err = refreshLatestWeather(tx, movedLocations)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetPartitions returns the monthly partitions of weather data ordered by month, the default partition isn't included
+func (r *Repository) GetPartitions() ([]types.Partition, error) {
+	rows, err := r.dbClient.Query(`
+    SELECT c.relname
+    FROM pg_inherits i
+    JOIN pg_class c ON c.oid = i.inhrelid
+    WHERE i.inhparent = 'weather_data'::regclass
+    ORDER BY c.relname
+  `)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var partitions []types.Partition
+
+	for rows.Next() {
+		var name string
+
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		from, err := time.Parse(partitionNameFormat, name)
+		if err != nil {
+			// Not a monthly partition
+			continue
+		}
+
+		partitions = append(partitions, types.Partition{
+			Name: name,
+			From: from,
+			To:   from.AddDate(0, 1, 0),
+		})
+	}
+
+	return partitions, rows.Err()
+}
+
+// DropPartition drops a monthly partition along with all of its weather data
+func (r *Repository) DropPartition(name string) error {
+	from, err := time.Parse(partitionNameFormat, name)
+	if err != nil {
+		return fmt.Errorf("not a monthly partition: %s", name)
+	}
+
+	tx, err := r.dbClient.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Dropping a partition doesn't fire the delete trigger, so the latest weather data it held is refreshed here
+	rows, err := tx.Query(`
+    SELECT latitude, longitude
+    FROM latest_weather
+    WHERE created_at >= $1 AND created_at < $2
+  `, from, from.AddDate(0, 1, 0))
+	if err != nil {
+		return fmt.Errorf("failed to get latest weather data in partition %s: %w", name, err)
+	}
+
+	locations, err := scanLocations(rows)
+	if err != nil {
+		return fmt.Errorf("failed to get latest weather data in partition %s: %w", name, err)
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`DROP TABLE %s`, pq.QuoteIdentifier(name)))
+	if err != nil {
+		return fmt.Errorf("failed to drop partition %s: %w", name, err)
+	}
+
+	err = refreshLatestWeather(tx, locations)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// refreshLatestWeather recomputes the latest weather data of the given locations from their remaining weather data
+func refreshLatestWeather(tx *sql.Tx, locations []types.Location) error {
+	for _, location := range locations {
+		_, err := tx.Exec(`SELECT refresh_latest_weather($1, $2)`, location.Latitude, location.Longitude)
+		if err != nil {
+			return fmt.Errorf("failed to refresh latest weather data of %f,%f: %w", location.Latitude, location.Longitude, err)
+		}
+	}
+
+	return nil
+}
+
+// scanLocations scans and closes rows of distinct locations
+func scanLocations(rows *sql.Rows) ([]types.Location, error) {
+	defer rows.Close()
+
+	seen := map[types.Location]bool{}
+	var locations []types.Location
+
+	for rows.Next() {
+		var location types.Location
+
+		err := rows.Scan(&location.Latitude, &location.Longitude)
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+
+	return locations, rows.Err()
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -2,10 +2,12 @@ package repository
 
 import (
 	"database/sql"
+	"time"
 
 	"go-sample-rest/internal/types"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type Repository struct {
@@ -18,26 +20,16 @@ func NewRepository(dbClient *sql.DB) *Repository {
 	}
 }
 
+// GetLatestWeatherData returns the latest weather data of a provider at the location, observations are kept apart in
+// latest_weather so they don't replace it
 func (r *Repository) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
 	row := r.dbClient.QueryRow(`
-    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, created_at
-    FROM weather_data
-    WHERE latitude = $1 AND longitude = $2
-    ORDER BY created_at DESC
-    LIMIT 1
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM latest_weather
+    WHERE latitude = $1 AND longitude = $2 AND NOT observation
   `, lat, long)
 
-	var weatherData types.WeatherData
-
-	err := row.Scan(
-		&weatherData.Id,
-		&weatherData.Latitude,
-		&weatherData.Longitude,
-		&weatherData.Temperature,
-		&weatherData.WindDirection,
-		&weatherData.WindSpeed,
-		&weatherData.CreatedAt,
-	)
+	weatherData, err := scanWeatherData(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// No data found
@@ -46,55 +38,225 @@ func (r *Repository) GetLatestWeatherData(lat, long float64) (*types.WeatherData
 		return nil, err
 	}
 
-	return &weatherData, nil
+	return weatherData, nil
+}
+
+// GetAllLatestWeatherData returns the latest weather data of a provider of every location, ordered by location
+func (r *Repository) GetAllLatestWeatherData() ([]*types.WeatherData, error) {
+	rows, err := r.dbClient.Query(`
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM latest_weather
+    WHERE NOT observation
+    ORDER BY latitude, longitude
+  `)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var weatherDataList []*types.WeatherData
+
+	for rows.Next() {
+		weatherData, err := scanWeatherData(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		weatherDataList = append(weatherDataList, weatherData)
+	}
+
+	return weatherDataList, rows.Err()
+}
+
+// GetLatestWeatherDataBatch returns the latest weather data of a provider of the given locations in a single query,
+// locations without it are left out
+func (r *Repository) GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error) {
+	latitudes, longitudes := locationArrays(locations)
+
+	rows, err := r.dbClient.Query(`
+    SELECT lw.id, lw.latitude, lw.longitude, lw.temperature, lw.wind_direction, lw.wind_speed, lw.source, lw.created_at
+    FROM unnest($1::float[], $2::float[]) AS l(latitude, longitude)
+    JOIN latest_weather lw ON lw.latitude = l.latitude AND lw.longitude = l.longitude AND NOT lw.observation
+  `, pq.Array(latitudes), pq.Array(longitudes))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var weatherDataList []*types.WeatherData
+
+	for rows.Next() {
+		weatherData, err := scanWeatherData(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		weatherDataList = append(weatherDataList, weatherData)
+	}
+
+	return weatherDataList, rows.Err()
 }
 
 func (r *Repository) GetWeatherHistory(lat, long float64) ([]*types.WeatherData, error) {
+	var weatherDataList []*types.WeatherData
+
+	err := r.StreamWeatherHistory(lat, long, func(weatherData *types.WeatherData) error {
+		weatherDataList = append(weatherDataList, weatherData)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return weatherDataList, nil
+}
+
+// StreamWeatherHistory calls fn with the location's weather history newest first as it's read from the cursor,
+// without holding it all in memory. An error returned by fn stops the stream and is returned.
+func (r *Repository) StreamWeatherHistory(lat, long float64, fn func(weatherData *types.WeatherData) error) error {
 	rows, err := r.dbClient.Query(`
-    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, created_at
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
     FROM weather_data
     WHERE latitude = $1 AND longitude = $2
     ORDER BY created_at DESC
   `, lat, long)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	defer rows.Close()
 
-	var weatherDataList []*types.WeatherData
+	for rows.Next() {
+		weatherData, err := scanWeatherData(rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(weatherData)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetWeatherDataSince returns up to limit weather data created at or after since, oldest first, of the location or of
+// every location when it's nil. Weather data created at since is only returned when its id sorts after afterId, so the
+// next page is read from the last weather data returned.
+func (r *Repository) GetWeatherDataSince(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error) {
+	var rows *sql.Rows
+	var err error
+
+	if location != nil {
+		rows, err = r.dbClient.Query(`
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM weather_data
+    WHERE latitude = $1 AND longitude = $2 AND (created_at, id) > ($3, $4)
+    ORDER BY created_at, id
+    LIMIT $5
+  `, location.Latitude, location.Longitude, since, afterId, limit)
+	} else {
+		rows, err = r.dbClient.Query(`
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM weather_data
+    WHERE (created_at, id) > ($1, $2)
+    ORDER BY created_at, id
+    LIMIT $3
+  `, since, afterId, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	defer rows.Close()
+
+	weatherDataList := []*types.WeatherData{}
 	for rows.Next() {
-		var weatherData types.WeatherData
-
-		err := rows.Scan(
-			&weatherData.Id,
-			&weatherData.Latitude,
-			&weatherData.Longitude,
-			&weatherData.Temperature,
-			&weatherData.WindDirection,
-			&weatherData.WindSpeed,
-			&weatherData.CreatedAt,
-		)
+		weatherData, err := scanWeatherData(rows)
 		if err != nil {
 			return nil, err
 		}
 
-		weatherDataList = append(weatherDataList, &weatherData)
+		weatherDataList = append(weatherDataList, weatherData)
 	}
 
-	return weatherDataList, nil
+	return weatherDataList, rows.Err()
 }
 
-func (r *Repository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64) (*types.WeatherData, error) {
+const insertWeatherDataQuery = `
+    INSERT INTO weather_data (id, latitude, longitude, temperature, wind_direction, wind_speed, source)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    RETURNING id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+  `
+
+func (r *Repository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
 	id := uuid.New()
 
-	row := r.dbClient.QueryRow(`
-    INSERT INTO weather_data (id, latitude, longitude, temperature, wind_direction, wind_speed)
-    VALUES ($1, $2, $3, $4, $5, $6)
-    RETURNING id, latitude, longitude, temperature, wind_direction, wind_speed, created_at
-  `, id.String(), lat, long, temperature, windDirection, windSpeed)
+	row := r.dbClient.QueryRow(insertWeatherDataQuery, id.String(), lat, long, temperature, windDirection, windSpeed, source)
+
+	weatherData, err := scanWeatherData(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return weatherData, nil
+}
+
+// SaveWeatherDataBatch saves the weather data of many locations in a single transaction, either all of it is saved or none of it
+func (r *Repository) SaveWeatherDataBatch(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error) {
+	tx, err := r.dbClient.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(insertWeatherDataQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	defer stmt.Close()
+
+	savedWeatherDataList := make([]*types.WeatherData, 0, len(weatherDataList))
+
+	for _, weatherData := range weatherDataList {
+		id := uuid.New()
+
+		row := stmt.QueryRow(
+			id.String(),
+			weatherData.Latitude,
+			weatherData.Longitude,
+			weatherData.Temperature,
+			weatherData.WindDirection,
+			weatherData.WindSpeed,
+			weatherData.Source,
+		)
 
+		savedWeatherData, err := scanWeatherData(row)
+		if err != nil {
+			return nil, err
+		}
+
+		savedWeatherDataList = append(savedWeatherDataList, savedWeatherData)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return savedWeatherDataList, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWeatherData(row scanner) (*types.WeatherData, error) {
 	var weatherData types.WeatherData
 
 	err := row.Scan(
@@ -104,11 +266,15 @@ func (r *Repository) SaveWeatherData(lat, long, temperature, windDirection, wind
 		&weatherData.Temperature,
 		&weatherData.WindDirection,
 		&weatherData.WindSpeed,
+		&weatherData.Source,
 		&weatherData.CreatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// The driver returns timestamps in the session time zone, normalise them
+	weatherData.CreatedAt = weatherData.CreatedAt.UTC()
+
 	return &weatherData, nil
 }
@@ -5,8 +5,11 @@ package repository_test
 import (
 	"database/sql"
 	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/repository/repositorytest"
 	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
 	"testing"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/require"
@@ -49,7 +52,8 @@ func TestIntegrationGetLatestWeatherData(t *testing.T) {
 				Temperature:   3.3,
 				WindSpeed:     4.4,
 				WindDirection: 5.5,
-				CreatedAt:     "2023-10-04T06:53:38.581587Z",
+				Source:        "openmeteo",
+				CreatedAt:     time.Date(2023, 10, 4, 6, 53, 38, 581587000, time.UTC),
 			},
 		},
 	}
@@ -113,7 +117,8 @@ func TestIntegrationGetWeatherHistory(t *testing.T) {
 					Temperature:   3.3,
 					WindSpeed:     3.4,
 					WindDirection: 3.5,
-					CreatedAt:     "2023-10-04T06:57:38.581587Z",
+					Source:        "openmeteo",
+					CreatedAt:     time.Date(2023, 10, 4, 6, 57, 38, 581587000, time.UTC),
 				},
 				{
 					Id:            "a2",
@@ -122,7 +127,8 @@ func TestIntegrationGetWeatherHistory(t *testing.T) {
 					Temperature:   2.3,
 					WindSpeed:     2.4,
 					WindDirection: 2.5,
-					CreatedAt:     "2023-10-04T06:55:38.581587Z",
+					Source:        "openmeteo",
+					CreatedAt:     time.Date(2023, 10, 4, 6, 55, 38, 581587000, time.UTC),
 				},
 				{
 					Id:            "a1",
@@ -131,7 +137,8 @@ func TestIntegrationGetWeatherHistory(t *testing.T) {
 					Temperature:   1.3,
 					WindSpeed:     1.4,
 					WindDirection: 1.5,
-					CreatedAt:     "2023-10-04T06:53:38.581587Z",
+					Source:        "openmeteo",
+					CreatedAt:     time.Date(2023, 10, 4, 6, 53, 38, 581587000, time.UTC),
 				},
 			},
 		},
@@ -173,6 +180,7 @@ func TestIntegrationSaveWeatherData(t *testing.T) {
 		temperature         float64
 		windSpeed           float64
 		windDirection       float64
+		source              string
 		assert              func(repo *repository.Repository, savedWeatherData *types.WeatherData, t *testing.T)
 		expectedWeatherData *types.WeatherData
 	}{
@@ -184,6 +192,7 @@ func TestIntegrationSaveWeatherData(t *testing.T) {
 			temperature:   3.3,
 			windSpeed:     4.4,
 			windDirection: 5.5,
+			source:        "metno",
 			assert: func(repo *repository.Repository, savedWeatherData *types.WeatherData, t *testing.T) {
 				weatherData, err := repo.GetLatestWeatherData(1.1, 2.2)
 
@@ -196,6 +205,7 @@ func TestIntegrationSaveWeatherData(t *testing.T) {
 					Temperature:   3.3,
 					WindSpeed:     4.4,
 					WindDirection: 5.5,
+					Source:        "metno",
 					CreatedAt:     weatherData.CreatedAt,
 				}, weatherData)
 			},
@@ -212,7 +222,7 @@ func TestIntegrationSaveWeatherData(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			repository := repository.NewRepository(dbClient)
-			savedWeatherData, err := repository.SaveWeatherData(tc.lat, tc.long, tc.temperature, tc.windDirection, tc.windSpeed)
+			savedWeatherData, err := repository.SaveWeatherData(tc.lat, tc.long, tc.temperature, tc.windDirection, tc.windSpeed, tc.source)
 			require.NoError(t, err)
 
 			tc.assert(repository, savedWeatherData, t)
@@ -222,3 +232,73 @@ func TestIntegrationSaveWeatherData(t *testing.T) {
 		require.NoError(t, err)
 	}
 }
+
+func TestIntegrationLatestWeather(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	// Weather data saved out of order doesn't replace newer weather data
+	_, err = dbClient.Exec(`
+    INSERT INTO "weather"."weather_data" (id, latitude, longitude, temperature, wind_speed, wind_direction, created_at)
+    VALUES
+      ('a1', 1.1, 2.2, 1, 1, 1, '2023-10-04T06:00:00Z'),
+      ('a2', 1.1, 2.2, 2, 2, 2, '2023-10-04T08:00:00Z'),
+      ('a3', 1.1, 2.2, 3, 3, 3, '2023-10-04T07:00:00Z'),
+      ('b1', 3.3, 4.4, 4, 4, 4, '2023-10-04T06:00:00Z')
+  `)
+	require.NoError(t, err)
+
+	weatherDataList, err := repo.GetAllLatestWeatherData()
+	require.NoError(t, err)
+	require.Len(t, weatherDataList, 2)
+	require.Equal(t, "a2", weatherDataList[0].Id)
+	require.Equal(t, "b1", weatherDataList[1].Id)
+
+	// Deleting the latest weather data falls back to the next most recent
+	_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data" WHERE id IN ('a2', 'b1')`)
+	require.NoError(t, err)
+
+	weatherDataList, err = repo.GetAllLatestWeatherData()
+	require.NoError(t, err)
+	require.Len(t, weatherDataList, 1)
+	require.Equal(t, &types.WeatherData{
+		Id:            "a3",
+		Latitude:      1.1,
+		Longitude:     2.2,
+		Temperature:   3,
+		WindSpeed:     3,
+		WindDirection: 3,
+		Source:        "openmeteo",
+		CreatedAt:     time.Date(2023, 10, 4, 7, 0, 0, 0, time.UTC),
+	}, weatherDataList[0])
+}
+
+func TestIntegrationConformance(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	repositorytest.Run(t, func(t *testing.T) weatherservice.WeatherDataRepository {
+		_, err := dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+
+		return repository.NewRepository(dbClient)
+	})
+
+	_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+	require.NoError(t, err)
+}
@@ -0,0 +1,472 @@
+// Package repositorytest holds the conformance suite every weatherservice.WeatherDataRepository implementation must pass
+package repositorytest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+
+	"github.com/stretchr/testify/require"
+)
+
+// NewRepository returns an empty repository for a single test
+type NewRepository func(t *testing.T) weatherservice.WeatherDataRepository
+
+func Run(t *testing.T, newRepository NewRepository) {
+	t.Run("GetLatestWeatherData", func(t *testing.T) {
+		testGetLatestWeatherData(t, newRepository)
+	})
+	t.Run("GetAllLatestWeatherData", func(t *testing.T) {
+		testGetAllLatestWeatherData(t, newRepository)
+	})
+	t.Run("GetLatestWeatherDataBatch", func(t *testing.T) {
+		testGetLatestWeatherDataBatch(t, newRepository)
+	})
+	t.Run("GetWeatherHistory", func(t *testing.T) {
+		testGetWeatherHistory(t, newRepository)
+	})
+	t.Run("StreamWeatherHistory", func(t *testing.T) {
+		testStreamWeatherHistory(t, newRepository)
+	})
+	t.Run("GetWeatherDataSince", func(t *testing.T) {
+		testGetWeatherDataSince(t, newRepository)
+	})
+	t.Run("SaveWeatherData", func(t *testing.T) {
+		testSaveWeatherData(t, newRepository)
+	})
+	t.Run("SaveWeatherDataBatch", func(t *testing.T) {
+		testSaveWeatherDataBatch(t, newRepository)
+	})
+}
+
+func testGetLatestWeatherData(t *testing.T, newRepository NewRepository) {
+	testCases := []struct {
+		name                string
+		setup               func(repo weatherservice.WeatherDataRepository, t *testing.T)
+		expectedWeatherData *types.WeatherData
+	}{
+		{
+			name: "should not error if weather data does not exist",
+			setup: func(repo weatherservice.WeatherDataRepository, t *testing.T) {
+				// No setup required
+			},
+			expectedWeatherData: nil,
+		},
+		{
+			name: "should not return weather data of other locations",
+			setup: func(repo weatherservice.WeatherDataRepository, t *testing.T) {
+				_, err := repo.SaveWeatherData(2.2, 1.1, 3.3, 4.4, 5.5, "openmeteo")
+				require.NoError(t, err)
+			},
+			expectedWeatherData: nil,
+		},
+		{
+			name: "should return the most recently saved weather data",
+			setup: func(repo weatherservice.WeatherDataRepository, t *testing.T) {
+				_, err := repo.SaveWeatherData(1.1, 2.2, 1.3, 1.4, 1.5, "openmeteo")
+				require.NoError(t, err)
+
+				_, err = repo.SaveWeatherData(1.1, 2.2, 2.3, 2.4, 2.5, "metno")
+				require.NoError(t, err)
+			},
+			expectedWeatherData: &types.WeatherData{
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   2.3,
+				WindDirection: 2.4,
+				WindSpeed:     2.5,
+				Source:        "metno",
+			},
+		},
+		{
+			name: "should not return observations saved after a provider's weather data",
+			setup: func(repo weatherservice.WeatherDataRepository, t *testing.T) {
+				_, err := repo.SaveWeatherData(1.1, 2.2, 1.3, 1.4, 1.5, "openmeteo")
+				require.NoError(t, err)
+
+				_, err = repo.SaveWeatherData(1.1, 2.2, 2.3, 2.4, 2.5, weatherservice.ManualSource)
+				require.NoError(t, err)
+
+				_, err = repo.SaveWeatherData(1.1, 2.2, 3.3, 3.4, 3.5, weatherservice.SensorSourcePrefix+"roof-1")
+				require.NoError(t, err)
+			},
+			expectedWeatherData: &types.WeatherData{
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   1.3,
+				WindDirection: 1.4,
+				WindSpeed:     1.5,
+				Source:        "openmeteo",
+			},
+		},
+		{
+			name: "should not return observations without a provider's weather data",
+			setup: func(repo weatherservice.WeatherDataRepository, t *testing.T) {
+				_, err := repo.SaveWeatherData(1.1, 2.2, 2.3, 2.4, 2.5, weatherservice.ManualSource)
+				require.NoError(t, err)
+			},
+			expectedWeatherData: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newRepository(t)
+			tc.setup(repo, t)
+
+			weatherData, err := repo.GetLatestWeatherData(1.1, 2.2)
+			require.NoError(t, err)
+
+			if tc.expectedWeatherData == nil {
+				require.Nil(t, weatherData)
+				return
+			}
+
+			require.NotNil(t, weatherData)
+			require.Equal(t, tc.expectedWeatherData, withoutGeneratedFields(weatherData))
+		})
+	}
+}
+
+func testGetAllLatestWeatherData(t *testing.T, newRepository NewRepository) {
+	t.Run("should return empty list if weather data does not exist", func(t *testing.T) {
+		repo := newRepository(t)
+
+		weatherDataList, err := repo.GetAllLatestWeatherData()
+		require.NoError(t, err)
+		require.Empty(t, weatherDataList)
+	})
+
+	t.Run("should return the latest weather data of every location ordered by location", func(t *testing.T) {
+		repo := newRepository(t)
+
+		_, err := repo.SaveWeatherData(3.3, 1.1, 1, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+
+		_, err = repo.SaveWeatherData(1.1, 2.2, 2, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+
+		_, err = repo.SaveWeatherData(3.3, 1.1, 3, 4.4, 5.5, "metno")
+		require.NoError(t, err)
+
+		_, err = repo.SaveWeatherData(1.1, 1.1, 4, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+
+		// Observations are left out, whether or not the location has a provider's weather data
+		_, err = repo.SaveWeatherData(1.1, 2.2, 5, 4.4, 5.5, weatherservice.ManualSource)
+		require.NoError(t, err)
+
+		_, err = repo.SaveWeatherData(0.1, 0.1, 6, 4.4, 5.5, weatherservice.ManualSource)
+		require.NoError(t, err)
+
+		latest, err := repo.GetLatestWeatherData(3.3, 1.1)
+		require.NoError(t, err)
+
+		weatherDataList, err := repo.GetAllLatestWeatherData()
+		require.NoError(t, err)
+		require.Len(t, weatherDataList, 3)
+
+		require.Equal(t, &types.WeatherData{Latitude: 1.1, Longitude: 1.1, Temperature: 4, WindDirection: 4.4, WindSpeed: 5.5, Source: "openmeteo"}, withoutGeneratedFields(weatherDataList[0]))
+		require.Equal(t, &types.WeatherData{Latitude: 1.1, Longitude: 2.2, Temperature: 2, WindDirection: 4.4, WindSpeed: 5.5, Source: "openmeteo"}, withoutGeneratedFields(weatherDataList[1]))
+		require.Equal(t, latest, weatherDataList[2])
+	})
+}
+
+func testGetLatestWeatherDataBatch(t *testing.T, newRepository NewRepository) {
+	t.Run("should return empty list if weather data does not exist", func(t *testing.T) {
+		repo := newRepository(t)
+
+		weatherDataList, err := repo.GetLatestWeatherDataBatch([]types.Location{{Latitude: 1.1, Longitude: 2.2}})
+		require.NoError(t, err)
+		require.Empty(t, weatherDataList)
+	})
+
+	t.Run("should return the latest weather data of the requested locations only", func(t *testing.T) {
+		repo := newRepository(t)
+
+		_, err := repo.SaveWeatherData(1.1, 2.2, 1, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+
+		_, err = repo.SaveWeatherData(1.1, 2.2, 2, 4.4, 5.5, "metno")
+		require.NoError(t, err)
+
+		_, err = repo.SaveWeatherData(3.3, 4.4, 3, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+
+		_, err = repo.SaveWeatherData(5.5, 6.6, 4, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+
+		// Observations are left out, whether or not the location has a provider's weather data
+		_, err = repo.SaveWeatherData(1.1, 2.2, 5, 4.4, 5.5, weatherservice.SensorSourcePrefix+"roof-1")
+		require.NoError(t, err)
+
+		_, err = repo.SaveWeatherData(7.7, 8.8, 6, 4.4, 5.5, weatherservice.ManualSource)
+		require.NoError(t, err)
+
+		weatherDataList, err := repo.GetLatestWeatherDataBatch([]types.Location{
+			{Latitude: 1.1, Longitude: 2.2},
+			{Latitude: 3.3, Longitude: 4.4},
+			{Latitude: 7.7, Longitude: 8.8},
+		})
+		require.NoError(t, err)
+
+		var stripped []*types.WeatherData
+		for _, weatherData := range weatherDataList {
+			stripped = append(stripped, withoutGeneratedFields(weatherData))
+		}
+
+		require.ElementsMatch(t, []*types.WeatherData{
+			{Latitude: 1.1, Longitude: 2.2, Temperature: 2, WindDirection: 4.4, WindSpeed: 5.5, Source: "metno"},
+			{Latitude: 3.3, Longitude: 4.4, Temperature: 3, WindDirection: 4.4, WindSpeed: 5.5, Source: "openmeteo"},
+		}, stripped)
+	})
+}
+
+func testGetWeatherHistory(t *testing.T, newRepository NewRepository) {
+	t.Run("should return empty history if weather data does not exist", func(t *testing.T) {
+		repo := newRepository(t)
+
+		weatherHistory, err := repo.GetWeatherHistory(1.1, 2.2)
+		require.NoError(t, err)
+		require.Empty(t, weatherHistory)
+	})
+
+	t.Run("should return the location's weather history newest first", func(t *testing.T) {
+		repo := newRepository(t)
+
+		for i := 1; i <= 3; i++ {
+			_, err := repo.SaveWeatherData(1.1, 2.2, float64(i), 4.4, 5.5, "openmeteo")
+			require.NoError(t, err)
+		}
+
+		_, err := repo.SaveWeatherData(2.2, 1.1, 10, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+
+		weatherHistory, err := repo.GetWeatherHistory(1.1, 2.2)
+		require.NoError(t, err)
+		require.Len(t, weatherHistory, 3)
+
+		for i, weatherData := range weatherHistory {
+			require.Equal(t, &types.WeatherData{
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   float64(3 - i),
+				WindDirection: 4.4,
+				WindSpeed:     5.5,
+				Source:        "openmeteo",
+			}, withoutGeneratedFields(weatherData))
+		}
+
+		require.False(t, weatherHistory[0].CreatedAt.Before(weatherHistory[1].CreatedAt))
+		require.False(t, weatherHistory[1].CreatedAt.Before(weatherHistory[2].CreatedAt))
+	})
+}
+
+func testStreamWeatherHistory(t *testing.T, newRepository NewRepository) {
+	t.Run("should stream the location's weather history newest first", func(t *testing.T) {
+		repo := newRepository(t)
+
+		for i := 1; i <= 3; i++ {
+			_, err := repo.SaveWeatherData(1.1, 2.2, float64(i), 4.4, 5.5, "openmeteo")
+			require.NoError(t, err)
+		}
+
+		_, err := repo.SaveWeatherData(2.2, 1.1, 10, 4.4, 5.5, "openmeteo")
+		require.NoError(t, err)
+
+		var temperatures []float64
+		err = repo.StreamWeatherHistory(1.1, 2.2, func(weatherData *types.WeatherData) error {
+			require.NotEmpty(t, weatherData.Id)
+			temperatures = append(temperatures, weatherData.Temperature)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []float64{3, 2, 1}, temperatures)
+	})
+
+	t.Run("should stop and return the error fn returns", func(t *testing.T) {
+		repo := newRepository(t)
+
+		for i := 1; i <= 3; i++ {
+			_, err := repo.SaveWeatherData(1.1, 2.2, float64(i), 4.4, 5.5, "openmeteo")
+			require.NoError(t, err)
+		}
+
+		fnErr := fmt.Errorf("error")
+		calls := 0
+		err := repo.StreamWeatherHistory(1.1, 2.2, func(weatherData *types.WeatherData) error {
+			calls++
+			return fnErr
+		})
+		require.ErrorIs(t, err, fnErr)
+		require.Equal(t, 1, calls)
+	})
+}
+
+func testGetWeatherDataSince(t *testing.T, newRepository NewRepository) {
+	repo := newRepository(t)
+
+	before, err := repo.SaveWeatherData(1.1, 2.2, 1, 4.4, 5.5, "openmeteo")
+	require.NoError(t, err)
+
+	// Saved strictly after the first one
+	time.Sleep(time.Millisecond)
+
+	first, err := repo.SaveWeatherData(1.1, 2.2, 2, 4.4, 5.5, "openmeteo")
+	require.NoError(t, err)
+
+	batch, err := repo.SaveWeatherDataBatch([]*types.WeatherData{
+		{Latitude: 1.1, Longitude: 2.2, Temperature: 3, WindDirection: 4.4, WindSpeed: 5.5, Source: "openmeteo"},
+		{Latitude: 2.2, Longitude: 1.1, Temperature: 4, WindDirection: 4.4, WindSpeed: 5.5, Source: "openmeteo"},
+	})
+	require.NoError(t, err)
+
+	temperatures := func(weatherDataList []*types.WeatherData) []float64 {
+		result := []float64{}
+		for _, weatherData := range weatherDataList {
+			result = append(result, weatherData.Temperature)
+		}
+
+		return result
+	}
+
+	t.Run("should return the location's weather data created since, oldest first", func(t *testing.T) {
+		weatherDataList, err := repo.GetWeatherDataSince(&types.Location{Latitude: 1.1, Longitude: 2.2}, first.CreatedAt, "", 10)
+		require.NoError(t, err)
+		require.Equal(t, []float64{2, 3}, temperatures(weatherDataList))
+		require.Equal(t, first, weatherDataList[0])
+		require.False(t, before.CreatedAt.Equal(first.CreatedAt))
+	})
+
+	t.Run("should return every location's weather data created since when no location is given", func(t *testing.T) {
+		weatherDataList, err := repo.GetWeatherDataSince(nil, first.CreatedAt, "", 10)
+		require.NoError(t, err)
+		require.Len(t, weatherDataList, 3)
+		require.Equal(t, 2.0, weatherDataList[0].Temperature)
+		require.ElementsMatch(t, []float64{3, 4}, temperatures(weatherDataList[1:]))
+		require.Equal(t, batch[0].CreatedAt, weatherDataList[1].CreatedAt)
+	})
+
+	t.Run("should return up to limit weather data", func(t *testing.T) {
+		weatherDataList, err := repo.GetWeatherDataSince(nil, before.CreatedAt, "", 2)
+		require.NoError(t, err)
+		require.Equal(t, []float64{1, 2}, temperatures(weatherDataList))
+	})
+
+	t.Run("should only return weather data created at since after the id", func(t *testing.T) {
+		weatherDataList, err := repo.GetWeatherDataSince(nil, before.CreatedAt, before.Id, 10)
+		require.NoError(t, err)
+		require.Len(t, weatherDataList, 3)
+		require.Equal(t, first, weatherDataList[0])
+
+		// Saved at the same time as the next one
+		last := weatherDataList[1]
+		next := weatherDataList[2]
+		weatherDataList, err = repo.GetWeatherDataSince(nil, last.CreatedAt, last.Id, 10)
+		require.NoError(t, err)
+		require.Equal(t, []*types.WeatherData{next}, weatherDataList)
+	})
+
+	t.Run("should return no weather data when none was created since", func(t *testing.T) {
+		weatherDataList, err := repo.GetWeatherDataSince(nil, batch[0].CreatedAt.Add(time.Second), "", 10)
+		require.NoError(t, err)
+		require.Empty(t, weatherDataList)
+	})
+}
+
+func testSaveWeatherData(t *testing.T, newRepository NewRepository) {
+	t.Run("should return the saved weather data with generated id and created at", func(t *testing.T) {
+		repo := newRepository(t)
+
+		savedWeatherData, err := repo.SaveWeatherData(1.1, 2.2, 3.3, 4.4, 5.5, "metno")
+		require.NoError(t, err)
+		require.NotEmpty(t, savedWeatherData.Id)
+		require.False(t, savedWeatherData.CreatedAt.IsZero())
+		require.Equal(t, "UTC", savedWeatherData.CreatedAt.Location().String())
+
+		weatherData, err := repo.GetLatestWeatherData(1.1, 2.2)
+		require.NoError(t, err)
+		require.Equal(t, savedWeatherData, weatherData)
+	})
+
+	t.Run("should save weather data concurrently", func(t *testing.T) {
+		repo := newRepository(t)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				_, err := repo.SaveWeatherData(1.1, 2.2, float64(i), 4.4, 5.5, "openmeteo")
+				if err != nil {
+					errs <- fmt.Errorf("failed to save weather data %d: %w", i, err)
+				}
+			}(i)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		weatherHistory, err := repo.GetWeatherHistory(1.1, 2.2)
+		require.NoError(t, err)
+		require.Len(t, weatherHistory, 20)
+	})
+}
+
+func testSaveWeatherDataBatch(t *testing.T, newRepository NewRepository) {
+	t.Run("should return the saved weather data in order with generated ids and created at", func(t *testing.T) {
+		repo := newRepository(t)
+
+		savedWeatherDataList, err := repo.SaveWeatherDataBatch([]*types.WeatherData{
+			{Latitude: 1.1, Longitude: 2.2, Temperature: 1, WindDirection: 4.4, WindSpeed: 5.5, Source: "openmeteo"},
+			{Latitude: 3.3, Longitude: 4.4, Temperature: 2, WindDirection: 4.4, WindSpeed: 5.5, Source: "metno"},
+		})
+		require.NoError(t, err)
+		require.Len(t, savedWeatherDataList, 2)
+		require.NotEqual(t, savedWeatherDataList[0].Id, savedWeatherDataList[1].Id)
+
+		require.Equal(t, &types.WeatherData{Latitude: 1.1, Longitude: 2.2, Temperature: 1, WindDirection: 4.4, WindSpeed: 5.5, Source: "openmeteo"}, withoutGeneratedFields(savedWeatherDataList[0]))
+		require.Equal(t, &types.WeatherData{Latitude: 3.3, Longitude: 4.4, Temperature: 2, WindDirection: 4.4, WindSpeed: 5.5, Source: "metno"}, withoutGeneratedFields(savedWeatherDataList[1]))
+
+		for _, savedWeatherData := range savedWeatherDataList {
+			require.NotEmpty(t, savedWeatherData.Id)
+			require.Equal(t, "UTC", savedWeatherData.CreatedAt.Location().String())
+
+			weatherData, err := repo.GetLatestWeatherData(savedWeatherData.Latitude, savedWeatherData.Longitude)
+			require.NoError(t, err)
+			require.Equal(t, savedWeatherData, weatherData)
+		}
+	})
+
+	t.Run("should save nothing for an empty batch", func(t *testing.T) {
+		repo := newRepository(t)
+
+		savedWeatherDataList, err := repo.SaveWeatherDataBatch(nil)
+		require.NoError(t, err)
+		require.Empty(t, savedWeatherDataList)
+
+		weatherDataList, err := repo.GetAllLatestWeatherData()
+		require.NoError(t, err)
+		require.Empty(t, weatherDataList)
+	})
+}
+
+// withoutGeneratedFields clears the fields repositories generate so weather data can be compared
+func withoutGeneratedFields(weatherData *types.WeatherData) *types.WeatherData {
+	stripped := *weatherData
+	stripped.Id = ""
+	stripped.CreatedAt = time.Time{}
+
+	return &stripped
+}
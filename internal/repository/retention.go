@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-sample-rest/internal/types"
+)
+
+type summaryResolution struct {
+	// field is the date_trunc field of the resolution's buckets
+	field string
+	// width is the interval of a bucket, days are 24 hours as buckets are in UTC
+	width string
+}
+
+var summaryResolutions = map[string]summaryResolution{
+	"hourly": {field: "hour", width: "1 hour"},
+	"daily":  {field: "day", width: "24 hours"},
+}
+
+// lateInsertOverlap is how long before a location's newest summarised weather data is checked again for weather data
+// saved late, a transaction can commit weather data after weather data saved later by another
+const lateInsertOverlap = "1 hour"
+
+// GetLocations returns every location with weather data. They're read from the latest weather data, which has a row
+// per location and kind, rather than from every partition of weather_data.
+func (r *Repository) GetLocations() ([]types.Location, error) {
+	rows, err := r.dbClient.Query(`
+    SELECT DISTINCT latitude, longitude
+    FROM latest_weather
+  `)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanLocations(rows)
+}
+
+// CountRetention counts the summaries retention would create or update and the rows it would delete for a location
+func (r *Repository) CountRetention(lat, long float64, cutoffs types.RetentionCutoffs) (*types.RetentionCounts, error) {
+	var counts types.RetentionCounts
+	var err error
+
+	if !cutoffs.HourlyBefore.IsZero() {
+		counts.HourlySummaries, err = r.countStaleSummaries("hourly", lat, long, cutoffs.HourlyBefore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count hourly summaries: %w", err)
+		}
+	}
+
+	if !cutoffs.DailyBefore.IsZero() {
+		counts.DailySummaries, err = r.countStaleSummaries("daily", lat, long, cutoffs.DailyBefore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count daily summaries: %w", err)
+		}
+	}
+
+	if !cutoffs.DeleteBefore.IsZero() {
+		err = r.dbClient.QueryRow(`
+      SELECT COUNT(*)
+      FROM weather_data
+      WHERE `+expiredRows+`
+    `, lat, long, cutoffs.DeleteBefore, timeParam(cutoffs.DeleteRowsFrom)).Scan(&counts.DeletedRows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count rows to delete: %w", err)
+		}
+	}
+
+	return &counts, nil
+}
+
+// expiredRows matches the rows of location $1,$2 before $3 that aren't in partitions dropped for ending before $4, a
+// NULL $4 drops no partitions. Weather data of months without a partition is in the default partition, which is never
+// dropped.
+const expiredRows = `latitude = $1 AND longitude = $2 AND created_at < $3
+      AND ($4::timestamptz IS NULL OR created_at >= $4::timestamptz OR tableoid = 'weather_data_default'::regclass)`
+
+// ApplyRetention summarises and deletes a location's weather data in a single transaction, summaries are created
+// first so no rows are deleted before they're summarised. Most raw weather data is deleted by dropping whole
+// partitions once every location is summarised, the rest is deleted here.
+func (r *Repository) ApplyRetention(lat, long float64, cutoffs types.RetentionCutoffs) (*types.RetentionCounts, error) {
+	tx, err := r.dbClient.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	var counts types.RetentionCounts
+
+	if !cutoffs.HourlyBefore.IsZero() {
+		counts.HourlySummaries, err = summarise(tx, "hourly", lat, long, cutoffs.HourlyBefore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create hourly summaries: %w", err)
+		}
+	}
+
+	if !cutoffs.DailyBefore.IsZero() {
+		counts.DailySummaries, err = summarise(tx, "daily", lat, long, cutoffs.DailyBefore)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create daily summaries: %w", err)
+		}
+	}
+
+	if !cutoffs.DeleteBefore.IsZero() {
+		result, err := tx.Exec(`
+      DELETE FROM weather_data
+      WHERE `+expiredRows+`
+    `, lat, long, cutoffs.DeleteBefore, timeParam(cutoffs.DeleteRowsFrom))
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete rows: %w", err)
+		}
+
+		counts.DeletedRows, err = result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &counts, nil
+}
+
+// countStaleSummaries counts the buckets that have no summary or more weather data than their summary
+func (r *Repository) countStaleSummaries(resolution string, lat, long float64, before time.Time) (int64, error) {
+	var count int64
+
+	err := r.dbClient.QueryRow(staleBuckets(resolution)+`
+    SELECT COUNT(*)
+    FROM (
+      SELECT b.bucket_start, COUNT(*) AS sample_count
+      FROM buckets b
+      JOIN weather_data w ON w.latitude = $1 AND w.longitude = $2
+        AND w.created_at >= b.bucket_start AND w.created_at < b.bucket_start + $6::interval AND w.created_at < $3
+      GROUP BY b.bucket_start
+    ) c
+    LEFT JOIN weather_data_summary s ON s.latitude = $1 AND s.longitude = $2 AND s.resolution = $4
+      AND s.bucket_start = c.bucket_start
+    WHERE s.sample_count IS NULL OR c.sample_count > s.sample_count
+  `, lat, long, before, resolution, lateInsertOverlap, summaryResolutions[resolution].width).Scan(&count)
+
+	return count, err
+}
+
+// summarise aggregates raw weather data before the given time into summaries. Buckets that are already summarised are
+// summarised again when weather data was saved in them since, only when they gained weather data so a bucket whose raw
+// weather data was deleted keeps its summary.
+func summarise(tx *sql.Tx, resolution string, lat, long float64, before time.Time) (int64, error) {
+	result, err := tx.Exec(staleBuckets(resolution)+`
+    INSERT INTO weather_data_summary (
+      latitude, longitude, resolution, bucket_start, sample_count,
+      temperature_avg, temperature_min, temperature_max,
+      wind_speed_avg, wind_speed_max, wind_direction_avg, last_inserted_at
+    )
+    SELECT
+      $1, $2, $4, b.bucket_start, COUNT(*),
+      AVG(w.temperature), MIN(w.temperature), MAX(w.temperature),
+      AVG(w.wind_speed), MAX(w.wind_speed),
+      -- Wind direction is circular, average it as vectors so 350 and 10 degrees average to 0
+      CAST(MOD(CAST(DEGREES(ATAN2(AVG(SIN(RADIANS(w.wind_direction))), AVG(COS(RADIANS(w.wind_direction))))) + 360 AS numeric), 360) AS float),
+      MAX(w.inserted_at)
+    FROM buckets b
+    JOIN weather_data w ON w.latitude = $1 AND w.longitude = $2
+      AND w.created_at >= b.bucket_start AND w.created_at < b.bucket_start + $6::interval AND w.created_at < $3
+    GROUP BY b.bucket_start
+    ON CONFLICT (latitude, longitude, resolution, bucket_start) DO UPDATE SET
+      sample_count = EXCLUDED.sample_count,
+      temperature_avg = EXCLUDED.temperature_avg,
+      temperature_min = EXCLUDED.temperature_min,
+      temperature_max = EXCLUDED.temperature_max,
+      wind_speed_avg = EXCLUDED.wind_speed_avg,
+      wind_speed_max = EXCLUDED.wind_speed_max,
+      wind_direction_avg = EXCLUDED.wind_direction_avg,
+      last_inserted_at = EXCLUDED.last_inserted_at
+    WHERE EXCLUDED.sample_count > weather_data_summary.sample_count
+  `, lat, long, before, resolution, lateInsertOverlap, summaryResolutions[resolution].width)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// staleBuckets selects the buckets of a location before $3 that may need summarising, rather than every bucket of
+// its history: buckets from its newest summary on, and buckets with weather data saved since its summaries were made.
+// $1 and $2 are the location, $4 the resolution and $5 the overlap of late inserts.
+func staleBuckets(resolution string) string {
+	return fmt.Sprintf(`
+    WITH summarised AS (
+      SELECT MAX(bucket_start) AS bucket_start, MAX(last_inserted_at) AS last_inserted_at
+      FROM weather_data_summary
+      WHERE latitude = $1 AND longitude = $2 AND resolution = $4
+    ),
+    buckets AS (
+      SELECT DISTINCT %s AS bucket_start
+      FROM weather_data, summarised
+      WHERE latitude = $1 AND longitude = $2 AND created_at < $3
+        AND (
+          summarised.bucket_start IS NULL
+          OR created_at >= summarised.bucket_start
+          OR inserted_at > summarised.last_inserted_at - $5::interval
+        )
+    )
+  `, bucketStart(resolution))
+}
+
+// bucketStart returns the expression of the UTC bucket a row's created at falls in
+func bucketStart(resolution string) string {
+	return fmt.Sprintf("date_trunc('%s', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'", summaryResolutions[resolution].field)
+}
@@ -0,0 +1,259 @@
+//go:build integration
+
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/repository"
+	"go-sample-rest/internal/types"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestIntegrationApplyRetention(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	_, err = dbClient.Exec(`
+    INSERT INTO "weather"."weather_data" (id, latitude, longitude, temperature, wind_speed, wind_direction, created_at)
+    VALUES
+      ('a1', 1.1, 2.2, 10, 20, 350, '2023-10-01T06:10:00Z'),
+      ('a2', 1.1, 2.2, 20, 40, 10, '2023-10-01T06:50:00Z'),
+      ('a3', 1.1, 2.2, 30, 60, 90, '2023-10-01T07:10:00Z'),
+      ('a4', 1.1, 2.2, 40, 80, 90, '2023-10-02T07:10:00Z'),
+      ('b1', 3.3, 4.4, 50, 10, 90, '2023-10-01T06:10:00Z')
+  `)
+	require.NoError(t, err)
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data_summary"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	locations, err := repo.GetLocations()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []types.Location{{Latitude: 1.1, Longitude: 2.2}, {Latitude: 3.3, Longitude: 4.4}}, locations)
+
+	cutoffs := types.RetentionCutoffs{
+		HourlyBefore: time.Date(2023, 10, 2, 7, 0, 0, 0, time.UTC),
+		DailyBefore:  time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	counts, err := repo.CountRetention(1.1, 2.2, cutoffs)
+	require.NoError(t, err)
+	require.Equal(t, &types.RetentionCounts{HourlySummaries: 2, DailySummaries: 1}, counts)
+
+	counts, err = repo.ApplyRetention(1.1, 2.2, cutoffs)
+	require.NoError(t, err)
+	require.Equal(t, &types.RetentionCounts{HourlySummaries: 2, DailySummaries: 1}, counts)
+
+	var sampleCount int
+	var temperatureAvg, windSpeedMax, windDirectionAvg float64
+
+	err = dbClient.QueryRow(`
+    SELECT sample_count, temperature_avg, wind_speed_max, wind_direction_avg
+    FROM "weather"."weather_data_summary"
+    WHERE latitude = 1.1 AND longitude = 2.2 AND resolution = 'hourly' AND bucket_start = '2023-10-01T06:00:00Z'
+  `).Scan(&sampleCount, &temperatureAvg, &windSpeedMax, &windDirectionAvg)
+	require.NoError(t, err)
+	require.Equal(t, 2, sampleCount)
+	require.Equal(t, 15.0, temperatureAvg)
+	require.Equal(t, 40.0, windSpeedMax)
+	require.InDelta(t, 0, windDirectionAvg, 0.0001)
+
+	err = dbClient.QueryRow(`
+    SELECT sample_count
+    FROM "weather"."weather_data_summary"
+    WHERE latitude = 1.1 AND longitude = 2.2 AND resolution = 'daily' AND bucket_start = '2023-10-01T00:00:00Z'
+  `).Scan(&sampleCount)
+	require.NoError(t, err)
+	require.Equal(t, 3, sampleCount)
+
+	// Raw weather data is kept without a delete cutoff
+	weatherHistory, err := repo.GetWeatherHistory(1.1, 2.2)
+	require.NoError(t, err)
+	require.Len(t, weatherHistory, 4)
+
+	// Applying again changes nothing
+	counts, err = repo.ApplyRetention(1.1, 2.2, cutoffs)
+	require.NoError(t, err)
+	require.Equal(t, &types.RetentionCounts{}, counts)
+
+	// Weather data saved late in a summarised bucket, e.g. by a backfill, is summarised again
+	_, err = dbClient.Exec(`
+    INSERT INTO "weather"."weather_data" (id, latitude, longitude, temperature, wind_speed, wind_direction, created_at)
+    VALUES ('a5', 1.1, 2.2, 60, 100, 0, '2023-10-01T06:30:00Z')
+  `)
+	require.NoError(t, err)
+
+	counts, err = repo.CountRetention(1.1, 2.2, cutoffs)
+	require.NoError(t, err)
+	require.Equal(t, &types.RetentionCounts{HourlySummaries: 1, DailySummaries: 1}, counts)
+
+	counts, err = repo.ApplyRetention(1.1, 2.2, cutoffs)
+	require.NoError(t, err)
+	require.Equal(t, &types.RetentionCounts{HourlySummaries: 1, DailySummaries: 1}, counts)
+
+	err = dbClient.QueryRow(`
+    SELECT sample_count, temperature_avg, wind_speed_max
+    FROM "weather"."weather_data_summary"
+    WHERE latitude = 1.1 AND longitude = 2.2 AND resolution = 'hourly' AND bucket_start = '2023-10-01T06:00:00Z'
+  `).Scan(&sampleCount, &temperatureAvg, &windSpeedMax)
+	require.NoError(t, err)
+	require.Equal(t, 3, sampleCount)
+	require.Equal(t, 30.0, temperatureAvg)
+	require.Equal(t, 100.0, windSpeedMax)
+
+	// A bucket whose raw weather data was deleted keeps its summary
+	_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data" WHERE id IN ('a1', 'a2')`)
+	require.NoError(t, err)
+
+	counts, err = repo.ApplyRetention(1.1, 2.2, cutoffs)
+	require.NoError(t, err)
+	require.Equal(t, &types.RetentionCounts{}, counts)
+}
+
+func TestIntegrationApplyRetentionDeletesRows(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	// 2019 has no partition, so its weather data is in the default partition
+	_, err = dbClient.Exec(`
+    INSERT INTO "weather"."weather_data" (id, latitude, longitude, temperature, wind_speed, wind_direction, created_at)
+    VALUES
+      ('a1', 1.1, 2.2, 10, 20, 30, '2019-06-01T00:00:00Z'),
+      ('a2', 1.1, 2.2, 10, 20, 30, '2019-06-03T00:00:00Z'),
+      ('b1', 3.3, 4.4, 10, 20, 30, '2019-06-01T00:00:00Z')
+  `)
+	require.NoError(t, err)
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	// Weather data of the default partition is deleted even though its month's partitions are dropped
+	cutoffs := types.RetentionCutoffs{
+		DeleteBefore:   time.Date(2019, 6, 2, 0, 0, 0, 0, time.UTC),
+		DeleteRowsFrom: time.Date(2019, 7, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	counts, err := repo.CountRetention(1.1, 2.2, cutoffs)
+	require.NoError(t, err)
+	require.Equal(t, &types.RetentionCounts{DeletedRows: 1}, counts)
+
+	counts, err = repo.ApplyRetention(1.1, 2.2, cutoffs)
+	require.NoError(t, err)
+	require.Equal(t, &types.RetentionCounts{DeletedRows: 1}, counts)
+
+	weatherHistory, err := repo.GetWeatherHistory(1.1, 2.2)
+	require.NoError(t, err)
+	require.Len(t, weatherHistory, 1)
+	require.Equal(t, "a2", weatherHistory[0].Id)
+
+	// Other locations are kept
+	weatherHistory, err = repo.GetWeatherHistory(3.3, 4.4)
+	require.NoError(t, err)
+	require.Len(t, weatherHistory, 1)
+}
+
+func TestIntegrationPartitions(t *testing.T) {
+	// Initialise db connection
+	dbClient, err := sql.Open("postgres", pgConnString)
+	if err != nil {
+		log.Fatalf("failed to initialise db: %v", err)
+	}
+	defer dbClient.Close()
+
+	// Weather data of a month without a partition ends up in the default partition
+	_, err = dbClient.Exec(`
+    INSERT INTO "weather"."weather_data" (id, latitude, longitude, temperature, wind_speed, wind_direction, created_at)
+    VALUES
+      ('a1', 1.1, 2.2, 10, 20, 30, '2020-01-01T00:00:00Z'),
+      ('a2', 1.1, 2.2, 10, 20, 30, '2020-01-31T23:59:59Z'),
+      ('a3', 1.1, 2.2, 10, 20, 30, '2020-02-01T00:00:00Z'),
+      ('b1', 3.3, 4.4, 10, 20, 30, '2020-01-15T00:00:00Z')
+  `)
+	require.NoError(t, err)
+
+	defer func() {
+		_, err = dbClient.Exec(`DELETE FROM "weather"."weather_data"`)
+		require.NoError(t, err)
+
+		_, err = dbClient.Exec(`DROP TABLE IF EXISTS "weather"."weather_data_2020_01"`)
+		require.NoError(t, err)
+	}()
+
+	repo := repository.NewRepository(dbClient)
+
+	created, err := repo.CreatePartition(time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.True(t, created)
+
+	created, err = repo.CreatePartition(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.False(t, created)
+
+	// The month's weather data is moved out of the default partition
+	var count int
+	err = dbClient.QueryRow(`SELECT COUNT(*) FROM "weather"."weather_data_2020_01"`).Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	err = dbClient.QueryRow(`SELECT COUNT(*) FROM "weather"."weather_data_default"`).Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	partitions, err := repo.GetPartitions()
+	require.NoError(t, err)
+	require.Contains(t, partitions, types.Partition{
+		Name: "weather_data_2020_01",
+		From: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	// Moving weather data between partitions keeps the latest weather data
+	latest, err := repo.GetAllLatestWeatherData()
+	require.NoError(t, err)
+	require.Len(t, latest, 2)
+	require.Equal(t, "a3", latest[0].Id)
+	require.Equal(t, "b1", latest[1].Id)
+
+	err = repo.DropPartition("weather_data_2020_01")
+	require.NoError(t, err)
+
+	weatherHistory, err := repo.GetWeatherHistory(1.1, 2.2)
+	require.NoError(t, err)
+	require.Len(t, weatherHistory, 1)
+	require.Equal(t, "a3", weatherHistory[0].Id)
+
+	// Locations only tracked in the dropped partition are no longer tracked
+	latest, err = repo.GetAllLatestWeatherData()
+	require.NoError(t, err)
+	require.Len(t, latest, 1)
+	require.Equal(t, "a3", latest[0].Id)
+
+	err = repo.DropPartition("weather_data_default")
+	require.Error(t, err)
+}
@@ -0,0 +1 @@
+DROP TABLE "weather_data";
@@ -0,0 +1 @@
+DROP INDEX "weather_data_latitude_longitude_idx";
@@ -0,0 +1,2 @@
+ALTER TABLE "weather_data"
+DROP COLUMN "source";
@@ -0,0 +1,8 @@
+DROP TRIGGER "weather_data_deleted";
+DROP TRIGGER "weather_data_inserted";
+DROP TABLE "latest_weather";
+
+CREATE INDEX "weather_data_latitude_longitude_idx"
+ON "weather_data"(latitude, longitude);
+
+DROP INDEX "weather_data_latitude_longitude_created_at_idx";
@@ -0,0 +1,57 @@
+DROP TRIGGER "weather_data_deleted";
+DROP TRIGGER "weather_data_inserted";
+DROP TABLE "latest_weather";
+
+CREATE TABLE "latest_weather" (
+    "latitude" REAL NOT NULL,
+    "longitude" REAL NOT NULL,
+    "id" TEXT NOT NULL,
+    "temperature" REAL NOT NULL,
+    "wind_direction" REAL NOT NULL,
+    "wind_speed" REAL NOT NULL,
+    "source" TEXT NOT NULL,
+    "created_at" TEXT NOT NULL,
+    CONSTRAINT "latest_weather_pk" PRIMARY KEY ("latitude", "longitude")
+);
+
+-- Weather data can be saved out of order, so only newer weather data replaces the latest
+CREATE TRIGGER "weather_data_inserted"
+AFTER INSERT ON "weather_data"
+BEGIN
+    INSERT INTO "latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    VALUES (NEW."latitude", NEW."longitude", NEW."id", NEW."temperature", NEW."wind_direction", NEW."wind_speed", NEW."source", NEW."created_at")
+    ON CONFLICT ("latitude", "longitude") DO UPDATE
+    SET
+        "id" = excluded."id",
+        "temperature" = excluded."temperature",
+        "wind_direction" = excluded."wind_direction",
+        "wind_speed" = excluded."wind_speed",
+        "source" = excluded."source",
+        "created_at" = excluded."created_at"
+    WHERE "latest_weather"."created_at" <= excluded."created_at";
+END;
+
+CREATE TRIGGER "weather_data_deleted"
+AFTER DELETE ON "weather_data"
+WHEN EXISTS (
+    SELECT 1
+    FROM "latest_weather"
+    WHERE "latitude" = OLD."latitude" AND "longitude" = OLD."longitude" AND "id" = OLD."id"
+)
+BEGIN
+    DELETE FROM "latest_weather"
+    WHERE "latitude" = OLD."latitude" AND "longitude" = OLD."longitude";
+
+    INSERT INTO "latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    SELECT "latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at"
+    FROM "weather_data"
+    WHERE "latitude" = OLD."latitude" AND "longitude" = OLD."longitude"
+    ORDER BY "created_at" DESC
+    LIMIT 1;
+END;
+
+-- SQLite takes the other columns from the row with the MAX created at
+INSERT INTO "latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+SELECT "latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", MAX("created_at")
+FROM "weather_data"
+GROUP BY "latitude", "longitude";
@@ -0,0 +1,10 @@
+CREATE TABLE "weather_data" (
+    "id" TEXT NOT NULL,
+    "latitude" REAL NOT NULL,
+    "longitude" REAL NOT NULL,
+    "temperature" REAL NOT NULL,
+    "wind_direction" REAL NOT NULL,
+    "wind_speed" REAL NOT NULL,
+    "created_at" TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000Z', 'now')),
+    CONSTRAINT "weather_data_pk" PRIMARY KEY ("id")
+);
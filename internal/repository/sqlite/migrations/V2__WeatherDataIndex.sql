@@ -0,0 +1,2 @@
+CREATE INDEX "weather_data_latitude_longitude_idx"
+ON "weather_data"(latitude, longitude);
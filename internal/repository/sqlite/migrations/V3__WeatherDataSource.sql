@@ -0,0 +1,2 @@
+ALTER TABLE "weather_data"
+ADD COLUMN "source" TEXT NOT NULL DEFAULT 'openmeteo';
@@ -0,0 +1,65 @@
+-- Observations are kept apart from the providers' weather data, so a location has a latest weather data of each kind
+-- and observations don't replace the providers' latest weather data. SQLite can't change a primary key, the table is
+-- recreated. Its LIKE ignores case, so sensors are matched by prefix.
+DROP TRIGGER "weather_data_deleted";
+DROP TRIGGER "weather_data_inserted";
+DROP TABLE "latest_weather";
+
+CREATE TABLE "latest_weather" (
+    "latitude" REAL NOT NULL,
+    "longitude" REAL NOT NULL,
+    "observation" INTEGER NOT NULL,
+    "id" TEXT NOT NULL,
+    "temperature" REAL NOT NULL,
+    "wind_direction" REAL NOT NULL,
+    "wind_speed" REAL NOT NULL,
+    "source" TEXT NOT NULL,
+    "created_at" TEXT NOT NULL,
+    CONSTRAINT "latest_weather_pk" PRIMARY KEY ("latitude", "longitude", "observation")
+);
+
+-- Weather data can be saved out of order, so only newer weather data replaces the latest
+CREATE TRIGGER "weather_data_inserted"
+AFTER INSERT ON "weather_data"
+BEGIN
+    INSERT INTO "latest_weather" ("latitude", "longitude", "observation", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    VALUES (
+        NEW."latitude", NEW."longitude", NEW."source" = 'manual' OR substr(NEW."source", 1, 7) = 'sensor:',
+        NEW."id", NEW."temperature", NEW."wind_direction", NEW."wind_speed", NEW."source", NEW."created_at"
+    )
+    ON CONFLICT ("latitude", "longitude", "observation") DO UPDATE
+    SET
+        "id" = excluded."id",
+        "temperature" = excluded."temperature",
+        "wind_direction" = excluded."wind_direction",
+        "wind_speed" = excluded."wind_speed",
+        "source" = excluded."source",
+        "created_at" = excluded."created_at"
+    WHERE "latest_weather"."created_at" <= excluded."created_at";
+END;
+
+CREATE TRIGGER "weather_data_deleted"
+AFTER DELETE ON "weather_data"
+WHEN EXISTS (
+    SELECT 1
+    FROM "latest_weather"
+    WHERE "latitude" = OLD."latitude" AND "longitude" = OLD."longitude" AND "id" = OLD."id"
+)
+BEGIN
+    DELETE FROM "latest_weather"
+    WHERE "latitude" = OLD."latitude" AND "longitude" = OLD."longitude" AND "id" = OLD."id";
+
+    INSERT INTO "latest_weather" ("latitude", "longitude", "observation", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    SELECT "latitude", "longitude", "source" = 'manual' OR substr("source", 1, 7) = 'sensor:', "id", "temperature", "wind_direction", "wind_speed", "source", "created_at"
+    FROM "weather_data"
+    WHERE "latitude" = OLD."latitude" AND "longitude" = OLD."longitude"
+        AND ("source" = 'manual' OR substr("source", 1, 7) = 'sensor:') = (OLD."source" = 'manual' OR substr(OLD."source", 1, 7) = 'sensor:')
+    ORDER BY "created_at" DESC
+    LIMIT 1;
+END;
+
+-- SQLite takes the other columns from the row with the MAX created at
+INSERT INTO "latest_weather" ("latitude", "longitude", "observation", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+SELECT "latitude", "longitude", "source" = 'manual' OR substr("source", 1, 7) = 'sensor:', "id", "temperature", "wind_direction", "wind_speed", "source", MAX("created_at")
+FROM "weather_data"
+GROUP BY "latitude", "longitude", "source" = 'manual' OR substr("source", 1, 7) = 'sensor:';
@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// FS holds the SQLite mirrors of the Postgres migrations in migrations/
+//
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,314 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/google/uuid"
+
+	_ "modernc.org/sqlite"
+)
+
+// Timestamps are stored as fixed width UTC text so they sort chronologically
+const timestampFormat = "2006-01-02T15:04:05.000000Z"
+
+type Repository struct {
+	dbClient *sql.DB
+}
+
+func NewRepository(dbClient *sql.DB) *Repository {
+	return &Repository{
+		dbClient: dbClient,
+	}
+}
+
+// Open opens the SQLite database at the given path. SQLite only allows a single writer,
+// so the connection pool is limited to one connection.
+func Open(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)", path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+// GetLatestWeatherData returns the latest weather data of a provider at the location, observations are kept apart in
+// latest_weather so they don't replace it
+func (r *Repository) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	row := r.dbClient.QueryRow(`
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM latest_weather
+    WHERE latitude = ? AND longitude = ? AND NOT observation
+  `, lat, long)
+
+	weatherData, err := scanWeatherData(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// No data found
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return weatherData, nil
+}
+
+// GetAllLatestWeatherData returns the latest weather data of a provider of every location, ordered by location
+func (r *Repository) GetAllLatestWeatherData() ([]*types.WeatherData, error) {
+	rows, err := r.dbClient.Query(`
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM latest_weather
+    WHERE NOT observation
+    ORDER BY latitude, longitude
+  `)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var weatherDataList []*types.WeatherData
+
+	for rows.Next() {
+		weatherData, err := scanWeatherData(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		weatherDataList = append(weatherDataList, weatherData)
+	}
+
+	return weatherDataList, rows.Err()
+}
+
+// GetLatestWeatherDataBatch returns the latest weather data of a provider of the given locations in a single query,
+// locations without it are left out
+func (r *Repository) GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error) {
+	if len(locations) == 0 {
+		return nil, nil
+	}
+
+	values := make([]string, 0, len(locations))
+	args := make([]any, 0, len(locations)*2)
+
+	for _, location := range locations {
+		values = append(values, "(?, ?)")
+		args = append(args, location.Latitude, location.Longitude)
+	}
+
+	rows, err := r.dbClient.Query(fmt.Sprintf(`
+    WITH l(latitude, longitude) AS (VALUES %s)
+    SELECT lw.id, lw.latitude, lw.longitude, lw.temperature, lw.wind_direction, lw.wind_speed, lw.source, lw.created_at
+    FROM l
+    JOIN latest_weather lw ON lw.latitude = l.latitude AND lw.longitude = l.longitude AND NOT lw.observation
+  `, strings.Join(values, ", ")), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var weatherDataList []*types.WeatherData
+
+	for rows.Next() {
+		weatherData, err := scanWeatherData(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		weatherDataList = append(weatherDataList, weatherData)
+	}
+
+	return weatherDataList, rows.Err()
+}
+
+func (r *Repository) GetWeatherHistory(lat, long float64) ([]*types.WeatherData, error) {
+	var weatherDataList []*types.WeatherData
+
+	err := r.StreamWeatherHistory(lat, long, func(weatherData *types.WeatherData) error {
+		weatherDataList = append(weatherDataList, weatherData)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return weatherDataList, nil
+}
+
+// StreamWeatherHistory calls fn with the location's weather history newest first as it's read from the cursor,
+// without holding it all in memory. An error returned by fn stops the stream and is returned.
+func (r *Repository) StreamWeatherHistory(lat, long float64, fn func(weatherData *types.WeatherData) error) error {
+	rows, err := r.dbClient.Query(`
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM weather_data
+    WHERE latitude = ? AND longitude = ?
+    ORDER BY created_at DESC
+  `, lat, long)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		weatherData, err := scanWeatherData(rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(weatherData)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetWeatherDataSince returns up to limit weather data created at or after since, oldest first, of the location or of
+// every location when it's nil. Weather data created at since is only returned when its id sorts after afterId.
+func (r *Repository) GetWeatherDataSince(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error) {
+	sinceText := since.UTC().Format(timestampFormat)
+
+	var rows *sql.Rows
+	var err error
+
+	if location != nil {
+		rows, err = r.dbClient.Query(`
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM weather_data
+    WHERE latitude = ? AND longitude = ? AND (created_at > ? OR (created_at = ? AND id > ?))
+    ORDER BY created_at, id
+    LIMIT ?
+  `, location.Latitude, location.Longitude, sinceText, sinceText, afterId, limit)
+	} else {
+		rows, err = r.dbClient.Query(`
+    SELECT id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+    FROM weather_data
+    WHERE created_at > ? OR (created_at = ? AND id > ?)
+    ORDER BY created_at, id
+    LIMIT ?
+  `, sinceText, sinceText, afterId, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	weatherDataList := []*types.WeatherData{}
+	for rows.Next() {
+		weatherData, err := scanWeatherData(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		weatherDataList = append(weatherDataList, weatherData)
+	}
+
+	return weatherDataList, rows.Err()
+}
+
+const insertWeatherDataQuery = `
+    INSERT INTO weather_data (id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    RETURNING id, latitude, longitude, temperature, wind_direction, wind_speed, source, created_at
+  `
+
+func (r *Repository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+	id := uuid.New()
+	createdAt := time.Now().UTC().Format(timestampFormat)
+
+	row := r.dbClient.QueryRow(insertWeatherDataQuery, id.String(), lat, long, temperature, windDirection, windSpeed, source, createdAt)
+
+	return scanWeatherData(row)
+}
+
+// SaveWeatherDataBatch saves the weather data of many locations in a single transaction, either all of it is saved or none of it
+func (r *Repository) SaveWeatherDataBatch(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error) {
+	tx, err := r.dbClient.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(insertWeatherDataQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	defer stmt.Close()
+
+	createdAt := time.Now().UTC().Format(timestampFormat)
+	savedWeatherDataList := make([]*types.WeatherData, 0, len(weatherDataList))
+
+	for _, weatherData := range weatherDataList {
+		id := uuid.New()
+
+		row := stmt.QueryRow(
+			id.String(),
+			weatherData.Latitude,
+			weatherData.Longitude,
+			weatherData.Temperature,
+			weatherData.WindDirection,
+			weatherData.WindSpeed,
+			weatherData.Source,
+			createdAt,
+		)
+
+		savedWeatherData, err := scanWeatherData(row)
+		if err != nil {
+			return nil, err
+		}
+
+		savedWeatherDataList = append(savedWeatherDataList, savedWeatherData)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return savedWeatherDataList, nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWeatherData(row scanner) (*types.WeatherData, error) {
+	var weatherData types.WeatherData
+	var createdAt string
+
+	err := row.Scan(
+		&weatherData.Id,
+		&weatherData.Latitude,
+		&weatherData.Longitude,
+		&weatherData.Temperature,
+		&weatherData.WindDirection,
+		&weatherData.WindSpeed,
+		&weatherData.Source,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	weatherData.CreatedAt, err = time.Parse(timestampFormat, createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse created at: %w", err)
+	}
+
+	return &weatherData, nil
+}
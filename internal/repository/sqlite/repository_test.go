@@ -0,0 +1,52 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-sample-rest/internal/migrate"
+	"go-sample-rest/internal/repository/repositorytest"
+	"go-sample-rest/internal/repository/sqlite"
+	"go-sample-rest/internal/repository/sqlite/migrations"
+	"go-sample-rest/internal/weatherservice"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConformance(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) weatherservice.WeatherDataRepository {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "weather.db"))
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			db.Close()
+		})
+
+		migrator, err := migrate.NewMigrator(db, migrate.SQLite, migrations.FS)
+		require.NoError(t, err)
+		require.NoError(t, migrator.Up())
+
+		return sqlite.NewRepository(db)
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "weather.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator, err := migrate.NewMigrator(db, migrate.SQLite, migrations.FS)
+	require.NoError(t, err)
+
+	// Every migration must be reversible
+	require.NoError(t, migrator.Up())
+
+	statuses, err := migrator.Status()
+	require.NoError(t, err)
+
+	for range statuses {
+		require.NoError(t, migrator.Down())
+	}
+
+	require.NoError(t, migrator.Up())
+}
@@ -0,0 +1,288 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Store interface {
+	GetLocations() ([]types.Location, error)
+	CountRetention(lat, long float64, cutoffs types.RetentionCutoffs) (*types.RetentionCounts, error)
+	ApplyRetention(lat, long float64, cutoffs types.RetentionCutoffs) (*types.RetentionCounts, error)
+	GetPartitions() ([]types.Partition, error)
+	DropPartition(name string) error
+}
+
+// Policy of zero days disables that step
+type Policy struct {
+	// DownsampleAfterDays summarises raw weather data older than this many days into hourly and daily summaries
+	DownsampleAfterDays int `json:"downsample_after_days"`
+	// DeleteAfterDays deletes raw weather data older than this many days, mostly a month at a time
+	DeleteAfterDays int `json:"delete_after_days"`
+}
+
+func (p Policy) Validate() error {
+	if p.DownsampleAfterDays < 0 || p.DeleteAfterDays < 0 {
+		return fmt.Errorf("retention days must not be negative")
+	}
+
+	if p.DownsampleAfterDays > 0 && p.DeleteAfterDays > 0 && p.DeleteAfterDays < p.DownsampleAfterDays {
+		return fmt.Errorf("raw weather data must be downsampled before it's deleted")
+	}
+
+	return nil
+}
+
+type LocationPolicy struct {
+	types.Location
+	Policy
+}
+
+type LocationReport struct {
+	types.Location
+	types.RetentionCounts
+	Policy  Policy                 `json:"policy"`
+	Cutoffs types.RetentionCutoffs `json:"cutoffs"`
+}
+
+type Report struct {
+	DryRun      bool             `json:"dry_run"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Locations   []LocationReport `json:"locations"`
+	// DropBefore is the earliest delete cutoff of every policy, partitions ending before it are dropped
+	DropBefore        time.Time         `json:"drop_before"`
+	DroppedPartitions []types.Partition `json:"dropped_partitions"`
+}
+
+type Service struct {
+	store            Store
+	policy           Policy
+	locationPolicies map[types.Location]Policy
+}
+
+func NewService(store Store, policy Policy, locationPolicies []LocationPolicy) (*Service, error) {
+	err := policy.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid retention policy: %w", err)
+	}
+
+	policies := map[types.Location]Policy{}
+	for _, locationPolicy := range locationPolicies {
+		err := locationPolicy.Policy.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention policy for %f,%f: %w", locationPolicy.Latitude, locationPolicy.Longitude, err)
+		}
+
+		policies[locationPolicy.Location] = locationPolicy.Policy
+	}
+
+	return &Service{
+		store:            store,
+		policy:           policy,
+		locationPolicies: policies,
+	}, nil
+}
+
+// Start applies retention every interval until the context is done
+func (s *Service) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Run()
+		if err != nil {
+			log.Errorf("failed to apply retention: %v", err)
+		} else {
+			logReport(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run applies retention to every location
+func (s *Service) Run() (*Report, error) {
+	return s.run(false)
+}
+
+// DryRun reports what retention would do to every location without changing anything
+func (s *Service) DryRun() (*Report, error) {
+	return s.run(true)
+}
+
+func (s *Service) GetReport(w http.ResponseWriter, r *http.Request) {
+	report, err := s.DryRun()
+	if err != nil {
+		log.Errorf("failed to get retention report: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, report)
+}
+
+func (s *Service) run(dryRun bool) (*Report, error) {
+	locations, err := s.store.GetLocations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get locations: %w", err)
+	}
+
+	now := time.Now().UTC()
+
+	report := &Report{
+		DryRun:            dryRun,
+		GeneratedAt:       now,
+		Locations:         []LocationReport{},
+		DropBefore:        s.dropBefore(now),
+		DroppedPartitions: []types.Partition{},
+	}
+
+	// Partitions to drop are picked first, so locations only delete the rows that aren't in them
+	var deleteRowsFrom time.Time
+
+	if !report.DropBefore.IsZero() {
+		partitions, err := s.store.GetPartitions()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partitions: %w", err)
+		}
+
+		for _, partition := range partitions {
+			if partition.To.After(report.DropBefore) {
+				continue
+			}
+
+			report.DroppedPartitions = append(report.DroppedPartitions, partition)
+
+			if partition.To.After(deleteRowsFrom) {
+				deleteRowsFrom = partition.To
+			}
+		}
+	}
+
+	for _, location := range locations {
+		policy := s.policyFor(location)
+		cutoffs := cutoffsFor(policy, now)
+
+		if cutoffs == (types.RetentionCutoffs{}) {
+			continue
+		}
+
+		if !cutoffs.DeleteBefore.IsZero() {
+			cutoffs.DeleteRowsFrom = deleteRowsFrom
+		}
+
+		var counts *types.RetentionCounts
+		if dryRun {
+			counts, err = s.store.CountRetention(location.Latitude, location.Longitude, cutoffs)
+		} else {
+			counts, err = s.store.ApplyRetention(location.Latitude, location.Longitude, cutoffs)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply retention to %f,%f: %w", location.Latitude, location.Longitude, err)
+		}
+
+		report.Locations = append(report.Locations, LocationReport{
+			Location:        location,
+			RetentionCounts: *counts,
+			Policy:          policy,
+			Cutoffs:         cutoffs,
+		})
+	}
+
+	// Every location is summarised by now, so partitions can be dropped
+	if !dryRun {
+		for _, partition := range report.DroppedPartitions {
+			err := s.store.DropPartition(partition.Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to drop partition %s: %w", partition.Name, err)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// dropBefore returns the earliest delete cutoff of the global and every location policy, as a partition holds the weather data
+// of every location. It's zero when any policy keeps raw weather data forever.
+func (s *Service) dropBefore(now time.Time) time.Time {
+	dropBefore := cutoffsFor(s.policy, now).DeleteBefore
+	if dropBefore.IsZero() {
+		return time.Time{}
+	}
+
+	for _, policy := range s.locationPolicies {
+		deleteBefore := cutoffsFor(policy, now).DeleteBefore
+		if deleteBefore.IsZero() {
+			return time.Time{}
+		}
+
+		if deleteBefore.Before(dropBefore) {
+			dropBefore = deleteBefore
+		}
+	}
+
+	return dropBefore
+}
+
+func (s *Service) policyFor(location types.Location) Policy {
+	if policy, ok := s.locationPolicies[location]; ok {
+		return policy
+	}
+
+	return s.policy
+}
+
+// cutoffsFor only summarises complete UTC hours and days. When downsampling, raw weather data is only
+// deleted once its day has been summarised.
+func cutoffsFor(policy Policy, now time.Time) types.RetentionCutoffs {
+	var cutoffs types.RetentionCutoffs
+
+	if policy.DownsampleAfterDays > 0 {
+		downsampleBefore := now.AddDate(0, 0, -policy.DownsampleAfterDays)
+
+		cutoffs.HourlyBefore = downsampleBefore.Truncate(time.Hour)
+		cutoffs.DailyBefore = time.Date(downsampleBefore.Year(), downsampleBefore.Month(), downsampleBefore.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	if policy.DeleteAfterDays > 0 {
+		cutoffs.DeleteBefore = now.AddDate(0, 0, -policy.DeleteAfterDays)
+
+		if !cutoffs.DailyBefore.IsZero() && cutoffs.DailyBefore.Before(cutoffs.DeleteBefore) {
+			cutoffs.DeleteBefore = cutoffs.DailyBefore
+		}
+	}
+
+	return cutoffs
+}
+
+func logReport(report *Report) {
+	var counts types.RetentionCounts
+
+	for _, location := range report.Locations {
+		counts.HourlySummaries += location.HourlySummaries
+		counts.DailySummaries += location.DailySummaries
+		counts.DeletedRows += location.DeletedRows
+	}
+
+	log.Infof(
+		"applied retention to %d locations: %d hourly summaries, %d daily summaries, %d rows deleted, %d partitions dropped",
+		len(report.Locations),
+		counts.HourlySummaries,
+		counts.DailySummaries,
+		counts.DeletedRows,
+		len(report.DroppedPartitions),
+	)
+}
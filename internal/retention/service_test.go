@@ -0,0 +1,312 @@
+package retention_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/retention"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+type call struct {
+	location types.Location
+	cutoffs  types.RetentionCutoffs
+}
+
+type MockStore struct {
+	locations         []types.Location
+	partitions        []types.Partition
+	err               error
+	countCalls        []call
+	applyCalls        []call
+	countsResult      types.RetentionCounts
+	droppedPartitions []string
+}
+
+func (m *MockStore) GetLocations() ([]types.Location, error) {
+	return m.locations, m.err
+}
+
+func (m *MockStore) CountRetention(lat, long float64, cutoffs types.RetentionCutoffs) (*types.RetentionCounts, error) {
+	m.countCalls = append(m.countCalls, call{location: types.Location{Latitude: lat, Longitude: long}, cutoffs: cutoffs})
+	counts := m.countsResult
+
+	return &counts, nil
+}
+
+func (m *MockStore) ApplyRetention(lat, long float64, cutoffs types.RetentionCutoffs) (*types.RetentionCounts, error) {
+	m.applyCalls = append(m.applyCalls, call{location: types.Location{Latitude: lat, Longitude: long}, cutoffs: cutoffs})
+	counts := m.countsResult
+
+	return &counts, nil
+}
+
+func (m *MockStore) GetPartitions() ([]types.Partition, error) {
+	return m.partitions, nil
+}
+
+func (m *MockStore) DropPartition(name string) error {
+	m.droppedPartitions = append(m.droppedPartitions, name)
+
+	return nil
+}
+
+// monthPartition returns the partition of the month the given number of months ago
+func monthPartition(monthsAgo int) types.Partition {
+	now := time.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -monthsAgo, 0)
+
+	return types.Partition{
+		Name: from.Format("weather_data_2006_01"),
+		From: from,
+		To:   from.AddDate(0, 1, 0),
+	}
+}
+
+func TestNewService(t *testing.T) {
+	testCases := []struct {
+		name             string
+		policy           retention.Policy
+		locationPolicies []retention.LocationPolicy
+		shouldError      bool
+	}{
+		{
+			name:   "should accept a policy that deletes after downsampling",
+			policy: retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 30},
+		},
+		{
+			name:   "should accept a disabled policy",
+			policy: retention.Policy{},
+		},
+		{
+			name:        "should error when raw weather data would be deleted before it's downsampled",
+			policy:      retention.Policy{DownsampleAfterDays: 30, DeleteAfterDays: 7},
+			shouldError: true,
+		},
+		{
+			name:   "should error when a location policy is invalid",
+			policy: retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 30},
+			locationPolicies: []retention.LocationPolicy{
+				{Location: types.Location{Latitude: 1.1, Longitude: 2.2}, Policy: retention.Policy{DeleteAfterDays: -1}},
+			},
+			shouldError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := retention.NewService(&MockStore{}, tc.policy, tc.locationPolicies)
+
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	store := &MockStore{
+		locations: []types.Location{
+			{Latitude: 1.1, Longitude: 2.2},
+			{Latitude: 3.3, Longitude: 4.4},
+			{Latitude: 5.5, Longitude: 6.6},
+		},
+		countsResult: types.RetentionCounts{HourlySummaries: 1, DailySummaries: 2},
+	}
+
+	service, err := retention.NewService(store, retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 30}, []retention.LocationPolicy{
+		{Location: types.Location{Latitude: 3.3, Longitude: 4.4}, Policy: retention.Policy{DeleteAfterDays: 90}},
+		{Location: types.Location{Latitude: 5.5, Longitude: 6.6}, Policy: retention.Policy{}},
+	})
+	require.NoError(t, err)
+
+	before := time.Now().UTC()
+	report, err := service.Run()
+	require.NoError(t, err)
+
+	require.False(t, report.DryRun)
+	require.Empty(t, store.countCalls)
+	require.Len(t, store.applyCalls, 2)
+	require.Len(t, report.Locations, 2)
+
+	// Global policy
+	cutoffs := store.applyCalls[0].cutoffs
+	require.Equal(t, types.Location{Latitude: 1.1, Longitude: 2.2}, store.applyCalls[0].location)
+	require.Equal(t, cutoffs.HourlyBefore.Truncate(time.Hour), cutoffs.HourlyBefore)
+	require.WithinDuration(t, before.AddDate(0, 0, -7), cutoffs.HourlyBefore, time.Hour)
+	require.Equal(t, 0, cutoffs.DailyBefore.Hour())
+	require.WithinDuration(t, before.AddDate(0, 0, -7), cutoffs.DailyBefore, 24*time.Hour)
+	require.WithinDuration(t, before.AddDate(0, 0, -30), cutoffs.DeleteBefore, time.Minute)
+	require.Equal(t, types.RetentionCounts{HourlySummaries: 1, DailySummaries: 2}, report.Locations[0].RetentionCounts)
+
+	// Location policy without downsampling
+	cutoffs = store.applyCalls[1].cutoffs
+	require.Equal(t, types.Location{Latitude: 3.3, Longitude: 4.4}, store.applyCalls[1].location)
+	require.True(t, cutoffs.HourlyBefore.IsZero())
+	require.True(t, cutoffs.DailyBefore.IsZero())
+	require.WithinDuration(t, before.AddDate(0, 0, -90), cutoffs.DeleteBefore, time.Minute)
+	require.Equal(t, retention.Policy{DeleteAfterDays: 90}, report.Locations[1].Policy)
+}
+
+func TestRunOnlyDeletesSummarisedDays(t *testing.T) {
+	store := &MockStore{
+		locations: []types.Location{{Latitude: 1.1, Longitude: 2.2}},
+	}
+
+	service, err := retention.NewService(store, retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 7}, nil)
+	require.NoError(t, err)
+
+	_, err = service.Run()
+	require.NoError(t, err)
+
+	cutoffs := store.applyCalls[0].cutoffs
+	require.Equal(t, cutoffs.DailyBefore, cutoffs.DeleteBefore)
+}
+
+func TestRunDropsPartitions(t *testing.T) {
+	// Months apart enough from the cutoffs for the test not to depend on the day of the month
+	partitions := []types.Partition{monthPartition(6), monthPartition(5), monthPartition(2), monthPartition(1), monthPartition(0)}
+
+	testCases := []struct {
+		name               string
+		policy             retention.Policy
+		locationPolicies   []retention.LocationPolicy
+		expectedPartitions []string
+	}{
+		{
+			name:               "should drop partitions that end before the delete cutoff",
+			policy:             retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 100},
+			expectedPartitions: []string{partitions[0].Name, partitions[1].Name},
+		},
+		{
+			name:   "should keep partitions a location policy keeps for longer",
+			policy: retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 30},
+			locationPolicies: []retention.LocationPolicy{
+				{Location: types.Location{Latitude: 1.1, Longitude: 2.2}, Policy: retention.Policy{DeleteAfterDays: 100}},
+			},
+			expectedPartitions: []string{partitions[0].Name, partitions[1].Name},
+		},
+		{
+			name:   "should keep every partition when a location policy keeps weather data forever",
+			policy: retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 30},
+			locationPolicies: []retention.LocationPolicy{
+				{Location: types.Location{Latitude: 1.1, Longitude: 2.2}, Policy: retention.Policy{DownsampleAfterDays: 7}},
+			},
+		},
+		{
+			name:   "should keep every partition when deleting is disabled",
+			policy: retention.Policy{DownsampleAfterDays: 7},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &MockStore{
+				locations:  []types.Location{{Latitude: 1.1, Longitude: 2.2}},
+				partitions: partitions,
+			}
+
+			service, err := retention.NewService(store, tc.policy, tc.locationPolicies)
+			require.NoError(t, err)
+
+			report, err := service.Run()
+			require.NoError(t, err)
+
+			require.Equal(t, tc.expectedPartitions, store.droppedPartitions)
+			require.Len(t, report.DroppedPartitions, len(tc.expectedPartitions))
+		})
+	}
+}
+
+func TestRunDeletesRowsOutsideDroppedPartitions(t *testing.T) {
+	partitions := []types.Partition{monthPartition(6), monthPartition(5), monthPartition(2), monthPartition(1), monthPartition(0)}
+
+	store := &MockStore{
+		locations: []types.Location{
+			{Latitude: 1.1, Longitude: 2.2},
+			{Latitude: 3.3, Longitude: 4.4},
+		},
+		partitions: partitions,
+	}
+
+	service, err := retention.NewService(store, retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 100}, []retention.LocationPolicy{
+		{Location: types.Location{Latitude: 3.3, Longitude: 4.4}, Policy: retention.Policy{DeleteAfterDays: 10}},
+	})
+	require.NoError(t, err)
+
+	_, err = service.Run()
+	require.NoError(t, err)
+
+	require.Equal(t, []string{partitions[0].Name, partitions[1].Name}, store.droppedPartitions)
+	require.Len(t, store.applyCalls, 2)
+
+	// Locations deleting weather data delete it row by row from the end of the dropped partitions, including a
+	// location deleting it sooner than partitions are dropped
+	require.Equal(t, partitions[1].To, store.applyCalls[0].cutoffs.DeleteRowsFrom)
+	require.Equal(t, partitions[1].To, store.applyCalls[1].cutoffs.DeleteRowsFrom)
+	require.WithinDuration(t, time.Now().AddDate(0, 0, -10), store.applyCalls[1].cutoffs.DeleteBefore, time.Minute)
+}
+
+func TestDryRun(t *testing.T) {
+	store := &MockStore{
+		locations:    []types.Location{{Latitude: 1.1, Longitude: 2.2}},
+		partitions:   []types.Partition{monthPartition(3), monthPartition(0)},
+		countsResult: types.RetentionCounts{HourlySummaries: 3},
+	}
+
+	service, err := retention.NewService(store, retention.Policy{DownsampleAfterDays: 7, DeleteAfterDays: 30}, nil)
+	require.NoError(t, err)
+
+	report, err := service.DryRun()
+	require.NoError(t, err)
+
+	require.True(t, report.DryRun)
+	require.Empty(t, store.applyCalls)
+	require.Empty(t, store.droppedPartitions)
+	require.Len(t, store.countCalls, 1)
+	require.Equal(t, int64(3), report.Locations[0].HourlySummaries)
+	require.Equal(t, []types.Partition{monthPartition(3)}, report.DroppedPartitions)
+}
+
+func TestGetReport(t *testing.T) {
+	testCases := []struct {
+		name               string
+		store              *MockStore
+		expectedStatusCode int
+	}{
+		{
+			name:               "should return internal error when store returns an error",
+			store:              &MockStore{err: fmt.Errorf("error")},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+		{
+			name: "should return the dry run report",
+			store: &MockStore{
+				locations: []types.Location{{Latitude: 1.1, Longitude: 2.2}},
+			},
+			expectedStatusCode: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			service, err := retention.NewService(tc.store, retention.Policy{DeleteAfterDays: 30}, nil)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest("GET", "/retention/report", nil)
+			w := httptest.NewRecorder()
+
+			service.GetReport(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Empty(t, tc.store.applyCalls)
+		})
+	}
+}
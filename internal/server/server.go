@@ -11,20 +11,91 @@ import (
 )
 
 type Server struct {
-	port           int
-	weatherService WeatherService
+	port                 int
+	weatherService       WeatherService
+	providerStatsService ProviderStatsService
+	retentionService     RetentionService
+	jobService           JobService
+	backfillService      BackfillService
+	importService        ImportService
+	alertService         AlertService
+	socketService        SocketService
+	graphQLService       GraphQLService
 }
 
 type WeatherService interface {
 	GetLatestWeather(w http.ResponseWriter, r *http.Request)
+	GetAllLatestWeather(w http.ResponseWriter, r *http.Request)
+	GetLatestWeatherBatch(w http.ResponseWriter, r *http.Request)
 	GetWeatherHistory(w http.ResponseWriter, r *http.Request)
 	UpdateWeather(w http.ResponseWriter, r *http.Request)
+	UpdateWeatherBatch(w http.ResponseWriter, r *http.Request)
+	SubmitObservation(w http.ResponseWriter, r *http.Request)
+	StreamWeather(w http.ResponseWriter, r *http.Request)
+	StreamAllWeather(w http.ResponseWriter, r *http.Request)
 }
 
-func NewServer(port int, weatherService WeatherService) *Server {
+type ProviderStatsService interface {
+	GetStats(w http.ResponseWriter, r *http.Request)
+}
+
+type RetentionService interface {
+	GetReport(w http.ResponseWriter, r *http.Request)
+}
+
+type BackfillService interface {
+	Backfill(w http.ResponseWriter, r *http.Request)
+}
+
+type ImportService interface {
+	ImportWeather(w http.ResponseWriter, r *http.Request)
+}
+
+type AlertService interface {
+	CreateRule(w http.ResponseWriter, r *http.Request)
+	ListRules(w http.ResponseWriter, r *http.Request)
+	GetRule(w http.ResponseWriter, r *http.Request)
+	UpdateRule(w http.ResponseWriter, r *http.Request)
+	DeleteRule(w http.ResponseWriter, r *http.Request)
+	ListDeliveries(w http.ResponseWriter, r *http.Request)
+	TestRule(w http.ResponseWriter, r *http.Request)
+}
+
+type SocketService interface {
+	Serve(w http.ResponseWriter, r *http.Request)
+}
+
+type GraphQLService interface {
+	Serve(w http.ResponseWriter, r *http.Request)
+}
+
+type JobService interface {
+	CreateJob(w http.ResponseWriter, r *http.Request)
+	GetJob(w http.ResponseWriter, r *http.Request)
+}
+
+// Options are the services not every storage supports, the routes of the ones left nil aren't served
+type Options struct {
+	RetentionService RetentionService
+	JobService       JobService
+	BackfillService  BackfillService
+	ImportService    ImportService
+	AlertService     AlertService
+	GraphQLService   GraphQLService
+}
+
+func NewServer(port int, weatherService WeatherService, providerStatsService ProviderStatsService, socketService SocketService, options Options) *Server {
 	return &Server{
-		port:           port,
-		weatherService: weatherService,
+		port:                 port,
+		weatherService:       weatherService,
+		providerStatsService: providerStatsService,
+		retentionService:     options.RetentionService,
+		jobService:           options.JobService,
+		backfillService:      options.BackfillService,
+		importService:        options.ImportService,
+		alertService:         options.AlertService,
+		socketService:        socketService,
+		graphQLService:       options.GraphQLService,
 	}
 }
 
@@ -38,11 +109,53 @@ func (s *Server) Start() {
 	r.Use(middleware.Recoverer)
 
 	r.Route("/weather", func(r chi.Router) {
+		r.Get("/latest", s.weatherService.GetAllLatestWeather)
+		r.Post("/latest:batch", s.weatherService.GetLatestWeatherBatch)
 		r.Get("/{lat},{long}/latest", s.weatherService.GetLatestWeather)
 		r.Get("/{lat},{long}/history", s.weatherService.GetWeatherHistory)
+		r.Get("/stream", s.weatherService.StreamAllWeather)
+		r.Get("/{lat},{long}/stream", s.weatherService.StreamWeather)
 		r.Post("/{lat},{long}/update", s.weatherService.UpdateWeather)
+		r.Post("/update:batch", s.weatherService.UpdateWeatherBatch)
+		r.Post("/{lat},{long}/observations", s.weatherService.SubmitObservation)
+
+		if s.backfillService != nil {
+			r.Post("/{lat},{long}/backfill", s.backfillService.Backfill)
+		}
+
+		if s.importService != nil {
+			r.Post("/import", s.importService.ImportWeather)
+		}
+
+		if s.jobService != nil {
+			r.Post("/jobs", s.jobService.CreateJob)
+			r.Get("/jobs/{id}", s.jobService.GetJob)
+		}
 	})
 
+	r.Get("/providers/stats", s.providerStatsService.GetStats)
+	r.Get("/ws", s.socketService.Serve)
+
+	if s.alertService != nil {
+		r.Route("/alerts/rules", func(r chi.Router) {
+			r.Post("/", s.alertService.CreateRule)
+			r.Get("/", s.alertService.ListRules)
+			r.Get("/{id}", s.alertService.GetRule)
+			r.Put("/{id}", s.alertService.UpdateRule)
+			r.Delete("/{id}", s.alertService.DeleteRule)
+			r.Get("/{id}/deliveries", s.alertService.ListDeliveries)
+			r.Post("/{id}/test", s.alertService.TestRule)
+		})
+	}
+
+	if s.retentionService != nil {
+		r.Get("/retention/report", s.retentionService.GetReport)
+	}
+
+	if s.graphQLService != nil {
+		r.Post("/graphql", s.graphQLService.Serve)
+	}
+
 	log.Infof("Starting server on port %d", s.port)
 	http.ListenAndServe(fmt.Sprintf(":%d", s.port), r)
 }
@@ -0,0 +1,296 @@
+// Package socket serves a WebSocket subscribing a single connection to the weather data and alerts of many locations
+package socket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-sample-rest/internal/stream"
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/units"
+
+	"github.com/gorilla/websocket"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WeatherDataSubscriber publishes newly saved weather data of a set of locations, the returned function unsubscribes
+type WeatherDataSubscriber interface {
+	SubscribeLocations(locations *stream.LocationSet) (<-chan *types.WeatherData, func())
+}
+
+// AlertSubscriber publishes fired alerts of a set of locations, the returned function unsubscribes
+type AlertSubscriber interface {
+	SubscribeLocations(locations *stream.LocationSet) (<-chan *types.AlertPayload, func())
+}
+
+const (
+	// maxMessageSize is the largest message a client can send
+	maxMessageSize = 4096
+	// writeWait is how long a client has to accept a message before it's disconnected
+	writeWait = 10 * time.Second
+	// pongWait is how long a client can go without answering a ping or sending a message before it's disconnected
+	pongWait = 60 * time.Second
+	// pingInterval is how often clients are pinged, often enough to be answered within pongWait
+	pingInterval = pongWait * 9 / 10
+)
+
+type Service struct {
+	upgrader              websocket.Upgrader
+	weatherDataSubscriber WeatherDataSubscriber
+	alertSubscriber       AlertSubscriber
+	maxSubscriptions      int
+}
+
+// NewService creates the service, alertSubscriber is optional as not every storage supports alerts.
+// A connection can subscribe to up to maxSubscriptions locations.
+func NewService(weatherDataSubscriber WeatherDataSubscriber, alertSubscriber AlertSubscriber, maxSubscriptions int) *Service {
+	return &Service{
+		weatherDataSubscriber: weatherDataSubscriber,
+		alertSubscriber:       alertSubscriber,
+		maxSubscriptions:      maxSubscriptions,
+	}
+}
+
+// Serve upgrades the request to a WebSocket and sends the weather data and fired alerts of the locations the client
+// subscribes to until either side closes it. A client that falls behind is disconnected with the try again later close
+// code, so it can resubscribe instead of holding up the others.
+func (s *Service) Serve(w http.ResponseWriter, r *http.Request) {
+	u, err := units.Parse(r.URL.Query().Get("units"), r.URL.Query().Get("temperature_unit"), r.URL.Query().Get("wind_speed_unit"))
+	if err != nil {
+		log.Errorf("failed to get units from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := getLocation(r)
+	if err != nil {
+		log.Errorf("failed to get time zone from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	// The upgrader responds with the error itself
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Errorf("failed to upgrade websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// The brokers only publish the subscribed locations to the connection, so a connection takes a single subscription
+	// however many locations it subscribes to and only falls behind on their values
+	subscriptions := stream.NewLocationSet()
+
+	weatherData, unsubscribeWeatherData := s.weatherDataSubscriber.SubscribeLocations(subscriptions)
+	defer unsubscribeWeatherData()
+
+	// Never receives without alerts
+	var alerts <-chan *types.AlertPayload
+	if s.alertSubscriber != nil {
+		var unsubscribeAlerts func()
+		alerts, unsubscribeAlerts = s.alertSubscriber.SubscribeLocations(subscriptions)
+		defer unsubscribeAlerts()
+	}
+
+	messages := make(chan []byte)
+	readDone := make(chan struct{})
+	closed := make(chan struct{})
+	defer close(closed)
+
+	go read(conn, messages, readDone, closed)
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	for {
+		var message *types.SocketServerMessage
+
+		select {
+		case <-readDone:
+			return
+		case <-ping.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+			if err != nil {
+				return
+			}
+
+			continue
+		case data := <-messages:
+			message = s.handleMessage(data, subscriptions)
+		case wd, ok := <-weatherData:
+			if !ok {
+				closeBehind(conn)
+				return
+			}
+
+			// Published before the location was unsubscribed
+			location := types.Location{Latitude: wd.Latitude, Longitude: wd.Longitude}
+			if !subscriptions.Contains(location) {
+				continue
+			}
+
+			formatted := units.Convert(wd, u)
+			formatted.CreatedAt = formatted.CreatedAt.In(loc)
+
+			message = &types.SocketServerMessage{Type: types.SocketWeather, Location: formatLocation(location), WeatherData: formatted}
+		case alert, ok := <-alerts:
+			if !ok {
+				closeBehind(conn)
+				return
+			}
+
+			location := types.Location{Latitude: alert.Rule.Latitude, Longitude: alert.Rule.Longitude}
+			if !subscriptions.Contains(location) {
+				continue
+			}
+
+			message = &types.SocketServerMessage{Type: types.SocketAlert, Location: formatLocation(location), Alert: alert}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		err := conn.WriteJSON(message)
+		if err != nil {
+			log.Warnf("failed to write websocket message: %v", err)
+			return
+		}
+	}
+}
+
+// read passes the client's messages on until the connection fails or is closed, it's the connection's only reader
+func read(conn *websocket.Conn, messages chan<- []byte, done chan<- struct{}, closed <-chan struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Warnf("failed to read websocket message: %v", err)
+			}
+
+			return
+		}
+
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		// Blocks while the connection is writing, so a client can't send faster than it's answered
+		select {
+		case messages <- data:
+		case <-closed:
+			return
+		}
+	}
+}
+
+// handleMessage applies a client's message to its subscriptions and returns the reply
+func (s *Service) handleMessage(data []byte, subscriptions *stream.LocationSet) *types.SocketServerMessage {
+	var message types.SocketClientMessage
+	err := json.Unmarshal(data, &message)
+	if err != nil {
+		return socketError("invalid message: %v", err)
+	}
+
+	switch message.Type {
+	case types.SocketPing:
+		return &types.SocketServerMessage{Type: types.SocketPong}
+	case types.SocketSubscribe, types.SocketUnsubscribe:
+	default:
+		return socketError("unsupported message type: %s", message.Type)
+	}
+
+	location, err := parseLocation(&message)
+	if err != nil {
+		return socketError("invalid location: %v", err)
+	}
+
+	if message.Type == types.SocketUnsubscribe {
+		subscriptions.Remove(location)
+		return &types.SocketServerMessage{Type: types.SocketUnsubscribed, Location: formatLocation(location)}
+	}
+
+	if !subscriptions.Add(location, s.maxSubscriptions) {
+		return socketError("a connection can subscribe to up to %d locations", s.maxSubscriptions)
+	}
+
+	return &types.SocketServerMessage{Type: types.SocketSubscribed, Location: formatLocation(location)}
+}
+
+// closeBehind closes the connection of a client that fell behind
+func closeBehind(conn *websocket.Conn) {
+	log.Warnf("websocket fell behind and was closed")
+
+	message := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind")
+	_ = conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(writeWait))
+}
+
+func socketError(format string, a ...any) *types.SocketServerMessage {
+	return &types.SocketServerMessage{Type: types.SocketError, Error: fmt.Sprintf(format, a...)}
+}
+
+// parseLocation returns the location of a message, from its location id or its latitude and longitude
+func parseLocation(message *types.SocketClientMessage) (types.Location, error) {
+	var location types.Location
+
+	switch {
+	case message.Location != "":
+		lat, long, ok := strings.Cut(message.Location, ",")
+		if !ok {
+			return location, fmt.Errorf("location id must be lat,long, got %s", message.Location)
+		}
+
+		var err error
+		location.Latitude, err = strconv.ParseFloat(lat, 64)
+		if err != nil {
+			return location, fmt.Errorf("failed to parse latitude: %w", err)
+		}
+
+		location.Longitude, err = strconv.ParseFloat(long, 64)
+		if err != nil {
+			return location, fmt.Errorf("failed to parse longitude: %w", err)
+		}
+	case message.Latitude != nil && message.Longitude != nil:
+		location.Latitude = *message.Latitude
+		location.Longitude = *message.Longitude
+	default:
+		return location, fmt.Errorf("location or latitude and longitude must be provided")
+	}
+
+	if location.Latitude < -90 || location.Latitude > 90 {
+		return location, fmt.Errorf("latitude must be between -90 and 90, got %v", location.Latitude)
+	}
+
+	if location.Longitude < -180 || location.Longitude > 180 {
+		return location, fmt.Errorf("longitude must be between -180 and 180, got %v", location.Longitude)
+	}
+
+	return location, nil
+}
+
+// formatLocation formats a location as its location id, e.g. "1.1,2.2"
+func formatLocation(location types.Location) string {
+	return strconv.FormatFloat(location.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(location.Longitude, 'f', -1, 64)
+}
+
+func getLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time zone: %w", err)
+	}
+
+	return loc, nil
+}
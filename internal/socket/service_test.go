@@ -0,0 +1,215 @@
+package socket_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/socket"
+	"go-sample-rest/internal/stream"
+	"go-sample-rest/internal/types"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+var createdAt = time.Date(2023, 10, 4, 6, 53, 38, 581587000, time.UTC)
+
+// newSocketServer serves the service's WebSocket, it's closed once the test's connections are
+func newSocketServer(t *testing.T, service *socket.Service) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(service.Serve))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func dial(t *testing.T, server *httptest.Server, query string) *websocket.Conn {
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func send(t *testing.T, conn *websocket.Conn, message string) {
+	err := conn.WriteMessage(websocket.TextMessage, []byte(message))
+	require.NoError(t, err)
+}
+
+func receive(t *testing.T, conn *websocket.Conn) types.SocketServerMessage {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var message types.SocketServerMessage
+	err := conn.ReadJSON(&message)
+	require.NoError(t, err)
+
+	return message
+}
+
+func TestServe(t *testing.T) {
+	t.Run("should send the weather data and alerts of subscribed locations", func(t *testing.T) {
+		weatherDataBroker := stream.NewWeatherDataBroker()
+		alertBroker := stream.NewAlertBroker()
+		server := newSocketServer(t, socket.NewService(weatherDataBroker, alertBroker, 10))
+
+		conn := dial(t, server, "?units=imperial")
+
+		send(t, conn, `{"type":"subscribe","location":"1.1,2.2"}`)
+		require.Equal(t, types.SocketServerMessage{Type: types.SocketSubscribed, Location: "1.1,2.2"}, receive(t, conn))
+
+		send(t, conn, `{"type":"subscribe","latitude":3.3,"longitude":4.4}`)
+		require.Equal(t, types.SocketServerMessage{Type: types.SocketSubscribed, Location: "3.3,4.4"}, receive(t, conn))
+
+		weatherDataBroker.Publish(&types.WeatherData{Id: "other", Latitude: 5.5, Longitude: 6.6, CreatedAt: createdAt})
+		weatherDataBroker.Publish(&types.WeatherData{Id: "abc123", Latitude: 1.1, Longitude: 2.2, Temperature: 10, CreatedAt: createdAt})
+
+		message := receive(t, conn)
+		require.Equal(t, types.SocketWeather, message.Type)
+		require.Equal(t, "1.1,2.2", message.Location)
+		require.Equal(t, "abc123", message.WeatherData.Id)
+		require.Equal(t, 50.0, message.WeatherData.Temperature)
+		require.Equal(t, "fahrenheit", message.WeatherData.Units.Temperature)
+
+		alertBroker.Publish(&types.AlertPayload{DeliveryId: "other", Rule: types.AlertRule{Latitude: 5.5, Longitude: 6.6}})
+		alertBroker.Publish(&types.AlertPayload{Event: types.AlertEventFired, DeliveryId: "delivery1", Rule: types.AlertRule{Id: "rule1", Latitude: 3.3, Longitude: 4.4}, Value: 42})
+
+		message = receive(t, conn)
+		require.Equal(t, types.SocketAlert, message.Type)
+		require.Equal(t, "3.3,4.4", message.Location)
+		require.Equal(t, "delivery1", message.Alert.DeliveryId)
+		require.Equal(t, 42.0, message.Alert.Value)
+	})
+
+	t.Run("should stop sending the weather data of unsubscribed locations", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+		server := newSocketServer(t, socket.NewService(broker, nil, 10))
+
+		conn := dial(t, server, "")
+
+		send(t, conn, `{"type":"subscribe","location":"1.1,2.2"}`)
+		receive(t, conn)
+		send(t, conn, `{"type":"subscribe","location":"3.3,4.4"}`)
+		receive(t, conn)
+
+		send(t, conn, `{"type":"unsubscribe","latitude":1.1,"longitude":2.2}`)
+		require.Equal(t, types.SocketServerMessage{Type: types.SocketUnsubscribed, Location: "1.1,2.2"}, receive(t, conn))
+
+		broker.Publish(&types.WeatherData{Id: "unsubscribed", Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt})
+		broker.Publish(&types.WeatherData{Id: "subscribed", Latitude: 3.3, Longitude: 4.4, CreatedAt: createdAt})
+
+		require.Equal(t, "subscribed", receive(t, conn).WeatherData.Id)
+	})
+
+	t.Run("should limit the subscriptions of a connection", func(t *testing.T) {
+		server := newSocketServer(t, socket.NewService(stream.NewWeatherDataBroker(), nil, 2))
+
+		conn := dial(t, server, "")
+
+		send(t, conn, `{"type":"subscribe","location":"1.1,2.2"}`)
+		require.Equal(t, types.SocketSubscribed, receive(t, conn).Type)
+		send(t, conn, `{"type":"subscribe","location":"3.3,4.4"}`)
+		require.Equal(t, types.SocketSubscribed, receive(t, conn).Type)
+
+		// Subscribing again doesn't count
+		send(t, conn, `{"type":"subscribe","location":"1.1,2.2"}`)
+		require.Equal(t, types.SocketSubscribed, receive(t, conn).Type)
+
+		send(t, conn, `{"type":"subscribe","location":"5.5,6.6"}`)
+		require.Equal(t, types.SocketServerMessage{Type: types.SocketError, Error: "a connection can subscribe to up to 2 locations"}, receive(t, conn))
+
+		send(t, conn, `{"type":"unsubscribe","location":"3.3,4.4"}`)
+		require.Equal(t, types.SocketUnsubscribed, receive(t, conn).Type)
+		send(t, conn, `{"type":"subscribe","location":"5.5,6.6"}`)
+		require.Equal(t, types.SocketSubscribed, receive(t, conn).Type)
+	})
+
+	t.Run("should not fall behind on the weather data of other locations", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+		server := newSocketServer(t, socket.NewService(broker, nil, 10))
+
+		conn := dial(t, server, "")
+
+		send(t, conn, `{"type":"subscribe","location":"1.1,2.2"}`)
+		receive(t, conn)
+
+		for i := 0; i < stream.SubscriptionBuffer*2; i++ {
+			broker.Publish(&types.WeatherData{Id: "other", Latitude: 3.3, Longitude: 4.4, CreatedAt: createdAt})
+		}
+
+		broker.Publish(&types.WeatherData{Id: "subscribed", Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt})
+
+		require.Equal(t, "subscribed", receive(t, conn).WeatherData.Id)
+		require.Equal(t, 1, broker.Subscribers())
+	})
+
+	t.Run("should answer pings", func(t *testing.T) {
+		server := newSocketServer(t, socket.NewService(stream.NewWeatherDataBroker(), nil, 10))
+
+		conn := dial(t, server, "")
+
+		send(t, conn, `{"type":"ping"}`)
+		require.Equal(t, types.SocketServerMessage{Type: types.SocketPong}, receive(t, conn))
+	})
+
+	t.Run("should close the connection when it falls behind", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+		server := newSocketServer(t, socket.NewService(broker, nil, 10))
+
+		conn := dial(t, server, "")
+
+		send(t, conn, `{"type":"subscribe","location":"1.1,2.2"}`)
+		receive(t, conn)
+
+		// Not read until the broker has dropped it, the socket's buffers take the weather data it's sent
+		for i := 0; broker.Subscribers() > 0; i++ {
+			broker.Publish(&types.WeatherData{Id: strings.Repeat("a", 1024), Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt})
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+		var err error
+		for err == nil {
+			_, _, err = conn.ReadMessage()
+		}
+		require.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), err.Error())
+	})
+
+	testCases := []struct {
+		name          string
+		message       string
+		expectedError string
+	}{
+		{name: "should err when the message is not json", message: `{`, expectedError: "invalid message: unexpected end of JSON input"},
+		{name: "should err when the type is not supported", message: `{"type":"publish"}`, expectedError: "unsupported message type: publish"},
+		{name: "should err when the location is missing", message: `{"type":"subscribe","latitude":1.1}`, expectedError: "invalid location: location or latitude and longitude must be provided"},
+		{name: "should err when the location id is invalid", message: `{"type":"subscribe","location":"1.1"}`, expectedError: "invalid location: location id must be lat,long, got 1.1"},
+		{name: "should err when the latitude is invalid", message: `{"type":"subscribe","location":"abc,2.2"}`, expectedError: `invalid location: failed to parse latitude: strconv.ParseFloat: parsing "abc": invalid syntax`},
+		{name: "should err when the latitude is out of range", message: `{"type":"unsubscribe","latitude":91,"longitude":2.2}`, expectedError: "invalid location: latitude must be between -90 and 90, got 91"},
+		{name: "should err when the longitude is out of range", message: `{"type":"subscribe","location":"1.1,-181"}`, expectedError: "invalid location: longitude must be between -180 and 180, got -181"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newSocketServer(t, socket.NewService(stream.NewWeatherDataBroker(), nil, 10))
+
+			conn := dial(t, server, "")
+
+			send(t, conn, tc.message)
+			require.Equal(t, types.SocketServerMessage{Type: types.SocketError, Error: tc.expectedError}, receive(t, conn))
+
+			// The connection stays open
+			send(t, conn, `{"type":"ping"}`)
+			require.Equal(t, types.SocketPong, receive(t, conn).Type)
+		})
+	}
+
+	t.Run("should err when units are invalid", func(t *testing.T) {
+		server := newSocketServer(t, socket.NewService(stream.NewWeatherDataBroker(), nil, 10))
+
+		_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"?units=kelvin", nil)
+		require.ErrorIs(t, err, websocket.ErrBadHandshake)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
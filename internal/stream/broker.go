@@ -0,0 +1,126 @@
+// Package stream fans newly saved weather data and fired alerts out to subscribers, e.g. Server-Sent Events and
+// WebSocket clients
+package stream
+
+import (
+	"sync"
+
+	"go-sample-rest/internal/types"
+)
+
+// SubscriptionBuffer is how many values a subscriber can fall behind by before it's dropped
+const SubscriptionBuffer = 64
+
+type subscription[T any] struct {
+	location  *types.Location
+	locations *LocationSet
+	ch        chan T
+}
+
+// matches tells whether the subscription receives the values of the location
+func (s *subscription[T]) matches(location types.Location) bool {
+	switch {
+	case s.locations != nil:
+		return s.locations.Contains(location)
+	case s.location != nil:
+		return *s.location == location
+	default:
+		return true
+	}
+}
+
+// Broker is an in-process pub/sub of values published per location. Publishing never blocks, a subscriber that falls
+// behind has its channel closed so it can resume from the last value it received instead of holding up the others.
+// Published values are shared by every subscriber, so they mustn't be modified.
+type Broker[T any] struct {
+	mu            sync.Mutex
+	locationOf    func(value T) types.Location
+	subscriptions map[*subscription[T]]struct{}
+}
+
+// NewBroker creates a broker publishing values to the subscribers of the location locationOf returns
+func NewBroker[T any](locationOf func(value T) types.Location) *Broker[T] {
+	return &Broker[T]{
+		locationOf:    locationOf,
+		subscriptions: map[*subscription[T]]struct{}{},
+	}
+}
+
+// NewWeatherDataBroker creates a broker of newly saved weather data
+func NewWeatherDataBroker() *Broker[*types.WeatherData] {
+	return NewBroker(func(weatherData *types.WeatherData) types.Location {
+		return types.Location{Latitude: weatherData.Latitude, Longitude: weatherData.Longitude}
+	})
+}
+
+// NewAlertBroker creates a broker of fired alerts, published to the subscribers of their rule's location
+func NewAlertBroker() *Broker[*types.AlertPayload] {
+	return NewBroker(func(payload *types.AlertPayload) types.Location {
+		return types.Location{Latitude: payload.Rule.Latitude, Longitude: payload.Rule.Longitude}
+	})
+}
+
+// Subscribe returns a channel of the values of the location, or of every location when it's nil, published from now
+// on. The returned function unsubscribes, it must be called once the subscriber is done.
+func (b *Broker[T]) Subscribe(location *types.Location) (<-chan T, func()) {
+	return b.subscribe(&subscription[T]{location: location})
+}
+
+// SubscribeLocations is Subscribe for the locations in the set as it changes, so only the values of those locations
+// count towards the subscriber falling behind
+func (b *Broker[T]) SubscribeLocations(locations *LocationSet) (<-chan T, func()) {
+	return b.subscribe(&subscription[T]{locations: locations})
+}
+
+func (b *Broker[T]) subscribe(sub *subscription[T]) (<-chan T, func()) {
+	sub.ch = make(chan T, SubscriptionBuffer)
+
+	b.mu.Lock()
+	b.subscriptions[sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		b.remove(sub)
+	}
+}
+
+// Publish sends the value to its location's subscribers and to the subscribers of every location
+func (b *Broker[T]) Publish(value T) {
+	location := b.locationOf(value)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscriptions {
+		if !sub.matches(location) {
+			continue
+		}
+
+		select {
+		case sub.ch <- value:
+		default:
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribers returns the number of subscribers
+func (b *Broker[T]) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscriptions)
+}
+
+// remove closes the subscription's channel unless it's already removed, the lock must be held
+func (b *Broker[T]) remove(sub *subscription[T]) {
+	if _, ok := b.subscriptions[sub]; !ok {
+		return
+	}
+
+	delete(b.subscriptions, sub)
+	close(sub.ch)
+}
@@ -0,0 +1,126 @@
+package stream_test
+
+import (
+	"testing"
+
+	"go-sample-rest/internal/repository/memory"
+	"go-sample-rest/internal/stream"
+	"go-sample-rest/internal/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	t.Run("should publish weather data to its location's subscribers and to every location's", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+
+		location, unsubscribeLocation := broker.Subscribe(&types.Location{Latitude: 1.1, Longitude: 2.2})
+		defer unsubscribeLocation()
+
+		all, unsubscribeAll := broker.Subscribe(nil)
+		defer unsubscribeAll()
+
+		broker.Publish(&types.WeatherData{Id: "other", Latitude: 3.3, Longitude: 4.4})
+		broker.Publish(&types.WeatherData{Id: "abc123", Latitude: 1.1, Longitude: 2.2})
+
+		require.Equal(t, "abc123", (<-location).Id)
+		require.Empty(t, location)
+
+		require.Equal(t, "other", (<-all).Id)
+		require.Equal(t, "abc123", (<-all).Id)
+	})
+
+	t.Run("should publish fired alerts to their rule's location's subscribers", func(t *testing.T) {
+		broker := stream.NewAlertBroker()
+
+		location, unsubscribe := broker.Subscribe(&types.Location{Latitude: 1.1, Longitude: 2.2})
+		defer unsubscribe()
+
+		broker.Publish(&types.AlertPayload{DeliveryId: "other", Rule: types.AlertRule{Latitude: 3.3, Longitude: 4.4}})
+		broker.Publish(&types.AlertPayload{DeliveryId: "abc123", Rule: types.AlertRule{Latitude: 1.1, Longitude: 2.2}})
+
+		require.Equal(t, "abc123", (<-location).DeliveryId)
+		require.Empty(t, location)
+	})
+
+	t.Run("should publish the values of the locations in a set as it changes", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+
+		locations := stream.NewLocationSet()
+		require.True(t, locations.Add(types.Location{Latitude: 1.1, Longitude: 2.2}, 2))
+		require.True(t, locations.Add(types.Location{Latitude: 3.3, Longitude: 4.4}, 2))
+
+		// Adding again doesn't count towards the limit
+		require.True(t, locations.Add(types.Location{Latitude: 1.1, Longitude: 2.2}, 2))
+		require.False(t, locations.Add(types.Location{Latitude: 5.5, Longitude: 6.6}, 2))
+
+		ch, unsubscribe := broker.SubscribeLocations(locations)
+		defer unsubscribe()
+
+		locations.Remove(types.Location{Latitude: 3.3, Longitude: 4.4})
+
+		broker.Publish(&types.WeatherData{Id: "removed", Latitude: 3.3, Longitude: 4.4})
+		broker.Publish(&types.WeatherData{Id: "other", Latitude: 5.5, Longitude: 6.6})
+		broker.Publish(&types.WeatherData{Id: "abc123", Latitude: 1.1, Longitude: 2.2})
+
+		require.Equal(t, "abc123", (<-ch).Id)
+		require.Empty(t, ch)
+	})
+
+	t.Run("should close the channel of a subscriber that falls behind", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+
+		slow, unsubscribeSlow := broker.Subscribe(nil)
+		defer unsubscribeSlow()
+
+		fast, unsubscribeFast := broker.Subscribe(nil)
+		defer unsubscribeFast()
+
+		for i := 0; i < stream.SubscriptionBuffer+1; i++ {
+			broker.Publish(&types.WeatherData{})
+			<-fast
+		}
+
+		require.Equal(t, 1, broker.Subscribers())
+
+		received := 0
+		for range slow {
+			received++
+		}
+		require.Equal(t, stream.SubscriptionBuffer, received)
+	})
+
+	t.Run("should stop publishing to unsubscribed subscribers", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+
+		ch, unsubscribe := broker.Subscribe(nil)
+		unsubscribe()
+		unsubscribe()
+
+		broker.Publish(&types.WeatherData{})
+
+		_, ok := <-ch
+		require.False(t, ok)
+		require.Equal(t, 0, broker.Subscribers())
+	})
+}
+
+func TestWrapRepository(t *testing.T) {
+	broker := stream.NewWeatherDataBroker()
+	repo := stream.WrapRepository(memory.NewRepository(), broker)
+
+	ch, unsubscribe := broker.Subscribe(nil)
+	defer unsubscribe()
+
+	saved, err := repo.SaveWeatherData(1.1, 2.2, 3.3, 4.4, 5.5, "openmeteo")
+	require.NoError(t, err)
+	require.Equal(t, saved, <-ch)
+
+	savedList, err := repo.SaveWeatherDataBatch([]*types.WeatherData{
+		{Latitude: 1.1, Longitude: 2.2, Source: "openmeteo"},
+		{Latitude: 3.3, Longitude: 4.4, Source: "openmeteo"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, savedList[0], <-ch)
+	require.Equal(t, savedList[1], <-ch)
+}
@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"sync"
+
+	"go-sample-rest/internal/types"
+)
+
+// LocationSet is a set of locations whose values a subscription receives, it can change while subscribed
+type LocationSet struct {
+	mu        sync.RWMutex
+	locations map[types.Location]struct{}
+}
+
+func NewLocationSet() *LocationSet {
+	return &LocationSet{locations: map[types.Location]struct{}{}}
+}
+
+// Add adds the location to the set, it returns false when the set already holds maxLocations other locations
+func (s *LocationSet) Add(location types.Location, maxLocations int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.locations[location]; !ok && len(s.locations) >= maxLocations {
+		return false
+	}
+
+	s.locations[location] = struct{}{}
+
+	return true
+}
+
+// Remove removes the location from the set, values of the location that were published before aren't taken back
+func (s *LocationSet) Remove(location types.Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.locations, location)
+}
+
+// Contains tells whether the location is in the set
+func (s *LocationSet) Contains(location types.Location) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.locations[location]
+
+	return ok
+}
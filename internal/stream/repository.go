@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+)
+
+// publishingRepository publishes every weather data it saves
+type publishingRepository struct {
+	weatherservice.WeatherDataRepository
+	broker *Broker[*types.WeatherData]
+}
+
+// WrapRepository returns a repository that publishes the weather data saved by repo to the broker. It's meant for
+// storages that can't notify other replicas, with Postgres the broker is fed by repository.Listen instead.
+func WrapRepository(repo weatherservice.WeatherDataRepository, broker *Broker[*types.WeatherData]) weatherservice.WeatherDataRepository {
+	return &publishingRepository{
+		WeatherDataRepository: repo,
+		broker:                broker,
+	}
+}
+
+func (r *publishingRepository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+	weatherData, err := r.WeatherDataRepository.SaveWeatherData(lat, long, temperature, windDirection, windSpeed, source)
+	if err != nil {
+		return nil, err
+	}
+
+	r.broker.Publish(weatherData)
+
+	return weatherData, nil
+}
+
+func (r *publishingRepository) SaveWeatherDataBatch(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error) {
+	savedWeatherDataList, err := r.WeatherDataRepository.SaveWeatherDataBatch(weatherDataList)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, weatherData := range savedWeatherDataList {
+		r.broker.Publish(weatherData)
+	}
+
+	return savedWeatherDataList, nil
+}
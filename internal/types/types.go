@@ -1,15 +1,279 @@
 package types
 
+import (
+	"encoding/json"
+	"time"
+)
+
+type Units struct {
+	Temperature   string `json:"temperature"`
+	WindSpeed     string `json:"wind_speed"`
+	WindDirection string `json:"wind_direction"`
+}
+
 type WeatherData struct {
-	Id            string  `json:"id"`
-	Latitude      float64 `json:"latitude"`
-	Longitude     float64 `json:"longitude"`
-	Temperature   float64 `json:"temperature"`
-	WindDirection float64 `json:"wind_direction"`
-	WindSpeed     float64 `json:"wind_speed"`
-	CreatedAt     string  `json:"created_at"`
+	Id            string    `json:"id"`
+	Latitude      float64   `json:"latitude"`
+	Longitude     float64   `json:"longitude"`
+	Temperature   float64   `json:"temperature"`
+	WindDirection float64   `json:"wind_direction"`
+	WindSpeed     float64   `json:"wind_speed"`
+	Source        string    `json:"source"`
+	CreatedAt     time.Time `json:"created_at"`
+	Units         *Units    `json:"units,omitempty"`
 }
 
 type GetLatestWeatherResponse WeatherData
 
 type GetWeatherHistoryResponse []WeatherData
+
+// Observation is a reading of an on-site sensor, in metric units. SensorId is optional, readings without one are manual.
+type Observation struct {
+	Temperature   *float64 `json:"temperature"`
+	WindDirection *float64 `json:"wind_direction"`
+	WindSpeed     *float64 `json:"wind_speed"`
+	SensorId      string   `json:"sensor_id"`
+}
+
+// WeatherBatchRequest is the request body of the batch endpoints
+type WeatherBatchRequest struct {
+	Locations []Location `json:"locations"`
+}
+
+// GetLatestWeatherBatchResponse results are keyed by the requested "lat,long", locations without weather data are null
+type GetLatestWeatherBatchResponse struct {
+	Results map[string]*WeatherData `json:"results"`
+}
+
+// UpdateWeatherBatchResult is either the saved weather data of a location or why it couldn't be updated
+type UpdateWeatherBatchResult struct {
+	WeatherData *WeatherData `json:"weather_data,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// UpdateWeatherBatchResponse results are keyed by the requested "lat,long"
+type UpdateWeatherBatchResponse struct {
+	Results map[string]UpdateWeatherBatchResult `json:"results"`
+}
+
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// WeatherHistoryCursor is the position of weather data in a location's history, newest first. A page of history
+// starts after it.
+type WeatherHistoryCursor struct {
+	CreatedAt time.Time
+	Id        string
+}
+
+// WeatherAggregate summarises a location's weather data created from From up to To, in metric units. First and Last
+// are when the oldest and newest weather data was created, they and the readings are nil without weather data.
+type WeatherAggregate struct {
+	Location       Location
+	Count          int
+	First          *time.Time
+	Last           *time.Time
+	MinTemperature *float64
+	MaxTemperature *float64
+	AvgTemperature *float64
+	AvgWindSpeed   *float64
+	MaxWindSpeed   *float64
+}
+
+// RetentionCutoffs are the points in time retention applies to, a zero cutoff skips that step.
+// Raw weather data before DeleteBefore is mostly deleted by dropping whole partitions, partitions ending before
+// DeleteRowsFrom are dropped so weather data from DeleteRowsFrom on is deleted row by row, as is weather data of the
+// default partition.
+type RetentionCutoffs struct {
+	HourlyBefore   time.Time `json:"hourly_before"`
+	DailyBefore    time.Time `json:"daily_before"`
+	DeleteBefore   time.Time `json:"delete_before"`
+	DeleteRowsFrom time.Time `json:"delete_rows_from"`
+}
+
+type RetentionCounts struct {
+	HourlySummaries int64 `json:"hourly_summaries"`
+	DailySummaries  int64 `json:"daily_summaries"`
+	DeletedRows     int64 `json:"deleted_rows"`
+}
+
+// Partition of weather data holding the weather data created from From up to To
+type Partition struct {
+	Name string    `json:"name"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// Statuses of an update job
+const (
+	UpdateJobQueued    = "queued"
+	UpdateJobRunning   = "running"
+	UpdateJobCompleted = "completed"
+	UpdateJobFailed    = "failed"
+)
+
+// UpdateJob updates the weather data of many locations in the background. Results are keyed by "lat,long" and filled
+// in as the job progresses, Completed and Failed count the locations that were and weren't updated so far.
+type UpdateJob struct {
+	Id         string                              `json:"id"`
+	Status     string                              `json:"status"`
+	Provider   string                              `json:"provider,omitempty"`
+	Locations  []Location                          `json:"-"`
+	Total      int                                 `json:"total"`
+	Completed  int                                 `json:"completed"`
+	Failed     int                                 `json:"failed"`
+	Results    map[string]UpdateWeatherBatchResult `json:"results"`
+	Error      string                              `json:"error,omitempty"`
+	Attempts   int                                 `json:"attempts"`
+	CreatedAt  time.Time                           `json:"created_at"`
+	UpdatedAt  time.Time                           `json:"updated_at"`
+	StartedAt  *time.Time                          `json:"started_at,omitempty"`
+	FinishedAt *time.Time                          `json:"finished_at,omitempty"`
+}
+
+// IdempotencyRecord is the response stored for an idempotency key, a zero StatusCode means the request is still in flight
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Statuses of a backfill
+const (
+	BackfillRunning   = "running"
+	BackfillCompleted = "completed"
+)
+
+// Backfill imports the historical weather data of a location for the UTC days From to To, both included.
+// Next is the first day not imported yet, Skipped counts the hours that already had weather data.
+type Backfill struct {
+	Id        string    `json:"id"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Next      time.Time `json:"next"`
+	Status    string    `json:"status"`
+	Imported  int       `json:"imported"`
+	Skipped   int       `json:"skipped"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ImportReport counts the rows of an import. Accepted rows were saved, Skipped rows were valid but already saved
+// with the same id and created at, Rejected rows were invalid and are listed in Rejections up to a limit.
+type ImportReport struct {
+	Accepted   int               `json:"accepted"`
+	Skipped    int               `json:"skipped"`
+	Rejected   int               `json:"rejected"`
+	Rejections []ImportRejection `json:"rejections"`
+}
+
+// ImportRejection is why the row on a line of an import was rejected, lines start at 1
+type ImportRejection struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// Metrics and comparators of an alert rule
+const (
+	AlertMetricTemperature   = "temperature"
+	AlertMetricWindSpeed     = "wind_speed"
+	AlertMetricWindDirection = "wind_direction"
+
+	AlertComparatorGreaterThan        = "gt"
+	AlertComparatorGreaterThanOrEqual = "gte"
+	AlertComparatorLessThan           = "lt"
+	AlertComparatorLessThanOrEqual    = "lte"
+)
+
+// AlertRule fires when the Metric of a location's weather data compares to Threshold, in metric units, and then not
+// again until CooldownSeconds have passed. Secret signs its webhooks, it's only returned when the rule is created.
+type AlertRule struct {
+	Id              string     `json:"id"`
+	Latitude        float64    `json:"latitude"`
+	Longitude       float64    `json:"longitude"`
+	Metric          string     `json:"metric"`
+	Comparator      string     `json:"comparator"`
+	Threshold       float64    `json:"threshold"`
+	CooldownSeconds int        `json:"cooldown_seconds"`
+	WebhookURL      string     `json:"webhook_url"`
+	Secret          string     `json:"secret,omitempty"`
+	Enabled         bool       `json:"enabled"`
+	LastFiredAt     *time.Time `json:"last_fired_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Events and statuses of an alert delivery
+const (
+	AlertEventFired = "alert.fired"
+	AlertEventTest  = "alert.test"
+
+	AlertDeliveryPending   = "pending"
+	AlertDeliveryDelivered = "delivered"
+	AlertDeliveryFailed    = "failed"
+)
+
+// AlertDelivery is a webhook call of a rule and the outcome of its latest attempt
+type AlertDelivery struct {
+	Id             string          `json:"id"`
+	RuleId         string          `json:"rule_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// AlertPayload is the body of an alert's webhook
+type AlertPayload struct {
+	Event       string       `json:"event"`
+	DeliveryId  string       `json:"delivery_id"`
+	Rule        AlertRule    `json:"rule"`
+	WeatherData *WeatherData `json:"weather_data"`
+	Value       float64      `json:"value"`
+	FiredAt     time.Time    `json:"fired_at"`
+}
+
+// Types of WebSocket messages
+const (
+	SocketSubscribe    = "subscribe"
+	SocketUnsubscribe  = "unsubscribe"
+	SocketPing         = "ping"
+	SocketSubscribed   = "subscribed"
+	SocketUnsubscribed = "unsubscribed"
+	SocketPong         = "pong"
+	SocketWeather      = "weather"
+	SocketAlert        = "alert"
+	SocketError        = "error"
+)
+
+// SocketClientMessage is a message sent by a WebSocket client. The location of subscribe and unsubscribe messages is
+// given either as a location id, e.g. "1.1,2.2", or as a latitude and a longitude.
+type SocketClientMessage struct {
+	Type      string   `json:"type"`
+	Location  string   `json:"location,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// SocketServerMessage is a message sent to a WebSocket client, its location is a location id
+type SocketServerMessage struct {
+	Type        string        `json:"type"`
+	Location    string        `json:"location,omitempty"`
+	WeatherData *WeatherData  `json:"weather_data,omitempty"`
+	Alert       *AlertPayload `json:"alert,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
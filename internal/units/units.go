@@ -0,0 +1,121 @@
+package units
+
+import (
+	"fmt"
+	"math"
+
+	"go-sample-rest/internal/types"
+)
+
+type TemperatureUnit string
+
+const (
+	Celsius    TemperatureUnit = "celsius"
+	Fahrenheit TemperatureUnit = "fahrenheit"
+)
+
+type WindSpeedUnit string
+
+const (
+	KilometresPerHour WindSpeedUnit = "kmh"
+	MetresPerSecond   WindSpeedUnit = "ms"
+	MilesPerHour      WindSpeedUnit = "mph"
+	Knots             WindSpeedUnit = "kn"
+)
+
+// Wind direction is always reported in degrees, regardless of the unit system
+const WindDirectionDegrees = "degrees"
+
+type Units struct {
+	Temperature TemperatureUnit
+	WindSpeed   WindSpeedUnit
+}
+
+// Metric is the unit system weather data is stored in
+var Metric = Units{
+	Temperature: Celsius,
+	WindSpeed:   KilometresPerHour,
+}
+
+var Imperial = Units{
+	Temperature: Fahrenheit,
+	WindSpeed:   MilesPerHour,
+}
+
+// Parse resolves the unit system, then applies the per-field overrides on top of it.
+// Empty values fall back to metric.
+func Parse(system, temperatureUnit, windSpeedUnit string) (Units, error) {
+	var u Units
+
+	switch system {
+	case "", "metric":
+		u = Metric
+	case "imperial":
+		u = Imperial
+	default:
+		return Units{}, fmt.Errorf("unsupported unit system: %s", system)
+	}
+
+	if temperatureUnit != "" {
+		switch TemperatureUnit(temperatureUnit) {
+		case Celsius, Fahrenheit:
+			u.Temperature = TemperatureUnit(temperatureUnit)
+		default:
+			return Units{}, fmt.Errorf("unsupported temperature unit: %s", temperatureUnit)
+		}
+	}
+
+	if windSpeedUnit != "" {
+		switch WindSpeedUnit(windSpeedUnit) {
+		case KilometresPerHour, MetresPerSecond, MilesPerHour, Knots:
+			u.WindSpeed = WindSpeedUnit(windSpeedUnit)
+		default:
+			return Units{}, fmt.Errorf("unsupported wind speed unit: %s", windSpeedUnit)
+		}
+	}
+
+	return u, nil
+}
+
+// Convert returns a copy of the metric weather data expressed in the given units,
+// labelled with the units used.
+func Convert(weatherData *types.WeatherData, u Units) *types.WeatherData {
+	converted := *weatherData
+
+	converted.Temperature = convertTemperature(weatherData.Temperature, u.Temperature)
+	converted.WindSpeed = convertWindSpeed(weatherData.WindSpeed, u.WindSpeed)
+	converted.Units = &types.Units{
+		Temperature:   string(u.Temperature),
+		WindSpeed:     string(u.WindSpeed),
+		WindDirection: WindDirectionDegrees,
+	}
+
+	return &converted
+}
+
+func convertTemperature(celsius float64, unit TemperatureUnit) float64 {
+	switch unit {
+	case Fahrenheit:
+		return round(celsius*9/5 + 32)
+	default:
+		return celsius
+	}
+}
+
+func convertWindSpeed(kmh float64, unit WindSpeedUnit) float64 {
+	switch unit {
+	case MetresPerSecond:
+		return round(kmh / 3.6)
+	case MilesPerHour:
+		return round(kmh / 1.609344)
+	case Knots:
+		return round(kmh / 1.852)
+	default:
+		return kmh
+	}
+}
+
+// round trims floating point noise off converted values
+func round(val float64) float64 {
+	return math.Round(val*100) / 100
+}
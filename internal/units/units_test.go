@@ -0,0 +1,170 @@
+package units_test
+
+import (
+	"testing"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/units"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name            string
+		system          string
+		temperatureUnit string
+		windSpeedUnit   string
+		shouldError     bool
+		expectedUnits   units.Units
+	}{
+		{
+			name:          "should default to metric when nothing is provided",
+			expectedUnits: units.Metric,
+		},
+		{
+			name:          "should return imperial units when requested",
+			system:        "imperial",
+			expectedUnits: units.Imperial,
+		},
+		{
+			name:            "should apply per-field overrides on top of the unit system",
+			system:          "metric",
+			temperatureUnit: "fahrenheit",
+			windSpeedUnit:   "kn",
+			expectedUnits: units.Units{
+				Temperature: units.Fahrenheit,
+				WindSpeed:   units.Knots,
+			},
+		},
+		{
+			name:        "should error when unit system is not supported",
+			system:      "scientific",
+			shouldError: true,
+		},
+		{
+			name:            "should error when temperature unit is not supported",
+			temperatureUnit: "kelvin",
+			shouldError:     true,
+		},
+		{
+			name:          "should error when wind speed unit is not supported",
+			windSpeedUnit: "beaufort",
+			shouldError:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := units.Parse(tc.system, tc.temperatureUnit, tc.windSpeedUnit)
+
+			if tc.shouldError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedUnits, u)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	weatherData := &types.WeatherData{
+		Id:            "abc123",
+		Latitude:      1.1,
+		Longitude:     2.2,
+		Temperature:   100,
+		WindDirection: 5.5,
+		WindSpeed:     36,
+	}
+
+	testCases := []struct {
+		name                string
+		units               units.Units
+		expectedWeatherData *types.WeatherData
+	}{
+		{
+			name:  "should keep values and label them when converting to metric",
+			units: units.Metric,
+			expectedWeatherData: &types.WeatherData{
+				Id:            "abc123",
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   100,
+				WindDirection: 5.5,
+				WindSpeed:     36,
+				Units: &types.Units{
+					Temperature:   "celsius",
+					WindSpeed:     "kmh",
+					WindDirection: "degrees",
+				},
+			},
+		},
+		{
+			name:  "should convert temperature to fahrenheit and wind speed to mph when converting to imperial",
+			units: units.Imperial,
+			expectedWeatherData: &types.WeatherData{
+				Id:            "abc123",
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   212,
+				WindDirection: 5.5,
+				WindSpeed:     22.37,
+				Units: &types.Units{
+					Temperature:   "fahrenheit",
+					WindSpeed:     "mph",
+					WindDirection: "degrees",
+				},
+			},
+		},
+		{
+			name: "should convert wind speed to metres per second",
+			units: units.Units{
+				Temperature: units.Celsius,
+				WindSpeed:   units.MetresPerSecond,
+			},
+			expectedWeatherData: &types.WeatherData{
+				Id:            "abc123",
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   100,
+				WindDirection: 5.5,
+				WindSpeed:     10,
+				Units: &types.Units{
+					Temperature:   "celsius",
+					WindSpeed:     "ms",
+					WindDirection: "degrees",
+				},
+			},
+		},
+		{
+			name: "should convert wind speed to knots",
+			units: units.Units{
+				Temperature: units.Celsius,
+				WindSpeed:   units.Knots,
+			},
+			expectedWeatherData: &types.WeatherData{
+				Id:            "abc123",
+				Latitude:      1.1,
+				Longitude:     2.2,
+				Temperature:   100,
+				WindDirection: 5.5,
+				WindSpeed:     19.44,
+				Units: &types.Units{
+					Temperature:   "celsius",
+					WindSpeed:     "kn",
+					WindDirection: "degrees",
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			converted := units.Convert(weatherData, tc.units)
+
+			require.Equal(t, tc.expectedWeatherData, converted)
+			require.Nil(t, weatherData.Units)
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package httpapi
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/units"
+	"go-sample-rest/internal/weatherservice"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	historyFormatJSON   = "json"
+	historyFormatCSV    = "csv"
+	historyFormatNDJSON = "ndjson"
+)
+
+// exportFlushRows is how many rows of an export are written before they're flushed to the client
+const exportFlushRows = 1000
+
+var historyContentTypes = map[string]string{
+	historyFormatCSV:    "text/csv; charset=utf-8",
+	historyFormatNDJSON: "application/x-ndjson",
+}
+
+var csvHeader = []string{
+	"id", "latitude", "longitude", "temperature", "wind_direction", "wind_speed", "source", "created_at",
+	"temperature_unit", "wind_speed_unit", "wind_direction_unit",
+}
+
+// historyEncoder writes weather history a row at a time
+type historyEncoder interface {
+	Encode(weatherData *types.WeatherData) error
+	Flush() error
+}
+
+type csvHistoryEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVHistoryEncoder(w io.Writer) *csvHistoryEncoder {
+	csvWriter := csv.NewWriter(w)
+
+	// Buffered, errors surface when it's flushed
+	_ = csvWriter.Write(csvHeader)
+
+	return &csvHistoryEncoder{w: csvWriter}
+}
+
+func (e *csvHistoryEncoder) Encode(weatherData *types.WeatherData) error {
+	var u types.Units
+	if weatherData.Units != nil {
+		u = *weatherData.Units
+	}
+
+	return e.w.Write([]string{
+		weatherData.Id,
+		formatFloat(weatherData.Latitude),
+		formatFloat(weatherData.Longitude),
+		formatFloat(weatherData.Temperature),
+		formatFloat(weatherData.WindDirection),
+		formatFloat(weatherData.WindSpeed),
+		weatherData.Source,
+		weatherData.CreatedAt.Format(time.RFC3339Nano),
+		u.Temperature,
+		u.WindSpeed,
+		u.WindDirection,
+	})
+}
+
+func (e *csvHistoryEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonHistoryEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONHistoryEncoder(w io.Writer) *ndjsonHistoryEncoder {
+	bufferedWriter := bufio.NewWriter(w)
+
+	return &ndjsonHistoryEncoder{w: bufferedWriter, enc: json.NewEncoder(bufferedWriter)}
+}
+
+func (e *ndjsonHistoryEncoder) Encode(weatherData *types.WeatherData) error {
+	return e.enc.Encode(weatherData)
+}
+
+func (e *ndjsonHistoryEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+// countingWriter counts the bytes written through it, to tell whether a response has started
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// getHistoryFormat picks the format of the weather history from the format query parameter, then the Accept header,
+// defaulting to JSON
+func (h *Handler) getHistoryFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format != "" {
+		switch format {
+		case historyFormatJSON, historyFormatCSV, historyFormatNDJSON:
+			return format, nil
+		default:
+			return "", fmt.Errorf("unsupported format: %s", format)
+		}
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case "application/json":
+			return historyFormatJSON, nil
+		case "text/csv":
+			return historyFormatCSV, nil
+		case "application/x-ndjson":
+			return historyFormatNDJSON, nil
+		}
+	}
+
+	return historyFormatJSON, nil
+}
+
+// streamWeatherHistory writes the weather history as it's read from the repository, flushing every exportFlushRows rows,
+// so exports of any size are never held in memory
+func (h *Handler) streamWeatherHistory(w http.ResponseWriter, format string, query weatherservice.HistoryQuery, u units.Units, loc *time.Location) {
+	w.Header().Set("Content-Type", historyContentTypes[format])
+
+	cw := &countingWriter{w: w}
+
+	var enc historyEncoder
+	switch format {
+	case historyFormatCSV:
+		enc = newCSVHistoryEncoder(cw)
+	default:
+		enc = newNDJSONHistoryEncoder(cw)
+	}
+
+	rc := http.NewResponseController(w)
+	rows := 0
+
+	err := h.weatherService.StreamHistory(query, func(weatherData *types.WeatherData) error {
+		err := enc.Encode(formatWeatherData(weatherData, u, loc))
+		if err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushRows != 0 {
+			return nil
+		}
+
+		err = enc.Flush()
+		if err != nil {
+			return err
+		}
+
+		// Not every writer can flush, the rows are sent once its buffer fills up instead
+		_ = rc.Flush()
+
+		return nil
+	})
+	if err == nil {
+		err = enc.Flush()
+	}
+
+	if err == nil {
+		return
+	}
+
+	if cw.n == 0 {
+		log.Errorf("failed to get weather data history: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// The status has been sent, abort the response so the client doesn't take a truncated export for a complete one
+	log.Errorf("failed to stream weather data history after %d rows: %v", rows, err)
+	panic(http.ErrAbortHandler)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,161 @@
+package httpapi_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+	"go-sample-rest/internal/weatherservice/httpapi"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func newHistoryRequest(query, accept string) *http.Request {
+	r := httptest.NewRequest("GET", "/1.1,2.2/history"+query, nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("lat", "1.1")
+	rctx.URLParams.Add("long", "2.2")
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestGetWeatherHistoryExport(t *testing.T) {
+	weatherHistory := func(lat, long float64) ([]*types.WeatherData, error) {
+		return []*types.WeatherData{
+			{Id: "abc123", Latitude: lat, Longitude: long, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5, Source: "openmeteo", CreatedAt: createdAt},
+			{Id: "def456", Latitude: lat, Longitude: long, Temperature: -40, WindSpeed: 36, WindDirection: 5.5, Source: "metno, \"oslo\"", CreatedAt: createdAt},
+		}, nil
+	}
+
+	testCases := []struct {
+		name                      string
+		query                     string
+		accept                    string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		expectedStatusCode        int
+		expectedContentType       string
+		expectedBody              string
+	}{
+		{
+			name:                      "should return csv when it's accepted",
+			accept:                    "text/csv",
+			mockWeatherDataRepository: &MockWeatherDataRepository{getWeatherHistory: weatherHistory},
+			expectedStatusCode:        http.StatusOK,
+			expectedContentType:       "text/csv; charset=utf-8",
+			expectedBody: "id,latitude,longitude,temperature,wind_direction,wind_speed,source,created_at,temperature_unit,wind_speed_unit,wind_direction_unit\n" +
+				"abc123,1.1,2.2,3.3,5.5,4.4,openmeteo,2023-10-04T06:53:38.581587Z,celsius,kmh,degrees\n" +
+				"def456,1.1,2.2,-40,5.5,36,\"metno, \"\"oslo\"\"\",2023-10-04T06:53:38.581587Z,celsius,kmh,degrees",
+		},
+		{
+			name:                      "should return ndjson when it's accepted after other media types",
+			accept:                    "text/html, application/x-ndjson;q=0.9",
+			mockWeatherDataRepository: &MockWeatherDataRepository{getWeatherHistory: weatherHistory},
+			expectedStatusCode:        http.StatusOK,
+			expectedContentType:       "application/x-ndjson",
+			expectedBody: `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}` + "\n" +
+				`{"id":"def456","latitude":1.1,"longitude":2.2,"temperature":-40,"wind_direction":5.5,"wind_speed":36,"source":"metno, \"oslo\"","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}`,
+		},
+		{
+			name:                      "should prefer the format query parameter over the accept header",
+			query:                     "?format=csv&temperature_unit=fahrenheit&wind_speed_unit=ms&tz=Australia/Sydney",
+			accept:                    "application/x-ndjson",
+			mockWeatherDataRepository: &MockWeatherDataRepository{getWeatherHistory: weatherHistory},
+			expectedStatusCode:        http.StatusOK,
+			expectedContentType:       "text/csv; charset=utf-8",
+			expectedBody: "id,latitude,longitude,temperature,wind_direction,wind_speed,source,created_at,temperature_unit,wind_speed_unit,wind_direction_unit\n" +
+				"abc123,1.1,2.2,37.94,5.5,1.22,openmeteo,2023-10-04T17:53:38.581587+11:00,fahrenheit,ms,degrees\n" +
+				"def456,1.1,2.2,-40,5.5,10,\"metno, \"\"oslo\"\"\",2023-10-04T17:53:38.581587+11:00,fahrenheit,ms,degrees",
+		},
+		{
+			name:                      "should return json when the format is json",
+			query:                     "?format=json",
+			accept:                    "text/csv",
+			mockWeatherDataRepository: &MockWeatherDataRepository{getWeatherHistory: weatherHistory},
+			expectedStatusCode:        http.StatusOK,
+			expectedContentType:       "application/json",
+			expectedBody:              `[{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}},{"id":"def456","latitude":1.1,"longitude":2.2,"temperature":-40,"wind_direction":5.5,"wind_speed":36,"source":"metno, \"oslo\"","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}]`,
+		},
+		{
+			name:                      "should return only the csv header when there's no history",
+			query:                     "?format=csv",
+			mockWeatherDataRepository: &MockWeatherDataRepository{getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) { return nil, nil }},
+			expectedStatusCode:        http.StatusOK,
+			expectedContentType:       "text/csv; charset=utf-8",
+			expectedBody:              "id,latitude,longitude,temperature,wind_direction,wind_speed,source,created_at,temperature_unit,wind_speed_unit,wind_direction_unit",
+		},
+		{
+			name:                      "should err when the format is not supported",
+			query:                     "?format=xml",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedContentType:       "text/plain; charset=utf-8",
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:   "should return internal error when repo returns an error before any row",
+			accept: "text/csv",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedStatusCode:  http.StatusInternalServerError,
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        http.StatusText(http.StatusInternalServerError),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, tc.mockWeatherDataRepository))
+			w := httptest.NewRecorder()
+
+			handler.GetWeatherHistory(w, newHistoryRequest(tc.query, tc.accept))
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedContentType, w.Result().Header.Get("Content-Type"))
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
+
+// failingHistoryRepository streams rows then fails, like a cursor losing its connection part way through
+type failingHistoryRepository struct {
+	MockWeatherDataRepository
+	rows int
+}
+
+func (m *failingHistoryRepository) StreamWeatherHistory(lat, long float64, fn func(weatherData *types.WeatherData) error) error {
+	for i := 0; i < m.rows; i++ {
+		err := fn(&types.WeatherData{Id: fmt.Sprintf("id%d", i), Latitude: lat, Longitude: long, CreatedAt: createdAt})
+		if err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("error")
+}
+
+func TestGetWeatherHistoryExportFailsPartWay(t *testing.T) {
+	handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, &failingHistoryRepository{rows: 1500}))
+	w := httptest.NewRecorder()
+
+	// Rows have been flushed so the status can't change, the response is aborted instead
+	require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.GetWeatherHistory(w, newHistoryRequest("?format=ndjson", ""))
+	})
+
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	require.True(t, w.Flushed)
+	require.GreaterOrEqual(t, strings.Count(w.Body.String(), "\n"), 1000)
+}
@@ -0,0 +1,369 @@
+// Package httpapi serves the weather service's REST routes, it translates requests into weatherservice calls and
+// their results and errors into responses, leaving the business logic to weatherservice
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/units"
+	"go-sample-rest/internal/weatherservice"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WeatherService is the business logic the handlers are served by
+type WeatherService interface {
+	LatestWeather(location types.Location) (*types.WeatherData, error)
+	AllLatestWeather() ([]*types.WeatherData, error)
+	LatestWeatherBatch(locations []types.Location) (map[string]*types.WeatherData, error)
+	WeatherHistory(query weatherservice.HistoryQuery) ([]*types.WeatherData, error)
+	StreamHistory(query weatherservice.HistoryQuery, fn func(weatherData *types.WeatherData) error) error
+	UpdateLocation(providerName string, location types.Location) (*types.WeatherData, error)
+	UpdateLocations(providerName string, locations []types.Location) (map[string]types.UpdateWeatherBatchResult, error)
+	SubmitObservation(location types.Location, observation types.Observation) (*types.WeatherData, error)
+	Subscribe(location *types.Location) (<-chan *types.WeatherData, func(), error)
+	WeatherDataSince(location *types.Location, since time.Time, afterId string) ([]*types.WeatherData, error)
+}
+
+type Handler struct {
+	weatherService   WeatherService
+	idempotencyStore IdempotencyStore
+	idempotencyTTL   time.Duration
+}
+
+func NewHandler(weatherService WeatherService) *Handler {
+	return &Handler{
+		weatherService: weatherService,
+	}
+}
+
+func (h *Handler) GetLatestWeather(w http.ResponseWriter, r *http.Request) {
+	location, err := h.getLatLong(r)
+	if err != nil {
+		log.Errorf("failed to get lat long from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.getUnits(r)
+	if err != nil {
+		log.Errorf("failed to get units from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := h.getLocation(r)
+	if err != nil {
+		log.Errorf("failed to get time zone from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	weatherData, err := h.weatherService.LatestWeather(location)
+	if errors.Is(err, weatherservice.ErrWeatherDataNotFound) {
+		log.Infof("weather data not found: lat(%f), long(%f)", location.Latitude, location.Longitude)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to get latest weather data: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, formatWeatherData(weatherData, u, loc))
+}
+
+// GetAllLatestWeather returns the latest weather data of every tracked location
+func (h *Handler) GetAllLatestWeather(w http.ResponseWriter, r *http.Request) {
+	u, err := h.getUnits(r)
+	if err != nil {
+		log.Errorf("failed to get units from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := h.getLocation(r)
+	if err != nil {
+		log.Errorf("failed to get time zone from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	weatherDataList, err := h.weatherService.AllLatestWeather()
+	if err != nil {
+		log.Errorf("failed to get latest weather data of every location: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	formattedWeatherDataList := make([]*types.WeatherData, 0, len(weatherDataList))
+	for _, weatherData := range weatherDataList {
+		formattedWeatherDataList = append(formattedWeatherDataList, formatWeatherData(weatherData, u, loc))
+	}
+
+	render.JSON(w, r, formattedWeatherDataList)
+}
+
+// GetLatestWeatherBatch returns the latest weather data of every requested location, see
+// weatherservice.Service.LatestWeatherBatch
+func (h *Handler) GetLatestWeatherBatch(w http.ResponseWriter, r *http.Request) {
+	u, err := h.getUnits(r)
+	if err != nil {
+		log.Errorf("failed to get units from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := h.getLocation(r)
+	if err != nil {
+		log.Errorf("failed to get time zone from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	locations, err := h.getBatchLocations(r)
+	if err != nil {
+		log.Errorf("failed to get locations from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.weatherService.LatestWeatherBatch(locations)
+	if errors.Is(err, weatherservice.ErrInvalidInput) {
+		log.Errorf("failed to get latest weather data batch: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to get latest weather data batch: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	response := types.GetLatestWeatherBatchResponse{
+		Results: make(map[string]*types.WeatherData, len(results)),
+	}
+
+	for key, weatherData := range results {
+		if weatherData == nil {
+			response.Results[key] = nil
+			continue
+		}
+
+		response.Results[key] = formatWeatherData(weatherData, u, loc)
+	}
+
+	render.JSON(w, r, response)
+}
+
+// GetWeatherHistory returns JSON by default, CSV and NDJSON exports are streamed from the repository
+// as they're read, see getHistoryFormat
+func (h *Handler) GetWeatherHistory(w http.ResponseWriter, r *http.Request) {
+	location, err := h.getLatLong(r)
+	if err != nil {
+		log.Errorf("failed to get lat long from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	u, err := h.getUnits(r)
+	if err != nil {
+		log.Errorf("failed to get units from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := h.getLocation(r)
+	if err != nil {
+		log.Errorf("failed to get time zone from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	format, err := h.getHistoryFormat(r)
+	if err != nil {
+		log.Errorf("failed to get format from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	kind, err := h.getKind(r)
+	if err != nil {
+		log.Errorf("failed to get kind from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	query := weatherservice.HistoryQuery{
+		Location: location,
+		Kind:     kind,
+	}
+
+	if format != historyFormatJSON {
+		h.streamWeatherHistory(w, format, query, u, loc)
+		return
+	}
+
+	weatherHistory, err := h.weatherService.WeatherHistory(query)
+	if err != nil {
+		log.Errorf("failed to get weather data history: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	formattedWeatherHistory := make([]*types.WeatherData, 0, len(weatherHistory))
+	for _, weatherData := range weatherHistory {
+		formattedWeatherHistory = append(formattedWeatherHistory, formatWeatherData(weatherData, u, loc))
+	}
+
+	render.JSON(w, r, formattedWeatherHistory)
+}
+
+// UpdateWeather is made idempotent with the Idempotency-Key header when an idempotency store is set
+func (h *Handler) UpdateWeather(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key != "" && h.idempotencyStore != nil {
+		h.serveIdempotent(w, r, key, h.updateWeather)
+		return
+	}
+
+	h.updateWeather(w, r)
+}
+
+func (h *Handler) updateWeather(w http.ResponseWriter, r *http.Request) {
+	location, err := h.getLatLong(r)
+	if err != nil {
+		log.Errorf("failed to get lat long from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	weatherData, err := h.weatherService.UpdateLocation(r.URL.Query().Get("provider"), location)
+	if errors.Is(err, weatherservice.ErrUnknownProvider) {
+		log.Errorf("failed to update weather data: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, weatherservice.ErrWeatherDataNotFound) {
+		log.Infof("weather data not found: lat(%f), long(%f)", location.Latitude, location.Longitude)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to update weather data: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, weatherData)
+}
+
+// UpdateWeatherBatch pulls and saves the latest weather data of every requested location, see
+// weatherservice.Service.UpdateLocations
+func (h *Handler) UpdateWeatherBatch(w http.ResponseWriter, r *http.Request) {
+	locations, err := h.getBatchLocations(r)
+	if err != nil {
+		log.Errorf("failed to get locations from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.weatherService.UpdateLocations(r.URL.Query().Get("provider"), locations)
+	if errors.Is(err, weatherservice.ErrUnknownProvider) || errors.Is(err, weatherservice.ErrInvalidInput) {
+		log.Errorf("failed to update weather data batch: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to update weather data batch: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.JSON(w, r, types.UpdateWeatherBatchResponse{Results: results})
+}
+
+func (h *Handler) getLatLong(r *http.Request) (types.Location, error) {
+	lat := chi.URLParam(r, "lat")
+	long := chi.URLParam(r, "long")
+
+	if lat == "" || long == "" {
+		return types.Location{}, fmt.Errorf("latitude and longitude must be provided")
+	}
+
+	latFloat, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return types.Location{}, fmt.Errorf("failed to parse latitude: %w", err)
+	}
+
+	longFloat, err := strconv.ParseFloat(long, 64)
+	if err != nil {
+		return types.Location{}, fmt.Errorf("failed to parse longitude: %w", err)
+	}
+
+	return types.Location{Latitude: latFloat, Longitude: longFloat}, nil
+}
+
+// getBatchLocations reads the locations of a batch request, the weather service checks how many there are
+func (h *Handler) getBatchLocations(r *http.Request) ([]types.Location, error) {
+	var request types.WeatherBatchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode request body: %w", err)
+	}
+
+	return request.Locations, nil
+}
+
+func (h *Handler) getUnits(r *http.Request) (units.Units, error) {
+	query := r.URL.Query()
+
+	return units.Parse(
+		query.Get("units"),
+		query.Get("temperature_unit"),
+		query.Get("wind_speed_unit"),
+	)
+}
+
+func (h *Handler) getLocation(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load time zone: %w", err)
+	}
+
+	return loc, nil
+}
+
+// getKind reads the kind of weather data from the kind query parameter, every kind without it
+func (h *Handler) getKind(r *http.Request) (weatherservice.Kind, error) {
+	return weatherservice.ParseKind(r.URL.Query().Get("kind"))
+}
+
+// formatWeatherData converts weather data into the requested units, with timestamps in the requested time zone
+func formatWeatherData(weatherData *types.WeatherData, u units.Units, loc *time.Location) *types.WeatherData {
+	formatted := units.Convert(weatherData, u)
+	formatted.CreatedAt = formatted.CreatedAt.In(loc)
+
+	return formatted
+}
@@ -0,0 +1,992 @@
+package httpapi_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/provider"
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+	"go-sample-rest/internal/weatherservice/httpapi"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+var createdAt = time.Date(2023, 10, 4, 6, 53, 38, 581587000, time.UTC)
+
+type MockWeatherDataClient struct {
+	getLatestWeatherData      func(provider string, lat, long float64) (*types.WeatherData, error)
+	getLatestWeatherDataBatch func(provider string, locations []types.Location) ([]provider.BatchResult, error)
+}
+
+func (m *MockWeatherDataClient) GetLatestWeatherData(provider string, lat, long float64) (*types.WeatherData, error) {
+	if m != nil && m.getLatestWeatherData != nil {
+		return m.getLatestWeatherData(provider, lat, long)
+	}
+
+	return &types.WeatherData{
+		Latitude:      lat,
+		Longitude:     long,
+		Temperature:   3.3,
+		WindSpeed:     4.4,
+		WindDirection: 5.5,
+		Source:        "openmeteo",
+		CreatedAt:     createdAt,
+	}, nil
+}
+
+func (m *MockWeatherDataClient) GetLatestWeatherDataBatch(providerName string, locations []types.Location) ([]provider.BatchResult, error) {
+	if m != nil && m.getLatestWeatherDataBatch != nil {
+		return m.getLatestWeatherDataBatch(providerName, locations)
+	}
+
+	var results []provider.BatchResult
+	for _, location := range locations {
+		weatherData, err := m.GetLatestWeatherData(providerName, location.Latitude, location.Longitude)
+		results = append(results, provider.BatchResult{WeatherData: weatherData, Err: err})
+	}
+
+	return results, nil
+}
+
+type MockWeatherDataRepository struct {
+	getLatestWeatherData      func(lat, long float64) (*types.WeatherData, error)
+	getAllLatestWeatherData   func() ([]*types.WeatherData, error)
+	getLatestWeatherDataBatch func(locations []types.Location) ([]*types.WeatherData, error)
+	getWeatherHistory         func(lat, long float64) ([]*types.WeatherData, error)
+	getWeatherDataSince       func(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error)
+	saveWeatherData           func(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error)
+	saveWeatherDataBatch      func(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error)
+}
+
+func (m *MockWeatherDataRepository) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
+	if m != nil && m.getLatestWeatherData != nil {
+		return m.getLatestWeatherData(lat, long)
+	}
+
+	return &types.WeatherData{
+		Latitude:      lat,
+		Longitude:     long,
+		Temperature:   3.3,
+		WindSpeed:     4.4,
+		WindDirection: 5.5,
+		Source:        "openmeteo",
+		CreatedAt:     createdAt,
+	}, nil
+}
+
+func (m *MockWeatherDataRepository) GetAllLatestWeatherData() ([]*types.WeatherData, error) {
+	if m != nil && m.getAllLatestWeatherData != nil {
+		return m.getAllLatestWeatherData()
+	}
+
+	return []*types.WeatherData{
+		{
+			Latitude:      1.1,
+			Longitude:     2.2,
+			Temperature:   3.3,
+			WindSpeed:     4.4,
+			WindDirection: 5.5,
+			Source:        "openmeteo",
+			CreatedAt:     createdAt,
+		},
+	}, nil
+}
+
+func (m *MockWeatherDataRepository) GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error) {
+	if m != nil && m.getLatestWeatherDataBatch != nil {
+		return m.getLatestWeatherDataBatch(locations)
+	}
+
+	var weatherDataList []*types.WeatherData
+
+	for _, location := range locations {
+		weatherDataList = append(weatherDataList, &types.WeatherData{
+			Latitude:      location.Latitude,
+			Longitude:     location.Longitude,
+			Temperature:   3.3,
+			WindSpeed:     4.4,
+			WindDirection: 5.5,
+			Source:        "openmeteo",
+			CreatedAt:     createdAt,
+		})
+	}
+
+	return weatherDataList, nil
+}
+
+func (m *MockWeatherDataRepository) GetWeatherHistory(lat, long float64) ([]*types.WeatherData, error) {
+	if m != nil && m.getWeatherHistory != nil {
+		return m.getWeatherHistory(lat, long)
+	}
+
+	return []*types.WeatherData{
+		{
+			Latitude:      lat,
+			Longitude:     long,
+			Temperature:   3.3,
+			WindSpeed:     4.4,
+			WindDirection: 5.5,
+			Source:        "openmeteo",
+			CreatedAt:     createdAt,
+		},
+	}, nil
+}
+
+func (m *MockWeatherDataRepository) StreamWeatherHistory(lat, long float64, fn func(weatherData *types.WeatherData) error) error {
+	weatherHistory, err := m.GetWeatherHistory(lat, long)
+	if err != nil {
+		return err
+	}
+
+	for _, weatherData := range weatherHistory {
+		err := fn(weatherData)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *MockWeatherDataRepository) GetWeatherDataSince(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error) {
+	if m != nil && m.getWeatherDataSince != nil {
+		return m.getWeatherDataSince(location, since, afterId, limit)
+	}
+
+	return []*types.WeatherData{}, nil
+}
+
+func (m *MockWeatherDataRepository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+	if m != nil && m.saveWeatherData != nil {
+		return m.saveWeatherData(lat, long, temperature, windDirection, windSpeed, source)
+	}
+
+	return &types.WeatherData{
+		Latitude:      lat,
+		Longitude:     long,
+		Temperature:   3.3,
+		WindSpeed:     4.4,
+		WindDirection: 5.5,
+		Source:        "openmeteo",
+		CreatedAt:     createdAt,
+	}, nil
+}
+
+func (m *MockWeatherDataRepository) SaveWeatherDataBatch(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error) {
+	if m != nil && m.saveWeatherDataBatch != nil {
+		return m.saveWeatherDataBatch(weatherDataList)
+	}
+
+	var savedWeatherDataList []*types.WeatherData
+	for i, weatherData := range weatherDataList {
+		saved := *weatherData
+		saved.Id = fmt.Sprintf("id%d", i)
+		saved.CreatedAt = createdAt
+
+		savedWeatherDataList = append(savedWeatherDataList, &saved)
+	}
+
+	return savedWeatherDataList, nil
+}
+
+func TestGetLatestWeatherData(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		lat                       string
+		long                      string
+		query                     string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		expectedStatusCode        int
+		expectedBody              string
+	}{
+		{
+			name:                      "should err when no lat and long provided",
+			lat:                       "",
+			long:                      "",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name: "should return internal error when repo returns an error trying to get latest weather data",
+			lat:  "1.1",
+			long: "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name: "should return not found when repo did not return an error but weatherData is nil",
+			lat:  "1.1",
+			long: "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
+					return nil, nil
+				},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       http.StatusText(http.StatusNotFound),
+		},
+		{
+			name: "should return weather data as json when repo returns weather data",
+			lat:  "1.1",
+			long: "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
+					return &types.WeatherData{
+						Id:            "abc123",
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   3.3,
+						WindSpeed:     4.4,
+						WindDirection: 5.5,
+						Source:        "openmeteo",
+						CreatedAt:     createdAt,
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}`,
+		},
+		{
+			name:                      "should err when time zone is not valid",
+			lat:                       "1.1",
+			long:                      "2.2",
+			query:                     "?tz=Mars/Olympus_Mons",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:  "should render created at in the requested time zone",
+			lat:   "1.1",
+			long:  "2.2",
+			query: "?tz=Australia/Sydney",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
+					return &types.WeatherData{
+						Id:            "abc123",
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   3.3,
+						WindSpeed:     4.4,
+						WindDirection: 5.5,
+						Source:        "openmeteo",
+						CreatedAt:     createdAt,
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T17:53:38.581587+11:00","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}`,
+		},
+		{
+			name:                      "should err when unit system is not supported",
+			lat:                       "1.1",
+			long:                      "2.2",
+			query:                     "?units=kelvin",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:  "should return weather data converted to imperial units when requested",
+			lat:   "1.1",
+			long:  "2.2",
+			query: "?units=imperial",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
+					return &types.WeatherData{
+						Id:            "abc123",
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   20,
+						WindSpeed:     16.09344,
+						WindDirection: 5.5,
+						Source:        "openmeteo",
+						CreatedAt:     createdAt,
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":68,"wind_direction":5.5,"wind_speed":10,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"fahrenheit","wind_speed":"mph","wind_direction":"degrees"}}`,
+		},
+		{
+			name:  "should apply per-field unit overrides on top of the unit system",
+			lat:   "1.1",
+			long:  "2.2",
+			query: "?units=imperial&wind_speed_unit=kn",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
+					return &types.WeatherData{
+						Id:            "abc123",
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   20,
+						WindSpeed:     18.52,
+						WindDirection: 5.5,
+						Source:        "openmeteo",
+						CreatedAt:     createdAt,
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":68,"wind_direction":5.5,"wind_speed":10,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"fahrenheit","wind_speed":"kn","wind_direction":"degrees"}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, tc.mockWeatherDataRepository))
+			r := httptest.NewRequest("GET", fmt.Sprintf("/%s,%s/latest%s", tc.lat, tc.long, tc.query), nil)
+			w := httptest.NewRecorder()
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("lat", tc.lat)
+			rctx.URLParams.Add("long", tc.long)
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handler.GetLatestWeather(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
+
+func TestGetAllLatestWeather(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		query                     string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		expectedStatusCode        int
+		expectedBody              string
+	}{
+		{
+			name: "should return internal error when repo returns an error trying to get latest weather data",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getAllLatestWeatherData: func() ([]*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name: "should return empty list when no location is tracked",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getAllLatestWeatherData: func() ([]*types.WeatherData, error) {
+					return nil, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[]`,
+		},
+		{
+			name: "should return the latest weather data of every location as json",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getAllLatestWeatherData: func() ([]*types.WeatherData, error) {
+					return []*types.WeatherData{
+						{
+							Id:            "abc123",
+							Latitude:      1.1,
+							Longitude:     2.2,
+							Temperature:   3.3,
+							WindSpeed:     4.4,
+							WindDirection: 5.5,
+							Source:        "openmeteo",
+							CreatedAt:     createdAt,
+						},
+						{
+							Id:            "def456",
+							Latitude:      3.3,
+							Longitude:     4.4,
+							Temperature:   5.5,
+							WindSpeed:     6.6,
+							WindDirection: 7.7,
+							Source:        "metno",
+							CreatedAt:     createdAt,
+						},
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}},{"id":"def456","latitude":3.3,"longitude":4.4,"temperature":5.5,"wind_direction":7.7,"wind_speed":6.6,"source":"metno","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}]`,
+		},
+		{
+			name:                      "should err when unit system is not supported",
+			query:                     "?units=kelvin",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:  "should return the latest weather data in the requested units and time zone",
+			query: "?units=imperial&tz=Asia/Tokyo",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getAllLatestWeatherData: func() ([]*types.WeatherData, error) {
+					return []*types.WeatherData{
+						{
+							Id:            "abc123",
+							Latitude:      1.1,
+							Longitude:     2.2,
+							Temperature:   20,
+							WindSpeed:     16.09344,
+							WindDirection: 5.5,
+							Source:        "openmeteo",
+							CreatedAt:     createdAt,
+						},
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":68,"wind_direction":5.5,"wind_speed":10,"source":"openmeteo","created_at":"2023-10-04T15:53:38.581587+09:00","units":{"temperature":"fahrenheit","wind_speed":"mph","wind_direction":"degrees"}}]`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, tc.mockWeatherDataRepository))
+			r := httptest.NewRequest("GET", fmt.Sprintf("/latest%s", tc.query), nil)
+			w := httptest.NewRecorder()
+
+			handler.GetAllLatestWeather(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
+
+func TestGetLatestWeatherBatch(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		query                     string
+		body                      string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		expectedLocations         []types.Location
+		expectedStatusCode        int
+		expectedBody              string
+	}{
+		{
+			name:                      "should err when body is not valid json",
+			body:                      `{"locations":`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when no locations are provided",
+			body:                      `{"locations":[]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when too many locations are provided",
+			body:                      fmt.Sprintf(`{"locations":[%s]}`, strings.Repeat(`{"latitude":1.1,"longitude":2.2},`, weatherservice.MaxBatchLocations)+`{"latitude":1.1,"longitude":2.2}`),
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name: "should return internal error when repo returns an error trying to get latest weather data",
+			body: `{"locations":[{"latitude":1.1,"longitude":2.2}]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getLatestWeatherDataBatch: func(locations []types.Location) ([]*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedLocations:  []types.Location{{Latitude: 1.1, Longitude: 2.2}},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name: "should return results keyed by location with null for locations without weather data",
+			body: `{"locations":[{"latitude":1.1,"longitude":2.2},{"latitude":-33.87,"longitude":151.21},{"latitude":1.1,"longitude":2.2}]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getLatestWeatherDataBatch: func(locations []types.Location) ([]*types.WeatherData, error) {
+					return []*types.WeatherData{
+						{
+							Id:            "abc123",
+							Latitude:      1.1,
+							Longitude:     2.2,
+							Temperature:   3.3,
+							WindSpeed:     4.4,
+							WindDirection: 5.5,
+							Source:        "openmeteo",
+							CreatedAt:     createdAt,
+						},
+					}, nil
+				},
+			},
+			expectedLocations:  []types.Location{{Latitude: 1.1, Longitude: 2.2}, {Latitude: -33.87, Longitude: 151.21}},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"results":{"-33.87,151.21":null,"1.1,2.2":{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}}}`,
+		},
+		{
+			name:                      "should return results in the requested units and time zone",
+			query:                     "?units=imperial&tz=Asia/Tokyo",
+			body:                      `{"locations":[{"latitude":1.1,"longitude":2.2}]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedLocations:         []types.Location{{Latitude: 1.1, Longitude: 2.2}},
+			expectedStatusCode:        http.StatusOK,
+			expectedBody:              `{"results":{"1.1,2.2":{"id":"","latitude":1.1,"longitude":2.2,"temperature":37.94,"wind_direction":5.5,"wind_speed":2.73,"source":"openmeteo","created_at":"2023-10-04T15:53:38.581587+09:00","units":{"temperature":"fahrenheit","wind_speed":"mph","wind_direction":"degrees"}}}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var requestedLocations []types.Location
+
+			mockWeatherDataRepository := *tc.mockWeatherDataRepository
+			mockWeatherDataRepository.getLatestWeatherDataBatch = func(locations []types.Location) ([]*types.WeatherData, error) {
+				requestedLocations = locations
+
+				return tc.mockWeatherDataRepository.GetLatestWeatherDataBatch(locations)
+			}
+
+			handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, &mockWeatherDataRepository))
+			r := httptest.NewRequest("POST", fmt.Sprintf("/latest:batch%s", tc.query), strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+
+			handler.GetLatestWeatherBatch(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+			require.Equal(t, tc.expectedLocations, requestedLocations)
+		})
+	}
+}
+
+func TestGetWeatherHistory(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		lat                       string
+		long                      string
+		query                     string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		expectedStatusCode        int
+		expectedBody              string
+	}{
+		{
+			name:                      "should err when no lat and long provided",
+			lat:                       "",
+			long:                      "",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name: "should return internal error when repo returns an error trying to get weather data history",
+			lat:  "1.1",
+			long: "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name: "should return weather data history as json when repo returns weather data history",
+			lat:  "1.1",
+			long: "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) {
+					return []*types.WeatherData{
+						{
+							Id:            "abc123",
+							Latitude:      lat,
+							Longitude:     long,
+							Temperature:   3.3,
+							WindSpeed:     4.4,
+							WindDirection: 5.5,
+							Source:        "openmeteo",
+							CreatedAt:     createdAt,
+						},
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}]`,
+		},
+		{
+			name: "should render created at in UTC when no time zone is requested",
+			lat:  "1.1",
+			long: "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) {
+					return []*types.WeatherData{
+						{
+							Id:            "abc123",
+							Latitude:      lat,
+							Longitude:     long,
+							Temperature:   3.3,
+							WindSpeed:     4.4,
+							WindDirection: 5.5,
+							Source:        "openmeteo",
+							CreatedAt:     createdAt.In(time.FixedZone("", 2*60*60)),
+						},
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"celsius","wind_speed":"kmh","wind_direction":"degrees"}}]`,
+		},
+		{
+			name:                      "should err when wind speed unit is not supported",
+			lat:                       "1.1",
+			long:                      "2.2",
+			query:                     "?wind_speed_unit=furlongs",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:  "should return weather data history converted to the requested units",
+			lat:   "1.1",
+			long:  "2.2",
+			query: "?temperature_unit=fahrenheit&wind_speed_unit=ms",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) {
+					return []*types.WeatherData{
+						{
+							Id:            "abc123",
+							Latitude:      lat,
+							Longitude:     long,
+							Temperature:   -40,
+							WindSpeed:     36,
+							WindDirection: 5.5,
+							Source:        "openmeteo",
+							CreatedAt:     createdAt,
+						},
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":-40,"wind_direction":5.5,"wind_speed":10,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z","units":{"temperature":"fahrenheit","wind_speed":"ms","wind_direction":"degrees"}}]`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, tc.mockWeatherDataRepository))
+			r := httptest.NewRequest("GET", fmt.Sprintf("/%s,%s/history%s", tc.lat, tc.long, tc.query), nil)
+			w := httptest.NewRecorder()
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("lat", tc.lat)
+			rctx.URLParams.Add("long", tc.long)
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handler.GetWeatherHistory(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
+
+func TestUpdateWeather(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		lat                       string
+		long                      string
+		query                     string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		mockWeatherDataClient     *MockWeatherDataClient
+		expectedStatusCode        int
+		expectedBody              string
+	}{
+		{
+			name:                      "should err when no lat and long provided",
+			lat:                       "",
+			long:                      "",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient:     &MockWeatherDataClient{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should return internal error when data client returns an error trying to get latest weather data",
+			lat:                       "1.1",
+			long:                      "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherData: func(provider string, lat, long float64) (*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name:                      "should return status not found when data client did not return an error but weatherData is nil",
+			lat:                       "1.1",
+			long:                      "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherData: func(provider string, lat, long float64) (*types.WeatherData, error) {
+					return nil, nil
+				},
+			},
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       http.StatusText(http.StatusNotFound),
+		},
+		{
+			name: "should return internal error when repo returns an error trying to save weather data",
+			lat:  "1.1",
+			long: "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				saveWeatherData: func(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherData: func(provider string, lat, long float64) (*types.WeatherData, error) {
+					return &types.WeatherData{
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   3.3,
+						WindSpeed:     4.4,
+						WindDirection: 5.5,
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name: "should return OK with weather data as json when repo returns weather data",
+			lat:  "1.1",
+			long: "2.2",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				saveWeatherData: func(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+					return &types.WeatherData{
+						Id:            "abc123",
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   temperature,
+						WindSpeed:     windDirection,
+						WindDirection: windSpeed,
+						Source:        "openmeteo",
+						CreatedAt:     createdAt,
+					}, nil
+				},
+			},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherData: func(provider string, lat, long float64) (*types.WeatherData, error) {
+					return &types.WeatherData{
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   3.3,
+						WindSpeed:     4.4,
+						WindDirection: 5.5,
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":4.4,"wind_speed":5.5,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`,
+		},
+		{
+			name:                      "should return bad request when requested provider is unknown",
+			lat:                       "1.1",
+			long:                      "2.2",
+			query:                     "?provider=unknown",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherData: func(providerName string, lat, long float64) (*types.WeatherData, error) {
+					return nil, fmt.Errorf("%w: %s", provider.ErrUnknownProvider, providerName)
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:  "should fetch from the requested provider and save it as the source",
+			lat:   "1.1",
+			long:  "2.2",
+			query: "?provider=metno",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				saveWeatherData: func(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+					return &types.WeatherData{
+						Id:            "abc123",
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   temperature,
+						WindSpeed:     windSpeed,
+						WindDirection: windDirection,
+						Source:        source,
+						CreatedAt:     createdAt,
+					}, nil
+				},
+			},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherData: func(providerName string, lat, long float64) (*types.WeatherData, error) {
+					if providerName != "metno" {
+						return nil, fmt.Errorf("unexpected provider: %s", providerName)
+					}
+
+					return &types.WeatherData{
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   3.3,
+						WindSpeed:     4.4,
+						WindDirection: 5.5,
+						Source:        providerName,
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"metno","created_at":"2023-10-04T06:53:38.581587Z"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := httpapi.NewHandler(weatherservice.NewService(tc.mockWeatherDataClient, tc.mockWeatherDataRepository))
+			r := httptest.NewRequest("POST", fmt.Sprintf("/%s,%s/update%s", tc.lat, tc.long, tc.query), nil)
+			w := httptest.NewRecorder()
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("lat", tc.lat)
+			rctx.URLParams.Add("long", tc.long)
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handler.UpdateWeather(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
+
+func TestUpdateWeatherBatch(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		query                     string
+		body                      string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		mockWeatherDataClient     *MockWeatherDataClient
+		expectedStatusCode        int
+		expectedBody              string
+	}{
+		{
+			name:                      "should err when no locations are provided",
+			body:                      `{"locations":[]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient:     &MockWeatherDataClient{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when too many locations are provided",
+			body:                      fmt.Sprintf(`{"locations":[%s{"latitude":1.1,"longitude":2.2}]}`, strings.Repeat(`{"latitude":1.1,"longitude":2.2},`, weatherservice.MaxUpdateBatchLocations)),
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient:     &MockWeatherDataClient{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when provider is not registered",
+			query:                     "?provider=unknown",
+			body:                      `{"locations":[{"latitude":1.1,"longitude":2.2}]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherDataBatch: func(providerName string, locations []types.Location) ([]provider.BatchResult, error) {
+					return nil, fmt.Errorf("%w: %s", provider.ErrUnknownProvider, providerName)
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should return internal error when weather data client returns an error",
+			body:                      `{"locations":[{"latitude":1.1,"longitude":2.2}]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherDataBatch: func(providerName string, locations []types.Location) ([]provider.BatchResult, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name: "should return internal error when repo returns an error trying to save weather data",
+			body: `{"locations":[{"latitude":1.1,"longitude":2.2}]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				saveWeatherDataBatch: func(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			mockWeatherDataClient: &MockWeatherDataClient{},
+			expectedStatusCode:    http.StatusInternalServerError,
+			expectedBody:          http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name:                      "should return the saved weather data or error of each location",
+			body:                      `{"locations":[{"latitude":1.1,"longitude":2.2},{"latitude":3.3,"longitude":4.4},{"latitude":5.5,"longitude":6.6}]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherDataBatch: func(providerName string, locations []types.Location) ([]provider.BatchResult, error) {
+					return []provider.BatchResult{
+						// Snapped to the provider's grid
+						{WeatherData: &types.WeatherData{Latitude: 1.125, Longitude: 2.25, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5, Source: "openmeteo"}},
+						{Err: fmt.Errorf("error")},
+						{},
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"results":{"1.1,2.2":{"weather_data":{"id":"id0","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}},"3.3,4.4":{"error":"failed to get weather data"},"5.5,6.6":{"error":"weather data not found"}}}`,
+		},
+		{
+			name:                      "should pass the requested provider to the weather data client",
+			query:                     "?provider=metno",
+			body:                      `{"locations":[{"latitude":1.1,"longitude":2.2}]}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			mockWeatherDataClient: &MockWeatherDataClient{
+				getLatestWeatherDataBatch: func(providerName string, locations []types.Location) ([]provider.BatchResult, error) {
+					if providerName != "metno" {
+						return nil, fmt.Errorf("unexpected provider: %s", providerName)
+					}
+
+					return []provider.BatchResult{
+						{WeatherData: &types.WeatherData{Latitude: 1.1, Longitude: 2.2, Temperature: 3.3, WindSpeed: 4.4, WindDirection: 5.5, Source: "metno"}},
+					}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"results":{"1.1,2.2":{"weather_data":{"id":"id0","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"metno","created_at":"2023-10-04T06:53:38.581587Z"}}}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := httpapi.NewHandler(weatherservice.NewService(tc.mockWeatherDataClient, tc.mockWeatherDataRepository))
+			r := httptest.NewRequest("POST", fmt.Sprintf("/update:batch%s", tc.query), strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+
+			handler.UpdateWeatherBatch(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		})
+	}
+}
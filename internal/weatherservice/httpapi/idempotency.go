@@ -0,0 +1,149 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"go-sample-rest/internal/types"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed for a repeated request
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// idempotencyLease is how long a request in flight holds its key, a crash can keep the key from being released so
+	// it's taken over by a retry after the lease. It outlasts the update's upstream request.
+	idempotencyLease = time.Minute
+)
+
+// IdempotencyStore keeps the responses of requests made with an idempotency key
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(key, fingerprint string, lockedUntil time.Time) (*types.IdempotencyRecord, error)
+	CompleteIdempotencyKey(key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error
+	ReleaseIdempotencyKey(key string) error
+	DeleteExpiredIdempotencyKeys() (int64, error)
+}
+
+// SetIdempotencyStore makes UpdateWeather replay the response of requests repeated with the same Idempotency-Key
+// header for ttl, without a store the header is ignored
+func (h *Handler) SetIdempotencyStore(store IdempotencyStore, ttl time.Duration) {
+	h.idempotencyStore = store
+	h.idempotencyTTL = ttl
+}
+
+// StartIdempotencyCleanup deletes expired idempotency keys every interval until the context is done
+func (h *Handler) StartIdempotencyCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := h.idempotencyStore.DeleteExpiredIdempotencyKeys()
+		if err != nil {
+			log.Errorf("failed to delete expired idempotency keys: %v", err)
+		} else if deleted > 0 {
+			log.Infof("deleted %d expired idempotency keys", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveIdempotent serves the request once per idempotency key, repeated requests get the stored response. Reusing a key
+// for a different request is rejected with 422, and repeating a request that's still in flight with 409 until its lease
+// is over.
+// Server errors aren't stored, so the request can be retried with the same key.
+func (h *Handler) serveIdempotent(w http.ResponseWriter, r *http.Request, key string, next http.HandlerFunc) {
+	if len(key) > maxIdempotencyKeyLength {
+		log.Errorf("idempotency key is longer than %d characters", maxIdempotencyKeyLength)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	fingerprint := requestFingerprint(r)
+
+	record, err := h.idempotencyStore.ReserveIdempotencyKey(key, fingerprint, time.Now().Add(idempotencyLease))
+	if err != nil {
+		log.Errorf("failed to reserve idempotency key: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if record != nil {
+		if record.Fingerprint != fingerprint {
+			log.Errorf("idempotency key %s was used for a different request", key)
+			http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if record.StatusCode == 0 {
+			log.Errorf("request with idempotency key %s is still in flight", key)
+			http.Error(w, http.StatusText(http.StatusConflict), http.StatusConflict)
+			return
+		}
+
+		if record.ContentType != "" {
+			w.Header().Set("Content-Type", record.ContentType)
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(record.StatusCode)
+		w.Write(record.Body)
+		return
+	}
+
+	completed := false
+
+	// Released when the request fails or panics, so it can be retried
+	defer func() {
+		if completed {
+			return
+		}
+
+		err := h.idempotencyStore.ReleaseIdempotencyKey(key)
+		if err != nil {
+			log.Errorf("failed to release idempotency key: %v", err)
+		}
+	}()
+
+	var body bytes.Buffer
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	ww.Tee(&body)
+
+	next(ww, r)
+
+	statusCode := ww.Status()
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		return
+	}
+
+	err = h.idempotencyStore.CompleteIdempotencyKey(key, statusCode, ww.Header().Get("Content-Type"), body.Bytes(), time.Now().Add(h.idempotencyTTL))
+	if err != nil {
+		log.Errorf("failed to store response of idempotency key: %v", err)
+		return
+	}
+
+	completed = true
+}
+
+// requestFingerprint identifies a request by its method, path and query parameters
+func requestFingerprint(r *http.Request) string {
+	hash := sha256.Sum256([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode()))
+
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,292 @@
+package httpapi_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+	"go-sample-rest/internal/weatherservice/httpapi"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// MockIdempotencyStore keeps idempotency keys in memory like the Postgres store does
+type MockIdempotencyStore struct {
+	records map[string]*types.IdempotencyRecord
+	err     error
+}
+
+func NewMockIdempotencyStore() *MockIdempotencyStore {
+	return &MockIdempotencyStore{records: map[string]*types.IdempotencyRecord{}}
+}
+
+func (m *MockIdempotencyStore) ReserveIdempotencyKey(key, fingerprint string, lockedUntil time.Time) (*types.IdempotencyRecord, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if record, ok := m.records[key]; ok && record.ExpiresAt.After(time.Now()) {
+		return record, nil
+	}
+
+	m.records[key] = &types.IdempotencyRecord{Key: key, Fingerprint: fingerprint, ExpiresAt: lockedUntil}
+
+	return nil, nil
+}
+
+func (m *MockIdempotencyStore) CompleteIdempotencyKey(key string, statusCode int, contentType string, body []byte, expiresAt time.Time) error {
+	record := m.records[key]
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = body
+	record.ExpiresAt = expiresAt
+
+	return nil
+}
+
+func (m *MockIdempotencyStore) ReleaseIdempotencyKey(key string) error {
+	if m.records[key].StatusCode == 0 {
+		delete(m.records, key)
+	}
+
+	return nil
+}
+
+func (m *MockIdempotencyStore) DeleteExpiredIdempotencyKeys() (int64, error) {
+	return 0, nil
+}
+
+type updateRequest struct {
+	lat   string
+	long  string
+	query string
+	key   string
+}
+
+type updateResponse struct {
+	statusCode int
+	body       string
+	replayed   bool
+}
+
+func TestUpdateWeatherIdempotency(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		store                 *MockIdempotencyStore
+		mockWeatherDataClient func(calls *int) *MockWeatherDataClient
+		requests              []updateRequest
+		expectedResponses     []updateResponse
+		expectedCalls         int
+	}{
+		{
+			name:  "should replay the response of a repeated request",
+			store: NewMockIdempotencyStore(),
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: "abc"},
+				{lat: "1.1", long: "2.2", key: "abc"},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`},
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`, replayed: true},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name:  "should update again for a different key",
+			store: NewMockIdempotencyStore(),
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: "abc"},
+				{lat: "1.1", long: "2.2", key: "def"},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`},
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`},
+			},
+			expectedCalls: 2,
+		},
+		{
+			name:  "should err when a key is reused for a different location or provider",
+			store: NewMockIdempotencyStore(),
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: "abc"},
+				{lat: "3.3", long: "4.4", key: "abc"},
+				{lat: "1.1", long: "2.2", query: "?provider=metno", key: "abc"},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`},
+				{statusCode: http.StatusUnprocessableEntity, body: http.StatusText(http.StatusUnprocessableEntity)},
+				{statusCode: http.StatusUnprocessableEntity, body: http.StatusText(http.StatusUnprocessableEntity)},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name:  "should replay client errors",
+			store: NewMockIdempotencyStore(),
+			mockWeatherDataClient: func(calls *int) *MockWeatherDataClient {
+				return &MockWeatherDataClient{
+					getLatestWeatherData: func(provider string, lat, long float64) (*types.WeatherData, error) {
+						*calls++
+						return nil, nil
+					},
+				}
+			},
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: "abc"},
+				{lat: "1.1", long: "2.2", key: "abc"},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusNotFound, body: http.StatusText(http.StatusNotFound)},
+				{statusCode: http.StatusNotFound, body: http.StatusText(http.StatusNotFound), replayed: true},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name:  "should allow retrying after a server error",
+			store: NewMockIdempotencyStore(),
+			mockWeatherDataClient: func(calls *int) *MockWeatherDataClient {
+				return &MockWeatherDataClient{
+					getLatestWeatherData: func(provider string, lat, long float64) (*types.WeatherData, error) {
+						*calls++
+						return nil, fmt.Errorf("error")
+					},
+				}
+			},
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: "abc"},
+				{lat: "1.1", long: "2.2", key: "abc"},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusInternalServerError, body: http.StatusText(http.StatusInternalServerError)},
+				{statusCode: http.StatusInternalServerError, body: http.StatusText(http.StatusInternalServerError)},
+			},
+			expectedCalls: 2,
+		},
+		{
+			name: "should take over a key whose request was abandoned in flight",
+			store: &MockIdempotencyStore{records: map[string]*types.IdempotencyRecord{
+				"abc": {Key: "abc", Fingerprint: "abandoned", ExpiresAt: time.Now().Add(-time.Second)},
+			}},
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: "abc"},
+				{lat: "1.1", long: "2.2", key: "abc"},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`},
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`, replayed: true},
+			},
+			expectedCalls: 1,
+		},
+		{
+			name:  "should err when the key is too long",
+			store: NewMockIdempotencyStore(),
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: strings.Repeat("a", 256)},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusBadRequest, body: http.StatusText(http.StatusBadRequest)},
+			},
+			expectedCalls: 0,
+		},
+		{
+			name:  "should return internal error when store returns an error",
+			store: &MockIdempotencyStore{err: fmt.Errorf("error")},
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: "abc"},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusInternalServerError, body: http.StatusText(http.StatusInternalServerError)},
+			},
+			expectedCalls: 0,
+		},
+		{
+			name: "should ignore the key without a store",
+			requests: []updateRequest{
+				{lat: "1.1", long: "2.2", key: "abc"},
+				{lat: "1.1", long: "2.2", key: "abc"},
+			},
+			expectedResponses: []updateResponse{
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`},
+				{statusCode: http.StatusOK, body: `{"id":"","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"source":"openmeteo","created_at":"2023-10-04T06:53:38.581587Z"}`},
+			},
+			expectedCalls: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+
+			mockWeatherDataClient := &MockWeatherDataClient{
+				getLatestWeatherData: func(provider string, lat, long float64) (*types.WeatherData, error) {
+					calls++
+					return (*MockWeatherDataClient)(nil).GetLatestWeatherData(provider, lat, long)
+				},
+			}
+			if tc.mockWeatherDataClient != nil {
+				mockWeatherDataClient = tc.mockWeatherDataClient(&calls)
+			}
+
+			handler := httpapi.NewHandler(weatherservice.NewService(mockWeatherDataClient, &MockWeatherDataRepository{}))
+			if tc.store != nil {
+				handler.SetIdempotencyStore(tc.store, time.Hour)
+			}
+
+			for i, request := range tc.requests {
+				w := httptest.NewRecorder()
+
+				handler.UpdateWeather(w, newUpdateRequest(request))
+
+				expected := tc.expectedResponses[i]
+				require.Equal(t, expected.statusCode, w.Result().StatusCode)
+				require.Equal(t, expected.body, strings.Trim(w.Body.String(), "\n"))
+				require.Equal(t, expected.replayed, w.Header().Get(httpapi.IdempotentReplayedHeader) == "true")
+			}
+
+			require.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+}
+
+func TestUpdateWeatherIdempotencyInFlight(t *testing.T) {
+	var handler *httpapi.Handler
+	var repeated *httptest.ResponseRecorder
+
+	// The request is repeated while the first one is still fetching weather data
+	mockWeatherDataClient := &MockWeatherDataClient{
+		getLatestWeatherData: func(provider string, lat, long float64) (*types.WeatherData, error) {
+			if repeated == nil {
+				repeated = httptest.NewRecorder()
+				handler.UpdateWeather(repeated, newUpdateRequest(updateRequest{lat: "1.1", long: "2.2", key: "abc"}))
+			}
+
+			return (*MockWeatherDataClient)(nil).GetLatestWeatherData(provider, lat, long)
+		},
+	}
+
+	handler = httpapi.NewHandler(weatherservice.NewService(mockWeatherDataClient, &MockWeatherDataRepository{}))
+	handler.SetIdempotencyStore(NewMockIdempotencyStore(), time.Hour)
+
+	w := httptest.NewRecorder()
+	handler.UpdateWeather(w, newUpdateRequest(updateRequest{lat: "1.1", long: "2.2", key: "abc"}))
+
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	require.Equal(t, http.StatusConflict, repeated.Result().StatusCode)
+}
+
+func newUpdateRequest(request updateRequest) *http.Request {
+	r := httptest.NewRequest("POST", fmt.Sprintf("/%s,%s/update%s", request.lat, request.long, request.query), nil)
+	r.Header.Set(httpapi.IdempotencyKeyHeader, request.key)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("lat", request.lat)
+	rctx.URLParams.Add("long", request.long)
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
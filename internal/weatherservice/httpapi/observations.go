@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+
+	"github.com/go-chi/render"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SubmitObservation saves a reading of an on-site sensor at the location, see weatherservice.Service.SubmitObservation
+func (h *Handler) SubmitObservation(w http.ResponseWriter, r *http.Request) {
+	location, err := h.getLatLong(r)
+	if err != nil {
+		log.Errorf("failed to get lat long from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	var observation types.Observation
+	err = json.NewDecoder(r.Body).Decode(&observation)
+	if err != nil {
+		log.Errorf("failed to decode observation: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	savedWeatherData, err := h.weatherService.SubmitObservation(location, observation)
+	if errors.Is(err, weatherservice.ErrInvalidInput) {
+		log.Errorf("invalid observation: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to submit observation: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, savedWeatherData)
+}
@@ -0,0 +1,238 @@
+package httpapi_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"go-sample-rest/internal/repository/memory"
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+	"go-sample-rest/internal/weatherservice/httpapi"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitObservation(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		lat                       string
+		long                      string
+		body                      string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		expectedStatusCode        int
+		expectedBody              string
+		expectedSource            string
+	}{
+		{
+			name:                      "should err when lat is invalid",
+			lat:                       "abc",
+			long:                      "2.2",
+			body:                      `{"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when body is not json",
+			lat:                       "1.1",
+			long:                      "2.2",
+			body:                      `{"temperature":`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when a reading is missing",
+			lat:                       "1.1",
+			long:                      "2.2",
+			body:                      `{"temperature":3.3,"wind_speed":4.4}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when wind direction is out of range",
+			lat:                       "1.1",
+			long:                      "2.2",
+			body:                      `{"temperature":3.3,"wind_direction":360.5,"wind_speed":4.4}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when wind speed is negative",
+			lat:                       "1.1",
+			long:                      "2.2",
+			body:                      `{"temperature":3.3,"wind_direction":5.5,"wind_speed":-0.1}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when temperature is implausible",
+			lat:                       "1.1",
+			long:                      "2.2",
+			body:                      `{"temperature":120,"wind_direction":5.5,"wind_speed":4.4}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name:                      "should err when sensor id is invalid",
+			lat:                       "1.1",
+			long:                      "2.2",
+			body:                      `{"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"sensor_id":"roof/north"}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+			expectedBody:              http.StatusText(http.StatusBadRequest),
+		},
+		{
+			name: "should return internal error when repo returns an error",
+			lat:  "1.1",
+			long: "2.2",
+			body: `{"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				saveWeatherData: func(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+			expectedBody:       http.StatusText(http.StatusInternalServerError),
+		},
+		{
+			name:                      "should save a manual observation",
+			lat:                       "1.1",
+			long:                      "2.2",
+			body:                      `{"temperature":3.3,"wind_direction":0,"wind_speed":0}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusCreated,
+			expectedBody:              `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":0,"wind_speed":0,"source":"manual","created_at":"2023-10-04T06:53:38.581587Z"}`,
+			expectedSource:            "manual",
+		},
+		{
+			name:                      "should save a sensor's observation under its id",
+			lat:                       "1.1",
+			long:                      "2.2",
+			body:                      `{"temperature":3.3,"wind_direction":360,"wind_speed":4.4,"sensor_id":"anemometer-1"}`,
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusCreated,
+			expectedBody:              `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":360,"wind_speed":4.4,"source":"sensor:anemometer-1","created_at":"2023-10-04T06:53:38.581587Z"}`,
+			expectedSource:            "sensor:anemometer-1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var savedSource string
+			if tc.mockWeatherDataRepository.saveWeatherData == nil {
+				tc.mockWeatherDataRepository.saveWeatherData = func(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error) {
+					savedSource = source
+
+					return &types.WeatherData{
+						Id:            "abc123",
+						Latitude:      lat,
+						Longitude:     long,
+						Temperature:   temperature,
+						WindDirection: windDirection,
+						WindSpeed:     windSpeed,
+						Source:        source,
+						CreatedAt:     createdAt,
+					}, nil
+				}
+			}
+
+			handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, tc.mockWeatherDataRepository))
+			r := httptest.NewRequest("POST", fmt.Sprintf("/%s,%s/observations", tc.lat, tc.long), strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("lat", tc.lat)
+			rctx.URLParams.Add("long", tc.long)
+
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+
+			handler.SubmitObservation(w, r)
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+			require.Equal(t, tc.expectedSource, savedSource)
+		})
+	}
+}
+
+func TestGetLatestWeatherAfterObservation(t *testing.T) {
+	repo := memory.NewRepository()
+	handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, repo))
+
+	withLocation := func(r *http.Request) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("lat", "1.1")
+		rctx.URLParams.Add("long", "2.2")
+
+		return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	}
+
+	provided, err := repo.SaveWeatherData(1.1, 2.2, 3.3, 5.5, 4.4, "openmeteo")
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.SubmitObservation(w, withLocation(httptest.NewRequest("POST", "/1.1,2.2/observations", strings.NewReader(`{"temperature":10,"wind_direction":90,"wind_speed":20}`))))
+	require.Equal(t, http.StatusCreated, w.Result().StatusCode)
+
+	w = httptest.NewRecorder()
+	handler.GetLatestWeather(w, withLocation(httptest.NewRequest("GET", "/1.1,2.2/latest", nil)))
+	require.Equal(t, http.StatusOK, w.Result().StatusCode)
+	require.Contains(t, w.Body.String(), `"id":"`+provided.Id+`"`)
+	require.Contains(t, w.Body.String(), `"source":"openmeteo"`)
+}
+
+func TestGetWeatherHistoryKind(t *testing.T) {
+	mockWeatherDataRepository := &MockWeatherDataRepository{
+		getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) {
+			return []*types.WeatherData{
+				{Id: "a1", Source: "sensor:anemometer-1", CreatedAt: createdAt},
+				{Id: "a2", Source: "openmeteo", CreatedAt: createdAt},
+				{Id: "a3", Source: "manual", CreatedAt: createdAt},
+				{Id: "a4", Source: "metno", CreatedAt: createdAt},
+			}, nil
+		},
+	}
+
+	testCases := []struct {
+		name               string
+		query              string
+		expectedStatusCode int
+		expectedIds        []string
+	}{
+		{name: "should return every kind by default", expectedStatusCode: http.StatusOK, expectedIds: []string{"a1", "a2", "a3", "a4"}},
+		{name: "should return only observations", query: "?kind=observation", expectedStatusCode: http.StatusOK, expectedIds: []string{"a1", "a3"}},
+		{name: "should return only provider weather data", query: "?kind=provider", expectedStatusCode: http.StatusOK, expectedIds: []string{"a2", "a4"}},
+		{name: "should filter exports too", query: "?kind=observation&format=csv", expectedStatusCode: http.StatusOK, expectedIds: []string{"a1", "a3"}},
+		{name: "should err when kind is not supported", query: "?kind=forecast", expectedStatusCode: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := httpapi.NewHandler(weatherservice.NewService(&MockWeatherDataClient{}, mockWeatherDataRepository))
+			w := httptest.NewRecorder()
+
+			handler.GetWeatherHistory(w, newHistoryRequest(tc.query, ""))
+
+			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
+
+			for _, id := range []string{"a1", "a2", "a3", "a4"} {
+				if slices.Contains(tc.expectedIds, id) {
+					require.Contains(t, w.Body.String(), id)
+				} else {
+					require.NotContains(t, w.Body.String(), id)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/units"
+	"go-sample-rest/internal/weatherservice"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	LastEventIdHeader = "Last-Event-ID"
+	// StreamEventName is the event name of weather data sent to streams
+	StreamEventName = "weather"
+	// streamKeepAliveInterval is how often an idle stream is sent a comment, so proxies don't close it
+	streamKeepAliveInterval = 15 * time.Second
+)
+
+// StreamWeather sends the location's newly saved weather data as Server-Sent Events, see streamWeather
+func (h *Handler) StreamWeather(w http.ResponseWriter, r *http.Request) {
+	location, err := h.getLatLong(r)
+	if err != nil {
+		log.Errorf("failed to get lat long from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	h.streamWeather(w, r, &location)
+}
+
+// StreamAllWeather sends every location's newly saved weather data as Server-Sent Events, see streamWeather
+func (h *Handler) StreamAllWeather(w http.ResponseWriter, r *http.Request) {
+	h.streamWeather(w, r, nil)
+}
+
+// streamEvent is the position of weather data in a stream, sent as the event id so a client can resume after it
+type streamEvent struct {
+	createdAt time.Time
+	id        string
+}
+
+// streamWeather sends the weather data of the location, or of every location when it's nil, as it's published until the
+// client disconnects. A stream resumed with the Last-Event-ID header first replays all the weather data saved after that
+// event, a page at a time. Without a subscriber it's not implemented.
+func (h *Handler) streamWeather(w http.ResponseWriter, r *http.Request, location *types.Location) {
+	u, err := h.getUnits(r)
+	if err != nil {
+		log.Errorf("failed to get units from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := h.getLocation(r)
+	if err != nil {
+		log.Errorf("failed to get time zone from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	kind, err := h.getKind(r)
+	if err != nil {
+		log.Errorf("failed to get kind from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	lastEvent, err := parseStreamEventId(r.Header.Get(LastEventIdHeader))
+	if err != nil {
+		log.Errorf("failed to get last event id from request: %v", err)
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Errorf("failed to stream weather data: response writer doesn't support flushing")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribed before replaying, so nothing saved in between is missed
+	published, unsubscribe, err := h.weatherService.Subscribe(location)
+	if errors.Is(err, weatherservice.ErrStreamingUnsupported) {
+		http.Error(w, http.StatusText(http.StatusNotImplemented), http.StatusNotImplemented)
+		return
+	}
+
+	if err != nil {
+		log.Errorf("failed to subscribe to weather data: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer unsubscribe()
+
+	var replay []*types.WeatherData
+	if lastEvent != nil {
+		replay, err = h.weatherService.WeatherDataSince(location, lastEvent.createdAt, lastEvent.id)
+		if err != nil {
+			log.Errorf("failed to get weather data since last event: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stops nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Replayed weather data may be published again while it's replayed
+	replayed := map[string]bool{}
+	for len(replay) > 0 {
+		for _, weatherData := range replay {
+			replayed[weatherData.Id] = true
+
+			if !kind.Matches(weatherData) {
+				continue
+			}
+
+			err := writeStreamEvent(w, weatherData, u, loc)
+			if err != nil {
+				log.Errorf("failed to write weather data event: %v", err)
+				return
+			}
+		}
+
+		flusher.Flush()
+
+		// Only a full page may be followed by more weather data, which is replayed before any published weather data
+		if len(replay) < weatherservice.MaxReplayedEvents {
+			break
+		}
+
+		last := replay[len(replay)-1]
+		replay, err = h.weatherService.WeatherDataSince(location, last.CreatedAt, last.Id)
+		if err != nil {
+			// The client resumes from the last replayed event once it reconnects
+			log.Errorf("failed to get weather data since last replayed event: %v", err)
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(streamKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return
+			}
+		case weatherData, ok := <-published:
+			// Fell behind, the client resumes with the Last-Event-ID header once it reconnects
+			if !ok {
+				log.Warnf("weather data stream fell behind and was closed")
+				return
+			}
+
+			if replayed[weatherData.Id] || !kind.Matches(weatherData) {
+				continue
+			}
+
+			err := writeStreamEvent(w, weatherData, u, loc)
+			if err != nil {
+				log.Errorf("failed to write weather data event: %v", err)
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+// writeStreamEvent writes weather data as a Server-Sent Event
+func writeStreamEvent(w http.ResponseWriter, weatherData *types.WeatherData, u units.Units, loc *time.Location) error {
+	data, err := json.Marshal(formatWeatherData(weatherData, u, loc))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", formatStreamEventId(weatherData), StreamEventName, data)
+
+	return err
+}
+
+// formatStreamEventId formats the event id of weather data as its created at in Unix microseconds and its id, e.g.
+// "1696402418581587-0b5f..."
+func formatStreamEventId(weatherData *types.WeatherData) string {
+	return strconv.FormatInt(weatherData.CreatedAt.UnixMicro(), 10) + "-" + weatherData.Id
+}
+
+// parseStreamEventId parses an event id formatted by formatStreamEventId, it returns nil when the id is empty
+func parseStreamEventId(eventId string) (*streamEvent, error) {
+	if eventId == "" {
+		return nil, nil
+	}
+
+	createdAt, id, ok := strings.Cut(eventId, "-")
+	if !ok || id == "" {
+		return nil, fmt.Errorf("invalid event id: %s", eventId)
+	}
+
+	micros, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid event id: %s", eventId)
+	}
+
+	return &streamEvent{
+		createdAt: time.UnixMicro(micros).UTC(),
+		id:        id,
+	}, nil
+}
@@ -0,0 +1,275 @@
+package httpapi_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-sample-rest/internal/stream"
+	"go-sample-rest/internal/types"
+	"go-sample-rest/internal/weatherservice"
+	"go-sample-rest/internal/weatherservice/httpapi"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+)
+
+type streamEvent struct {
+	id          string
+	event       string
+	weatherData types.WeatherData
+}
+
+// readStreamEvent reads the next event of a stream, skipping comments
+func readStreamEvent(t *testing.T, reader *bufio.Reader) streamEvent {
+	var event streamEvent
+
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event.id != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event.weatherData)
+			require.NoError(t, err)
+		}
+	}
+}
+
+// newStreamServer serves the stream endpoints of a service subscribed to the subscriber, it's closed once the
+// test's streams are
+func newStreamServer(t *testing.T, repo *MockWeatherDataRepository, subscriber weatherservice.WeatherDataSubscriber) *httptest.Server {
+	service := weatherservice.NewService(&MockWeatherDataClient{}, repo)
+	service.SetSubscriber(subscriber)
+	handler := httpapi.NewHandler(service)
+
+	r := chi.NewRouter()
+	r.Get("/weather/stream", handler.StreamAllWeather)
+	r.Get("/weather/{lat},{long}/stream", handler.StreamWeather)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// closedSubscriber drops every subscriber right away, as if they had fallen behind
+type closedSubscriber struct{}
+
+func (closedSubscriber) Subscribe(location *types.Location) (<-chan *types.WeatherData, func()) {
+	ch := make(chan *types.WeatherData)
+	close(ch)
+
+	return ch, func() {}
+}
+
+// openStream opens a stream and waits for it to subscribe
+func openStream(t *testing.T, server *httptest.Server, broker *stream.Broker[*types.WeatherData], path, lastEventId string) *bufio.Reader {
+	subscribers := broker.Subscribers()
+
+	req, err := http.NewRequest("GET", server.URL+path, nil)
+	require.NoError(t, err)
+
+	if lastEventId != "" {
+		req.Header.Set(httpapi.LastEventIdHeader, lastEventId)
+	}
+
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+	require.Equal(t, subscribers+1, broker.Subscribers())
+
+	return bufio.NewReader(resp.Body)
+}
+
+func TestStreamWeather(t *testing.T) {
+	t.Run("should stream the location's weather data as it's published", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+		server := newStreamServer(t, &MockWeatherDataRepository{}, broker)
+
+		reader := openStream(t, server, broker, "/weather/1.1,2.2/stream?units=imperial", "")
+
+		broker.Publish(&types.WeatherData{Id: "other", Latitude: 3.3, Longitude: 4.4, Temperature: 10, CreatedAt: createdAt})
+		broker.Publish(&types.WeatherData{Id: "abc123", Latitude: 1.1, Longitude: 2.2, Temperature: 10, WindSpeed: 36, CreatedAt: createdAt})
+
+		event := readStreamEvent(t, reader)
+		require.Equal(t, fmt.Sprintf("%d-abc123", createdAt.UnixMicro()), event.id)
+		require.Equal(t, httpapi.StreamEventName, event.event)
+		require.Equal(t, "abc123", event.weatherData.Id)
+		require.Equal(t, 50.0, event.weatherData.Temperature)
+		require.Equal(t, "fahrenheit", event.weatherData.Units.Temperature)
+	})
+
+	t.Run("should stream every location's weather data of the kind", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+		server := newStreamServer(t, &MockWeatherDataRepository{}, broker)
+
+		reader := openStream(t, server, broker, "/weather/stream?kind=observation", "")
+
+		broker.Publish(&types.WeatherData{Id: "provider", Latitude: 1.1, Longitude: 2.2, Source: "openmeteo", CreatedAt: createdAt})
+		broker.Publish(&types.WeatherData{Id: "manual", Latitude: 1.1, Longitude: 2.2, Source: weatherservice.ManualSource, CreatedAt: createdAt})
+		broker.Publish(&types.WeatherData{Id: "sensor", Latitude: 3.3, Longitude: 4.4, Source: weatherservice.SensorSourcePrefix + "s1", CreatedAt: createdAt})
+
+		require.Equal(t, "manual", readStreamEvent(t, reader).weatherData.Id)
+		require.Equal(t, "sensor", readStreamEvent(t, reader).weatherData.Id)
+	})
+
+	t.Run("should replay the weather data saved since the last event", func(t *testing.T) {
+		var requestedLocation *types.Location
+		var requestedSince time.Time
+		var requestedAfterId string
+
+		repo := &MockWeatherDataRepository{
+			getWeatherDataSince: func(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error) {
+				requestedLocation = location
+				requestedSince = since
+				requestedAfterId = afterId
+
+				return []*types.WeatherData{
+					{Id: "missed1", Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt},
+					{Id: "missed2", Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt.Add(time.Second)},
+				}, nil
+			},
+		}
+
+		broker := stream.NewWeatherDataBroker()
+		server := newStreamServer(t, repo, broker)
+
+		reader := openStream(t, server, broker, "/weather/1.1,2.2/stream", fmt.Sprintf("%d-last", createdAt.UnixMicro()))
+
+		require.Equal(t, &types.Location{Latitude: 1.1, Longitude: 2.2}, requestedLocation)
+		require.True(t, createdAt.Equal(requestedSince))
+		require.Equal(t, "last", requestedAfterId)
+
+		// Published again while it was replayed
+		broker.Publish(&types.WeatherData{Id: "missed2", Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt.Add(time.Second)})
+		broker.Publish(&types.WeatherData{Id: "new", Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt.Add(2 * time.Second)})
+
+		require.Equal(t, "missed1", readStreamEvent(t, reader).weatherData.Id)
+		require.Equal(t, "missed2", readStreamEvent(t, reader).weatherData.Id)
+		require.Equal(t, "new", readStreamEvent(t, reader).weatherData.Id)
+	})
+
+	t.Run("should replay every page of weather data saved since the last event", func(t *testing.T) {
+		// The first page is full, the second one is read from its last weather data
+		pages := [][]*types.WeatherData{{}, {{Id: "next", Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt.Add(time.Hour)}}}
+		for i := 0; i < weatherservice.MaxReplayedEvents; i++ {
+			pages[0] = append(pages[0], &types.WeatherData{Id: fmt.Sprintf("missed%04d", i), Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt.Add(time.Duration(i) * time.Millisecond)})
+		}
+
+		var requestedAfterIds []string
+
+		repo := &MockWeatherDataRepository{
+			getWeatherDataSince: func(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error) {
+				requestedAfterIds = append(requestedAfterIds, afterId)
+				page := pages[0]
+				pages = pages[1:]
+
+				return page, nil
+			},
+		}
+
+		broker := stream.NewWeatherDataBroker()
+		server := newStreamServer(t, repo, broker)
+
+		reader := openStream(t, server, broker, "/weather/stream", fmt.Sprintf("%d-last", createdAt.UnixMicro()))
+
+		broker.Publish(&types.WeatherData{Id: "new", Latitude: 1.1, Longitude: 2.2, CreatedAt: createdAt.Add(2 * time.Hour)})
+
+		for i := 0; i < weatherservice.MaxReplayedEvents; i++ {
+			require.Equal(t, fmt.Sprintf("missed%04d", i), readStreamEvent(t, reader).weatherData.Id)
+		}
+
+		require.Equal(t, "next", readStreamEvent(t, reader).weatherData.Id)
+		require.Equal(t, "new", readStreamEvent(t, reader).weatherData.Id)
+		require.Equal(t, []string{"last", fmt.Sprintf("missed%04d", weatherservice.MaxReplayedEvents-1)}, requestedAfterIds)
+	})
+
+	t.Run("should end the stream when it falls behind", func(t *testing.T) {
+		server := newStreamServer(t, &MockWeatherDataRepository{}, closedSubscriber{})
+
+		resp, err := server.Client().Get(server.URL + "/weather/stream")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Empty(t, body)
+	})
+
+	testCases := []struct {
+		name                      string
+		path                      string
+		lastEventId               string
+		mockWeatherDataRepository *MockWeatherDataRepository
+		expectedStatusCode        int
+	}{
+		{
+			name:                      "should err when lat is invalid",
+			path:                      "/weather/abc,2.2/stream",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+		},
+		{
+			name:                      "should err when units are invalid",
+			path:                      "/weather/stream?units=kelvin",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+		},
+		{
+			name:                      "should err when the last event id is invalid",
+			path:                      "/weather/1.1,2.2/stream",
+			lastEventId:               "abc",
+			mockWeatherDataRepository: &MockWeatherDataRepository{},
+			expectedStatusCode:        http.StatusBadRequest,
+		},
+		{
+			name:        "should err when repository returns an error on replay",
+			path:        "/weather/1.1,2.2/stream",
+			lastEventId: "1696402418581587-abc123",
+			mockWeatherDataRepository: &MockWeatherDataRepository{
+				getWeatherDataSince: func(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error) {
+					return nil, fmt.Errorf("error")
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			broker := stream.NewWeatherDataBroker()
+			server := newStreamServer(t, tc.mockWeatherDataRepository, broker)
+
+			req, err := http.NewRequest("GET", server.URL+tc.path, nil)
+			require.NoError(t, err)
+			req.Header.Set(httpapi.LastEventIdHeader, tc.lastEventId)
+
+			resp, err := server.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			require.Equal(t, tc.expectedStatusCode, resp.StatusCode)
+			require.Equal(t, 0, broker.Subscribers())
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package weatherservice
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+
+	"go-sample-rest/internal/types"
+)
+
+// Sources of observations, a sensor's readings are saved as SensorSourcePrefix followed by its id,
+// so they can't be mistaken for a provider's
+const (
+	ManualSource       = "manual"
+	SensorSourcePrefix = "sensor:"
+)
+
+// Kind of weather data the history can be filtered by
+type Kind string
+
+const (
+	KindAny         Kind = ""
+	KindObservation Kind = "observation"
+	KindProvider    Kind = "provider"
+)
+
+// Plausible temperatures in celsius, anything outside is a faulty sensor
+const (
+	minTemperature = -100
+	maxTemperature = 70
+)
+
+var sensorIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// SubmitObservation saves a reading of an on-site sensor at the location, alongside the providers' weather data.
+// Implausible readings are rejected with an error wrapping ErrInvalidInput.
+func (s *Service) SubmitObservation(location types.Location, observation types.Observation) (*types.WeatherData, error) {
+	err := validateObservation(&observation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	source := ManualSource
+	if observation.SensorId != "" {
+		source = SensorSourcePrefix + observation.SensorId
+	}
+
+	savedWeatherData, err := s.weatherDataRepository.SaveWeatherData(
+		location.Latitude,
+		location.Longitude,
+		*observation.Temperature,
+		*observation.WindDirection,
+		*observation.WindSpeed,
+		source,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save observation to repository: %w", err)
+	}
+
+	savedWeatherData.CreatedAt = savedWeatherData.CreatedAt.UTC()
+
+	return savedWeatherData, nil
+}
+
+func validateObservation(observation *types.Observation) error {
+	if observation.Temperature == nil || observation.WindDirection == nil || observation.WindSpeed == nil {
+		return fmt.Errorf("temperature, wind_direction and wind_speed must be provided")
+	}
+
+	for _, v := range []float64{*observation.Temperature, *observation.WindDirection, *observation.WindSpeed} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("readings must be finite numbers")
+		}
+	}
+
+	if *observation.Temperature < minTemperature || *observation.Temperature > maxTemperature {
+		return fmt.Errorf("temperature must be between %d and %d, got %v", minTemperature, maxTemperature, *observation.Temperature)
+	}
+
+	if *observation.WindDirection < 0 || *observation.WindDirection > 360 {
+		return fmt.Errorf("wind_direction must be between 0 and 360, got %v", *observation.WindDirection)
+	}
+
+	if *observation.WindSpeed < 0 {
+		return fmt.Errorf("wind_speed must not be negative, got %v", *observation.WindSpeed)
+	}
+
+	if observation.SensorId != "" && !sensorIdPattern.MatchString(observation.SensorId) {
+		return fmt.Errorf("sensor_id must be 1 to 64 letters, digits, dots, underscores or dashes, got %q", observation.SensorId)
+	}
+
+	return nil
+}
+
+// isObservation tells observations apart from the providers' weather data by their source
+func isObservation(weatherData *types.WeatherData) bool {
+	return IsObservationSource(weatherData.Source)
+}
+
+// IsObservationSource tells whether the source is reserved for observations
+func IsObservationSource(source string) bool {
+	return source == ManualSource || strings.HasPrefix(source, SensorSourcePrefix)
+}
+
+// ParseKind parses a kind of weather data, an unsupported kind is an error wrapping ErrInvalidInput
+func ParseKind(kind string) (Kind, error) {
+	switch Kind(kind) {
+	case KindAny, KindObservation, KindProvider:
+		return Kind(kind), nil
+	default:
+		return "", fmt.Errorf("%w: unsupported kind: %s", ErrInvalidInput, kind)
+	}
+}
+
+// Matches returns whether weather data is of the kind, every kind matches KindAny
+func (k Kind) Matches(weatherData *types.WeatherData) bool {
+	switch k {
+	case KindObservation:
+		return isObservation(weatherData)
+	case KindProvider:
+		return !isObservation(weatherData)
+	default:
+		return true
+	}
+}
@@ -1,31 +1,57 @@
 package weatherservice
 
 import (
+	"errors"
 	"fmt"
-	"net/http"
 	"strconv"
+	"time"
 
+	"go-sample-rest/internal/provider"
 	"go-sample-rest/internal/types"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/render"
-
 	log "github.com/sirupsen/logrus"
 )
 
+// WeatherDataClient fetches weather data from a named provider, an empty provider name
+// lets the client pick the provider for the location
 type WeatherDataClient interface {
-	GetLatestWeatherData(lat, long float64) (*types.WeatherData, error)
+	GetLatestWeatherData(provider string, lat, long float64) (*types.WeatherData, error)
+	GetLatestWeatherDataBatch(provider string, locations []types.Location) ([]provider.BatchResult, error)
 }
 
 type WeatherDataRepository interface {
 	GetLatestWeatherData(lat, long float64) (*types.WeatherData, error)
+	GetAllLatestWeatherData() ([]*types.WeatherData, error)
+	GetLatestWeatherDataBatch(locations []types.Location) ([]*types.WeatherData, error)
 	GetWeatherHistory(lat, long float64) ([]*types.WeatherData, error)
-	SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64) (*types.WeatherData, error)
+	StreamWeatherHistory(lat, long float64, fn func(weatherData *types.WeatherData) error) error
+	GetWeatherDataSince(location *types.Location, since time.Time, afterId string, limit int) ([]*types.WeatherData, error)
+	SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64, source string) (*types.WeatherData, error)
+	SaveWeatherDataBatch(weatherDataList []*types.WeatherData) ([]*types.WeatherData, error)
 }
 
+var (
+	// ErrWeatherDataNotFound is returned when a location has no weather data
+	ErrWeatherDataNotFound = errors.New("weather data not found")
+	// ErrInvalidInput is wrapped by the errors of inputs that can't be served, e.g. too many locations or an
+	// implausible observation
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrUnknownProvider is wrapped by the errors of updates from a provider that isn't registered
+	ErrUnknownProvider = provider.ErrUnknownProvider
+)
+
+// MaxBatchLocations is the most locations a batch request can look up
+const MaxBatchLocations = 500
+
+// MaxUpdateBatchLocations is the most locations a batch request can update, as every location
+// goes into the URL of a single upstream request
+const MaxUpdateBatchLocations = 100
+
+// Service holds the weather data business logic, independent of the transport it's served over
 type Service struct {
 	weatherDataClient     WeatherDataClient
 	weatherDataRepository WeatherDataRepository
+	subscriber            WeatherDataSubscriber
 }
 
 func NewService(weatherDataClient WeatherDataClient, weatherDataRepository WeatherDataRepository) *Service {
@@ -35,102 +61,207 @@ func NewService(weatherDataClient WeatherDataClient, weatherDataRepository Weath
 	}
 }
 
-func (s *Service) GetLatestWeather(w http.ResponseWriter, r *http.Request) {
-	lat, long, err := s.getLatLong(r)
-	if err != nil {
-		log.Errorf("failed to get lat long from request: %v", err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
+// HistoryQuery selects the weather history of a location
+type HistoryQuery struct {
+	Location types.Location
+	// Kind limits the history to observations or to the providers' weather data, every kind when empty
+	Kind Kind
+}
 
-	weatherData, err := s.weatherDataRepository.GetLatestWeatherData(lat, long)
+// LatestWeather returns the location's most recently saved weather data of a provider, ErrWeatherDataNotFound when it
+// has none. Observations are kept apart in the history, so they never replace it.
+func (s *Service) LatestWeather(location types.Location) (*types.WeatherData, error) {
+	weatherData, err := s.weatherDataRepository.GetLatestWeatherData(location.Latitude, location.Longitude)
 	if err != nil {
-		log.Errorf("failed to get weather data from repository: %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to get weather data from repository: %w", err)
 	}
 
 	if weatherData == nil {
-		log.Infof("weather data not found: lat(%f), long(%f)", lat, long)
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-		return
+		return nil, ErrWeatherDataNotFound
+	}
+
+	return weatherData, nil
+}
+
+// AllLatestWeather returns the latest weather data of a provider of every tracked location
+func (s *Service) AllLatestWeather() ([]*types.WeatherData, error) {
+	weatherDataList, err := s.weatherDataRepository.GetAllLatestWeatherData()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest weather data of every location from repository: %w", err)
 	}
 
-	render.JSON(w, r, weatherData)
+	return weatherDataList, nil
 }
 
-func (s *Service) GetWeatherHistory(w http.ResponseWriter, r *http.Request) {
-	lat, long, err := s.getLatLong(r)
+// LatestWeatherBatch returns the latest weather data of up to MaxBatchLocations locations with a single repository
+// query. Results are keyed by "lat,long", locations without weather data have a nil result.
+func (s *Service) LatestWeatherBatch(locations []types.Location) (map[string]*types.WeatherData, error) {
+	locations, err := uniqueLocations(locations, MaxBatchLocations)
 	if err != nil {
-		log.Errorf("failed to get lat long from request: %v", err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
+		return nil, err
 	}
 
-	weatherHistory, err := s.weatherDataRepository.GetWeatherHistory(lat, long)
+	weatherDataList, err := s.weatherDataRepository.GetLatestWeatherDataBatch(locations)
 	if err != nil {
-		log.Errorf("failed to get weather data history from repository: %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to get latest weather data batch from repository: %w", err)
+	}
+
+	results := make(map[string]*types.WeatherData, len(locations))
+
+	for _, location := range locations {
+		results[LocationKey(location)] = nil
 	}
 
-	render.JSON(w, r, weatherHistory)
+	for _, weatherData := range weatherDataList {
+		results[LocationKey(types.Location{Latitude: weatherData.Latitude, Longitude: weatherData.Longitude})] = weatherData
+	}
+
+	return results, nil
 }
 
-func (s *Service) UpdateWeather(w http.ResponseWriter, r *http.Request) {
-	lat, long, err := s.getLatLong(r)
+// WeatherHistory returns the location's weather history of the query's kind newest first
+func (s *Service) WeatherHistory(query HistoryQuery) ([]*types.WeatherData, error) {
+	weatherHistory, err := s.weatherDataRepository.GetWeatherHistory(query.Location.Latitude, query.Location.Longitude)
 	if err != nil {
-		log.Errorf("failed to get lat long from request: %v", err)
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
+		return nil, fmt.Errorf("failed to get weather data history from repository: %w", err)
 	}
 
-	weatherData, err := s.weatherDataClient.GetLatestWeatherData(lat, long)
+	filteredWeatherHistory := make([]*types.WeatherData, 0, len(weatherHistory))
+	for _, weatherData := range weatherHistory {
+		if query.Kind.Matches(weatherData) {
+			filteredWeatherHistory = append(filteredWeatherHistory, weatherData)
+		}
+	}
+
+	return filteredWeatherHistory, nil
+}
+
+// StreamHistory calls fn with the location's weather history of the query's kind newest first as it's read from the
+// repository, so histories of any size are never held in memory. An error of fn stops the stream and is returned.
+func (s *Service) StreamHistory(query HistoryQuery, fn func(weatherData *types.WeatherData) error) error {
+	return s.weatherDataRepository.StreamWeatherHistory(query.Location.Latitude, query.Location.Longitude, func(weatherData *types.WeatherData) error {
+		if !query.Kind.Matches(weatherData) {
+			return nil
+		}
+
+		return fn(weatherData)
+	})
+}
+
+// UpdateLocation fetches the location's latest weather data from the named provider and saves it. It returns
+// ErrWeatherDataNotFound when the provider has none and wraps ErrUnknownProvider for an unknown provider.
+func (s *Service) UpdateLocation(providerName string, location types.Location) (*types.WeatherData, error) {
+	weatherData, err := s.weatherDataClient.GetLatestWeatherData(providerName, location.Latitude, location.Longitude)
 	if err != nil {
-		log.Errorf("failed to get weather data from weather data client: %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to get weather data from weather data client: %w", err)
 	}
 
 	if weatherData == nil {
-		log.Infof("weather data not found: lat(%f), long(%f)", lat, long)
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
-		return
+		return nil, ErrWeatherDataNotFound
 	}
 
 	savedWeatherData, err := s.weatherDataRepository.SaveWeatherData(
-		lat,
-		long,
+		location.Latitude,
+		location.Longitude,
 		weatherData.Temperature,
 		weatherData.WindDirection,
 		weatherData.WindSpeed,
+		weatherData.Source,
 	)
 	if err != nil {
-		log.Errorf("failed to save weather data to repository: %v", err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("failed to save weather data to repository: %w", err)
 	}
 
-	render.JSON(w, r, savedWeatherData)
-}
+	savedWeatherData.CreatedAt = savedWeatherData.CreatedAt.UTC()
 
-func (s *Service) getLatLong(r *http.Request) (float64, float64, error) {
-	lat := chi.URLParam(r, "lat")
-	long := chi.URLParam(r, "long")
+	return savedWeatherData, nil
+}
 
-	if lat == "" || long == "" {
-		return 0, 0, fmt.Errorf("latitude and longitude must be provided")
+// UpdateLocations fetches the latest weather data of up to MaxUpdateBatchLocations locations from the named provider,
+// with a single upstream request where the provider supports it, and saves it in a single transaction. Results are
+// keyed by "lat,long", locations that couldn't be updated have an error instead.
+func (s *Service) UpdateLocations(providerName string, locations []types.Location) (map[string]types.UpdateWeatherBatchResult, error) {
+	locations, err := uniqueLocations(locations, MaxUpdateBatchLocations)
+	if err != nil {
+		return nil, err
 	}
 
-	latFloat, err := strconv.ParseFloat(lat, 64)
+	results, err := s.weatherDataClient.GetLatestWeatherDataBatch(providerName, locations)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to parse latitude: %w", err)
+		return nil, fmt.Errorf("failed to get weather data batch from weather data client: %w", err)
 	}
 
-	longFloat, err := strconv.ParseFloat(long, 64)
-	if err != nil {
-		return 0, 0, fmt.Errorf("failed to parse longitude: %w", err)
+	response := make(map[string]types.UpdateWeatherBatchResult, len(locations))
+
+	var weatherDataList []*types.WeatherData
+	var savedLocations []types.Location
+
+	for i, result := range results {
+		location := locations[i]
+		key := LocationKey(location)
+
+		if result.Err != nil {
+			log.Errorf("failed to get weather data from weather data client: lat(%f), long(%f): %v", location.Latitude, location.Longitude, result.Err)
+			response[key] = types.UpdateWeatherBatchResult{Error: "failed to get weather data"}
+			continue
+		}
+
+		if result.WeatherData == nil {
+			log.Infof("weather data not found: lat(%f), long(%f)", location.Latitude, location.Longitude)
+			response[key] = types.UpdateWeatherBatchResult{Error: "weather data not found"}
+			continue
+		}
+
+		// Saved under the requested location, providers may snap it to their grid
+		weatherData := *result.WeatherData
+		weatherData.Latitude = location.Latitude
+		weatherData.Longitude = location.Longitude
+
+		weatherDataList = append(weatherDataList, &weatherData)
+		savedLocations = append(savedLocations, location)
+	}
+
+	if len(weatherDataList) > 0 {
+		savedWeatherDataList, err := s.weatherDataRepository.SaveWeatherDataBatch(weatherDataList)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save weather data batch to repository: %w", err)
+		}
+
+		for i, savedWeatherData := range savedWeatherDataList {
+			savedWeatherData.CreatedAt = savedWeatherData.CreatedAt.UTC()
+			response[LocationKey(savedLocations[i])] = types.UpdateWeatherBatchResult{WeatherData: savedWeatherData}
+		}
 	}
 
-	return latFloat, longFloat, nil
+	return response, nil
+}
+
+// uniqueLocations drops repeated locations, there must be between one and maxLocations of them
+func uniqueLocations(locations []types.Location, maxLocations int) ([]types.Location, error) {
+	if len(locations) == 0 {
+		return nil, fmt.Errorf("%w: at least one location must be provided", ErrInvalidInput)
+	}
+
+	if len(locations) > maxLocations {
+		return nil, fmt.Errorf("%w: at most %d locations can be provided, got %d", ErrInvalidInput, maxLocations, len(locations))
+	}
+
+	seen := make(map[types.Location]bool, len(locations))
+	unique := make([]types.Location, 0, len(locations))
+
+	for _, location := range locations {
+		if seen[location] {
+			continue
+		}
+
+		seen[location] = true
+		unique = append(unique, location)
+	}
+
+	return unique, nil
+}
+
+// LocationKey formats a location the way it's sent in requests, e.g. "1.1,2.2"
+func LocationKey(location types.Location) string {
+	return strconv.FormatFloat(location.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(location.Longitude, 'f', -1, 64)
 }
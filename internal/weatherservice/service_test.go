@@ -1,365 +1,327 @@
 package weatherservice_test
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	"net/http"
-	"net/http/httptest"
-	"strings"
 	"testing"
+	"time"
 
+	"go-sample-rest/internal/provider"
+	"go-sample-rest/internal/repository/memory"
+	"go-sample-rest/internal/stream"
 	"go-sample-rest/internal/types"
 	"go-sample-rest/internal/weatherservice"
 
-	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/require"
 )
 
 type MockWeatherDataClient struct {
-	getLatestWeatherData func(lat, long float64) (*types.WeatherData, error)
+	weatherData *types.WeatherData
+	err         error
 }
 
-func (m *MockWeatherDataClient) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
-	if m != nil && m.getLatestWeatherData != nil {
-		return m.getLatestWeatherData(lat, long)
+func (m *MockWeatherDataClient) GetLatestWeatherData(providerName string, lat, long float64) (*types.WeatherData, error) {
+	if providerName == "unknown" {
+		return nil, fmt.Errorf("%w: %s", provider.ErrUnknownProvider, providerName)
 	}
 
-	return &types.WeatherData{
-		Latitude:      lat,
-		Longitude:     long,
-		Temperature:   3.3,
-		WindSpeed:     4.4,
-		WindDirection: 5.5,
-		CreatedAt:     "2023-10-04T06:53:38.581587Z",
-	}, nil
+	return m.weatherData, m.err
 }
 
-type MockWeatherDataRepository struct {
-	getLatestWeatherData func(lat, long float64) (*types.WeatherData, error)
-	getWeatherHistory    func(lat, long float64) ([]*types.WeatherData, error)
-	saveWeatherData      func(lat, long, temperature, windDirection, windSpeed float64) (*types.WeatherData, error)
-}
+func (m *MockWeatherDataClient) GetLatestWeatherDataBatch(providerName string, locations []types.Location) ([]provider.BatchResult, error) {
+	if providerName == "unknown" {
+		return nil, fmt.Errorf("%w: %s", provider.ErrUnknownProvider, providerName)
+	}
 
-func (m *MockWeatherDataRepository) GetLatestWeatherData(lat, long float64) (*types.WeatherData, error) {
-	if m != nil && m.getLatestWeatherData != nil {
-		return m.getLatestWeatherData(lat, long)
+	results := make([]provider.BatchResult, 0, len(locations))
+	for _, location := range locations {
+		// Providers snap locations to their grid
+		results = append(results, provider.BatchResult{WeatherData: &types.WeatherData{
+			Latitude:      location.Latitude + 0.01,
+			Longitude:     location.Longitude + 0.01,
+			Temperature:   location.Latitude,
+			WindDirection: 90,
+			WindSpeed:     10,
+			Source:        "openmeteo",
+		}})
 	}
 
-	return &types.WeatherData{
-		Latitude:      lat,
-		Longitude:     long,
-		Temperature:   3.3,
-		WindSpeed:     4.4,
-		WindDirection: 5.5,
-		CreatedAt:     "2023-10-04T06:53:38.581587Z",
-	}, nil
+	return results, nil
 }
 
-func (m *MockWeatherDataRepository) GetWeatherHistory(lat, long float64) ([]*types.WeatherData, error) {
-	if m != nil && m.getWeatherHistory != nil {
-		return m.getWeatherHistory(lat, long)
+var location = types.Location{Latitude: 1.1, Longitude: 2.2}
+
+// newRepository returns a repository with two provider entries and an observation at location, oldest first
+func newRepository(t *testing.T) *memory.Repository {
+	repo := memory.NewRepository()
+
+	for _, source := range []string{"openmeteo", "metno", weatherservice.ManualSource} {
+		_, err := repo.SaveWeatherData(location.Latitude, location.Longitude, 10, 90, 36, source)
+		require.NoError(t, err)
 	}
 
-	return []*types.WeatherData{
-		{
-			Latitude:      lat,
-			Longitude:     long,
-			Temperature:   3.3,
-			WindSpeed:     4.4,
-			WindDirection: 5.5,
-			CreatedAt:     "2023-10-04T06:53:38.581587Z",
-		},
-	}, nil
+	return repo
 }
 
-func (m *MockWeatherDataRepository) SaveWeatherData(lat, long, temperature, windDirection, windSpeed float64) (*types.WeatherData, error) {
-	if m != nil && m.saveWeatherData != nil {
-		return m.saveWeatherData(lat, long, temperature, windDirection, windSpeed)
+func sources(weatherDataList []*types.WeatherData) []string {
+	var sources []string
+	for _, weatherData := range weatherDataList {
+		sources = append(sources, weatherData.Source)
 	}
 
-	return &types.WeatherData{
-		Latitude:      lat,
-		Longitude:     long,
-		Temperature:   3.3,
-		WindSpeed:     4.4,
-		WindDirection: 5.5,
-		CreatedAt:     "2023-10-04T06:53:38.581587Z",
-	}, nil
+	return sources
+}
+
+func TestLatestWeather(t *testing.T) {
+	service := weatherservice.NewService(&MockWeatherDataClient{}, newRepository(t))
+
+	// The observation saved after it doesn't replace the providers' latest weather data
+	weatherData, err := service.LatestWeather(location)
+	require.NoError(t, err)
+	require.Equal(t, "metno", weatherData.Source)
+
+	_, err = service.LatestWeather(types.Location{Latitude: 3.3, Longitude: 4.4})
+	require.ErrorIs(t, err, weatherservice.ErrWeatherDataNotFound)
 }
 
-func TestGetLatestWeatherData(t *testing.T) {
-	testCases := []struct {
-		name                      string
-		lat                       string
-		long                      string
-		mockWeatherDataRepository *MockWeatherDataRepository
-		expectedStatusCode        int
-		expectedBody              string
+func TestLatestWeatherBatch(t *testing.T) {
+	service := weatherservice.NewService(&MockWeatherDataClient{}, newRepository(t))
+
+	t.Run("should return the latest weather data of every unique location", func(t *testing.T) {
+		results, err := service.LatestWeatherBatch([]types.Location{location, location, {Latitude: 3.3, Longitude: 4.4}})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, "metno", results["1.1,2.2"].Source)
+		require.Contains(t, results, "3.3,4.4")
+		require.Nil(t, results["3.3,4.4"])
+	})
+
+	tests := []struct {
+		name      string
+		locations []types.Location
 	}{
 		{
-			name:                      "should err when no lat and long provided",
-			lat:                       "",
-			long:                      "",
-			mockWeatherDataRepository: &MockWeatherDataRepository{},
-			expectedStatusCode:        http.StatusBadRequest,
-			expectedBody:              http.StatusText(http.StatusBadRequest),
-		},
-		{
-			name: "should return internal error when repo returns an error trying to get latest weather data",
-			lat:  "1.1",
-			long: "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{
-				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
-					return nil, fmt.Errorf("error")
-				},
-			},
-			expectedStatusCode: http.StatusInternalServerError,
-			expectedBody:       http.StatusText(http.StatusInternalServerError),
+			name: "should reject no locations",
 		},
 		{
-			name: "should return not found when repo did not return an error but weatherData is nil",
-			lat:  "1.1",
-			long: "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{
-				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
-					return nil, nil
-				},
-			},
-			expectedStatusCode: http.StatusNotFound,
-			expectedBody:       http.StatusText(http.StatusNotFound),
-		},
-		{
-			name: "should return weather data as json when repo returns weather data",
-			lat:  "1.1",
-			long: "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{
-				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
-					return &types.WeatherData{
-						Id:            "abc123",
-						Latitude:      lat,
-						Longitude:     long,
-						Temperature:   3.3,
-						WindSpeed:     4.4,
-						WindDirection: 5.5,
-						CreatedAt:     "2023-10-04T06:53:38.581587Z",
-					}, nil
-				},
-			},
-			expectedStatusCode: http.StatusOK,
-			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"created_at":"2023-10-04T06:53:38.581587Z"}`,
+			name:      "should reject too many locations",
+			locations: make([]types.Location, weatherservice.MaxBatchLocations+1),
 		},
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			service := weatherservice.NewService(&MockWeatherDataClient{}, tc.mockWeatherDataRepository)
-			r := httptest.NewRequest("GET", fmt.Sprintf("/%s,%s/latest", tc.lat, tc.long), nil)
-			w := httptest.NewRecorder()
-
-			rctx := chi.NewRouteContext()
-			rctx.URLParams.Add("lat", tc.lat)
-			rctx.URLParams.Add("long", tc.long)
-
-			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
-
-			service.GetLatestWeather(w, r)
-
-			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
-			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.LatestWeatherBatch(tt.locations)
+			require.ErrorIs(t, err, weatherservice.ErrInvalidInput)
 		})
 	}
 }
 
-func TestGetWeatherHistory(t *testing.T) {
-	testCases := []struct {
-		name                      string
-		lat                       string
-		long                      string
-		mockWeatherDataRepository *MockWeatherDataRepository
-		expectedStatusCode        int
-		expectedBody              string
+func TestWeatherHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		kind    weatherservice.Kind
+		sources []string
 	}{
 		{
-			name:                      "should err when no lat and long provided",
-			lat:                       "",
-			long:                      "",
-			mockWeatherDataRepository: &MockWeatherDataRepository{},
-			expectedStatusCode:        http.StatusBadRequest,
-			expectedBody:              http.StatusText(http.StatusBadRequest),
+			name:    "should return every kind newest first",
+			kind:    weatherservice.KindAny,
+			sources: []string{weatherservice.ManualSource, "metno", "openmeteo"},
 		},
 		{
-			name: "should return internal error when repo returns an error trying to get weather data history",
-			lat:  "1.1",
-			long: "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{
-				getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) {
-					return nil, fmt.Errorf("error")
-				},
-			},
-			expectedStatusCode: http.StatusInternalServerError,
-			expectedBody:       http.StatusText(http.StatusInternalServerError),
+			name:    "should only return observations",
+			kind:    weatherservice.KindObservation,
+			sources: []string{weatherservice.ManualSource},
 		},
 		{
-			name: "should return weather data history as json when repo returns weather data history",
-			lat:  "1.1",
-			long: "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{
-				getWeatherHistory: func(lat, long float64) ([]*types.WeatherData, error) {
-					return []*types.WeatherData{
-						{
-							Id:            "abc123",
-							Latitude:      lat,
-							Longitude:     long,
-							Temperature:   3.3,
-							WindSpeed:     4.4,
-							WindDirection: 5.5,
-							CreatedAt:     "2023-10-04T06:53:38.581587Z",
-						},
-					}, nil
-				},
-			},
-			expectedStatusCode: http.StatusOK,
-			expectedBody:       `[{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":5.5,"wind_speed":4.4,"created_at":"2023-10-04T06:53:38.581587Z"}]`,
+			name:    "should only return the providers' weather data",
+			kind:    weatherservice.KindProvider,
+			sources: []string{"metno", "openmeteo"},
 		},
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			service := weatherservice.NewService(&MockWeatherDataClient{}, tc.mockWeatherDataRepository)
-			r := httptest.NewRequest("GET", fmt.Sprintf("/%s,%s/history", tc.lat, tc.long), nil)
-			w := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := weatherservice.NewService(&MockWeatherDataClient{}, newRepository(t))
+			query := weatherservice.HistoryQuery{Location: location, Kind: tt.kind}
 
-			rctx := chi.NewRouteContext()
-			rctx.URLParams.Add("lat", tc.lat)
-			rctx.URLParams.Add("long", tc.long)
+			weatherHistory, err := service.WeatherHistory(query)
+			require.NoError(t, err)
+			require.Equal(t, tt.sources, sources(weatherHistory))
 
-			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			var streamed []*types.WeatherData
+			err = service.StreamHistory(query, func(weatherData *types.WeatherData) error {
+				streamed = append(streamed, weatherData)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, tt.sources, sources(streamed))
+		})
+	}
 
-			service.GetWeatherHistory(w, r)
+	t.Run("should stop streaming at the first error", func(t *testing.T) {
+		service := weatherservice.NewService(&MockWeatherDataClient{}, newRepository(t))
+		errStop := errors.New("stop")
 
-			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
-			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+		calls := 0
+		err := service.StreamHistory(weatherservice.HistoryQuery{Location: location}, func(weatherData *types.WeatherData) error {
+			calls++
+			return errStop
 		})
+		require.ErrorIs(t, err, errStop)
+		require.Equal(t, 1, calls)
+	})
+}
+
+func TestParseKind(t *testing.T) {
+	for _, kind := range []string{"", "observation", "provider"} {
+		parsed, err := weatherservice.ParseKind(kind)
+		require.NoError(t, err)
+		require.Equal(t, weatherservice.Kind(kind), parsed)
 	}
+
+	_, err := weatherservice.ParseKind("forecast")
+	require.ErrorIs(t, err, weatherservice.ErrInvalidInput)
 }
 
-func TestUpdateWeather(t *testing.T) {
-	testCases := []struct {
-		name                      string
-		lat                       string
-		long                      string
-		mockWeatherDataRepository *MockWeatherDataRepository
-		mockWeatherDataClient     *MockWeatherDataClient
-		expectedStatusCode        int
-		expectedBody              string
+func TestUpdateLocation(t *testing.T) {
+	t.Run("should save the provider's weather data under the location", func(t *testing.T) {
+		repo := memory.NewRepository()
+		service := weatherservice.NewService(&MockWeatherDataClient{weatherData: &types.WeatherData{Temperature: 20, WindDirection: 180, WindSpeed: 5, Source: "metno"}}, repo)
+
+		weatherData, err := service.UpdateLocation("metno", location)
+		require.NoError(t, err)
+		require.Equal(t, location.Latitude, weatherData.Latitude)
+		require.Equal(t, location.Longitude, weatherData.Longitude)
+		require.Equal(t, "metno", weatherData.Source)
+		require.Equal(t, time.UTC, weatherData.CreatedAt.Location())
+
+		latest, err := repo.GetLatestWeatherData(location.Latitude, location.Longitude)
+		require.NoError(t, err)
+		require.Equal(t, weatherData.Id, latest.Id)
+	})
+
+	tests := []struct {
+		name     string
+		provider string
+		client   *MockWeatherDataClient
+		err      error
 	}{
 		{
-			name:                      "should err when no lat and long provided",
-			lat:                       "",
-			long:                      "",
-			mockWeatherDataRepository: &MockWeatherDataRepository{},
-			mockWeatherDataClient:     &MockWeatherDataClient{},
-			expectedStatusCode:        http.StatusBadRequest,
-			expectedBody:              http.StatusText(http.StatusBadRequest),
+			name:     "should wrap an unknown provider",
+			provider: "unknown",
+			client:   &MockWeatherDataClient{},
+			err:      weatherservice.ErrUnknownProvider,
 		},
 		{
-			name:                      "should return internal error when data client returns an error trying to get latest weather data",
-			lat:                       "1.1",
-			long:                      "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{},
-			mockWeatherDataClient: &MockWeatherDataClient{
-				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
-					return nil, fmt.Errorf("error")
-				},
-			},
-			expectedStatusCode: http.StatusInternalServerError,
-			expectedBody:       http.StatusText(http.StatusInternalServerError),
+			name:   "should return not found when the provider has no weather data",
+			client: &MockWeatherDataClient{},
+			err:    weatherservice.ErrWeatherDataNotFound,
 		},
 		{
-			name:                      "should return status not found when data client did not return an error but weatherData is nil",
-			lat:                       "1.1",
-			long:                      "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{},
-			mockWeatherDataClient: &MockWeatherDataClient{
-				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
-					return nil, nil
-				},
-			},
-			expectedStatusCode: http.StatusNotFound,
-			expectedBody:       http.StatusText(http.StatusNotFound),
-		},
-		{
-			name: "should return internal error when repo returns an error trying to save weather data",
-			lat:  "1.1",
-			long: "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{
-				saveWeatherData: func(lat, long, temperature, windDirection, windSpeed float64) (*types.WeatherData, error) {
-					return nil, fmt.Errorf("error")
-				},
-			},
-			mockWeatherDataClient: &MockWeatherDataClient{
-				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
-					return &types.WeatherData{
-						Latitude:      lat,
-						Longitude:     long,
-						Temperature:   3.3,
-						WindSpeed:     4.4,
-						WindDirection: 5.5,
-					}, nil
-				},
-			},
-			expectedStatusCode: http.StatusInternalServerError,
-			expectedBody:       http.StatusText(http.StatusInternalServerError),
-		},
-		{
-			name: "should return OK with weather data as json when repo returns weather data",
-			lat:  "1.1",
-			long: "2.2",
-			mockWeatherDataRepository: &MockWeatherDataRepository{
-				saveWeatherData: func(lat, long, temperature, windDirection, windSpeed float64) (*types.WeatherData, error) {
-					return &types.WeatherData{
-						Id:            "abc123",
-						Latitude:      lat,
-						Longitude:     long,
-						Temperature:   temperature,
-						WindSpeed:     windDirection,
-						WindDirection: windSpeed,
-						CreatedAt:     "2023-10-04T06:53:38.581587Z",
-					}, nil
-				},
-			},
-			mockWeatherDataClient: &MockWeatherDataClient{
-				getLatestWeatherData: func(lat, long float64) (*types.WeatherData, error) {
-					return &types.WeatherData{
-						Latitude:      lat,
-						Longitude:     long,
-						Temperature:   3.3,
-						WindSpeed:     4.4,
-						WindDirection: 5.5,
-					}, nil
-				},
-			},
-			expectedStatusCode: http.StatusOK,
-			expectedBody:       `{"id":"abc123","latitude":1.1,"longitude":2.2,"temperature":3.3,"wind_direction":4.4,"wind_speed":5.5,"created_at":"2023-10-04T06:53:38.581587Z"}`,
+			name:   "should wrap provider errors",
+			client: &MockWeatherDataClient{err: errors.New("timeout")},
 		},
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			service := weatherservice.NewService(tc.mockWeatherDataClient, tc.mockWeatherDataRepository)
-			r := httptest.NewRequest("POST", fmt.Sprintf("/%s,%s/update", tc.lat, tc.long), nil)
-			w := httptest.NewRecorder()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := weatherservice.NewService(tt.client, memory.NewRepository())
+
+			_, err := service.UpdateLocation(tt.provider, location)
+			require.Error(t, err)
+			if tt.err != nil {
+				require.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestUpdateLocations(t *testing.T) {
+	service := weatherservice.NewService(&MockWeatherDataClient{}, memory.NewRepository())
 
-			rctx := chi.NewRouteContext()
-			rctx.URLParams.Add("lat", tc.lat)
-			rctx.URLParams.Add("long", tc.long)
+	t.Run("should save the weather data of every unique location under the requested location", func(t *testing.T) {
+		results, err := service.UpdateLocations("", []types.Location{location, location, {Latitude: 3.3, Longitude: 4.4}})
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		require.Equal(t, 1.1, results["1.1,2.2"].WeatherData.Latitude)
+		require.Equal(t, 3.3, results["3.3,4.4"].WeatherData.Latitude)
+	})
 
-			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+	t.Run("should wrap an unknown provider", func(t *testing.T) {
+		_, err := service.UpdateLocations("unknown", []types.Location{location})
+		require.ErrorIs(t, err, weatherservice.ErrUnknownProvider)
+	})
+
+	t.Run("should reject too many locations", func(t *testing.T) {
+		_, err := service.UpdateLocations("", make([]types.Location, weatherservice.MaxUpdateBatchLocations+1))
+		require.ErrorIs(t, err, weatherservice.ErrInvalidInput)
+	})
+}
 
-			service.UpdateWeather(w, r)
+func TestSubmitObservationService(t *testing.T) {
+	temperature, windDirection, windSpeed := 12.5, 270.0, 18.0
 
-			require.Equal(t, tc.expectedStatusCode, w.Result().StatusCode)
-			require.Equal(t, tc.expectedBody, strings.Trim(w.Body.String(), "\n"))
+	t.Run("should save a sensor's reading under its source", func(t *testing.T) {
+		service := weatherservice.NewService(&MockWeatherDataClient{}, memory.NewRepository())
+
+		weatherData, err := service.SubmitObservation(location, types.Observation{
+			Temperature:   &temperature,
+			WindDirection: &windDirection,
+			WindSpeed:     &windSpeed,
+			SensorId:      "roof-1",
 		})
-	}
+		require.NoError(t, err)
+		require.Equal(t, weatherservice.SensorSourcePrefix+"roof-1", weatherData.Source)
+		require.Equal(t, 12.5, weatherData.Temperature)
+	})
+
+	t.Run("should reject an implausible reading", func(t *testing.T) {
+		service := weatherservice.NewService(&MockWeatherDataClient{}, memory.NewRepository())
+		implausible := 500.0
+
+		_, err := service.SubmitObservation(location, types.Observation{
+			Temperature:   &implausible,
+			WindDirection: &windDirection,
+			WindSpeed:     &windSpeed,
+		})
+		require.ErrorIs(t, err, weatherservice.ErrInvalidInput)
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Run("should be unsupported without a subscriber", func(t *testing.T) {
+		service := weatherservice.NewService(&MockWeatherDataClient{}, memory.NewRepository())
+
+		_, _, err := service.Subscribe(nil)
+		require.ErrorIs(t, err, weatherservice.ErrStreamingUnsupported)
+	})
+
+	t.Run("should receive the location's published weather data", func(t *testing.T) {
+		broker := stream.NewWeatherDataBroker()
+		service := weatherservice.NewService(&MockWeatherDataClient{}, memory.NewRepository())
+		service.SetSubscriber(broker)
+
+		published, unsubscribe, err := service.Subscribe(&location)
+		require.NoError(t, err)
+		defer unsubscribe()
+
+		broker.Publish(&types.WeatherData{Id: "other", Latitude: 3.3, Longitude: 4.4})
+		broker.Publish(&types.WeatherData{Id: "subscribed", Latitude: location.Latitude, Longitude: location.Longitude})
+
+		require.Equal(t, "subscribed", (<-published).Id)
+	})
+}
+
+func TestWeatherDataSince(t *testing.T) {
+	repo := newRepository(t)
+	service := weatherservice.NewService(&MockWeatherDataClient{}, repo)
+
+	weatherDataList, err := service.WeatherDataSince(&location, time.Now().Add(-time.Hour), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"openmeteo", "metno", weatherservice.ManualSource}, sources(weatherDataList))
+
+	weatherDataList, err = service.WeatherDataSince(nil, time.Now().Add(time.Hour), "")
+	require.NoError(t, err)
+	require.Empty(t, weatherDataList)
 }
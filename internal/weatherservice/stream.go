@@ -0,0 +1,52 @@
+package weatherservice
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go-sample-rest/internal/types"
+)
+
+// WeatherDataSubscriber publishes newly saved weather data, the returned function unsubscribes
+type WeatherDataSubscriber interface {
+	Subscribe(location *types.Location) (<-chan *types.WeatherData, func())
+}
+
+// ErrStreamingUnsupported is returned by Subscribe when the service has no subscriber
+var ErrStreamingUnsupported = errors.New("streaming weather data is not supported")
+
+// MaxReplayedEvents is the most weather data WeatherDataSince returns, e.g. to a resumed stream
+const MaxReplayedEvents = 1000
+
+// SetSubscriber makes Subscribe subscribe to the weather data published by the subscriber, without a subscriber
+// streaming isn't supported
+func (s *Service) SetSubscriber(subscriber WeatherDataSubscriber) {
+	s.subscriber = subscriber
+}
+
+// Subscribe returns the newly saved weather data of the location, or of every location when it's nil, the returned
+// function unsubscribes. The channel is closed when the subscriber falls behind. Published weather data is shared
+// between subscribers and must not be modified.
+func (s *Service) Subscribe(location *types.Location) (<-chan *types.WeatherData, func(), error) {
+	if s.subscriber == nil {
+		return nil, nil, ErrStreamingUnsupported
+	}
+
+	published, unsubscribe := s.subscriber.Subscribe(location)
+
+	return published, unsubscribe, nil
+}
+
+// WeatherDataSince returns up to MaxReplayedEvents weather data of the location, or of every location when it's nil,
+// saved since the time oldest first. Weather data saved at that time is only returned when its id sorts after afterId,
+// so when all MaxReplayedEvents are returned the rest is read from the last one. Subscribe before calling it, so nothing
+// saved in between is missed.
+func (s *Service) WeatherDataSince(location *types.Location, since time.Time, afterId string) ([]*types.WeatherData, error) {
+	weatherDataList, err := s.weatherDataRepository.GetWeatherDataSince(location, since, afterId, MaxReplayedEvents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get weather data since %s from repository: %w", since.Format(time.RFC3339Nano), err)
+	}
+
+	return weatherDataList, nil
+}
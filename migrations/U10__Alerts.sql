@@ -0,0 +1,2 @@
+DROP TABLE "weather"."alert_deliveries";
+DROP TABLE "weather"."alert_rules";
@@ -0,0 +1,2 @@
+DROP TRIGGER "weather_data_notify" ON "weather"."weather_data";
+DROP FUNCTION "weather"."weather_data_notify"();
@@ -0,0 +1,5 @@
+ALTER TABLE "weather"."weather_data_summary" DROP COLUMN "last_inserted_at";
+
+DROP INDEX "weather"."weather.weather_data_latitude_longitude_inserted_at_idx";
+
+ALTER TABLE "weather"."weather_data" DROP COLUMN "inserted_at";
@@ -0,0 +1,44 @@
+CREATE OR REPLACE FUNCTION "weather"."weather_data_inserted"() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    VALUES (NEW."latitude", NEW."longitude", NEW."id", NEW."temperature", NEW."wind_direction", NEW."wind_speed", NEW."source", NEW."created_at")
+    ON CONFLICT ("latitude", "longitude") DO UPDATE
+    SET
+        "id" = EXCLUDED."id",
+        "temperature" = EXCLUDED."temperature",
+        "wind_direction" = EXCLUDED."wind_direction",
+        "wind_speed" = EXCLUDED."wind_speed",
+        "source" = EXCLUDED."source",
+        "created_at" = EXCLUDED."created_at"
+    WHERE "latest_weather"."created_at" <= EXCLUDED."created_at";
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION "weather"."refresh_latest_weather"(lat float, long float) RETURNS void AS $$
+BEGIN
+    DELETE FROM "weather"."latest_weather"
+    WHERE "latitude" = lat AND "longitude" = long;
+
+    INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    SELECT "latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at"
+    FROM "weather"."weather_data"
+    WHERE "latitude" = lat AND "longitude" = long
+    ORDER BY "created_at" DESC
+    LIMIT 1;
+END
+$$ LANGUAGE plpgsql;
+
+DELETE FROM "weather"."latest_weather";
+
+ALTER TABLE "weather"."latest_weather" DROP CONSTRAINT "latest_weather_pk";
+ALTER TABLE "weather"."latest_weather" DROP COLUMN "observation";
+ALTER TABLE "weather"."latest_weather" ADD CONSTRAINT "latest_weather_pk" PRIMARY KEY ("latitude", "longitude");
+
+INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+SELECT DISTINCT ON ("latitude", "longitude") "latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at"
+FROM "weather"."weather_data"
+ORDER BY "latitude", "longitude", "created_at" DESC;
+
+DROP FUNCTION "weather"."is_observation"(character varying);
@@ -0,0 +1 @@
+DROP INDEX "weather"."weather.weather_data_latitude_longitude_idx";
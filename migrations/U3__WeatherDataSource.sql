@@ -0,0 +1,2 @@
+ALTER TABLE "weather"."weather_data"
+DROP COLUMN "source";
@@ -0,0 +1 @@
+DROP TABLE "weather"."weather_data_summary";
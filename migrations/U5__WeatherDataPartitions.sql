@@ -0,0 +1,25 @@
+ALTER TABLE "weather"."weather_data" RENAME TO "weather_data_partitioned";
+ALTER TABLE "weather"."weather_data_partitioned" RENAME CONSTRAINT "weather_data_pk" TO "weather_data_partitioned_pk";
+ALTER INDEX "weather"."weather.weather_data_latitude_longitude_idx" RENAME TO "weather.weather_data_partitioned_latitude_longitude_idx";
+
+CREATE TABLE "weather"."weather_data" (
+    "id" character varying NOT NULL,
+    "latitude" float NOT NULL,
+    "longitude" float NOT NULL,
+    "temperature" float NOT NULL,
+    "wind_direction" float NOT NULL,
+    "wind_speed" float NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "source" character varying NOT NULL DEFAULT 'openmeteo',
+    CONSTRAINT "weather_data_pk" PRIMARY KEY ("id")
+);
+
+CREATE INDEX "weather.weather_data_latitude_longitude_idx"
+ON "weather"."weather_data"(latitude, longitude);
+
+INSERT INTO "weather"."weather_data" ("id", "latitude", "longitude", "temperature", "wind_direction", "wind_speed", "created_at", "source")
+SELECT "id", "latitude", "longitude", "temperature", "wind_direction", "wind_speed", "created_at", "source"
+FROM "weather"."weather_data_partitioned";
+
+-- Drops every partition along with it
+DROP TABLE "weather"."weather_data_partitioned";
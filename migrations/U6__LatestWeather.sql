@@ -0,0 +1,11 @@
+DROP TRIGGER "weather_data_deleted" ON "weather"."weather_data";
+DROP TRIGGER "weather_data_inserted" ON "weather"."weather_data";
+DROP FUNCTION "weather"."weather_data_deleted"();
+DROP FUNCTION "weather"."weather_data_inserted"();
+DROP FUNCTION "weather"."refresh_latest_weather"(float, float);
+DROP TABLE "weather"."latest_weather";
+
+CREATE INDEX "weather.weather_data_latitude_longitude_idx"
+ON "weather"."weather_data"(latitude, longitude);
+
+DROP INDEX "weather"."weather.weather_data_latitude_longitude_created_at_idx";
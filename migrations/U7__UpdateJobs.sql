@@ -0,0 +1 @@
+DROP TABLE "weather"."update_jobs";
@@ -0,0 +1,49 @@
+-- Alert rules fire when a location's weather data crosses a threshold, last_fired_at enforces the cooldown between firings
+CREATE TABLE "weather"."alert_rules" (
+    "id" character varying NOT NULL,
+    "latitude" float NOT NULL,
+    "longitude" float NOT NULL,
+    "metric" character varying NOT NULL,
+    "comparator" character varying NOT NULL,
+    "threshold" float NOT NULL,
+    "cooldown_seconds" integer NOT NULL DEFAULT 0,
+    "webhook_url" character varying NOT NULL,
+    "secret" character varying NOT NULL,
+    "enabled" boolean NOT NULL DEFAULT true,
+    "last_fired_at" TIMESTAMP WITH TIME ZONE,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT "alert_rules_pk" PRIMARY KEY ("id")
+);
+
+-- Rules are evaluated for the location of every saved weather data
+CREATE INDEX "weather.alert_rules_latitude_longitude_idx"
+ON "weather"."alert_rules"(latitude, longitude)
+WHERE enabled;
+
+-- Webhook deliveries of fired alerts, claimed by workers with SELECT ... FOR UPDATE SKIP LOCKED once next_attempt_at
+-- is due. Claiming pushes next_attempt_at out, so a delivery whose worker is gone is retried.
+CREATE TABLE "weather"."alert_deliveries" (
+    "id" character varying NOT NULL,
+    "rule_id" character varying NOT NULL REFERENCES "weather"."alert_rules"("id") ON DELETE CASCADE,
+    "event" character varying NOT NULL,
+    "payload" jsonb NOT NULL,
+    "status" character varying NOT NULL DEFAULT 'pending',
+    "attempts" integer NOT NULL DEFAULT 0,
+    "last_status_code" integer NOT NULL DEFAULT 0,
+    "last_error" character varying NOT NULL DEFAULT '',
+    "next_attempt_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "delivered_at" TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT "alert_deliveries_pk" PRIMARY KEY ("id")
+);
+
+-- Workers claim pending deliveries that are due
+CREATE INDEX "weather.alert_deliveries_next_attempt_at_idx"
+ON "weather"."alert_deliveries"(next_attempt_at)
+WHERE status = 'pending';
+
+-- A rule's delivery log, newest first
+CREATE INDEX "weather.alert_deliveries_rule_id_created_at_idx"
+ON "weather"."alert_deliveries"(rule_id, created_at DESC);
@@ -0,0 +1,24 @@
+-- Notifies listeners of every replica of newly saved weather data, it's delivered once the transaction commits.
+-- Backfilled and imported weather data from more than an hour ago isn't new, so it isn't notified.
+CREATE FUNCTION "weather"."weather_data_notify"() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('weather_data_inserted', json_build_object(
+        'id', NEW."id",
+        'latitude', NEW."latitude",
+        'longitude', NEW."longitude",
+        'temperature', NEW."temperature",
+        'wind_direction', NEW."wind_direction",
+        'wind_speed', NEW."wind_speed",
+        'source', NEW."source",
+        'created_at', NEW."created_at"
+    )::text);
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "weather_data_notify"
+AFTER INSERT ON "weather"."weather_data"
+FOR EACH ROW
+WHEN (NEW."created_at" >= NOW() - INTERVAL '1 hour')
+EXECUTE FUNCTION "weather"."weather_data_notify"();
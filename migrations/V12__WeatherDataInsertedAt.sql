@@ -0,0 +1,10 @@
+-- inserted_at is when weather data was saved, so retention can find weather data saved after its bucket was summarised,
+-- e.g. by backfills and imports. Weather data saved before it existed is -infinity, it was summarised by created_at.
+ALTER TABLE "weather"."weather_data" ADD COLUMN "inserted_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '-infinity';
+ALTER TABLE "weather"."weather_data" ALTER COLUMN "inserted_at" SET DEFAULT NOW();
+
+CREATE INDEX "weather.weather_data_latitude_longitude_inserted_at_idx"
+ON "weather"."weather_data"(latitude, longitude, inserted_at);
+
+-- The inserted_at of the newest weather data a summary was made from
+ALTER TABLE "weather"."weather_data_summary" ADD COLUMN "last_inserted_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT '-infinity';
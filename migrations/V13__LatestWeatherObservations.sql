@@ -0,0 +1,49 @@
+-- Observations are kept apart from the providers' weather data, so a location has a latest weather data of each kind
+-- and observations don't replace the providers' latest weather data
+CREATE FUNCTION "weather"."is_observation"(source character varying) RETURNS boolean AS $$
+    SELECT source = 'manual' OR source LIKE 'sensor:%'
+$$ LANGUAGE sql IMMUTABLE;
+
+ALTER TABLE "weather"."latest_weather" ADD COLUMN "observation" boolean NOT NULL DEFAULT false;
+ALTER TABLE "weather"."latest_weather" DROP CONSTRAINT "latest_weather_pk";
+ALTER TABLE "weather"."latest_weather" ADD CONSTRAINT "latest_weather_pk" PRIMARY KEY ("latitude", "longitude", "observation");
+
+CREATE OR REPLACE FUNCTION "weather"."refresh_latest_weather"(lat float, long float) RETURNS void AS $$
+BEGIN
+    DELETE FROM "weather"."latest_weather"
+    WHERE "latitude" = lat AND "longitude" = long;
+
+    INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "observation", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    SELECT DISTINCT ON ("weather"."is_observation"("source"))
+        "latitude", "longitude", "weather"."is_observation"("source"), "id", "temperature", "wind_direction", "wind_speed", "source", "created_at"
+    FROM "weather"."weather_data"
+    WHERE "latitude" = lat AND "longitude" = long
+    ORDER BY "weather"."is_observation"("source"), "created_at" DESC;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION "weather"."weather_data_inserted"() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "observation", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    VALUES (NEW."latitude", NEW."longitude", "weather"."is_observation"(NEW."source"), NEW."id", NEW."temperature", NEW."wind_direction", NEW."wind_speed", NEW."source", NEW."created_at")
+    ON CONFLICT ("latitude", "longitude", "observation") DO UPDATE
+    SET
+        "id" = EXCLUDED."id",
+        "temperature" = EXCLUDED."temperature",
+        "wind_direction" = EXCLUDED."wind_direction",
+        "wind_speed" = EXCLUDED."wind_speed",
+        "source" = EXCLUDED."source",
+        "created_at" = EXCLUDED."created_at"
+    WHERE "latest_weather"."created_at" <= EXCLUDED."created_at";
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+DELETE FROM "weather"."latest_weather";
+
+INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "observation", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+SELECT DISTINCT ON ("latitude", "longitude", "weather"."is_observation"("source"))
+    "latitude", "longitude", "weather"."is_observation"("source"), "id", "temperature", "wind_direction", "wind_speed", "source", "created_at"
+FROM "weather"."weather_data"
+ORDER BY "latitude", "longitude", "weather"."is_observation"("source"), "created_at" DESC;
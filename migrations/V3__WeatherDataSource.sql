@@ -0,0 +1,2 @@
+ALTER TABLE "weather"."weather_data"
+ADD COLUMN "source" character varying NOT NULL DEFAULT 'openmeteo';
@@ -0,0 +1,15 @@
+CREATE TABLE "weather"."weather_data_summary" (
+    "latitude" float NOT NULL,
+    "longitude" float NOT NULL,
+    "resolution" character varying NOT NULL,
+    "bucket_start" TIMESTAMP WITH TIME ZONE NOT NULL,
+    "sample_count" integer NOT NULL,
+    "temperature_avg" float NOT NULL,
+    "temperature_min" float NOT NULL,
+    "temperature_max" float NOT NULL,
+    "wind_speed_avg" float NOT NULL,
+    "wind_speed_max" float NOT NULL,
+    "wind_direction_avg" float NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT "weather_data_summary_pk" PRIMARY KEY ("latitude", "longitude", "resolution", "bucket_start")
+);
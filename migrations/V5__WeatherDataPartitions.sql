@@ -0,0 +1,51 @@
+-- Move the existing table out of the way, its constraint and index names are reused by the partitioned table
+ALTER TABLE "weather"."weather_data" RENAME TO "weather_data_unpartitioned";
+ALTER TABLE "weather"."weather_data_unpartitioned" RENAME CONSTRAINT "weather_data_pk" TO "weather_data_unpartitioned_pk";
+ALTER INDEX "weather"."weather.weather_data_latitude_longitude_idx" RENAME TO "weather.weather_data_unpartitioned_latitude_longitude_idx";
+
+-- The partition key has to be part of the primary key
+CREATE TABLE "weather"."weather_data" (
+    "id" character varying NOT NULL,
+    "latitude" float NOT NULL,
+    "longitude" float NOT NULL,
+    "temperature" float NOT NULL,
+    "wind_direction" float NOT NULL,
+    "wind_speed" float NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "source" character varying NOT NULL DEFAULT 'openmeteo',
+    CONSTRAINT "weather_data_pk" PRIMARY KEY ("id", "created_at")
+) PARTITION BY RANGE ("created_at");
+
+CREATE INDEX "weather.weather_data_latitude_longitude_idx"
+ON "weather"."weather_data"(latitude, longitude);
+
+-- Catches weather data outside of the monthly partitions, the service creates monthly partitions ahead of time so it stays empty
+CREATE TABLE "weather"."weather_data_default" PARTITION OF "weather"."weather_data" DEFAULT;
+
+-- Monthly partitions in UTC from the oldest weather data up to next month
+DO $$
+DECLARE
+    month_start TIMESTAMP WITH TIME ZONE;
+BEGIN
+    SELECT date_trunc('month', COALESCE(MIN("created_at"), NOW()) AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+    INTO month_start
+    FROM "weather"."weather_data_unpartitioned";
+
+    WHILE month_start <= NOW() + INTERVAL '1 month' LOOP
+        EXECUTE format(
+            'CREATE TABLE "weather".%I PARTITION OF "weather"."weather_data" FOR VALUES FROM (%L) TO (%L)',
+            'weather_data_' || to_char(month_start AT TIME ZONE 'UTC', 'YYYY_MM'),
+            month_start,
+            month_start + INTERVAL '1 month'
+        );
+
+        month_start := month_start + INTERVAL '1 month';
+    END LOOP;
+END
+$$;
+
+INSERT INTO "weather"."weather_data" ("id", "latitude", "longitude", "temperature", "wind_direction", "wind_speed", "created_at", "source")
+SELECT "id", "latitude", "longitude", "temperature", "wind_direction", "wind_speed", "created_at", "source"
+FROM "weather"."weather_data_unpartitioned";
+
+DROP TABLE "weather"."weather_data_unpartitioned";
@@ -0,0 +1,82 @@
+-- Latest-per-location lookups read the index in order instead of sorting the location's weather data,
+-- it replaces the (latitude, longitude) index as that's a prefix of it
+CREATE INDEX "weather.weather_data_latitude_longitude_created_at_idx"
+ON "weather"."weather_data"(latitude, longitude, created_at DESC)
+INCLUDE (id, temperature, wind_direction, wind_speed, source);
+
+DROP INDEX "weather"."weather.weather_data_latitude_longitude_idx";
+
+-- The latest weather data of every location, maintained by the triggers below
+CREATE TABLE "weather"."latest_weather" (
+    "latitude" float NOT NULL,
+    "longitude" float NOT NULL,
+    "id" character varying NOT NULL,
+    "temperature" float NOT NULL,
+    "wind_direction" float NOT NULL,
+    "wind_speed" float NOT NULL,
+    "source" character varying NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT "latest_weather_pk" PRIMARY KEY ("latitude", "longitude")
+);
+
+-- Replaces a location's latest weather data with its most recent weather data, removing it when there's none left
+CREATE FUNCTION "weather"."refresh_latest_weather"(lat float, long float) RETURNS void AS $$
+BEGIN
+    DELETE FROM "weather"."latest_weather"
+    WHERE "latitude" = lat AND "longitude" = long;
+
+    INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    SELECT "latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at"
+    FROM "weather"."weather_data"
+    WHERE "latitude" = lat AND "longitude" = long
+    ORDER BY "created_at" DESC
+    LIMIT 1;
+END
+$$ LANGUAGE plpgsql;
+
+-- Weather data can be saved out of order, so only newer weather data replaces the latest
+CREATE FUNCTION "weather"."weather_data_inserted"() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+    VALUES (NEW."latitude", NEW."longitude", NEW."id", NEW."temperature", NEW."wind_direction", NEW."wind_speed", NEW."source", NEW."created_at")
+    ON CONFLICT ("latitude", "longitude") DO UPDATE
+    SET
+        "id" = EXCLUDED."id",
+        "temperature" = EXCLUDED."temperature",
+        "wind_direction" = EXCLUDED."wind_direction",
+        "wind_speed" = EXCLUDED."wind_speed",
+        "source" = EXCLUDED."source",
+        "created_at" = EXCLUDED."created_at"
+    WHERE "latest_weather"."created_at" <= EXCLUDED."created_at";
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION "weather"."weather_data_deleted"() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM "weather"."latest_weather"
+        WHERE "latitude" = OLD."latitude" AND "longitude" = OLD."longitude" AND "id" = OLD."id"
+    ) THEN
+        PERFORM "weather"."refresh_latest_weather"(OLD."latitude", OLD."longitude");
+    END IF;
+
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- Dropping a partition doesn't fire these, the repository refreshes the latest weather data when it drops one
+CREATE TRIGGER "weather_data_inserted"
+AFTER INSERT ON "weather"."weather_data"
+FOR EACH ROW EXECUTE FUNCTION "weather"."weather_data_inserted"();
+
+CREATE TRIGGER "weather_data_deleted"
+AFTER DELETE ON "weather"."weather_data"
+FOR EACH ROW EXECUTE FUNCTION "weather"."weather_data_deleted"();
+
+INSERT INTO "weather"."latest_weather" ("latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at")
+SELECT DISTINCT ON ("latitude", "longitude") "latitude", "longitude", "id", "temperature", "wind_direction", "wind_speed", "source", "created_at"
+FROM "weather"."weather_data"
+ORDER BY "latitude", "longitude", "created_at" DESC;
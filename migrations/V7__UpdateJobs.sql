@@ -0,0 +1,24 @@
+-- Update jobs are claimed by workers with SELECT ... FOR UPDATE SKIP LOCKED, a running job whose updated_at is stale
+-- is claimed again with its attempts incremented, so the worker that lost it stops writing to it
+CREATE TABLE "weather"."update_jobs" (
+    "id" character varying NOT NULL,
+    "status" character varying NOT NULL DEFAULT 'queued',
+    "provider" character varying NOT NULL DEFAULT '',
+    "locations" jsonb NOT NULL,
+    "results" jsonb NOT NULL DEFAULT '{}',
+    "total" integer NOT NULL,
+    "completed" integer NOT NULL DEFAULT 0,
+    "failed" integer NOT NULL DEFAULT 0,
+    "error" character varying NOT NULL DEFAULT '',
+    "attempts" integer NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "started_at" TIMESTAMP WITH TIME ZONE,
+    "finished_at" TIMESTAMP WITH TIME ZONE,
+    CONSTRAINT "update_jobs_pk" PRIMARY KEY ("id")
+);
+
+-- Workers claim the oldest unfinished job
+CREATE INDEX "weather.update_jobs_status_created_at_idx"
+ON "weather"."update_jobs"(status, created_at)
+WHERE status IN ('queued', 'running');
@@ -0,0 +1,14 @@
+-- Responses of requests made with an Idempotency-Key header, replayed for repeated requests until they expire.
+-- The response columns are null while the first request is in flight.
+CREATE TABLE "weather"."idempotency_keys" (
+    "key" character varying NOT NULL,
+    "fingerprint" character varying NOT NULL,
+    "status_code" integer,
+    "content_type" character varying,
+    "body" bytea,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "expires_at" TIMESTAMP WITH TIME ZONE NOT NULL,
+    CONSTRAINT "idempotency_keys_pk" PRIMARY KEY ("key")
+);
+
+CREATE INDEX "weather.idempotency_keys_expires_at_idx" ON "weather"."idempotency_keys"(expires_at);
@@ -0,0 +1,16 @@
+-- Progress of historical weather data imports, a backfill of the same location and days carries on from next_date
+CREATE TABLE "weather"."backfills" (
+    "id" character varying NOT NULL,
+    "latitude" float NOT NULL,
+    "longitude" float NOT NULL,
+    "from_date" date NOT NULL,
+    "to_date" date NOT NULL,
+    "next_date" date NOT NULL,
+    "status" character varying NOT NULL DEFAULT 'running',
+    "imported" integer NOT NULL DEFAULT 0,
+    "skipped" integer NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    "updated_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT "backfills_pk" PRIMARY KEY ("id"),
+    CONSTRAINT "backfills_location_dates_key" UNIQUE ("latitude", "longitude", "from_date", "to_date")
+);
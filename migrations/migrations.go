@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// FS holds the Postgres migrations, embedded so the service can migrate the database itself
+//
+//go:embed *.sql
+var FS embed.FS